@@ -44,6 +44,10 @@ export default defineNuxtConfig({
 
     githubWebhookSecret: "",
 
+    // Wildcard domain for preview deployments, e.g. "preview.zeitwork.app" -> <branch>-<project>.preview.zeitwork.app
+    // (*.<previewDomain> must resolve to the edge proxy). Preview deployments are disabled when empty.
+    previewDomain: "",
+
     encryptionKey: "",
   },
 
@@ -0,0 +1,33 @@
+import { apiTokens } from "@zeitwork/database/schema";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.uuid(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event, { apiToken: false });
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  // Revoke the token, it stops working at once
+  const [revoked] = await useDrizzle()
+    .update(apiTokens)
+    .set({ deletedAt: new Date(), updatedAt: new Date() })
+    .where(
+      and(
+        eq(apiTokens.id, id),
+        eq(apiTokens.organisationId, secure.organisationId),
+        isNull(apiTokens.deletedAt),
+      ),
+    )
+    .returning({ id: apiTokens.id });
+
+  if (!revoked) {
+    throw createError({ statusCode: 404, message: "API token not found" });
+  }
+
+  return { success: true };
+});
@@ -0,0 +1,19 @@
+import { apiTokens } from "@zeitwork/database/schema";
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  // Get all API tokens of the organisation (without the tokens)
+  return await useDrizzle()
+    .select({
+      id: apiTokens.id,
+      name: apiTokens.name,
+      lastUsedAt: apiTokens.lastUsedAt,
+      createdAt: apiTokens.createdAt,
+    })
+    .from(apiTokens)
+    .where(and(eq(apiTokens.organisationId, secure.organisationId), isNull(apiTokens.deletedAt)))
+    .orderBy(apiTokens.name);
+});
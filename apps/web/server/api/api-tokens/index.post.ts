@@ -0,0 +1,36 @@
+import { randomBytes } from "node:crypto";
+import { apiTokens } from "@zeitwork/database/schema";
+import { z } from "zod";
+import { hashApiToken } from "~~/server/utils/auth";
+
+const bodySchema = z.object({
+  name: z.string().min(1, "Name is required").max(255, "Name must be 255 characters or less"),
+});
+
+// Only a signed-in user manages API tokens, not an API token
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event, { apiToken: false });
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  // The token is only returned here, the database only has its hash
+  const token = `zw_${randomBytes(32).toString("base64url")}`;
+
+  const [apiToken] = await useDrizzle()
+    .insert(apiTokens)
+    .values({
+      name: body.name,
+      tokenHash: hashApiToken(token),
+      userId: secure.userId,
+      organisationId: secure.organisationId,
+    })
+    .returning({
+      id: apiTokens.id,
+      name: apiTokens.name,
+      createdAt: apiTokens.createdAt,
+    });
+
+  return { ...apiToken, token };
+});
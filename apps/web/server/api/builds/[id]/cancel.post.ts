@@ -0,0 +1,44 @@
+import { buildLogs, builds } from "@zeitwork/database/schema";
+import { eq, and, inArray } from "@zeitwork/database/utils/drizzle";
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const buildId = getRouterParam(event, "id");
+  if (!buildId) {
+    throw createError({ statusCode: 400, message: "Build ID is required" });
+  }
+
+  const [build] = await useDrizzle()
+    .select()
+    .from(builds)
+    .where(and(eq(builds.id, buildId), eq(builds.organisationId, secure.organisationId)));
+  if (!build) {
+    throw createError({ statusCode: 404, message: "Build not found" });
+  }
+
+  // The reconciler stops a running build and deletes the build VM,
+  // deployments waiting for the build fail with it
+  const [cancelledBuild] = await useDrizzle()
+    .update(builds)
+    .set({
+      status: "cancelled",
+      cancelledAt: new Date(),
+    })
+    .where(and(eq(builds.id, buildId), inArray(builds.status, ["pending", "building"])))
+    .returning();
+  if (!cancelledBuild) {
+    throw createError({ statusCode: 400, message: `Build is already in a terminal state: ${build.status}` });
+  }
+
+  await useDrizzle().insert(buildLogs).values({
+    buildId: cancelledBuild.id,
+    message: "Build cancelled",
+    level: "info",
+    organisationId: cancelledBuild.organisationId,
+  });
+
+  return cancelledBuild;
+});
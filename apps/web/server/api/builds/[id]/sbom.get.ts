@@ -0,0 +1,29 @@
+import { builds, imageSboms } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const buildId = getRouterParam(event, "id");
+  if (!buildId) {
+    throw createError({ statusCode: 400, message: "Build ID is required" });
+  }
+
+  const [build] = await useDrizzle()
+    .select()
+    .from(builds)
+    .where(and(eq(builds.id, buildId), eq(builds.organisationId, secure.organisationId)));
+  if (!build?.imageId) {
+    throw createError({ statusCode: 404, message: "Build not found" });
+  }
+
+  // SBOMs belong to images, which are shared by builds of the same commit
+  const [sbom] = await useDrizzle().select().from(imageSboms).where(eq(imageSboms.imageId, build.imageId));
+  if (!sbom) {
+    throw createError({ statusCode: 404, message: "SBOM not found" });
+  }
+
+  return { format: sbom.format, document: sbom.document };
+});
@@ -0,0 +1,28 @@
+import { buildSteps, builds } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const buildId = getRouterParam(event, "id");
+  if (!buildId) {
+    throw createError({ statusCode: 400, message: "Build ID is required" });
+  }
+
+  const [build] = await useDrizzle()
+    .select()
+    .from(builds)
+    .where(and(eq(builds.id, buildId), eq(builds.organisationId, secure.organisationId)));
+  if (!build) {
+    throw createError({ statusCode: 404, message: "Build not found" });
+  }
+
+  // One row per BuildKit step, with its timing and whether it was served from cache
+  return await useDrizzle()
+    .select()
+    .from(buildSteps)
+    .where(and(eq(buildSteps.buildId, build.id), eq(buildSteps.organisationId, secure.organisationId)))
+    .orderBy(asc(buildSteps.number));
+});
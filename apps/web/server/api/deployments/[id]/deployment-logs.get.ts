@@ -0,0 +1,52 @@
+import { deploymentLogs, deployments } from "@zeitwork/database/schema";
+import { eq, and, gt } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const querySchema = z.object({
+  cursor: z.uuid().optional(),
+  limit: z.coerce.number().int().min(1).max(1000).default(200),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const deploymentId = getRouterParam(event, "id");
+  if (!deploymentId) {
+    throw createError({ statusCode: 400, message: "Deployment ID is required" });
+  }
+
+  const { cursor, limit } = await getValidatedQuery(event, querySchema.parse);
+
+  // Get the deployment to verify access
+  const [deployment] = await useDrizzle()
+    .select()
+    .from(deployments)
+    .where(
+      and(eq(deployments.id, deploymentId), eq(deployments.organisationId, secure.organisationId)),
+    )
+    .limit(1);
+
+  if (!deployment) {
+    throw createError({ statusCode: 404, message: "Deployment not found" });
+  }
+
+  // Build conditions with optional cursor
+  const conditions = [eq(deploymentLogs.deploymentId, deployment.id)];
+  if (cursor) {
+    conditions.push(gt(deploymentLogs.id, cursor));
+  }
+
+  // Fetch logs of the deployment itself, e.g. release command output
+  const logs = await useDrizzle()
+    .select()
+    .from(deploymentLogs)
+    .where(and(...conditions))
+    .orderBy(deploymentLogs.id)
+    .limit(limit);
+
+  const nextCursor = logs.length === limit ? (logs.at(-1)?.id ?? null) : null;
+
+  return { logs, nextCursor };
+});
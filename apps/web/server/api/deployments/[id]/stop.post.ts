@@ -24,16 +24,17 @@ export default defineEventHandler(async (event) => {
   }
 
   const currentStatus = deploymentStatus(deployment);
-  if (currentStatus === "stopped" || currentStatus === "failed") {
+  if (currentStatus === "stopping" || currentStatus === "stopped" || currentStatus === "failed") {
     throw createError({ statusCode: 400, message: `Deployment is already in a terminal state: ${currentStatus}` });
   }
 
-  // Update the deployment to be stopped
+  // Take the deployment out of routing, the reconciler marks it stopped once its
+  // in-flight requests have finished
   const [updatedDeployment] = await useDrizzle()
     .update(deployments)
     .set({
-      status: "stopped",
-      stoppedAt: new Date(),
+      status: "stopping",
+      stoppingAt: new Date(),
     })
     .where(
       and(eq(deployments.id, deploymentId), eq(deployments.organisationId, secure.organisationId)),
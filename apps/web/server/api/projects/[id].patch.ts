@@ -1,4 +1,4 @@
-import { projects } from "@zeitwork/database/schema";
+import { organisations, projects } from "@zeitwork/database/schema";
 import { eq, and } from "@zeitwork/database/utils/drizzle";
 import { z } from "zod";
 
@@ -21,6 +21,38 @@ const bodySchema = z.object({
       message: "Dockerfile path must be a relative path without '..' sequences",
     })
     .optional(),
+  rolloutSteps: z
+    .array(z.number().int().min(1).max(100))
+    .max(10)
+    .refine((steps) => steps.every((step, i) => i === 0 || step > steps[i - 1]!), {
+      message: "Rollout steps must be strictly increasing",
+    })
+    .refine((steps) => steps.length === 0 || steps[steps.length - 1] === 100, {
+      message: "The last rollout step must be 100",
+    })
+    .optional(),
+  previewDeployments: z.boolean().optional(),
+  releaseCommand: z.string().trim().max(1024).optional(),
+  cancelSupersededBuilds: z.boolean().optional(),
+  // capped by the organisation's build limits below
+  buildTimeout: z.number().int().min(60).optional(), // seconds
+  buildVcpus: z.number().int().min(1).optional(),
+  buildMemory: z.number().int().min(1024).optional(), // MB
+  buildMode: z.enum(["dockerfile", "buildpacks"]).optional(),
+  // empty = cluster default builder
+  buildpackBuilder: z
+    .string()
+    .trim()
+    .max(255)
+    .regex(/^(?:[a-z0-9][a-z0-9._\-/:@]*)?$/, {
+      message: "Buildpack builder must be an image reference, e.g. paketobuildpacks/builder-jammy-base",
+    })
+    .optional(),
+  vulnerabilityScan: z.boolean().optional(),
+  // null = report vulnerabilities without failing builds
+  vulnerabilityFailSeverity: z.enum(["low", "medium", "high", "critical"]).nullable().optional(),
+  // boot images without the cluster's signature
+  allowExternalImages: z.boolean().optional(),
 });
 
 export default defineEventHandler(async (event) => {
@@ -42,6 +74,40 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
+  // Enforce the organisation's build limits
+  if (body.buildTimeout !== undefined || body.buildVcpus !== undefined || body.buildMemory !== undefined) {
+    const [organisation] = await useDrizzle()
+      .select({
+        buildTimeoutLimit: organisations.buildTimeoutLimit,
+        buildVcpusLimit: organisations.buildVcpusLimit,
+        buildMemoryLimit: organisations.buildMemoryLimit,
+      })
+      .from(organisations)
+      .where(eq(organisations.id, secure.organisationId));
+    if (!organisation) {
+      throw createError({ statusCode: 404, message: "Organisation not found" });
+    }
+
+    if (body.buildTimeout !== undefined && body.buildTimeout > organisation.buildTimeoutLimit) {
+      throw createError({
+        statusCode: 403,
+        message: `Build timeout limit exceeded (${organisation.buildTimeoutLimit} seconds maximum)`,
+      });
+    }
+    if (body.buildVcpus !== undefined && body.buildVcpus > organisation.buildVcpusLimit) {
+      throw createError({
+        statusCode: 403,
+        message: `Build vCPU limit exceeded (${organisation.buildVcpusLimit} vCPUs maximum)`,
+      });
+    }
+    if (body.buildMemory !== undefined && body.buildMemory > organisation.buildMemoryLimit) {
+      throw createError({
+        statusCode: 403,
+        message: `Build memory limit exceeded (${organisation.buildMemoryLimit} MB maximum)`,
+      });
+    }
+  }
+
   // Build update object with only provided fields
   const updateData: Partial<typeof projects.$inferInsert> = {};
   if (body.rootDirectory !== undefined) {
@@ -50,6 +116,42 @@ export default defineEventHandler(async (event) => {
   if (body.dockerfilePath !== undefined) {
     updateData.dockerfilePath = body.dockerfilePath;
   }
+  if (body.rolloutSteps !== undefined) {
+    updateData.rolloutSteps = body.rolloutSteps;
+  }
+  if (body.previewDeployments !== undefined) {
+    updateData.previewDeployments = body.previewDeployments;
+  }
+  if (body.releaseCommand !== undefined) {
+    updateData.releaseCommand = body.releaseCommand;
+  }
+  if (body.cancelSupersededBuilds !== undefined) {
+    updateData.cancelSupersededBuilds = body.cancelSupersededBuilds;
+  }
+  if (body.buildTimeout !== undefined) {
+    updateData.buildTimeout = body.buildTimeout;
+  }
+  if (body.buildVcpus !== undefined) {
+    updateData.buildVcpus = body.buildVcpus;
+  }
+  if (body.buildMemory !== undefined) {
+    updateData.buildMemory = body.buildMemory;
+  }
+  if (body.buildMode !== undefined) {
+    updateData.buildMode = body.buildMode;
+  }
+  if (body.buildpackBuilder !== undefined) {
+    updateData.buildpackBuilder = body.buildpackBuilder;
+  }
+  if (body.vulnerabilityScan !== undefined) {
+    updateData.vulnerabilityScan = body.vulnerabilityScan;
+  }
+  if (body.vulnerabilityFailSeverity !== undefined) {
+    updateData.vulnerabilityFailSeverity = body.vulnerabilityFailSeverity;
+  }
+  if (body.allowExternalImages !== undefined) {
+    updateData.allowExternalImages = body.allowExternalImages;
+  }
 
   // Only update if there are changes
   if (Object.keys(updateData).length === 0) {
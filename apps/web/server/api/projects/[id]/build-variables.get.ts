@@ -0,0 +1,43 @@
+import { buildVariables, projects } from "@zeitwork/database/schema";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id: projectSlug } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  // Find the project by slug
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, projectSlug), eq(projects.organisationId, secure.organisationId)))
+    .limit(1);
+
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  // Get all build variables of this project (without decrypting values)
+  return await useDrizzle()
+    .select({
+      id: buildVariables.id,
+      name: buildVariables.name,
+      secret: buildVariables.secret,
+      createdAt: buildVariables.createdAt,
+      updatedAt: buildVariables.updatedAt,
+    })
+    .from(buildVariables)
+    .where(
+      and(
+        eq(buildVariables.projectId, project.id),
+        eq(buildVariables.organisationId, secure.organisationId),
+      ),
+    )
+    .orderBy(buildVariables.name);
+});
@@ -0,0 +1,68 @@
+import { buildVariables, projects } from "@zeitwork/database/schema";
+import { z } from "zod";
+import { encrypt } from "~~/server/utils/crypto";
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+const bodySchema = z.object({
+  name: z
+    .string()
+    .min(1, "Name is required")
+    .max(255, "Name must be 255 characters or less")
+    .regex(/^[A-Z_][A-Z0-9_]*$/i, "Name must be a valid build argument name"),
+  value: z.string(),
+  // secrets are mounted with `RUN --mount=type=secret,id=NAME` instead of passed as build args
+  secret: z.boolean().default(false),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id: projectSlug } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  // Find the project by slug
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, projectSlug), eq(projects.organisationId, secure.organisationId)))
+    .limit(1);
+
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  // Check if a build variable with same name already exists in the project
+  const [existing] = await useDrizzle()
+    .select()
+    .from(buildVariables)
+    .where(and(eq(buildVariables.name, body.name), eq(buildVariables.projectId, project.id)))
+    .limit(1);
+
+  if (existing) {
+    throw createError({ statusCode: 409, message: "Build variable with this name already exists" });
+  }
+
+  const [buildVariable] = await useDrizzle()
+    .insert(buildVariables)
+    .values({
+      name: body.name,
+      value: encrypt(body.value),
+      secret: body.secret,
+      projectId: project.id,
+      organisationId: secure.organisationId,
+    })
+    .returning({
+      id: buildVariables.id,
+      name: buildVariables.name,
+      secret: buildVariables.secret,
+      createdAt: buildVariables.createdAt,
+      updatedAt: buildVariables.updatedAt,
+    });
+
+  return buildVariable;
+});
@@ -0,0 +1,47 @@
+import { buildVariables, projects } from "@zeitwork/database/schema";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  variableId: z.uuid(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id: projectSlug, variableId } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  // Find the project by slug
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, projectSlug), eq(projects.organisationId, secure.organisationId)))
+    .limit(1);
+
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  // Check if the build variable exists
+  const [existing] = await useDrizzle()
+    .select()
+    .from(buildVariables)
+    .where(
+      and(
+        eq(buildVariables.id, variableId),
+        eq(buildVariables.projectId, project.id),
+        eq(buildVariables.organisationId, secure.organisationId),
+      ),
+    )
+    .limit(1);
+
+  if (!existing) {
+    throw createError({ statusCode: 404, message: "Build variable not found" });
+  }
+
+  await useDrizzle().delete(buildVariables).where(eq(buildVariables.id, variableId));
+
+  return { success: true };
+});
@@ -0,0 +1,104 @@
+import { buildVariables, projects } from "@zeitwork/database/schema";
+import { z } from "zod";
+import { encrypt } from "~~/server/utils/crypto";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  variableId: z.uuid(),
+});
+
+const bodySchema = z.object({
+  name: z
+    .string()
+    .min(1, "Name is required")
+    .max(255, "Name must be 255 characters or less")
+    .regex(/^[A-Z_][A-Z0-9_]*$/i, "Name must be a valid build argument name")
+    .optional(),
+  value: z.string().optional(),
+  secret: z.boolean().optional(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id: projectSlug, variableId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  if (!body.name && body.value === undefined && body.secret === undefined) {
+    throw createError({ statusCode: 400, message: "At least one of name, value or secret must be provided" });
+  }
+
+  // Find the project by slug
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, projectSlug), eq(projects.organisationId, secure.organisationId)))
+    .limit(1);
+
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  // Get the existing build variable
+  const [existing] = await useDrizzle()
+    .select()
+    .from(buildVariables)
+    .where(
+      and(
+        eq(buildVariables.id, variableId),
+        eq(buildVariables.projectId, project.id),
+        eq(buildVariables.organisationId, secure.organisationId),
+      ),
+    )
+    .limit(1);
+
+  if (!existing) {
+    throw createError({ statusCode: 404, message: "Build variable not found" });
+  }
+
+  // Check for name conflict if name is being changed
+  if (body.name && body.name !== existing.name) {
+    const [conflict] = await useDrizzle()
+      .select()
+      .from(buildVariables)
+      .where(and(eq(buildVariables.name, body.name), eq(buildVariables.projectId, project.id)))
+      .limit(1);
+
+    if (conflict) {
+      throw createError({ statusCode: 409, message: "Build variable with this name already exists" });
+    }
+  }
+
+  // Build update object
+  const updateData: { name?: string; value?: string; secret?: boolean; updatedAt: Date } = {
+    updatedAt: new Date(),
+  };
+
+  if (body.name) {
+    updateData.name = body.name;
+  }
+
+  if (body.value !== undefined) {
+    updateData.value = encrypt(body.value);
+  }
+
+  if (body.secret !== undefined) {
+    updateData.secret = body.secret;
+  }
+
+  const [updated] = await useDrizzle()
+    .update(buildVariables)
+    .set(updateData)
+    .where(eq(buildVariables.id, variableId))
+    .returning({
+      id: buildVariables.id,
+      name: buildVariables.name,
+      secret: buildVariables.secret,
+      createdAt: buildVariables.createdAt,
+      updatedAt: buildVariables.updatedAt,
+    });
+
+  return updated;
+});
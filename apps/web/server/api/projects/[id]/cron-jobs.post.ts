@@ -0,0 +1,56 @@
+import { cronJobs, projects } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+import { useEnvironmentModel } from "~~/server/models/environment";
+import { cronScheduleSchema } from "~~/server/models/cron-job";
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+const bodySchema = z.object({
+  name: z.string().min(1).max(255),
+  schedule: cronScheduleSchema,
+  command: z.string().trim().min(1).max(1024),
+  timeout: z.number().int().min(1).max(86400).default(3600), // seconds
+  environment: z.string().optional(), // environment slug, defaults to production
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const environment = await useEnvironmentModel().findBySlug(project.id, body.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  // The reconciler computes the first run from the schedule
+  const [cronJob] = await useDrizzle()
+    .insert(cronJobs)
+    .values({
+      name: body.name,
+      schedule: body.schedule,
+      command: body.command,
+      timeout: body.timeout,
+      projectId: project.id,
+      environmentId: environment.id,
+      organisationId: secure.organisationId,
+    })
+    .returning();
+
+  return cronJob;
+});
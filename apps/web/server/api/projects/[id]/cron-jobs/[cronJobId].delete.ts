@@ -0,0 +1,42 @@
+import { cronJobs, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  cronJobId: z.uuid(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, cronJobId } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [cronJob] = await useDrizzle()
+    .update(cronJobs)
+    .set({ deletedAt: new Date(), updatedAt: new Date() })
+    .where(
+      and(
+        eq(cronJobs.id, cronJobId),
+        eq(cronJobs.projectId, project.id),
+        isNull(cronJobs.deletedAt),
+      ),
+    )
+    .returning();
+  if (!cronJob) {
+    throw createError({ statusCode: 404, message: "Cron job not found" });
+  }
+
+  return { success: true };
+});
@@ -0,0 +1,56 @@
+import { cronJobs, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+import { cronScheduleSchema } from "~~/server/models/cron-job";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  cronJobId: z.uuid(),
+});
+
+const bodySchema = z.object({
+  name: z.string().min(1).max(255).optional(),
+  schedule: cronScheduleSchema.optional(),
+  command: z.string().trim().min(1).max(1024).optional(),
+  timeout: z.number().int().min(1).max(86400).optional(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, cronJobId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [cronJob] = await useDrizzle()
+    .update(cronJobs)
+    .set({
+      ...body,
+      // A new schedule is picked up by the reconciler when the next run is unset
+      ...(body.schedule !== undefined ? { nextRunAt: null } : {}),
+      updatedAt: new Date(),
+    })
+    .where(
+      and(
+        eq(cronJobs.id, cronJobId),
+        eq(cronJobs.projectId, project.id),
+        isNull(cronJobs.deletedAt),
+      ),
+    )
+    .returning();
+  if (!cronJob) {
+    throw createError({ statusCode: 404, message: "Cron job not found" });
+  }
+
+  return cronJob;
+});
@@ -0,0 +1,47 @@
+import { cronJobRuns, cronJobs, projects } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  cronJobId: z.uuid(),
+});
+
+const querySchema = z.object({
+  limit: z.coerce.number().int().min(1).max(100).default(50),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, cronJobId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const { limit } = await getValidatedQuery(event, querySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [cronJob] = await useDrizzle()
+    .select()
+    .from(cronJobs)
+    .where(and(eq(cronJobs.id, cronJobId), eq(cronJobs.projectId, project.id)))
+    .limit(1);
+  if (!cronJob) {
+    throw createError({ statusCode: 404, message: "Cron job not found" });
+  }
+
+  // Run history, newest first
+  return useDrizzle()
+    .select()
+    .from(cronJobRuns)
+    .where(eq(cronJobRuns.cronJobId, cronJob.id))
+    .orderBy(desc(cronJobRuns.id))
+    .limit(limit);
+});
@@ -0,0 +1,65 @@
+import { cronJobRunLogs, cronJobRuns, cronJobs, projects } from "@zeitwork/database/schema";
+import { eq, and, gt } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  cronJobId: z.uuid(),
+  runId: z.uuid(),
+});
+
+const querySchema = z.object({
+  cursor: z.uuid().optional(),
+  limit: z.coerce.number().int().min(1).max(1000).default(200),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, cronJobId, runId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const { cursor, limit } = await getValidatedQuery(event, querySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [run] = await useDrizzle()
+    .select({ id: cronJobRuns.id })
+    .from(cronJobRuns)
+    .innerJoin(cronJobs, eq(cronJobRuns.cronJobId, cronJobs.id))
+    .where(
+      and(
+        eq(cronJobRuns.id, runId),
+        eq(cronJobRuns.cronJobId, cronJobId),
+        eq(cronJobs.projectId, project.id),
+      ),
+    )
+    .limit(1);
+  if (!run) {
+    throw createError({ statusCode: 404, message: "Cron job run not found" });
+  }
+
+  // Build conditions with optional cursor
+  const conditions = [eq(cronJobRunLogs.cronJobRunId, run.id)];
+  if (cursor) {
+    conditions.push(gt(cronJobRunLogs.id, cursor));
+  }
+
+  const logs = await useDrizzle()
+    .select()
+    .from(cronJobRunLogs)
+    .where(and(...conditions))
+    .orderBy(cronJobRunLogs.id)
+    .limit(limit);
+
+  const nextCursor = logs.length === limit ? (logs.at(-1)?.id ?? null) : null;
+
+  return { logs, nextCursor };
+});
@@ -2,17 +2,25 @@ import { projects } from "@zeitwork/database/schema";
 import { eq, and } from "@zeitwork/database/utils/drizzle";
 import { z } from "zod";
 import { useDeploymentModel } from "~~/server/models/deployment";
+import { useEnvironmentModel } from "~~/server/models/environment";
 
 const paramsSchema = z.object({
   id: z.string(),
 });
 
+const bodySchema = z
+  .object({
+    environment: z.string().optional(), // environment slug, defaults to production
+  })
+  .default({});
+
 export default defineEventHandler(async (event) => {
   const { secure, verified } = await requireVerifiedUser(event);
   if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
   if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
 
   const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
 
   const [project] = await useDrizzle()
     .select()
@@ -26,11 +34,17 @@ export default defineEventHandler(async (event) => {
     });
   }
 
+  const environment = await useEnvironmentModel().findBySlug(project.id, body.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
   // Create a new deployment
   const deploymentModel = useDeploymentModel();
   const { data: deployment, error } = await deploymentModel.create({
     projectId: project.id,
     organisationId: secure.organisationId,
+    environmentId: environment.id,
   });
 
   if (error) {
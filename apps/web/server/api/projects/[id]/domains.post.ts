@@ -1,6 +1,7 @@
 import { domains, projects } from "@zeitwork/database/schema";
 import { eq, and, ne, isNull } from "@zeitwork/database/utils/drizzle";
 import { z } from "zod";
+import { useEnvironmentModel } from "~~/server/models/environment";
 
 const paramsSchema = z.object({
   id: z.string(),
@@ -14,6 +15,7 @@ const bodySchema = z.object({
       /^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}$/,
       "Invalid domain format",
     ),
+  environment: z.string().optional(), // environment slug, defaults to production
 });
 
 /**
@@ -55,6 +57,11 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
+  const environment = await useEnvironmentModel().findBySlug(project.id, body.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
   // Check if domain already exists on this project
   const [existingDomain] = await useDrizzle()
     .select()
@@ -74,6 +81,8 @@ export default defineEventHandler(async (event) => {
       .set({
         deletedAt: null,
         verifiedAt: null,
+        environmentId: environment.id,
+        deploymentId: null,
         txtVerificationRequired: txtRequired,
         updatedAt: new Date(),
       })
@@ -91,6 +100,7 @@ export default defineEventHandler(async (event) => {
     .values({
       name: body.name,
       projectId: project.id,
+      environmentId: environment.id,
       organisationId: secure.organisationId,
       txtVerificationRequired: txtRequired,
     })
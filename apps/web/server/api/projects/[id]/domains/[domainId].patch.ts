@@ -106,6 +106,7 @@ export default defineEventHandler(async (event) => {
     .values({
       name: body.name,
       projectId: project.id,
+      environmentId: existingDomain.environmentId,
       organisationId: secure.organisationId,
       redirectTo: body.redirectTo,
       redirectStatusCode: body.redirectStatusCode,
@@ -1,17 +1,24 @@
 import { environmentVariables, projects } from "@zeitwork/database/schema";
 import { z } from "zod";
+import { useDeploymentModel } from "~~/server/models/deployment";
 
 const paramsSchema = z.object({
   id: z.string(),
   envId: z.uuid(),
 });
 
+const querySchema = z.object({
+  // false batches several edits, apply them with POST /environments/:environmentId/redeploy
+  redeploy: z.enum(["true", "false"]).default("true"),
+});
+
 export default defineEventHandler(async (event) => {
   const { secure, verified } = await requireVerifiedUser(event);
   if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
   if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
 
   const { id: projectSlug, envId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const query = await getValidatedQuery(event, querySchema.parse);
 
   // Find the project by slug
   const [project] = await useDrizzle()
@@ -46,5 +53,12 @@ export default defineEventHandler(async (event) => {
     .delete(environmentVariables)
     .where(eq(environmentVariables.id, envId));
 
+  if (query.redeploy === "true") {
+    const { error } = await useDeploymentModel().redeployEnvironment(existing.environmentId);
+    if (error) {
+      throw createError({ statusCode: 500, message: error.message });
+    }
+  }
+
   return { success: true };
 });
@@ -1,6 +1,7 @@
 import { environmentVariables, projects } from "@zeitwork/database/schema";
 import { z } from "zod";
 import { encrypt } from "~~/server/utils/crypto";
+import { useDeploymentModel } from "~~/server/models/deployment";
 
 const paramsSchema = z.object({
   id: z.string(),
@@ -15,6 +16,8 @@ const bodySchema = z.object({
     .regex(/^[A-Z_][A-Z0-9_]*$/i, "Name must be a valid environment variable name")
     .optional(),
   value: z.string().optional(),
+  // false batches several edits, apply them with POST /environments/:environmentId/redeploy
+  redeploy: z.boolean().default(true),
 });
 
 export default defineEventHandler(async (event) => {
@@ -65,7 +68,7 @@ export default defineEventHandler(async (event) => {
       .where(
         and(
           eq(environmentVariables.name, body.name),
-          eq(environmentVariables.projectId, project.id),
+          eq(environmentVariables.environmentId, existing.environmentId),
         ),
       )
       .limit(1);
@@ -100,5 +103,12 @@ export default defineEventHandler(async (event) => {
       updatedAt: environmentVariables.updatedAt,
     });
 
+  if (body.redeploy) {
+    const { error } = await useDeploymentModel().redeployEnvironment(existing.environmentId);
+    if (error) {
+      throw createError({ statusCode: 500, message: error.message });
+    }
+  }
+
   return updated;
 });
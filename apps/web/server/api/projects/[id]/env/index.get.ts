@@ -1,16 +1,22 @@
 import { environmentVariables, projects } from "@zeitwork/database/schema";
 import { z } from "zod";
+import { useEnvironmentModel } from "~~/server/models/environment";
 
 const paramsSchema = z.object({
   id: z.string(),
 });
 
+const querySchema = z.object({
+  environment: z.string().optional(), // environment slug, defaults to production
+});
+
 export default defineEventHandler(async (event) => {
   const { secure, verified } = await requireVerifiedUser(event);
   if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
   if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
 
   const { id: projectSlug } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const query = await getValidatedQuery(event, querySchema.parse);
 
   // Find the project by slug
   const [project] = await useDrizzle()
@@ -23,7 +29,12 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
-  // Get all environment variables for this project (without decrypting values)
+  const environment = await useEnvironmentModel().findBySlug(project.id, query.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  // Get all environment variables for this environment (without decrypting values)
   const envVars = await useDrizzle()
     .select({
       id: environmentVariables.id,
@@ -34,7 +45,7 @@ export default defineEventHandler(async (event) => {
     .from(environmentVariables)
     .where(
       and(
-        eq(environmentVariables.projectId, project.id),
+        eq(environmentVariables.environmentId, environment.id),
         eq(environmentVariables.organisationId, secure.organisationId),
       ),
     )
@@ -1,6 +1,8 @@
 import { environmentVariables, projects } from "@zeitwork/database/schema";
 import { z } from "zod";
 import { encrypt } from "~~/server/utils/crypto";
+import { useEnvironmentModel } from "~~/server/models/environment";
+import { useDeploymentModel } from "~~/server/models/deployment";
 
 const paramsSchema = z.object({
   id: z.string(),
@@ -13,6 +15,9 @@ const bodySchema = z.object({
     .max(255, "Name must be 255 characters or less")
     .regex(/^[A-Z_][A-Z0-9_]*$/i, "Name must be a valid environment variable name"),
   value: z.string(),
+  environment: z.string().optional(), // environment slug, defaults to production
+  // false batches several edits, apply them with POST /environments/:environmentId/redeploy
+  redeploy: z.boolean().default(true),
 });
 
 export default defineEventHandler(async (event) => {
@@ -34,14 +39,19 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
-  // Check if env var with same name already exists
+  const environment = await useEnvironmentModel().findBySlug(project.id, body.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  // Check if env var with same name already exists in the environment
   const [existing] = await useDrizzle()
     .select()
     .from(environmentVariables)
     .where(
       and(
         eq(environmentVariables.name, body.name),
-        eq(environmentVariables.projectId, project.id),
+        eq(environmentVariables.environmentId, environment.id),
       ),
     )
     .limit(1);
@@ -59,6 +69,7 @@ export default defineEventHandler(async (event) => {
       name: body.name,
       value: encryptedValue,
       projectId: project.id,
+      environmentId: environment.id,
       organisationId: secure.organisationId,
     })
     .returning({
@@ -68,5 +79,12 @@ export default defineEventHandler(async (event) => {
       updatedAt: environmentVariables.updatedAt,
     });
 
+  if (body.redeploy) {
+    const { error } = await useDeploymentModel().redeployEnvironment(environment.id);
+    if (error) {
+      throw createError({ statusCode: 500, message: error.message });
+    }
+  }
+
   return envVar;
 });
@@ -0,0 +1,63 @@
+import { environments, projects } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+const bodySchema = z.object({
+  name: z.string().min(1).max(255),
+  slug: z
+    .string()
+    .min(1)
+    .max(63)
+    .regex(/^[a-z0-9]+(?:-[a-z0-9]+)*$/, "Slug must be lowercase alphanumeric with dashes"),
+  branch: z.string().min(1).max(255),
+  vcpus: z.number().int().min(1).max(8).default(1),
+  memory: z.number().int().min(256).max(16384).default(2048),
+  replicas: z.number().int().min(1).max(10).default(1),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [existing] = await useDrizzle()
+    .select()
+    .from(environments)
+    .where(and(eq(environments.slug, body.slug), eq(environments.projectId, project.id)))
+    .limit(1);
+  if (existing) {
+    throw createError({ statusCode: 409, message: "Environment with this slug already exists" });
+  }
+
+  const [environment] = await useDrizzle()
+    .insert(environments)
+    .values({
+      name: body.name,
+      slug: body.slug,
+      branch: body.branch,
+      vcpus: body.vcpus,
+      memory: body.memory,
+      replicas: body.replicas,
+      projectId: project.id,
+      organisationId: secure.organisationId,
+    })
+    .returning();
+
+  return environment;
+});
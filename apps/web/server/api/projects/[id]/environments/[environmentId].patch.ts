@@ -0,0 +1,56 @@
+import { environments, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  environmentId: z.uuid(),
+});
+
+// Changes take effect with the next deployment of the environment,
+// except replicas which running deployments are scaled to.
+const bodySchema = z.object({
+  name: z.string().min(1).max(255).optional(),
+  branch: z.string().min(1).max(255).optional(),
+  vcpus: z.number().int().min(1).max(8).optional(),
+  memory: z.number().int().min(256).max(16384).optional(),
+  replicas: z.number().int().min(1).max(10).optional(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, environmentId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [environment] = await useDrizzle()
+    .update(environments)
+    .set({
+      ...body,
+      updatedAt: new Date(),
+    })
+    .where(
+      and(
+        eq(environments.id, environmentId),
+        eq(environments.projectId, project.id),
+        isNull(environments.deletedAt),
+      ),
+    )
+    .returning();
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  return environment;
+});
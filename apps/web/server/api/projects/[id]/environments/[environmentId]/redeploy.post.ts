@@ -0,0 +1,53 @@
+import { environments, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+import { useDeploymentModel } from "~~/server/models/deployment";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  environmentId: z.uuid(),
+});
+
+// Restarts the environment with its current environment variables without rebuilding,
+// e.g. after several edits made with redeploy: false
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, environmentId } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [environment] = await useDrizzle()
+    .select()
+    .from(environments)
+    .where(
+      and(
+        eq(environments.id, environmentId),
+        eq(environments.projectId, project.id),
+        isNull(environments.deletedAt),
+      ),
+    )
+    .limit(1);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  const { data: deployment, error } = await useDeploymentModel().redeployEnvironment(environment.id);
+  if (error) {
+    throw createError({ statusCode: 500, message: error.message });
+  }
+  if (!deployment) {
+    throw createError({ statusCode: 409, message: "Environment has no running deployment" });
+  }
+
+  return deployment;
+});
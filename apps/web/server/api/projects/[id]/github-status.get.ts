@@ -22,6 +22,10 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
+  if (project.sourceProvider !== "github" || !project.githubInstallationId) {
+    throw createError({ statusCode: 400, message: "Project is not connected to GitHub" });
+  }
+
   // Look up the GitHub installation record
   const [installation] = await useDrizzle()
     .select()
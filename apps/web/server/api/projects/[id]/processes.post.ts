@@ -0,0 +1,65 @@
+import { processTypes, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+// Process types apply to running deployments: replicas are scaled and removed process
+// types are stopped. Command changes take effect with the next deployment.
+const bodySchema = z.object({
+  name: z
+    .string()
+    .min(1)
+    .max(63)
+    .regex(/^[a-z][a-z0-9-]*$/, "Name must be lowercase alphanumeric with dashes, e.g. worker"),
+  command: z.string().trim().max(1024).default(""), // empty = image command
+  replicas: z.number().int().min(0).max(10).default(1), // ignored for web, which is scaled per environment
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [existing] = await useDrizzle()
+    .select()
+    .from(processTypes)
+    .where(
+      and(
+        eq(processTypes.name, body.name),
+        eq(processTypes.projectId, project.id),
+        isNull(processTypes.deletedAt),
+      ),
+    )
+    .limit(1);
+  if (existing) {
+    throw createError({ statusCode: 409, message: "Process type with this name already exists" });
+  }
+
+  const [processType] = await useDrizzle()
+    .insert(processTypes)
+    .values({
+      name: body.name,
+      command: body.command,
+      replicas: body.replicas,
+      projectId: project.id,
+      organisationId: secure.organisationId,
+    })
+    .returning();
+
+  return processType;
+});
@@ -0,0 +1,43 @@
+import { processTypes, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  processId: z.uuid(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, processId } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  // Deleting the web process type only removes its command override
+  const [processType] = await useDrizzle()
+    .update(processTypes)
+    .set({ deletedAt: new Date(), updatedAt: new Date() })
+    .where(
+      and(
+        eq(processTypes.id, processId),
+        eq(processTypes.projectId, project.id),
+        isNull(processTypes.deletedAt),
+      ),
+    )
+    .returning();
+  if (!processType) {
+    throw createError({ statusCode: 404, message: "Process type not found" });
+  }
+
+  return { success: true };
+});
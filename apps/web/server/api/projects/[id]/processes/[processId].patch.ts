@@ -0,0 +1,52 @@
+import { processTypes, projects } from "@zeitwork/database/schema";
+import { eq, and, isNull } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.string(),
+  processId: z.uuid(),
+});
+
+// Replicas are applied to running deployments, commands with the next deployment
+const bodySchema = z.object({
+  command: z.string().trim().max(1024).optional(),
+  replicas: z.number().int().min(0).max(10).optional(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id, processId } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const body = await readValidatedBody(event, bodySchema.parse);
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .orderBy(desc(projects.id));
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const [processType] = await useDrizzle()
+    .update(processTypes)
+    .set({
+      ...body,
+      updatedAt: new Date(),
+    })
+    .where(
+      and(
+        eq(processTypes.id, processId),
+        eq(processTypes.projectId, project.id),
+        isNull(processTypes.deletedAt),
+      ),
+    )
+    .returning();
+  if (!processType) {
+    throw createError({ statusCode: 404, message: "Process type not found" });
+  }
+
+  return processType;
+});
@@ -22,6 +22,10 @@ export default defineEventHandler(async (event) => {
     throw createError({ statusCode: 404, message: "Project not found" });
   }
 
+  if (project.sourceProvider !== "github") {
+    throw createError({ statusCode: 400, message: "Project is not connected to GitHub" });
+  }
+
   // Load all GitHub installations for this organisation
   const installations = await useDrizzle()
     .select()
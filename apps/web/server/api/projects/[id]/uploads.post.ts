@@ -0,0 +1,116 @@
+import { createHash } from "node:crypto";
+import type { H3Event } from "h3";
+import { projects, sourceUploads } from "@zeitwork/database/schema";
+import { eq, and } from "@zeitwork/database/utils/drizzle";
+import { z } from "zod";
+import { useDeploymentModel } from "~~/server/models/deployment";
+import { useEnvironmentModel } from "~~/server/models/environment";
+
+// Uploaded tarballs are stored in the database, same limit as zeitworkctl deploy
+const MAX_UPLOAD_SIZE = 100 * 1024 * 1024;
+
+const paramsSchema = z.object({
+  id: z.string(),
+});
+
+const querySchema = z.object({
+  environment: z.string().optional(), // environment slug, defaults to production
+});
+
+// Deploys a gzip tarball of a directory, with a single top-level directory like the tarballs
+// of source providers, instead of a commit. The body is the tarball itself.
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+  const query = await getValidatedQuery(event, querySchema.parse);
+
+  const contentLength = Number(getRequestHeader(event, "content-length") ?? 0);
+  if (contentLength > MAX_UPLOAD_SIZE) {
+    throw createError({ statusCode: 413, message: "Upload is larger than 100 MB" });
+  }
+  // Content-Length is optional, e.g. for chunked uploads, the body is limited while it's read
+  const tarball = await readBodyWithLimit(event, MAX_UPLOAD_SIZE);
+  if (tarball.length === 0) {
+    throw createError({ statusCode: 400, message: "Upload is empty" });
+  }
+  // gzip magic bytes
+  if (tarball[0] !== 0x1f || tarball[1] !== 0x8b) {
+    throw createError({ statusCode: 400, message: "Upload must be a gzip tarball" });
+  }
+
+  const [project] = await useDrizzle()
+    .select()
+    .from(projects)
+    .where(and(eq(projects.slug, id), eq(projects.organisationId, secure.organisationId)))
+    .limit(1);
+  if (!project) {
+    throw createError({ statusCode: 404, message: "Project not found" });
+  }
+
+  const environment = await useEnvironmentModel().findBySlug(project.id, query.environment);
+  if (!environment) {
+    throw createError({ statusCode: 404, message: "Environment not found" });
+  }
+
+  const digest = createHash("sha256").update(tarball).digest("hex");
+
+  // Store the upload together with its deployment, an upload without one would never be built
+  const deployment = await useDrizzle().transaction(async (tx) => {
+    const [upload] = await tx
+      .insert(sourceUploads)
+      .values({
+        projectId: project.id,
+        digest,
+        size: tarball.length,
+        data: tarball,
+        organisationId: secure.organisationId,
+      })
+      .returning({ id: sourceUploads.id });
+    if (!upload) {
+      throw createError({ statusCode: 500, message: "Failed to store upload" });
+    }
+
+    // The upload's digest takes the place of the commit, and tags the image
+    const { data: deployment, error } = await useDeploymentModel().create(
+      {
+        projectId: project.id,
+        organisationId: secure.organisationId,
+        environmentId: environment.id,
+        githubCommit: `upload-${digest.slice(0, 12)}`,
+        sourceUploadId: upload.id,
+      },
+      tx,
+    );
+    if (error) {
+      throw createError({ statusCode: 500, message: error.message });
+    }
+    return deployment;
+  });
+
+  return deployment;
+});
+
+// Reads the request body, and stops reading as soon as it exceeds the limit instead of buffering
+// all of it
+async function readBodyWithLimit(event: H3Event, limit: number): Promise<Buffer> {
+  const stream = getRequestWebStream(event);
+  if (!stream) return Buffer.alloc(0);
+
+  const reader = stream.getReader();
+  const chunks: Uint8Array[] = [];
+  let size = 0;
+  while (true) {
+    const { done, value } = await reader.read();
+    if (done) break;
+    size += value.byteLength;
+    if (size > limit) {
+      await reader.cancel();
+      throw createError({ statusCode: 413, message: "Upload is larger than 100 MB" });
+    }
+    chunks.push(value);
+  }
+  return Buffer.concat(chunks, size);
+}
@@ -1,35 +1,65 @@
-import { environmentVariables, githubInstallations, organisations, projects } from "@zeitwork/database/schema";
+import {
+  environmentVariables,
+  environments,
+  githubInstallations,
+  organisations,
+  projects,
+} from "@zeitwork/database/schema";
 import { count } from "@zeitwork/database/utils/drizzle";
 import z from "zod";
 import { encrypt } from "~~/server/utils/crypto";
+import { gitUrlSchema, repositoryUrlSchema } from "~~/server/utils/source";
+import { DEFAULT_ENVIRONMENT_SLUG } from "~~/server/models/environment";
 
-const bodySchema = z.object({
-  name: z.string().min(1).max(255),
-  repository: z.object({
-    owner: z.string().min(1).max(255),
-    repo: z.string().min(1).max(255),
-  }),
-  secrets: z.array(
-    z.object({
-      name: z.string().min(1).max(255),
-      value: z.string(),
-    }),
-  ),
-  rootDirectory: z
-    .string()
-    .max(255)
-    .regex(/^\/(?:[^./][^/]*(?:\/[^./][^/]*)*)?$/, {
-      message: "Root directory must start with / and cannot contain '..' or hidden directories",
-    })
-    .default("/"),
-  dockerfilePath: z
-    .string()
-    .max(255)
-    .regex(/^(?!.*\.\.)(?!\/)[a-zA-Z0-9._\-/]+$/, {
-      message: "Dockerfile path must be a relative path without '..' sequences",
-    })
-    .default("Dockerfile"),
-});
+const bodySchema = z
+  .object({
+    name: z.string().min(1).max(255),
+    // GitHub repository, through the organisation's GitHub App installation
+    repository: z
+      .object({
+        owner: z.string().min(1).max(255),
+        repo: z.string().min(1).max(255),
+      })
+      .optional(),
+    // repository of another source provider, e.g. an internal Gitea over SSH with a deploy key
+    source: z
+      .discriminatedUnion("provider", [
+        z.object({
+          provider: z.enum(["gitlab", "bitbucket"]),
+          url: repositoryUrlSchema,
+          token: z.string().default(""), // access token, empty for public repositories
+        }),
+        z.object({
+          provider: z.literal("git"),
+          url: gitUrlSchema,
+          deployKey: z.string().default(""), // SSH private key, empty for public https repositories
+        }),
+      ])
+      .optional(),
+    secrets: z.array(
+      z.object({
+        name: z.string().min(1).max(255),
+        value: z.string(),
+      }),
+    ),
+    rootDirectory: z
+      .string()
+      .max(255)
+      .regex(/^\/(?:[^./][^/]*(?:\/[^./][^/]*)*)?$/, {
+        message: "Root directory must start with / and cannot contain '..' or hidden directories",
+      })
+      .default("/"),
+    dockerfilePath: z
+      .string()
+      .max(255)
+      .regex(/^(?!.*\.\.)(?!\/)[a-zA-Z0-9._\-/]+$/, {
+        message: "Dockerfile path must be a relative path without '..' sequences",
+      })
+      .default("Dockerfile"),
+  })
+  .refine((body) => !body.repository !== !body.source, {
+    message: "Either a GitHub repository or a source is required",
+  });
 
 export default defineEventHandler(async (event) => {
   const { secure, verified } = await requireVerifiedUser(event);
@@ -59,29 +89,32 @@ export default defineEventHandler(async (event) => {
     });
   }
 
-  const githubRepository = `${body.repository.owner}/${body.repository.repo}`;
+  let githubRepository = "";
+  let githubInstallationId: null | string = null;
+  if (body.repository) {
+    githubRepository = `${body.repository.owner}/${body.repository.repo}`;
 
-  // Check if we have access to the GitHub repository and find the githubInstallationId
-  const github = useGitHub();
+    // Check if we have access to the GitHub repository and find the githubInstallationId
+    const github = useGitHub();
 
-  const installations = await useDrizzle()
-    .select()
-    .from(githubInstallations)
-    .where(eq(githubInstallations.organisationId, secure.organisationId));
+    const installations = await useDrizzle()
+      .select()
+      .from(githubInstallations)
+      .where(eq(githubInstallations.organisationId, secure.organisationId));
 
-  let githubInstallationId: null | string = null;
-  for (const installation of installations) {
-    const { data: repo } = await github.repository.get(
-      installation.githubInstallationId,
-      body.repository.owner,
-      body.repository.repo,
-    );
-    if (repo) {
-      githubInstallationId = installation.id;
+    for (const installation of installations) {
+      const { data: repo } = await github.repository.get(
+        installation.githubInstallationId,
+        body.repository.owner,
+        body.repository.repo,
+      );
+      if (repo) {
+        githubInstallationId = installation.id;
+      }
+    }
+    if (!githubInstallationId) {
+      throw createError({ statusCode: 500, message: "Installation not found" });
     }
-  }
-  if (!githubInstallationId) {
-    throw createError({ statusCode: 500, message: "Installation not found" });
   }
 
   // Create project and environment variables in a transaction
@@ -92,8 +125,18 @@ export default defineEventHandler(async (event) => {
       .values({
         name: body.name,
         slug: slugify(body.name),
+        sourceProvider: body.source?.provider ?? "github",
         githubRepository: githubRepository,
         githubInstallationId: githubInstallationId,
+        sourceUrl: body.source?.url ?? "",
+        sourceToken:
+          body.source && body.source.provider !== "git" && body.source.token
+            ? encrypt(body.source.token)
+            : "",
+        sourceDeployKey:
+          body.source?.provider === "git" && body.source.deployKey
+            ? encrypt(body.source.deployKey)
+            : "",
         organisationId: secure.organisationId,
         rootDirectory: body.rootDirectory,
         dockerfilePath: body.dockerfilePath,
@@ -103,6 +146,21 @@ export default defineEventHandler(async (event) => {
       throw createError({ statusCode: 500, message: "Failed to create project" });
     }
 
+    // Every project starts with a production environment tracking main
+    const [environment] = await tx
+      .insert(environments)
+      .values({
+        name: "Production",
+        slug: DEFAULT_ENVIRONMENT_SLUG,
+        branch: "main",
+        projectId: project.id,
+        organisationId: secure.organisationId,
+      })
+      .returning();
+    if (!environment) {
+      throw createError({ statusCode: 500, message: "Failed to create environment" });
+    }
+
     if (body.secrets.length > 0) {
       // Create environment variables with encrypted values
       await tx.insert(environmentVariables).values(
@@ -110,6 +168,7 @@ export default defineEventHandler(async (event) => {
           name: secret.name,
           value: encrypt(secret.value),
           projectId: project.id,
+          environmentId: environment.id,
           organisationId: secure.organisationId,
         })),
       );
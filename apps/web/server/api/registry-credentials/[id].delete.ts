@@ -0,0 +1,34 @@
+import { registryCredentials } from "@zeitwork/database/schema";
+import { z } from "zod";
+
+const paramsSchema = z.object({
+  id: z.uuid(),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const { id } = await getValidatedRouterParams(event, paramsSchema.parse);
+
+  // Check if the registry credentials exist
+  const [existing] = await useDrizzle()
+    .select()
+    .from(registryCredentials)
+    .where(
+      and(
+        eq(registryCredentials.id, id),
+        eq(registryCredentials.organisationId, secure.organisationId),
+      ),
+    )
+    .limit(1);
+
+  if (!existing) {
+    throw createError({ statusCode: 404, message: "Registry credentials not found" });
+  }
+
+  await useDrizzle().delete(registryCredentials).where(eq(registryCredentials.id, id));
+
+  return { success: true };
+});
@@ -0,0 +1,20 @@
+import { registryCredentials } from "@zeitwork/database/schema";
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  // Get all registry credentials of the organisation (without passwords)
+  return await useDrizzle()
+    .select({
+      id: registryCredentials.id,
+      registry: registryCredentials.registry,
+      username: registryCredentials.username,
+      createdAt: registryCredentials.createdAt,
+      updatedAt: registryCredentials.updatedAt,
+    })
+    .from(registryCredentials)
+    .where(eq(registryCredentials.organisationId, secure.organisationId))
+    .orderBy(registryCredentials.registry);
+});
@@ -0,0 +1,56 @@
+import { registryCredentials } from "@zeitwork/database/schema";
+import { z } from "zod";
+import { encrypt } from "~~/server/utils/crypto";
+
+const bodySchema = z.object({
+  registry: z
+    .string()
+    .min(1, "Registry is required")
+    .max(255, "Registry must be 255 characters or less")
+    .regex(/^[a-z0-9.-]+(:[0-9]+)?$/i, "Registry must be a host, e.g. registry.example.com"),
+  username: z.string().min(1, "Username is required"),
+  password: z.string().min(1, "Password is required"),
+});
+
+export default defineEventHandler(async (event) => {
+  const { secure, verified } = await requireVerifiedUser(event);
+  if (!secure) throw createError({ statusCode: 401, message: "Unauthorized" });
+  if (!verified) throw createError({ statusCode: 403, message: "Account not verified" });
+
+  const body = await readValidatedBody(event, bodySchema.parse);
+  const registry = body.registry.toLowerCase();
+
+  // Check if credentials for the registry already exist in the organisation
+  const [existing] = await useDrizzle()
+    .select()
+    .from(registryCredentials)
+    .where(
+      and(
+        eq(registryCredentials.registry, registry),
+        eq(registryCredentials.organisationId, secure.organisationId),
+      ),
+    )
+    .limit(1);
+
+  if (existing) {
+    throw createError({ statusCode: 409, message: "Credentials for this registry already exist" });
+  }
+
+  const [credential] = await useDrizzle()
+    .insert(registryCredentials)
+    .values({
+      registry,
+      username: body.username,
+      password: encrypt(body.password),
+      organisationId: secure.organisationId,
+    })
+    .returning({
+      id: registryCredentials.id,
+      registry: registryCredentials.registry,
+      username: registryCredentials.username,
+      createdAt: registryCredentials.createdAt,
+      updatedAt: registryCredentials.updatedAt,
+    });
+
+  return credential;
+});
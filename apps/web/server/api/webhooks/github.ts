@@ -1,4 +1,5 @@
 import { useDeploymentModel } from "~~/server/models/deployment";
+import { useEnvironmentModel } from "~~/server/models/environment";
 import { tryCatch } from "~~/server/utils/tryCatch";
 import * as schema from "@zeitwork/database/schema";
 import { Webhooks } from "@octokit/webhooks";
@@ -49,6 +50,15 @@ export default defineEventHandler(async (event) => {
         });
       }
       return "ok";
+    case "pull_request":
+      const { error: pullRequestError } = await tryCatch(handlePullRequestEvent(payload));
+      if (pullRequestError) {
+        throw createError({
+          statusCode: 500,
+          statusMessage: pullRequestError.message,
+        });
+      }
+      return "ok";
     case "installation_repositories":
       break;
   }
@@ -164,10 +174,11 @@ async function handleInstallationEvent(payload: any) {
 }
 
 async function handlePushEvent(payload: any) {
-  const ref = payload.ref;
-  if (ref !== "refs/heads/main") {
+  const ref: string | undefined = payload.ref;
+  if (!ref?.startsWith("refs/heads/")) {
     return;
   }
+  const branch = ref.slice("refs/heads/".length);
 
   const installationId = payload.installation?.id;
   const githubOwner = payload.repository?.owner?.login;
@@ -178,12 +189,112 @@ async function handlePushEvent(payload: any) {
     throw new Error("Missing required fields");
   }
 
-  // A push that deletes a branch sends the all-zeros SHA — ignore it.
+  const projectsList = await findProjectsForRepository(installationId, githubOwner, githubRepo);
+  const environmentModel = useEnvironmentModel();
+
+  // A push that deletes a branch sends the all-zeros SHA — remove its preview.
   const DELETED_BRANCH_SHA = "0000000000000000000000000000000000000000";
-  if (commitSHA === DELETED_BRANCH_SHA) {
+  if (payload.deleted || commitSHA === DELETED_BRANCH_SHA) {
+    for (const project of projectsList) {
+      await environmentModel.deletePreview(project.id, branch);
+    }
+    return;
+  }
+
+  // Create a deployment for each environment tracking the pushed branch.
+  // Branches without an environment get a preview environment.
+  const deploymentModel = useDeploymentModel();
+  for (const project of projectsList) {
+    const environmentList = await environmentModel.findByBranch(project.id, branch);
+    if (environmentList.length === 0) {
+      const preview = await environmentModel.ensurePreview({ project, branch });
+      if (preview) {
+        environmentList.push(preview.environment);
+      }
+    }
+
+    for (const environment of environmentList) {
+      const { error: deploymentError } = await deploymentModel.create({
+        projectId: project.id,
+        organisationId: project.organisationId,
+        environmentId: environment.id,
+        githubCommit: commitSHA,
+      });
+
+      if (deploymentError) {
+        throw new Error(
+          `Failed to create deployment for project ${project.slug} (${environment.slug})`,
+        );
+      }
+    }
+  }
+}
+
+async function handlePullRequestEvent(payload: any) {
+  const installationId = payload.installation?.id;
+  const githubOwner = payload.repository?.owner?.login;
+  const githubRepo = payload.repository?.name;
+  const pullRequest = payload.pull_request;
+
+  if (!installationId || !githubOwner || !githubRepo || !pullRequest) {
+    throw new Error("Missing required fields");
+  }
+
+  // Pull requests from forks can not be built with this installation
+  if (pullRequest.head?.repo?.full_name !== payload.repository?.full_name) {
     return;
   }
 
+  const branch: string = pullRequest.head.ref;
+  const commitSHA: string = pullRequest.head.sha;
+
+  const projectsList = await findProjectsForRepository(installationId, githubOwner, githubRepo);
+  const environmentModel = useEnvironmentModel();
+  const deploymentModel = useDeploymentModel();
+
+  for (const project of projectsList) {
+    switch (payload.action) {
+      case "opened":
+      case "reopened": {
+        // Branches tracked by a regular environment do not get a preview
+        const environmentList = await environmentModel.findByBranch(project.id, branch);
+        if (environmentList.some((environment) => !environment.preview)) {
+          break;
+        }
+
+        const preview = await environmentModel.ensurePreview({
+          project,
+          branch,
+          githubPullRequest: pullRequest.number,
+        });
+
+        // Pushes deploy existing previews, only deploy previews created here
+        if (preview?.created) {
+          const { error: deploymentError } = await deploymentModel.create({
+            projectId: project.id,
+            organisationId: project.organisationId,
+            environmentId: preview.environment.id,
+            githubCommit: commitSHA,
+          });
+          if (deploymentError) {
+            throw new Error(`Failed to create preview deployment for project ${project.slug}`);
+          }
+        }
+        break;
+      }
+      case "closed":
+        await environmentModel.deletePreview(project.id, branch);
+        break;
+    }
+  }
+}
+
+// findProjectsForRepository returns all projects using the repository, scoped to the triggering installation
+async function findProjectsForRepository(
+  installationId: number,
+  githubOwner: string,
+  githubRepo: string,
+): Promise<(typeof schema.projects.$inferSelect)[]> {
   // Find the installation record to scope project lookups
   const { data: installationRecords, error: installationError } = await tryCatch(
     useDrizzle()
@@ -197,9 +308,8 @@ async function handlePushEvent(payload: any) {
     throw new Error("Installation not found");
   }
 
-  // Fetch all projects using this githubRepository scoped to the triggering installation
   const githubRepository = `${githubOwner}/${githubRepo}`;
-  const { data: projectsList, error: findProjectError } = await tryCatch<any[]>(
+  const { data: projectsList, error: findProjectError } = await tryCatch(
     useDrizzle()
       .select()
       .from(schema.projects)
@@ -214,21 +324,7 @@ async function handlePushEvent(payload: any) {
   if (findProjectError) {
     throw new Error("Failed to query projects");
   }
-  if (!projectsList || projectsList.length === 0) {
-    // No projects configured for this repo yet — not an error.
-    return;
-  }
 
-  // Create a deployment for each project linked to this repository
-  const deploymentModel = useDeploymentModel();
-  for (const project of projectsList) {
-    const { error: deploymentError } = await deploymentModel.create({
-      projectId: project.id,
-      organisationId: project.organisationId,
-    });
-
-    if (deploymentError) {
-      throw new Error(`Failed to create deployment for project ${project.slug}`);
-    }
-  }
+  // No projects configured for this repo yet — not an error.
+  return projectsList ?? [];
 }
@@ -0,0 +1,11 @@
+import { z } from "zod";
+
+// Five-field cron expression (minute hour day-of-month month day-of-week) in UTC, or a macro
+// like @daily. Values are validated by the reconciler, which skips jobs it cannot parse.
+export const cronScheduleSchema = z
+  .string()
+  .trim()
+  .max(255)
+  .regex(/^(@(yearly|annually|monthly|weekly|daily|midnight|hourly)|[\w*,\/-]+(\s+[\w*,\/-]+){4})$/i, {
+    message: "Schedule must be a five-field cron expression, e.g. '0 3 * * *'",
+  });
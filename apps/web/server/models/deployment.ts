@@ -3,11 +3,17 @@ import {
   organisations,
   projects,
   domains,
+  environments,
   githubInstallations,
   DeploymentStatus,
 } from "@zeitwork/database/schema";
-import { eq } from "../utils/drizzle";
+import { and, desc, eq, isNotNull, isNull } from "../utils/drizzle";
 import { customAlphabet } from "nanoid";
+import { useEnvironmentModel } from "./environment";
+
+type Database =
+  | ReturnType<typeof useDrizzle>
+  | Parameters<Parameters<ReturnType<typeof useDrizzle>["transaction"]>[0]>[0];
 
 type ModelResponse<T> =
   | {
@@ -23,16 +29,26 @@ export function useDeploymentModel() {
   interface CreateDeploymentParams {
     projectId: string;
     organisationId: string;
+    // defaults to the project's production environment
+    environmentId?: string;
+    // defaults to the latest commit of the environment's branch, for every source provider
+    githubCommit?: string;
+    // reuses the image of a finished build instead of building the commit again
+    buildId?: string;
+    // builds an uploaded source tarball instead of a commit, githubCommit is then required
+    sourceUploadId?: string;
+    // skips the release command, e.g. when the build's release already ran
+    released?: boolean;
   }
 
+  // db is a transaction to create the deployment in, e.g. together with its source upload
   async function createDeployment(
     params: CreateDeploymentParams,
+    db: Database = useDrizzle(),
   ): Promise<ModelResponse<typeof deployments.$inferSelect | null>> {
     try {
-      const github = useGitHub();
-
       // Get the project
-      const [project] = await useDrizzle()
+      const [project] = await db
         .select()
         .from(projects)
         .where(eq(projects.id, params.projectId))
@@ -41,7 +57,7 @@ export function useDeploymentModel() {
         return { data: null, error: new Error("Project not found") };
       }
 
-      const [organisation] = await useDrizzle()
+      const [organisation] = await db
         .select()
         .from(organisations)
         .where(eq(organisations.id, params.organisationId))
@@ -50,55 +66,83 @@ export function useDeploymentModel() {
         return { data: null, error: new Error("Organisation not found") };
       }
 
-      const [githubInstallation] = await useDrizzle()
-        .select()
-        .from(githubInstallations)
-        .where(eq(githubInstallations.id, project.githubInstallationId))
-        .limit(1);
-      if (!githubInstallation) {
-        return { data: null, error: new Error("GitHub installation not found") };
+      const environment = params.environmentId
+        ? (
+            await db
+              .select()
+              .from(environments)
+              .where(eq(environments.id, params.environmentId))
+              .limit(1)
+          )[0]
+        : await useEnvironmentModel().findBySlug(project.id);
+      if (!environment || environment.projectId !== project.id) {
+        return { data: null, error: new Error("Environment not found") };
       }
 
-      const { data: latestCommitHash, error: latestCommitHashError } =
-        await github.branch.getLatestCommitSHA(
-          githubInstallation.githubInstallationId,
-          project.githubRepository.split("/")[0],
-          project.githubRepository.split("/")[1],
-          "main",
-        );
-      if (latestCommitHashError) {
-        return { data: null, error: new Error("Failed to get latest commit hash") };
-      }
+      let githubCommit = params.githubCommit;
+      if (!githubCommit && project.sourceProvider === "github") {
+        const [githubInstallation] = project.githubInstallationId
+          ? await db
+              .select()
+              .from(githubInstallations)
+              .where(eq(githubInstallations.id, project.githubInstallationId))
+              .limit(1)
+          : [];
+        if (!githubInstallation) {
+          return { data: null, error: new Error("GitHub installation not found") };
+        }
 
-      const [deployment] = await useDrizzle()
-        .insert(deployments)
-        .values({
-          status: "pending",
-          projectId: project.id,
-          githubCommit: latestCommitHash,
-          organisationId: params.organisationId,
-        })
-        .returning();
-
-      if (!deployment) {
-        return { data: null, error: new Error("Failed to create deployment") };
+        const { data: latestCommitHash, error: latestCommitHashError } =
+          await useGitHub().branch.getLatestCommitSHA(
+            githubInstallation.githubInstallationId,
+            project.githubRepository.split("/")[0],
+            project.githubRepository.split("/")[1],
+            environment.branch,
+          );
+        if (latestCommitHashError) {
+          return { data: null, error: new Error("Failed to get latest commit hash") };
+        }
+        githubCommit = latestCommitHash;
+      } else if (!githubCommit) {
+        const { data: latestCommitHash, error: latestCommitHashError } =
+          await useSource().branch.getLatestCommitSHA(project, environment.branch);
+        if (latestCommitHashError) {
+          return { data: null, error: new Error("Failed to get latest commit hash") };
+        }
+        githubCommit = latestCommitHash;
       }
 
-      // Create internal domain for the deployment
       const internalDomainName = generateInternalDomain(project.slug, organisation.slug);
+      const deployment = await db.transaction(async (tx) => {
+        const [deployment] = await tx
+          .insert(deployments)
+          .values({
+            status: "pending",
+            projectId: project.id,
+            environmentId: environment.id,
+            githubCommit: githubCommit,
+            buildId: params.buildId,
+            sourceUploadId: params.sourceUploadId,
+            releasedAt: params.released ? new Date() : undefined,
+            organisationId: params.organisationId,
+          })
+          .returning();
+        if (!deployment) {
+          throw new Error("Failed to create deployment");
+        }
 
-      try {
-        await useDrizzle().insert(domains).values({
+        // Create internal domain for the deployment
+        await tx.insert(domains).values({
           name: internalDomainName,
           projectId: project.id,
+          environmentId: environment.id,
           deploymentId: deployment.id,
           organisationId: params.organisationId,
+          internal: true,
           verifiedAt: new Date(),
         });
-      } catch (domainError) {
-        // Log the error but don't fail the deployment creation
-        console.error("Failed to create internal domain:", domainError);
-      }
+        return deployment;
+      });
 
       return { data: deployment, error: null };
     } catch (error) {
@@ -106,8 +150,57 @@ export function useDeploymentModel() {
     }
   }
 
+  // redeployEnvironment creates a deployment of the image currently serving an environment, so
+  // its replicas are replaced with ones that get the current environment variables. The new
+  // deployment goes through the usual health-checked swap, without running the release command
+  // again for the same build. Deployments of newer builds still supersede it, as running
+  // deployments are ordered by build. Returns null when nothing is running.
+  async function redeployEnvironment(
+    environmentId: string,
+  ): Promise<ModelResponse<typeof deployments.$inferSelect | null>> {
+    const [environment] = await useDrizzle()
+      .select()
+      .from(environments)
+      .where(eq(environments.id, environmentId))
+      .limit(1);
+    if (!environment) {
+      return { data: null, error: new Error("Environment not found") };
+    }
+
+    const [current] = await useDrizzle()
+      .select()
+      .from(deployments)
+      .where(
+        and(
+          eq(deployments.environmentId, environment.id),
+          isNotNull(deployments.runningAt),
+          isNotNull(deployments.buildId),
+          isNull(deployments.stoppingAt),
+          isNull(deployments.stoppedAt),
+          isNull(deployments.failedAt),
+          isNull(deployments.deletedAt),
+        ),
+      )
+      .orderBy(desc(deployments.buildId), desc(deployments.id))
+      .limit(1);
+    if (!current) {
+      return { data: null, error: null };
+    }
+
+    return createDeployment({
+      projectId: environment.projectId,
+      organisationId: environment.organisationId,
+      environmentId: environment.id,
+      githubCommit: current.githubCommit,
+      buildId: current.buildId!,
+      sourceUploadId: current.sourceUploadId ?? undefined,
+      released: true,
+    });
+  }
+
   return {
     create: createDeployment,
+    redeployEnvironment,
   };
 }
 
@@ -123,6 +216,9 @@ export function deploymentStatus(deployment: typeof deployments.$inferSelect): D
   if (deployment.stoppedAt) {
     return "stopped";
   }
+  if (deployment.stoppingAt) {
+    return "stopping";
+  }
   if (deployment.runningAt) {
     return "running";
   }
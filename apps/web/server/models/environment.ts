@@ -0,0 +1,182 @@
+import { domains, environments, projects } from "@zeitwork/database/schema";
+import { and, desc, eq, isNull } from "../utils/drizzle";
+
+// Every project gets a production environment on creation. Requests that do not
+// name an environment operate on it.
+export const DEFAULT_ENVIRONMENT_SLUG = "production";
+
+export function useEnvironmentModel() {
+  async function findBySlug(
+    projectId: string,
+    slug: string = DEFAULT_ENVIRONMENT_SLUG,
+  ): Promise<typeof environments.$inferSelect | null> {
+    const [environment] = await useDrizzle()
+      .select()
+      .from(environments)
+      .where(
+        and(
+          eq(environments.projectId, projectId),
+          eq(environments.slug, slug),
+          isNull(environments.deletedAt),
+        ),
+      )
+      .limit(1);
+    return environment ?? null;
+  }
+
+  async function findByBranch(
+    projectId: string,
+    branch: string,
+  ): Promise<(typeof environments.$inferSelect)[]> {
+    return useDrizzle()
+      .select()
+      .from(environments)
+      .where(
+        and(
+          eq(environments.projectId, projectId),
+          eq(environments.branch, branch),
+          isNull(environments.deletedAt),
+        ),
+      );
+  }
+
+  interface EnsurePreviewParams {
+    project: typeof projects.$inferSelect;
+    branch: string;
+    githubPullRequest?: number;
+  }
+
+  // ensurePreview returns the preview environment of a branch, creating it with a
+  // <branch>-<project>.<previewDomain> hostname if needed. Previews start without environment
+  // variables: they run unreviewed branches, which must not get production's secrets or database.
+  // Previews of deleted branches are revived. Returns null when preview deployments are disabled.
+  async function ensurePreview(
+    params: EnsurePreviewParams,
+  ): Promise<{ environment: typeof environments.$inferSelect; created: boolean } | null> {
+    const previewDomain = useRuntimeConfig().previewDomain;
+    if (!previewDomain || !params.project.previewDeployments) {
+      return null;
+    }
+
+    const [existing] = await useDrizzle()
+      .select()
+      .from(environments)
+      .where(
+        and(
+          eq(environments.projectId, params.project.id),
+          eq(environments.branch, params.branch),
+          eq(environments.preview, true),
+        ),
+      )
+      .orderBy(desc(environments.id))
+      .limit(1);
+    if (existing && !existing.deletedAt) {
+      if (params.githubPullRequest && existing.githubPullRequest !== params.githubPullRequest) {
+        await useDrizzle()
+          .update(environments)
+          .set({ githubPullRequest: params.githubPullRequest, updatedAt: new Date() })
+          .where(eq(environments.id, existing.id));
+      }
+      return { environment: existing, created: false };
+    }
+
+    const production = await findBySlug(params.project.id);
+    const branchSlug = slugifyLabel(params.branch);
+
+    const environment = await useDrizzle().transaction(async (tx) => {
+      let environment: typeof environments.$inferSelect | undefined;
+      if (existing) {
+        [environment] = await tx
+          .update(environments)
+          .set({
+            deletedAt: null,
+            githubPullRequest: params.githubPullRequest ?? null,
+            updatedAt: new Date(),
+          })
+          .where(eq(environments.id, existing.id))
+          .returning();
+      } else {
+        [environment] = await tx
+          .insert(environments)
+          .values({
+            name: `Preview ${params.branch}`,
+            slug: slugifyLabel(`preview-${branchSlug}`),
+            branch: params.branch,
+            preview: true,
+            githubPullRequest: params.githubPullRequest,
+            vcpus: production?.vcpus,
+            memory: production?.memory,
+            projectId: params.project.id,
+            organisationId: params.project.organisationId,
+          })
+          .onConflictDoNothing()
+          .returning();
+        if (!environment) {
+          // another branch already maps to the same slug
+          return null;
+        }
+      }
+
+      // Revive the hostname if the preview was deleted before
+      await tx
+        .insert(domains)
+        .values({
+          name: `${slugifyLabel(`${branchSlug}-${params.project.slug}`)}.${previewDomain}`,
+          projectId: params.project.id,
+          environmentId: environment!.id,
+          organisationId: params.project.organisationId,
+          verifiedAt: new Date(),
+        })
+        .onConflictDoUpdate({
+          target: [domains.name, domains.projectId],
+          set: {
+            environmentId: environment!.id,
+            deploymentId: null,
+            verifiedAt: new Date(),
+            deletedAt: null,
+            updatedAt: new Date(),
+          },
+        });
+
+      return environment!;
+    });
+    if (!environment) {
+      return null;
+    }
+
+    return { environment, created: true };
+  }
+
+  // deletePreview soft-deletes the preview environment of a branch. The reconciler then stops
+  // its deployments and removes its domains.
+  async function deletePreview(projectId: string, branch: string): Promise<void> {
+    await useDrizzle()
+      .update(environments)
+      .set({ deletedAt: new Date(), updatedAt: new Date() })
+      .where(
+        and(
+          eq(environments.projectId, projectId),
+          eq(environments.branch, branch),
+          eq(environments.preview, true),
+          isNull(environments.deletedAt),
+        ),
+      );
+  }
+
+  return {
+    findBySlug,
+    findByBranch,
+    ensurePreview,
+    deletePreview,
+  };
+}
+
+// slugifyLabel turns a string into a valid DNS label (max 63 characters)
+function slugifyLabel(value: string): string {
+  return value
+    .toLowerCase()
+    .replace(/[^a-z0-9]+/g, "-")
+    .replace(/^-+|-+$/g, "")
+    .slice(0, 63)
+    .replace(/-+$/g, "");
+}
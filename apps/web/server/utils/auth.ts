@@ -1,16 +1,34 @@
-import { users } from "@zeitwork/database/schema";
-import { eq } from "@zeitwork/database/utils/drizzle";
+import { createHash } from "node:crypto";
+import { apiTokens, users } from "@zeitwork/database/schema";
+import { and, eq, isNull } from "@zeitwork/database/utils/drizzle";
+import type { SecureSessionData } from "#auth-utils";
 import type { H3Event } from "h3";
 
+type VerifiedUser = {
+  secure: Pick<SecureSessionData, "userId" | "organisationId"> | null;
+  verified: boolean;
+};
+
 /**
  * Requires a verified user session.
- * - First checks that the user is logged in via requireUserSession
+ * - First checks that the user is logged in via requireUserSession, or sends an API token
+ *   as "Authorization: Bearer <token>"
  * - Then queries the database to check if the user is verified (verified_at is set)
  *
+ * Pass { apiToken: false } for endpoints only a signed-in user may call, e.g. managing API tokens,
+ * so a leaked token can't mint new ones or revoke the others.
+ *
  * @returns { secure, verified } - secure is the session data, verified is boolean
  */
-export async function requireVerifiedUser(event: H3Event) {
-  const { secure } = await requireUserSession(event);
+export async function requireVerifiedUser(
+  event: H3Event,
+  options: { apiToken?: boolean } = {},
+): Promise<VerifiedUser> {
+  const token = getRequestHeader(event, "authorization")?.match(/^Bearer (\S+)$/)?.[1];
+  if (token && options.apiToken === false) {
+    throw createError({ statusCode: 403, message: "API tokens can't be used here, sign in instead" });
+  }
+  const secure = token ? await apiTokenSession(token) : (await requireUserSession(event)).secure;
 
   if (!secure) {
     return { secure: null, verified: false };
@@ -29,3 +47,19 @@ export async function requireVerifiedUser(event: H3Event) {
 
   return { secure, verified: !!user.verifiedAt };
 }
+
+// Hash of an API token, tokens are only stored hashed
+export function hashApiToken(token: string) {
+  return createHash("sha256").update(token).digest("hex");
+}
+
+// Session data of the user and organisation an API token was created for
+async function apiTokenSession(token: string) {
+  const [apiToken] = await useDrizzle()
+    .update(apiTokens)
+    .set({ lastUsedAt: new Date() })
+    .where(and(eq(apiTokens.tokenHash, hashApiToken(token)), isNull(apiTokens.deletedAt)))
+    .returning({ userId: apiTokens.userId, organisationId: apiTokens.organisationId });
+
+  return apiToken ?? null;
+}
@@ -1,4 +1,4 @@
-export { sql, eq, and, or, asc, desc, isNull } from "@zeitwork/database/utils/drizzle";
+export { sql, eq, and, or, asc, desc, isNull, isNotNull } from "@zeitwork/database/utils/drizzle";
 import { useClient } from "@zeitwork/database/client";
 
 const client = useClient({ dsn: process.env.NUXT_DSN! });
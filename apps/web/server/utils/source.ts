@@ -0,0 +1,197 @@
+import { execFile } from "node:child_process";
+import { lookup } from "node:dns/promises";
+import { mkdtemp, rm, writeFile } from "node:fs/promises";
+import { BlockList, isIP } from "node:net";
+import { tmpdir } from "node:os";
+import { join } from "node:path";
+import { promisify } from "node:util";
+import type { projects } from "@zeitwork/database/schema";
+import { z } from "zod";
+import { decrypt } from "./crypto";
+
+type Project = typeof projects.$inferSelect;
+
+// Addresses that aren't reachable on the internet: loopback, private, link-local (e.g. cloud
+// metadata services) and other special ranges. Repository URLs must not reach the cluster itself.
+const nonPublicAddresses = new BlockList();
+for (const [network, prefix] of [
+  ["0.0.0.0", 8],
+  ["10.0.0.0", 8],
+  ["100.64.0.0", 10],
+  ["127.0.0.0", 8],
+  ["169.254.0.0", 16],
+  ["172.16.0.0", 12],
+  ["192.168.0.0", 16],
+  ["224.0.0.0", 3],
+] as const) {
+  nonPublicAddresses.addSubnet(network, prefix, "ipv4");
+}
+for (const [network, prefix] of [
+  ["::", 127],
+  ["::ffff:0:0", 96],
+  ["fc00::", 7],
+  ["fe80::", 10],
+  ["ff00::", 8],
+] as const) {
+  nonPublicAddresses.addSubnet(network, prefix, "ipv6");
+}
+
+function isPublicAddress(address: string) {
+  const family = isIP(address);
+  if (family === 0) return false;
+  return !nonPublicAddresses.check(address, family === 4 ? "ipv4" : "ipv6");
+}
+
+// Whether a hostname is localhost or an IP literal of a non-public address
+function isPrivateHostname(hostname: string) {
+  const host = hostname.toLowerCase().replace(/^\[|\]$/g, "").replace(/\.$/, "");
+  if (host === "localhost" || host.endsWith(".localhost")) return true;
+  return isIP(host) !== 0 && !isPublicAddress(host);
+}
+
+// Refuse hosts that resolve to non-public addresses, before connecting to them
+async function assertPublicHost(hostname: string) {
+  const addresses = await lookup(hostname.replace(/^\[|\]$/g, ""), { all: true });
+  for (const { address } of addresses) {
+    if (!isPublicAddress(address)) {
+      throw new Error(`${hostname} resolves to a non-public address`);
+    }
+  }
+}
+
+// Hostname of an ssh, https or scp-like git URL
+function gitUrlHostname(gitUrl: string) {
+  if (/^(ssh|https):\/\//.test(gitUrl)) {
+    return URL.canParse(gitUrl) ? new URL(gitUrl).hostname : "";
+  }
+  return gitUrl.split(":")[0]!.replace(/^[^@]*@/, "");
+}
+
+// Repository URLs of GitLab and Bitbucket projects, e.g. https://gitlab.com/group/subgroup/app.
+// Tokens are sent to them, so only https URLs of public hosts
+export const repositoryUrlSchema = z
+  .string()
+  .url()
+  .regex(
+    /^https:\/\/[^/@]+\/[^/]+\/.+$/,
+    "Repository URL must be an https URL with the repository path",
+  )
+  .refine((url) => URL.canParse(url) && !isPrivateHostname(new URL(url).hostname), {
+    message: "Repository host must be public",
+  });
+
+// Git URLs of projects with a git source: ssh, https or scp-like git@host:path. Other transports,
+// e.g. file://, would read from the server.
+export const gitUrlSchema = z
+  .string()
+  .regex(
+    /^(ssh:\/\/|https:\/\/|([A-Za-z0-9._-]+@)?[A-Za-z0-9.-]+:(?![:/]))\S+$/,
+    "Git URL must be an ssh or https URL",
+  )
+  .refine((url) => !isPrivateHostname(gitUrlHostname(url)), { message: "Git host must be public" });
+
+// Main composable for the source providers other than GitHub, see useGitHub for GitHub
+export function useSource() {
+  // Get the latest commit SHA of a branch
+  async function getLatestCommitSHA(project: Project, branch: string) {
+    try {
+      switch (project.sourceProvider) {
+        case "gitlab":
+          return { data: await gitlabLatestCommitSHA(project, branch), error: null };
+        case "bitbucket":
+          return { data: await bitbucketLatestCommitSHA(project, branch), error: null };
+        case "git":
+          return { data: await gitLatestCommitSHA(project, branch), error: null };
+        default:
+          return {
+            data: null,
+            error: new Error(`Unsupported source provider: ${project.sourceProvider}`),
+          };
+      }
+    } catch (error) {
+      return {
+        data: null,
+        error: error instanceof Error ? error : new Error(`Unknown error: ${error}`),
+      };
+    }
+  }
+
+  return {
+    branch: {
+      getLatestCommitSHA,
+    },
+  };
+}
+
+function repositoryPath(sourceUrl: string) {
+  const url = new URL(sourceUrl);
+  const path = url.pathname.replace(/^\/+|\/+$/g, "").replace(/\.git$/, "");
+  return { origin: url.origin, path };
+}
+
+function sourceToken(project: Project) {
+  return project.sourceToken ? decrypt(project.sourceToken) : "";
+}
+
+async function gitlabLatestCommitSHA(project: Project, branch: string): Promise<string> {
+  const { origin, path } = repositoryPath(project.sourceUrl);
+  await assertPublicHost(new URL(origin).hostname);
+  const token = sourceToken(project);
+  const response = await fetch(
+    `${origin}/api/v4/projects/${encodeURIComponent(path)}/repository/branches/${encodeURIComponent(branch)}`,
+    { headers: token ? { "PRIVATE-TOKEN": token } : {}, redirect: "error" },
+  );
+  if (!response.ok) {
+    throw new Error(`GitLab returned status ${response.status}`);
+  }
+  const data = (await response.json()) as { commit: { id: string } };
+  return data.commit.id;
+}
+
+async function bitbucketLatestCommitSHA(project: Project, branch: string): Promise<string> {
+  const { path } = repositoryPath(project.sourceUrl);
+  const token = sourceToken(project);
+  const response = await fetch(
+    `https://api.bitbucket.org/2.0/repositories/${path}/refs/branches/${encodeURIComponent(branch)}`,
+    { headers: token ? { Authorization: `Bearer ${token}` } : {} },
+  );
+  if (!response.ok) {
+    throw new Error(`Bitbucket returned status ${response.status}`);
+  }
+  const data = (await response.json()) as { target: { hash: string } };
+  return data.target.hash;
+}
+
+async function gitLatestCommitSHA(project: Project, branch: string): Promise<string> {
+  await assertPublicHost(gitUrlHostname(project.sourceUrl));
+  const dir = await mkdtemp(join(tmpdir(), "source-"));
+  try {
+    const env: NodeJS.ProcessEnv = { ...process.env, GIT_TERMINAL_PROMPT: "0" };
+    if (project.sourceDeployKey) {
+      const keyPath = join(dir, "deploy_key");
+      // ssh rejects keys without a final newline
+      await writeFile(keyPath, decrypt(project.sourceDeployKey).trim() + "\n", { mode: 0o600 });
+      env.GIT_SSH_COMMAND = [
+        `ssh -i ${keyPath} -o IdentitiesOnly=yes -o BatchMode=yes`,
+        `-o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=${join(dir, "known_hosts")}`,
+      ].join(" ");
+    }
+
+    const { stdout } = await promisify(execFile)(
+      "git",
+      [
+        ...["-c", "protocol.allow=never", "-c", "protocol.ssh.allow=always"],
+        ...["-c", "protocol.https.allow=always"],
+        ...["ls-remote", "--heads", "--", project.sourceUrl, `refs/heads/${branch}`],
+      ],
+      { env, timeout: 30_000 },
+    );
+    const sha = stdout.split(/\s+/)[0];
+    if (!sha) {
+      throw new Error(`Branch ${branch} not found`);
+    }
+    return sha;
+  } finally {
+    await rm(dir, { recursive: true, force: true });
+  }
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
-	"os"
 	"os/exec"
 	"strconv"
 	"sync"
@@ -89,7 +90,7 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 	cmd := &exec.Cmd{
 		Path: "/.zeitwork/busybox",
 		Args: append(nsenterArgs, req.Command...),
-		Env:  os.Environ(),
+		Env:  customerEnv,
 	}
 
 	if req.TTY {
@@ -261,3 +262,46 @@ func sendExecExit(conn *websocket.Conn, ctx context.Context, exitCode int) {
 	conn.Write(ctx, websocket.MessageText, data)
 	conn.Close(websocket.StatusNormalClosure, "")
 }
+
+// startDockerSocketProxy forwards connections on VSOCK port 1026 to the docker socket of the
+// customer app, so the host can drive a build VM's daemon without it listening on the network.
+func startDockerSocketProxy() {
+	lis, err := vsock.Listen(dockerPort, nil)
+	if err != nil {
+		slog.Error("failed to listen on docker VSOCK port", "port", dockerPort, "err", err)
+		return
+	}
+	defer lis.Close()
+
+	slog.Info("docker socket proxy listening", "port", dockerPort)
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			slog.Error("docker socket proxy accept failed", "err", err)
+			return
+		}
+		go proxyDockerSocket(conn)
+	}
+}
+
+func proxyDockerSocket(conn net.Conn) {
+	defer conn.Close()
+
+	// The daemon runs in the customer app's mount namespace, reach its socket through /proc
+	socketPath := fmt.Sprintf("/proc/%d/root/var/run/docker.sock", customerPID)
+	docker, err := net.Dial("unix", socketPath)
+	if err != nil {
+		slog.Debug("failed to connect to docker socket", "path", socketPath, "err", err)
+		return
+	}
+	defer docker.Close()
+
+	// Half-close towards the daemon when the host is done writing, and return once the
+	// daemon is done answering
+	go func() {
+		io.Copy(docker, conn)
+		docker.(*net.UnixConn).CloseWrite()
+	}()
+	io.Copy(conn, docker)
+}
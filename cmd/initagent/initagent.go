@@ -15,9 +15,10 @@ import (
 )
 
 const (
-	hostCID   = 2    // Well-known VSOCK CID for the host
-	agentPort = 1024 // VSOCK port for guest->host HTTP (config, logs)
-	execPort  = 1025 // VSOCK port the guest listens on for exec
+	hostCID    = 2    // Well-known VSOCK CID for the host
+	agentPort  = 1024 // VSOCK port for guest->host HTTP (config, logs)
+	execPort   = 1025 // VSOCK port the guest listens on for exec
+	dockerPort = 1026 // VSOCK port the guest exposes the docker socket on (build VMs)
 )
 
 // customerPID is the PID of the customer app in the root PID namespace.
@@ -29,6 +30,10 @@ var customerPID int
 var customerUID uint32
 var customerGID uint32
 
+// customerEnv is the environment of the customer app.
+// Used by exec so commands see the same env vars as the app.
+var customerEnv []string
+
 func checkErr(err error) {
 	if err != nil {
 		slog.Error("fatal error", "err", err)
@@ -73,6 +78,8 @@ func main() {
 		"ip_addr", configResp.IPAddr,
 		"ip_gw", configResp.IPGW,
 		"hostname", configResp.Hostname,
+		"idle", configResp.Idle,
+		"expose_docker_socket", configResp.ExposeDockerSocket,
 	)
 
 	// ── Phase 4: Setup system ──────────────────────────────────────────
@@ -111,6 +118,7 @@ func main() {
 	// Merge env: OCI image env + user env from host + ZEITWORK=1
 	env := append(ociConfig.Process.Env, configResp.Env...)
 	env = append(env, "ZEITWORK=1")
+	customerEnv = env
 
 	customerUID = ociConfig.Process.User.UID
 	customerGID = ociConfig.Process.User.GID
@@ -124,9 +132,18 @@ func main() {
 		ociConfig.Process.Cwd,
 		"--",
 	}
+	// Idle VMs only host exec sessions (e.g. release commands), keep a placeholder
+	// process around so they can join its namespaces.
+	args := ociConfig.Process.Args
+	if len(configResp.Command) > 0 {
+		args = configResp.Command
+	}
+	if configResp.Idle {
+		args = []string{"/.zeitwork/busybox", "sleep", "2147483647"}
+	}
 	cmd := &exec.Cmd{
 		Path: "/.zeitwork/initexec",
-		Args: append(initexecArgs, ociConfig.Process.Args...),
+		Args: append(initexecArgs, args...),
 		Env:  env,
 		SysProcAttr: &syscall.SysProcAttr{
 			Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWNS,
@@ -140,13 +157,16 @@ func main() {
 	cmd.Stderr = combined
 	cmd.Stdin = nil
 
-	slog.Info("starting customer app", "args", ociConfig.Process.Args, "cwd", ociConfig.Process.Cwd)
+	slog.Info("starting customer app", "args", args, "cwd", ociConfig.Process.Cwd)
 	checkErr(cmd.Start())
 	customerPID = cmd.Process.Pid
 	slog.Info("customer app started", "pid", customerPID)
 
 	// ── Phase 7: Start guest server (exec) ─────────────────────────────
 	go startGuestServer()
+	if configResp.ExposeDockerSocket {
+		go startDockerSocketProxy()
+	}
 
 	// ── Phase 8: Wait for child exit ───────────────────────────────────
 	waitErr := cmd.Wait()
@@ -166,6 +186,11 @@ func main() {
 
 	logWriter.Close()
 
+	// Idle VMs only exit when the host removes them
+	if !configResp.Idle {
+		reportExit(exitCode)
+	}
+
 	slog.Info("initagent exiting", "app_exit_code", exitCode)
 
 	syscall.Sync()
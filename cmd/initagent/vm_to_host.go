@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -42,6 +43,22 @@ func fetchConfig() rpc.ConfigResponse {
 	return config
 }
 
+// reportExit calls POST /exit on the host with the exit code of the customer app.
+func reportExit(exitCode int) {
+	body, err := json.Marshal(rpc.ExitRequest{ExitCode: exitCode})
+	if err != nil {
+		slog.Error("failed to marshal exit request", "err", err)
+		return
+	}
+
+	resp, err := vsockHTTPClient().Post("http://host/exit", "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("POST /exit failed", "err", err)
+		return
+	}
+	resp.Body.Close()
+}
+
 // startLogStream opens a long-lived POST /logs to the host and returns a writer.
 // Each line written is sent as a raw text line to the host.
 // Close the writer to end the stream.
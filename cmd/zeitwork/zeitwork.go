@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,6 +16,7 @@ import (
 	slogmulti "github.com/samber/slog-multi"
 	"github.com/zeitwork/zeitwork/internal/database"
 	"github.com/zeitwork/zeitwork/internal/edgeproxy"
+	"github.com/zeitwork/zeitwork/internal/registry"
 	"github.com/zeitwork/zeitwork/internal/telemetry"
 	"github.com/zeitwork/zeitwork/internal/zeitwork"
 )
@@ -24,13 +26,46 @@ type Config struct {
 	DatabaseURL            string `env:"DATABASE_URL,required"`        // PgBouncer pooled connection (for queries)
 	DatabaseDirectURL      string `env:"DATABASE_DIRECT_URL,required"` // Direct connection (for WAL replication)
 	InternalIP             string `env:"INTERNAL_IP,required"`         // This server's VLAN IP
-	DockerRegistryURL      string `env:"DOCKER_REGISTRY_URL,required"`
-	DockerRegistryUsername string `env:"DOCKER_REGISTRY_USERNAME,required"`
-	DockerRegistryPAT      string `env:"DOCKER_REGISTRY_PAT,required"` // GitHub PAT with write:packages scope
+	DockerRegistryURL      string `env:"DOCKER_REGISTRY_URL"`          // required without the embedded registry
+	DockerRegistryUsername string `env:"DOCKER_REGISTRY_USERNAME"`     // required without the embedded registry
+	DockerRegistryPAT      string `env:"DOCKER_REGISTRY_PAT,required"` // GitHub PAT with write:packages scope, or the embedded registry's password
+	DockerRegistryInsecure bool   `env:"DOCKER_REGISTRY_INSECURE"`     // plain HTTP, always for the embedded registry
 	GitHubAppID            string `env:"GITHUB_APP_ID"`
 	GitHubAppPrivateKey    string `env:"GITHUB_APP_PRIVATE_KEY"` // base64-encoded
+	GitKnownHosts          string `env:"GIT_KNOWN_HOSTS"`        // known_hosts file for git sources
 
-	// S3/MinIO for shared image storage (optional — only needed for multi-node)
+	// Credentials of other registries as JSON, e.g. {"registry.example.com": {"username": "...", "password": "..."}}
+	RegistryCredentials string `env:"REGISTRY_CREDENTIALS"`
+
+	// Embedded registry (optional — serves the cluster's images without an external registry,
+	// stored in S3 if S3_BUCKET is set and in REGISTRY_STORAGE_PATH otherwise). Single-node
+	// clusters only, it serves plain HTTP.
+	RegistryEmbedded    bool   `env:"REGISTRY_EMBEDDED" envDefault:"false"`
+	RegistryAddr        string `env:"REGISTRY_ADDR" envDefault:":5000"`
+	RegistryStoragePath string `env:"REGISTRY_STORAGE_PATH" envDefault:"/data/registry"`
+
+	// How long a new deployment may take to become healthy before it is marked failed
+	DeploymentStartupTimeout time.Duration `env:"DEPLOYMENT_STARTUP_TIMEOUT" envDefault:"5m"`
+
+	// How long a replaced or stopped VM may finish in-flight requests before it is deleted
+	DeploymentDrainTimeout time.Duration `env:"DEPLOYMENT_DRAIN_TIMEOUT" envDefault:"30s"`
+
+	// How many builds may run at once in the cluster, and for a single organisation
+	BuildConcurrency             int `env:"BUILD_CONCURRENCY" envDefault:"4"`
+	BuildOrganisationConcurrency int `env:"BUILD_ORGANISATION_CONCURRENCY" envDefault:"2"`
+
+	// Cloud Native Buildpacks builder image for projects in buildpacks mode without their own builder
+	BuildpackBuilder string `env:"BUILDPACK_BUILDER" envDefault:"paketobuildpacks/builder-jammy-base"`
+
+	// OCI repository of the vulnerability database for image scans (optional — defaults to the scanner's)
+	VulnerabilityDBRepository string `env:"VULNERABILITY_DB_REPOSITORY"`
+
+	// Image signing (optional — without keys, images are neither signed nor verified)
+	ImageSigningKey        string `env:"IMAGE_SIGNING_KEY"`
+	ImageSigningPassphrase string `env:"IMAGE_SIGNING_PASSPHRASE"`
+	ImageVerificationKey   string `env:"IMAGE_VERIFICATION_KEY"`
+
+	// S3/MinIO for shared image storage of the embedded registry (optional — only needed for multi-node)
 	S3Endpoint  string `env:"S3_ENDPOINT"`
 	S3Bucket    string `env:"S3_BUCKET"`
 	S3AccessKey string `env:"S3_ACCESS_KEY"`
@@ -93,21 +128,84 @@ func main() {
 		panic("failed to init database: " + err.Error())
 	}
 
+	registryCredentials, err := registry.ParseAuth(cfg.RegistryCredentials)
+	if err != nil {
+		panic("failed to parse config: " + err.Error())
+	}
+
+	// Embedded registry, served at the cluster-wide DOCKER_REGISTRY_URL
+	var registryServer *registry.Server
+	if cfg.RegistryEmbedded {
+		if cfg.DockerRegistryUsername == "" {
+			cfg.DockerRegistryUsername = "zeitwork"
+		}
+		// Every node pushes to and pulls from the same address, images built on one node boot on all
+		if cfg.DockerRegistryURL == "" {
+			panic("failed to parse config: DOCKER_REGISTRY_URL is required with REGISTRY_EMBEDDED, set it to an address every node reaches the registry at")
+		}
+		// The registry serves plain HTTP with the cluster's password, which must not cross the
+		// network to other nodes. Only this node and its build VMs may use it.
+		host := registry.URLHost(cfg.DockerRegistryURL)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host != cfg.InternalIP {
+			panic("failed to parse config: REGISTRY_EMBEDDED serves plain HTTP and is for single-node clusters, point DOCKER_REGISTRY_URL at this node's INTERNAL_IP or use an external registry")
+		}
+		cfg.DockerRegistryInsecure = true
+
+		registryServer, err = registry.NewServer(ctx, registry.ServerConfig{
+			Addr:          cfg.RegistryAddr,
+			RootDirectory: cfg.RegistryStoragePath,
+			S3Endpoint:    cfg.S3Endpoint,
+			S3Bucket:      cfg.S3Bucket,
+			S3AccessKey:   cfg.S3AccessKey,
+			S3SecretKey:   cfg.S3SecretKey,
+			S3UseSSL:      cfg.S3UseSSL,
+			Username:      cfg.DockerRegistryUsername,
+			Password:      cfg.DockerRegistryPAT,
+		})
+		if err != nil {
+			panic("failed to create embedded registry: " + err.Error())
+		}
+		go func() {
+			if err := registryServer.Start(); err != nil {
+				slog.Error("embedded registry error", "err", err)
+			}
+		}()
+	}
+	if cfg.DockerRegistryURL == "" || cfg.DockerRegistryUsername == "" {
+		panic("failed to parse config: DOCKER_REGISTRY_URL and DOCKER_REGISTRY_USERNAME are required without REGISTRY_EMBEDDED")
+	}
+
 	// Route change notification channel (shared between zeitwork service and edge proxy)
 	routeChangeNotify := make(chan struct{}, 1)
 
 	service, err := zeitwork.New(zeitwork.Config{
-		DB:                     db,
-		IPAdress:               cfg.IPAdress,
-		DatabaseDirectURL:      cfg.DatabaseDirectURL,
-		InternalIP:             cfg.InternalIP,
-		ServerID:               serverID,
-		RouteChangeNotify:      routeChangeNotify,
-		DockerRegistryURL:      cfg.DockerRegistryURL,
-		DockerRegistryUsername: cfg.DockerRegistryUsername,
-		DockerRegistryPAT:      cfg.DockerRegistryPAT,
-		GitHubAppID:            cfg.GitHubAppID,
-		GitHubAppPrivateKey:    cfg.GitHubAppPrivateKey,
+		DB:                           db,
+		IPAdress:                     cfg.IPAdress,
+		DatabaseDirectURL:            cfg.DatabaseDirectURL,
+		InternalIP:                   cfg.InternalIP,
+		ServerID:                     serverID,
+		RouteChangeNotify:            routeChangeNotify,
+		DockerRegistryURL:            cfg.DockerRegistryURL,
+		DockerRegistryUsername:       cfg.DockerRegistryUsername,
+		DockerRegistryPAT:            cfg.DockerRegistryPAT,
+		DockerRegistryInsecure:       cfg.DockerRegistryInsecure,
+		DockerRegistryEmbedded:       cfg.RegistryEmbedded,
+		RegistryCredentials:          registryCredentials,
+		GitHubAppID:                  cfg.GitHubAppID,
+		GitHubAppPrivateKey:          cfg.GitHubAppPrivateKey,
+		GitKnownHosts:                cfg.GitKnownHosts,
+		DeploymentStartupTimeout:     cfg.DeploymentStartupTimeout,
+		DeploymentDrainTimeout:       cfg.DeploymentDrainTimeout,
+		BuildConcurrency:             cfg.BuildConcurrency,
+		BuildOrganisationConcurrency: cfg.BuildOrganisationConcurrency,
+		BuildpackBuilder:             cfg.BuildpackBuilder,
+		VulnerabilityDBRepository:    cfg.VulnerabilityDBRepository,
+		ImageSigningKey:              cfg.ImageSigningKey,
+		ImageSigningPassphrase:       cfg.ImageSigningPassphrase,
+		ImageVerificationKey:         cfg.ImageVerificationKey,
 	})
 	if err != nil {
 		panic(err)
@@ -127,6 +225,7 @@ func main() {
 		ACMEEmail:         cfg.EdgeProxyACMEEmail,
 		ACMEStaging:       cfg.EdgeProxyACMEStaging,
 		DB:                db,
+		ServerID:          serverID,
 		RouteChangeNotify: routeChangeNotify,
 	}, logger)
 	if err != nil {
@@ -155,5 +254,10 @@ func main() {
 			slog.Error("edge proxy shutdown error", "err", err)
 		}
 	}
+	if registryServer != nil {
+		if err := registryServer.Stop(shutdownCtx); err != nil {
+			slog.Error("embedded registry shutdown error", "err", err)
+		}
+	}
 	service.Stop()
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/zeitwork/zeitwork/internal/zeitwork"
+)
+
+// cmdDeploy uploads a directory as the source of a new deployment of a project's environment,
+// e.g. for hotfixes without a commit. The upload goes through the dashboard's API with an API
+// token, and the deployment is built and rolled out like deployments of commits.
+func cmdDeploy(args []string) int {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	projectSlug := fs.String("project", "", "slug of the project to deploy")
+	environmentSlug := fs.String("environment", "production", "slug of the environment to deploy to")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *projectSlug == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: zeitworkctl deploy -project <project> [-environment <slug>] [path]")
+		return 1
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	apiURL := strings.TrimSuffix(os.Getenv("ZEITWORK_URL"), "/")
+	token := os.Getenv("ZEITWORK_TOKEN")
+	if apiURL == "" || token == "" {
+		fmt.Fprintln(os.Stderr, "ZEITWORK_URL (the dashboard's URL) and ZEITWORK_TOKEN (an API token) are required")
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	tarball, err := archiveDirectory(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to archive %s: %v\n", dir, err)
+		return 1
+	}
+	if len(tarball) > zeitwork.MaxSourceUploadSize {
+		fmt.Fprintf(os.Stderr, "%s is %d MB compressed, the limit is %d MB. Exclude files with a .dockerignore\n",
+			dir, len(tarball)>>20, zeitwork.MaxSourceUploadSize>>20)
+		return 1
+	}
+
+	deploymentID, err := uploadDeployment(ctx, apiURL, token, *projectSlug, *environmentSlug, tarball)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Uploaded %s (%d KB), created deployment %s of %s in %s\n",
+		dir, len(tarball)>>10, deploymentID, *projectSlug, *environmentSlug)
+	return 0
+}
+
+// uploadDeployment posts a tarball to the dashboard's uploads API, which stores it and creates
+// the deployment. Returns the deployment's ID.
+func uploadDeployment(ctx context.Context, apiURL, token, projectSlug, environmentSlug string, tarball []byte) (string, error) {
+	endpoint := fmt.Sprintf("%s/api/projects/%s/uploads?environment=%s",
+		apiURL, url.PathEscape(projectSlug), url.QueryEscape(environmentSlug))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(tarball))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if body.Message != "" {
+			return "", fmt.Errorf("upload failed: %s", body.Message)
+		}
+		return "", fmt.Errorf("upload failed with status %d", resp.StatusCode)
+	}
+	return body.ID, nil
+}
+
+// archiveDirectory creates a gzip tarball of a directory, without the files its .dockerignore
+// excludes. Entries are placed in a top-level source/ directory, the layout of the tarballs of
+// source providers.
+func archiveDirectory(dir string) ([]byte, error) {
+	var patterns []string
+	if f, err := os.Open(filepath.Join(dir, ".dockerignore")); err == nil {
+		patterns, err = ignorefile.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return tw.WriteHeader(&tar.Header{Name: "source/", Typeflag: tar.TypeDir, Mode: 0755})
+		}
+
+		excluded, err := matcher.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		}
+		if excluded {
+			// Exclusions with ! patterns may re-include files inside an excluded directory
+			if d.IsDir() && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil // sockets, devices and pipes can't be built
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = "source/" + rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		// The build doesn't depend on who owns the files locally
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(tw, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestArchiveDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".dockerignore":         "node_modules\n*.log\n.env\n!keep.log\n",
+		"Dockerfile":            "FROM scratch\n",
+		"src/main.go":           "package main\n",
+		"debug.log":             "noise",
+		"keep.log":              "kept",
+		".env":                  "SECRET=1",
+		"node_modules/x/pkg.js": "ignored",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tarball, err := archiveDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+
+	want := []string{
+		"source/",
+		"source/.dockerignore",
+		"source/Dockerfile",
+		"source/keep.log",
+		"source/src/",
+		"source/src/main.go",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+}
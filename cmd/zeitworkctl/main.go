@@ -33,6 +33,10 @@ func main() {
 	switch os.Args[1] {
 	case "exec":
 		os.Exit(cmdExec(os.Args[2:]))
+	case "run":
+		os.Exit(cmdRun(os.Args[2:]))
+	case "deploy":
+		os.Exit(cmdDeploy(os.Args[2:]))
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
 		usage()
@@ -45,6 +49,11 @@ func usage() {
 
 Commands:
   exec <vm-id> -- <command...>    Execute a command inside a VM
+  run <project> -- <command...>   Run a one-off command in a temporary VM from a project's deployment
+  deploy -project <project> [path]
+                                  Deploy a directory, honouring its .dockerignore, without a commit.
+                                  Uploads to the dashboard at $ZEITWORK_URL with the API token
+                                  in $ZEITWORK_TOKEN
 `)
 }
 
@@ -72,9 +81,6 @@ func cmdExec(args []string) int {
 		command = []string{"/bin/sh"}
 	}
 
-	stdinFd := int(os.Stdin.Fd())
-	isTTY := term.IsTerminal(stdinFd)
-
 	// Connect directly to the VM via VSOCK
 	rawConn, err := zeitwork.DialGuest(vmID, execPort)
 	if err != nil {
@@ -83,7 +89,16 @@ func cmdExec(args []string) int {
 	}
 	defer rawConn.Close()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	return execSession(context.Background(), rawConn, command)
+}
+
+// execSession runs a command over an exec connection to a guest, attached to the local
+// terminal, and returns its exit code.
+func execSession(ctx context.Context, rawConn net.Conn, command []string) int {
+	stdinFd := int(os.Stdin.Fd())
+	isTTY := term.IsTerminal(stdinFd)
+
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// WebSocket upgrade over the raw VSOCK connection.
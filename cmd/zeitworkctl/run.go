@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/zeitwork/zeitwork/internal/database"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+	"github.com/zeitwork/zeitwork/internal/zeitwork"
+)
+
+// runBootTimeout is how long the temporary VM may take to accept exec sessions.
+const runBootTimeout = 2 * time.Minute
+
+// cmdRun runs a one-off command in a temporary VM from the image of a project's running
+// deployment, with the environment variables of its environment. The VM is created on this
+// server, since exec sessions are dialed through the local VSOCK socket, and deleted on exit.
+func cmdRun(args []string) int {
+	// Split off the command after "--"
+	var command []string
+	for i, a := range args {
+		if a == "--" {
+			command = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+	if len(command) == 0 {
+		command = []string{"/bin/sh"}
+	}
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	environmentSlug := fs.String("environment", "production", "slug of the environment whose deployment to run")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: zeitworkctl run [-environment <slug>] <project> [-- <command...>]")
+		return 1
+	}
+
+	// Same configuration as the zeitwork daemon on this node
+	_ = godotenv.Load("/data/zeitwork.env")
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	db, err := database.New(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	serverID, err := zeitwork.LoadServerID()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load server ID: %v\n", err)
+		return 1
+	}
+
+	deployment, err := findRunDeployment(ctx, db, fs.Arg(0), *environmentSlug)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	vm, err := zeitwork.RunVMCreate(ctx, db, serverID, deployment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create VM: %v\n", err)
+		return 1
+	}
+	defer func() {
+		// The session context may already be cancelled
+		if err := db.VMSoftDelete(context.Background(), vm.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete VM %s: %v\n", vm.ID, err)
+		}
+	}()
+
+	go extendRunVM(ctx, db, vm.ID)
+
+	fmt.Fprintf(os.Stderr, "Starting VM %s from deployment %s...\n", vm.ID, deployment.ID)
+
+	rawConn, err := waitForRunVM(ctx, db, vm.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer rawConn.Close()
+
+	return execSession(ctx, rawConn, command)
+}
+
+// findProject resolves a project by ID or slug.
+func findProject(ctx context.Context, db *database.DB, projectRef string) (queries.Project, error) {
+	if id, err := uuid.Parse(projectRef); err == nil {
+		project, err := db.ProjectFirstByID(ctx, id)
+		if err != nil {
+			return queries.Project{}, fmt.Errorf("failed to find project %s: %w", projectRef, err)
+		}
+		return project, nil
+	}
+
+	projects, err := db.ProjectFindBySlug(ctx, projectRef)
+	if err != nil {
+		return queries.Project{}, fmt.Errorf("failed to find project %s: %w", projectRef, err)
+	}
+	switch len(projects) {
+	case 0:
+		return queries.Project{}, fmt.Errorf("project %s not found", projectRef)
+	case 1:
+		return projects[0], nil
+	default:
+		return queries.Project{}, fmt.Errorf("project slug %s is used by %d organisations, pass the project ID instead", projectRef, len(projects))
+	}
+}
+
+// findRunDeployment resolves a project by ID or slug and returns the running deployment of
+// one of its environments.
+func findRunDeployment(ctx context.Context, db *database.DB, projectRef, environmentSlug string) (queries.Deployment, error) {
+	project, err := findProject(ctx, db, projectRef)
+	if err != nil {
+		return queries.Deployment{}, err
+	}
+
+	environment, err := db.EnvironmentFirstByProjectIDAndSlug(ctx, queries.EnvironmentFirstByProjectIDAndSlugParams{
+		ProjectID: project.ID,
+		Slug:      environmentSlug,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queries.Deployment{}, fmt.Errorf("environment %s not found in project %s", environmentSlug, project.Slug)
+	}
+	if err != nil {
+		return queries.Deployment{}, fmt.Errorf("failed to find environment: %w", err)
+	}
+
+	deployment, err := db.DeploymentLatestRunningByEnvironmentID(ctx, environment.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return queries.Deployment{}, fmt.Errorf("no running deployment in environment %s of project %s", environmentSlug, project.Slug)
+	}
+	if err != nil {
+		return queries.Deployment{}, fmt.Errorf("failed to find running deployment: %w", err)
+	}
+	return deployment, nil
+}
+
+// extendRunVM keeps the VM from expiring until the session ends.
+func extendRunVM(ctx context.Context, db *database.DB, vmID uuid.UUID) {
+	ticker := time.NewTicker(zeitwork.RunVMLease / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := zeitwork.RunVMExtend(ctx, db, vmID); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "failed to extend VM %s: %v\n", vmID, err)
+			}
+		}
+	}
+}
+
+// waitForRunVM waits until the zeitwork daemon has booted the VM and its guest accepts exec
+// connections.
+func waitForRunVM(ctx context.Context, db *database.DB, vmID uuid.UUID) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, runBootTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("VM did not become reachable: %w", ctx.Err())
+		case <-ticker.C:
+		}
+
+		vm, err := db.VMFirstByID(ctx, vmID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find VM: %w", err)
+		}
+		if vm.DeletedAt.Valid {
+			return nil, fmt.Errorf("VM was deleted")
+		}
+		if vm.Status == queries.VmStatusFailed {
+			return nil, fmt.Errorf("VM failed to start")
+		}
+		if vm.Status != queries.VmStatusRunning {
+			continue
+		}
+
+		// The guest may still be booting
+		conn, err := zeitwork.DialGuest(vmID, execPort)
+		if err == nil {
+			return conn, nil
+		}
+	}
+}
@@ -1,2 +1,5 @@
 #!/bin/sh
-dockerd --host=unix:///var/run/docker.sock --host=tcp://0.0.0.0:2375
+# The daemon only listens on its unix socket, which the VM's init agent exposes to the host over
+# VSOCK. It uses the containerd image store, which BuildKit needs to push images and export
+# registry caches. See /etc/docker/daemon.json
+dockerd --config-file /etc/docker/daemon.json
@@ -8,21 +8,82 @@ package queries
 import (
 	"context"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
+const buildCancelSuperseded = `-- name: BuildCancelSuperseded :many
+UPDATE builds
+SET status = 'cancelled', cancelled_at = now()
+WHERE project_id = $1
+  AND github_branch = $2
+  AND id < $3
+  AND status IN ('pending', 'building')
+  AND deleted_at IS NULL
+RETURNING id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
+`
+
+type BuildCancelSupersededParams struct {
+	ProjectID    uuid.UUID `json:"project_id"`
+	GithubBranch string    `json:"github_branch"`
+	ID           uuid.UUID `json:"id"`
+}
+
+// Cancel the in-flight builds of a project branch that were created before the given build
+func (q *Queries) BuildCancelSuperseded(ctx context.Context, arg BuildCancelSupersededParams) ([]Build, error) {
+	rows, err := q.db.Query(ctx, buildCancelSuperseded, arg.ProjectID, arg.GithubBranch, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Build{}
+	for rows.Next() {
+		var i Build
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.ProjectID,
+			&i.GithubCommit,
+			&i.GithubBranch,
+			&i.ImageID,
+			&i.VmID,
+			&i.PendingAt,
+			&i.BuildingAt,
+			&i.SuccessfulAt,
+			&i.FailedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.ProcessingBy,
+			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const buildClaimLease = `-- name: BuildClaimLease :one
 UPDATE builds
 SET processing_by = $2, processing_started_at = now()
 WHERE id = $1
-  AND status IN ('pending', 'building')
+  AND status IN ('pending', 'building', 'cancelled')
   AND deleted_at IS NULL
   AND (
     processing_by IS NULL
         OR processing_by = $2
         OR processing_started_at < now() - interval '30 minutes'
     )
-RETURNING id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at
+RETURNING id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
 `
 
 type BuildClaimLeaseParams struct {
@@ -31,8 +92,8 @@ type BuildClaimLeaseParams struct {
 }
 
 // Atomically claim a build lease for processing on a server.
-// Succeeds if the build is pending/building and either unclaimed, already
-// claimed by this server, or the previous lease is stale.
+// Succeeds if the build is pending/building (or cancelled, to release its VM) and
+// either unclaimed, already claimed by this server, or the previous lease is stale.
 func (q *Queries) BuildClaimLease(ctx context.Context, arg BuildClaimLeaseParams) (Build, error) {
 	row := q.db.QueryRow(ctx, buildClaimLease, arg.ID, arg.ProcessingBy)
 	var i Build
@@ -54,10 +115,47 @@ func (q *Queries) BuildClaimLease(ctx context.Context, arg BuildClaimLeaseParams
 		&i.DeletedAt,
 		&i.ProcessingBy,
 		&i.ProcessingStartedAt,
+		&i.Priority,
+		&i.QueuePosition,
+		&i.CancelledAt,
+		&i.SourceUploadID,
 	)
 	return i, err
 }
 
+const buildCountBuildingByOrganisation = `-- name: BuildCountBuildingByOrganisation :many
+SELECT organisation_id, count(*)::integer AS builds
+FROM builds
+WHERE status = 'building'
+  AND deleted_at IS NULL
+GROUP BY organisation_id
+`
+
+type BuildCountBuildingByOrganisationRow struct {
+	OrganisationID uuid.UUID `json:"organisation_id"`
+	Builds         int32     `json:"builds"`
+}
+
+func (q *Queries) BuildCountBuildingByOrganisation(ctx context.Context) ([]BuildCountBuildingByOrganisationRow, error) {
+	rows, err := q.db.Query(ctx, buildCountBuildingByOrganisation)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []BuildCountBuildingByOrganisationRow{}
+	for rows.Next() {
+		var i BuildCountBuildingByOrganisationRow
+		if err := rows.Scan(&i.OrganisationID, &i.Builds); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const buildCreate = `-- name: BuildCreate :one
 INSERT INTO builds (
     id,
@@ -65,12 +163,14 @@ INSERT INTO builds (
     project_id,
     github_commit,
     github_branch,
+    priority,
     organisation_id,
+    source_upload_id,
     created_at,
     updated_at
 )
-VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
-RETURNING id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+RETURNING id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
 `
 
 type BuildCreateParams struct {
@@ -79,7 +179,9 @@ type BuildCreateParams struct {
 	ProjectID      uuid.UUID   `json:"project_id"`
 	GithubCommit   string      `json:"github_commit"`
 	GithubBranch   string      `json:"github_branch"`
+	Priority       int32       `json:"priority"`
 	OrganisationID uuid.UUID   `json:"organisation_id"`
+	SourceUploadID uuid.UUID   `json:"source_upload_id"`
 }
 
 func (q *Queries) BuildCreate(ctx context.Context, arg BuildCreateParams) (Build, error) {
@@ -89,7 +191,9 @@ func (q *Queries) BuildCreate(ctx context.Context, arg BuildCreateParams) (Build
 		arg.ProjectID,
 		arg.GithubCommit,
 		arg.GithubBranch,
+		arg.Priority,
 		arg.OrganisationID,
+		arg.SourceUploadID,
 	)
 	var i Build
 	err := row.Scan(
@@ -110,12 +214,37 @@ func (q *Queries) BuildCreate(ctx context.Context, arg BuildCreateParams) (Build
 		&i.DeletedAt,
 		&i.ProcessingBy,
 		&i.ProcessingStartedAt,
+		&i.Priority,
+		&i.QueuePosition,
+		&i.CancelledAt,
+		&i.SourceUploadID,
 	)
 	return i, err
 }
 
+const buildExistsByImageIDAndOrganisationID = `-- name: BuildExistsByImageIDAndOrganisationID :one
+SELECT EXISTS (
+    SELECT 1 FROM builds
+    WHERE image_id = $1
+      AND organisation_id = $2
+)::boolean
+`
+
+type BuildExistsByImageIDAndOrganisationIDParams struct {
+	ImageID        uuid.UUID `json:"image_id"`
+	OrganisationID uuid.UUID `json:"organisation_id"`
+}
+
+// Whether the cluster built an image for an organisation
+func (q *Queries) BuildExistsByImageIDAndOrganisationID(ctx context.Context, arg BuildExistsByImageIDAndOrganisationIDParams) (bool, error) {
+	row := q.db.QueryRow(ctx, buildExistsByImageIDAndOrganisationID, arg.ImageID, arg.OrganisationID)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const buildFind = `-- name: BuildFind :many
-SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
 FROM builds
 `
 
@@ -146,6 +275,10 @@ func (q *Queries) BuildFind(ctx context.Context) ([]Build, error) {
 			&i.DeletedAt,
 			&i.ProcessingBy,
 			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
 		); err != nil {
 			return nil, err
 		}
@@ -158,7 +291,7 @@ func (q *Queries) BuildFind(ctx context.Context) ([]Build, error) {
 }
 
 const buildFindByVMID = `-- name: BuildFindByVMID :many
-SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at FROM builds WHERE vm_id = $1
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id FROM builds WHERE vm_id = $1
 `
 
 func (q *Queries) BuildFindByVMID(ctx context.Context, vmID uuid.UUID) ([]Build, error) {
@@ -188,6 +321,113 @@ func (q *Queries) BuildFindByVMID(ctx context.Context, vmID uuid.UUID) ([]Build,
 			&i.DeletedAt,
 			&i.ProcessingBy,
 			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const buildFindQueued = `-- name: BuildFindQueued :many
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
+FROM builds
+WHERE status = 'pending'
+  AND deleted_at IS NULL
+ORDER BY priority DESC, id
+`
+
+// Pending builds in queue order: higher priority first, then first in first out
+func (q *Queries) BuildFindQueued(ctx context.Context) ([]Build, error) {
+	rows, err := q.db.Query(ctx, buildFindQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Build{}
+	for rows.Next() {
+		var i Build
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.ProjectID,
+			&i.GithubCommit,
+			&i.GithubBranch,
+			&i.ImageID,
+			&i.VmID,
+			&i.PendingAt,
+			&i.BuildingAt,
+			&i.SuccessfulAt,
+			&i.FailedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.ProcessingBy,
+			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const buildFindRunningByServerID = `-- name: BuildFindRunningByServerID :many
+SELECT b.id, b.status, b.project_id, b.github_commit, b.github_branch, b.image_id, b.vm_id, b.pending_at, b.building_at, b.successful_at, b.failed_at, b.organisation_id, b.created_at, b.updated_at, b.deleted_at, b.processing_by, b.processing_started_at, b.priority, b.queue_position, b.cancelled_at, b.source_upload_id FROM builds b
+JOIN vms v ON v.id = b.vm_id
+WHERE v.server_id = $1
+  AND v.deleted_at IS NULL
+  AND b.status IN ('pending', 'building', 'cancelled')
+  AND b.deleted_at IS NULL
+`
+
+// Builds with a VM on a server, which runs them
+func (q *Queries) BuildFindRunningByServerID(ctx context.Context, serverID uuid.UUID) ([]Build, error) {
+	rows, err := q.db.Query(ctx, buildFindRunningByServerID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Build{}
+	for rows.Next() {
+		var i Build
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.ProjectID,
+			&i.GithubCommit,
+			&i.GithubBranch,
+			&i.ImageID,
+			&i.VmID,
+			&i.PendingAt,
+			&i.BuildingAt,
+			&i.SuccessfulAt,
+			&i.FailedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.ProcessingBy,
+			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
 		); err != nil {
 			return nil, err
 		}
@@ -200,7 +440,7 @@ func (q *Queries) BuildFindByVMID(ctx context.Context, vmID uuid.UUID) ([]Build,
 }
 
 const buildFindWaitingForBuildImage = `-- name: BuildFindWaitingForBuildImage :many
-SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at FROM builds 
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id FROM builds 
 WHERE status IN ('pending', 'building') 
   AND image_id IS NULL 
   AND deleted_at IS NULL
@@ -233,6 +473,10 @@ func (q *Queries) BuildFindWaitingForBuildImage(ctx context.Context) ([]Build, e
 			&i.DeletedAt,
 			&i.ProcessingBy,
 			&i.ProcessingStartedAt,
+			&i.Priority,
+			&i.QueuePosition,
+			&i.CancelledAt,
+			&i.SourceUploadID,
 		); err != nil {
 			return nil, err
 		}
@@ -245,7 +489,7 @@ func (q *Queries) BuildFindWaitingForBuildImage(ctx context.Context) ([]Build, e
 }
 
 const buildFirstByID = `-- name: BuildFirstByID :one
-SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
 FROM builds
 WHERE id = $1
 LIMIT 1
@@ -272,12 +516,16 @@ func (q *Queries) BuildFirstByID(ctx context.Context, id uuid.UUID) (Build, erro
 		&i.DeletedAt,
 		&i.ProcessingBy,
 		&i.ProcessingStartedAt,
+		&i.Priority,
+		&i.QueuePosition,
+		&i.CancelledAt,
+		&i.SourceUploadID,
 	)
 	return i, err
 }
 
 const buildFirstPending = `-- name: BuildFirstPending :one
-SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at
+SELECT id, status, project_id, github_commit, github_branch, image_id, vm_id, pending_at, building_at, successful_at, failed_at, organisation_id, created_at, updated_at, deleted_at, processing_by, processing_started_at, priority, queue_position, cancelled_at, source_upload_id
 FROM builds WHERE status = 'pending'
 ORDER BY id DESC
 LIMIT 1
@@ -304,6 +552,10 @@ func (q *Queries) BuildFirstPending(ctx context.Context) (Build, error) {
 		&i.DeletedAt,
 		&i.ProcessingBy,
 		&i.ProcessingStartedAt,
+		&i.Priority,
+		&i.QueuePosition,
+		&i.CancelledAt,
+		&i.SourceUploadID,
 	)
 	return i, err
 }
@@ -336,6 +588,7 @@ const buildMarkBuilding = `-- name: BuildMarkBuilding :exec
 UPDATE builds
 SET status = 'building', building_at = now(), vm_id = $2
 WHERE id = $1
+  AND status = 'pending'
 `
 
 type BuildMarkBuildingParams struct {
@@ -352,6 +605,7 @@ const buildMarkFailed = `-- name: BuildMarkFailed :exec
 UPDATE builds
 SET status = 'failed', failed_at = now()
 WHERE id = $1
+  AND status IN ('pending', 'building')
 `
 
 func (q *Queries) BuildMarkFailed(ctx context.Context, id uuid.UUID) error {
@@ -363,6 +617,7 @@ const buildMarkSuccessful = `-- name: BuildMarkSuccessful :exec
 UPDATE builds
 SET status = 'succesful', successful_at = now(), image_id = $2
 WHERE id = $1
+  AND status IN ('pending', 'building')
 `
 
 type BuildMarkSuccessfulParams struct {
@@ -370,6 +625,7 @@ type BuildMarkSuccessfulParams struct {
 	ImageID uuid.UUID `json:"image_id"`
 }
 
+// A cancelled build stays cancelled
 func (q *Queries) BuildMarkSuccessful(ctx context.Context, arg BuildMarkSuccessfulParams) error {
 	_, err := q.db.Exec(ctx, buildMarkSuccessful, arg.ID, arg.ImageID)
 	return err
@@ -392,3 +648,71 @@ func (q *Queries) BuildReleaseLease(ctx context.Context, arg BuildReleaseLeasePa
 	_, err := q.db.Exec(ctx, buildReleaseLease, arg.ID, arg.ProcessingBy)
 	return err
 }
+
+const buildResetPending = `-- name: BuildResetPending :exec
+UPDATE builds
+SET status = 'pending', building_at = NULL, vm_id = NULL
+WHERE id = $1
+  AND status IN ('pending', 'building')
+`
+
+// Start a build over on a new VM, e.g. after the server of its VM went away
+func (q *Queries) BuildResetPending(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, buildResetPending, id)
+	return err
+}
+
+const buildStepUpsert = `-- name: BuildStepUpsert :exec
+INSERT INTO build_steps (id, build_id, vertex, number, name, cached, error, started_at, completed_at, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+ON CONFLICT (build_id, vertex) DO UPDATE SET
+    cached = EXCLUDED.cached,
+    error = EXCLUDED.error,
+    started_at = COALESCE(EXCLUDED.started_at, build_steps.started_at),
+    completed_at = COALESCE(EXCLUDED.completed_at, build_steps.completed_at)
+`
+
+type BuildStepUpsertParams struct {
+	ID             uuid.UUID          `json:"id"`
+	BuildID        uuid.UUID          `json:"build_id"`
+	Vertex         string             `json:"vertex"`
+	Number         int32              `json:"number"`
+	Name           string             `json:"name"`
+	Cached         bool               `json:"cached"`
+	Error          string             `json:"error"`
+	StartedAt      pgtype.Timestamptz `json:"started_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+}
+
+func (q *Queries) BuildStepUpsert(ctx context.Context, arg BuildStepUpsertParams) error {
+	_, err := q.db.Exec(ctx, buildStepUpsert,
+		arg.ID,
+		arg.BuildID,
+		arg.Vertex,
+		arg.Number,
+		arg.Name,
+		arg.Cached,
+		arg.Error,
+		arg.StartedAt,
+		arg.CompletedAt,
+		arg.OrganisationID,
+	)
+	return err
+}
+
+const buildUpdateQueuePosition = `-- name: BuildUpdateQueuePosition :exec
+UPDATE builds
+SET queue_position = $2
+WHERE id = $1
+`
+
+type BuildUpdateQueuePositionParams struct {
+	ID            uuid.UUID   `json:"id"`
+	QueuePosition pgtype.Int4 `json:"queue_position"`
+}
+
+func (q *Queries) BuildUpdateQueuePosition(ctx context.Context, arg BuildUpdateQueuePositionParams) error {
+	_, err := q.db.Exec(ctx, buildUpdateQueuePosition, arg.ID, arg.QueuePosition)
+	return err
+}
@@ -0,0 +1,44 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: build_variable.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const buildVariableFindByProjectID = `-- name: BuildVariableFindByProjectID :many
+SELECT name, value, secret FROM build_variables
+WHERE project_id = $1 AND deleted_at IS NULL
+ORDER BY name
+`
+
+type BuildVariableFindByProjectIDRow struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+}
+
+func (q *Queries) BuildVariableFindByProjectID(ctx context.Context, projectID uuid.UUID) ([]BuildVariableFindByProjectIDRow, error) {
+	rows, err := q.db.Query(ctx, buildVariableFindByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []BuildVariableFindByProjectIDRow{}
+	for rows.Next() {
+		var i BuildVariableFindByProjectIDRow
+		if err := rows.Scan(&i.Name, &i.Value, &i.Secret); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
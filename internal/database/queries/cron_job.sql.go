@@ -0,0 +1,363 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: cron_job.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const cronJobFindActive = `-- name: CronJobFindActive :many
+SELECT id, name, schedule, command, timeout, project_id, environment_id, next_run_at, organisation_id, created_at, updated_at, deleted_at
+FROM cron_jobs
+WHERE deleted_at IS NULL
+`
+
+func (q *Queries) CronJobFindActive(ctx context.Context) ([]CronJob, error) {
+	rows, err := q.db.Query(ctx, cronJobFindActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CronJob{}
+	for rows.Next() {
+		var i CronJob
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Schedule,
+			&i.Command,
+			&i.Timeout,
+			&i.ProjectID,
+			&i.EnvironmentID,
+			&i.NextRunAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const cronJobFirstByID = `-- name: CronJobFirstByID :one
+SELECT id, name, schedule, command, timeout, project_id, environment_id, next_run_at, organisation_id, created_at, updated_at, deleted_at
+FROM cron_jobs
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) CronJobFirstByID(ctx context.Context, id uuid.UUID) (CronJob, error) {
+	row := q.db.QueryRow(ctx, cronJobFirstByID, id)
+	var i CronJob
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Schedule,
+		&i.Command,
+		&i.Timeout,
+		&i.ProjectID,
+		&i.EnvironmentID,
+		&i.NextRunAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const cronJobRunCreate = `-- name: CronJobRunCreate :one
+INSERT INTO cron_job_runs (id, cron_job_id, deployment_id, status, organisation_id)
+VALUES ($1, $2, $3, 'pending', $4)
+RETURNING id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+`
+
+type CronJobRunCreateParams struct {
+	ID             uuid.UUID `json:"id"`
+	CronJobID      uuid.UUID `json:"cron_job_id"`
+	DeploymentID   uuid.UUID `json:"deployment_id"`
+	OrganisationID uuid.UUID `json:"organisation_id"`
+}
+
+func (q *Queries) CronJobRunCreate(ctx context.Context, arg CronJobRunCreateParams) (CronJobRun, error) {
+	row := q.db.QueryRow(ctx, cronJobRunCreate,
+		arg.ID,
+		arg.CronJobID,
+		arg.DeploymentID,
+		arg.OrganisationID,
+	)
+	var i CronJobRun
+	err := row.Scan(
+		&i.ID,
+		&i.CronJobID,
+		&i.DeploymentID,
+		&i.VmID,
+		&i.Status,
+		&i.ExitCode,
+		&i.FailedReason,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const cronJobRunFindUnfinished = `-- name: CronJobRunFindUnfinished :many
+SELECT id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+FROM cron_job_runs
+WHERE finished_at IS NULL
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) CronJobRunFindUnfinished(ctx context.Context) ([]CronJobRun, error) {
+	rows, err := q.db.Query(ctx, cronJobRunFindUnfinished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CronJobRun{}
+	for rows.Next() {
+		var i CronJobRun
+		if err := rows.Scan(
+			&i.ID,
+			&i.CronJobID,
+			&i.DeploymentID,
+			&i.VmID,
+			&i.Status,
+			&i.ExitCode,
+			&i.FailedReason,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const cronJobRunFindUnfinishedByCronJobID = `-- name: CronJobRunFindUnfinishedByCronJobID :many
+SELECT id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+FROM cron_job_runs
+WHERE cron_job_id = $1
+  AND finished_at IS NULL
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) CronJobRunFindUnfinishedByCronJobID(ctx context.Context, cronJobID uuid.UUID) ([]CronJobRun, error) {
+	rows, err := q.db.Query(ctx, cronJobRunFindUnfinishedByCronJobID, cronJobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CronJobRun{}
+	for rows.Next() {
+		var i CronJobRun
+		if err := rows.Scan(
+			&i.ID,
+			&i.CronJobID,
+			&i.DeploymentID,
+			&i.VmID,
+			&i.Status,
+			&i.ExitCode,
+			&i.FailedReason,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const cronJobRunFirstByID = `-- name: CronJobRunFirstByID :one
+SELECT id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+FROM cron_job_runs
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) CronJobRunFirstByID(ctx context.Context, id uuid.UUID) (CronJobRun, error) {
+	row := q.db.QueryRow(ctx, cronJobRunFirstByID, id)
+	var i CronJobRun
+	err := row.Scan(
+		&i.ID,
+		&i.CronJobID,
+		&i.DeploymentID,
+		&i.VmID,
+		&i.Status,
+		&i.ExitCode,
+		&i.FailedReason,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const cronJobRunLogCreate = `-- name: CronJobRunLogCreate :exec
+INSERT INTO cron_job_run_logs (id, cron_job_run_id, message, level, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, now())
+`
+
+type CronJobRunLogCreateParams struct {
+	ID             uuid.UUID `json:"id"`
+	CronJobRunID   uuid.UUID `json:"cron_job_run_id"`
+	Message        string    `json:"message"`
+	Level          string    `json:"level"`
+	OrganisationID uuid.UUID `json:"organisation_id"`
+}
+
+func (q *Queries) CronJobRunLogCreate(ctx context.Context, arg CronJobRunLogCreateParams) error {
+	_, err := q.db.Exec(ctx, cronJobRunLogCreate,
+		arg.ID,
+		arg.CronJobRunID,
+		arg.Message,
+		arg.Level,
+		arg.OrganisationID,
+	)
+	return err
+}
+
+const cronJobRunMarkFailed = `-- name: CronJobRunMarkFailed :exec
+UPDATE cron_job_runs
+SET status = 'failed', exit_code = $2, failed_reason = $3, finished_at = now(), updated_at = now()
+WHERE id = $1
+`
+
+type CronJobRunMarkFailedParams struct {
+	ID           uuid.UUID   `json:"id"`
+	ExitCode     pgtype.Int4 `json:"exit_code"`
+	FailedReason pgtype.Text `json:"failed_reason"`
+}
+
+func (q *Queries) CronJobRunMarkFailed(ctx context.Context, arg CronJobRunMarkFailedParams) error {
+	_, err := q.db.Exec(ctx, cronJobRunMarkFailed, arg.ID, arg.ExitCode, arg.FailedReason)
+	return err
+}
+
+const cronJobRunMarkRunning = `-- name: CronJobRunMarkRunning :one
+UPDATE cron_job_runs
+SET status = 'running', started_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+`
+
+func (q *Queries) CronJobRunMarkRunning(ctx context.Context, id uuid.UUID) (CronJobRun, error) {
+	row := q.db.QueryRow(ctx, cronJobRunMarkRunning, id)
+	var i CronJobRun
+	err := row.Scan(
+		&i.ID,
+		&i.CronJobID,
+		&i.DeploymentID,
+		&i.VmID,
+		&i.Status,
+		&i.ExitCode,
+		&i.FailedReason,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const cronJobRunMarkSucceeded = `-- name: CronJobRunMarkSucceeded :exec
+UPDATE cron_job_runs
+SET status = 'succeeded', exit_code = $2, finished_at = now(), updated_at = now()
+WHERE id = $1
+`
+
+type CronJobRunMarkSucceededParams struct {
+	ID       uuid.UUID   `json:"id"`
+	ExitCode pgtype.Int4 `json:"exit_code"`
+}
+
+func (q *Queries) CronJobRunMarkSucceeded(ctx context.Context, arg CronJobRunMarkSucceededParams) error {
+	_, err := q.db.Exec(ctx, cronJobRunMarkSucceeded, arg.ID, arg.ExitCode)
+	return err
+}
+
+const cronJobRunUpdateVM = `-- name: CronJobRunUpdateVM :one
+UPDATE cron_job_runs
+SET vm_id = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, cron_job_id, deployment_id, vm_id, status, exit_code, failed_reason, started_at, finished_at, organisation_id, created_at, updated_at, deleted_at
+`
+
+type CronJobRunUpdateVMParams struct {
+	ID   uuid.UUID `json:"id"`
+	VmID uuid.UUID `json:"vm_id"`
+}
+
+func (q *Queries) CronJobRunUpdateVM(ctx context.Context, arg CronJobRunUpdateVMParams) (CronJobRun, error) {
+	row := q.db.QueryRow(ctx, cronJobRunUpdateVM, arg.ID, arg.VmID)
+	var i CronJobRun
+	err := row.Scan(
+		&i.ID,
+		&i.CronJobID,
+		&i.DeploymentID,
+		&i.VmID,
+		&i.Status,
+		&i.ExitCode,
+		&i.FailedReason,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const cronJobUpdateNextRun = `-- name: CronJobUpdateNextRun :exec
+UPDATE cron_jobs
+SET next_run_at = $2, updated_at = now()
+WHERE id = $1
+`
+
+type CronJobUpdateNextRunParams struct {
+	ID        uuid.UUID          `json:"id"`
+	NextRunAt pgtype.Timestamptz `json:"next_run_at"`
+}
+
+func (q *Queries) CronJobUpdateNextRun(ctx context.Context, arg CronJobUpdateNextRunParams) error {
+	_, err := q.db.Exec(ctx, cronJobUpdateNextRun, arg.ID, arg.NextRunAt)
+	return err
+}
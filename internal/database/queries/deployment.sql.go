@@ -12,8 +12,35 @@ import (
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
+const deploymentExistsRunningAndNewer = `-- name: DeploymentExistsRunningAndNewer :one
+SELECT EXISTS (
+    SELECT 1 FROM deployments
+    WHERE deployments.environment_id = $1
+      AND (deployments.build_id, deployments.id) > (SELECT d.build_id, d.id FROM deployments d WHERE d.id = $2)
+      AND deployments.running_at IS NOT NULL
+      AND deployments.stopping_at IS NULL
+      AND deployments.stopped_at IS NULL
+      AND deployments.failed_at IS NULL
+      AND deployments.deleted_at IS NULL
+)
+`
+
+type DeploymentExistsRunningAndNewerParams struct {
+	EnvironmentID uuid.UUID `json:"environment_id"`
+	ID            uuid.UUID `json:"id"`
+}
+
+// Whether a running deployment of an environment is newer than the specified deployment, in the order
+// of DeploymentFindRunningAndOlder
+func (q *Queries) DeploymentExistsRunningAndNewer(ctx context.Context, arg DeploymentExistsRunningAndNewerParams) (bool, error) {
+	row := q.db.QueryRow(ctx, deploymentExistsRunningAndNewer, arg.EnvironmentID, arg.ID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const deploymentFind = `-- name: DeploymentFind :many
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 FROM deployments
 `
 
@@ -45,6 +72,67 @@ func (q *Queries) DeploymentFind(ctx context.Context) ([]Deployment, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deploymentFindActiveByEnvironmentID = `-- name: DeploymentFindActiveByEnvironmentID :many
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+FROM deployments
+WHERE environment_id = $1
+  AND stopped_at IS NULL
+  AND failed_at IS NULL
+  AND deleted_at IS NULL
+`
+
+// Find all deployments of an environment that are not in a terminal state
+func (q *Queries) DeploymentFindActiveByEnvironmentID(ctx context.Context, environmentID uuid.UUID) ([]Deployment, error) {
+	rows, err := q.db.Query(ctx, deploymentFindActiveByEnvironmentID, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Deployment{}
+	for rows.Next() {
+		var i Deployment
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.GithubCommit,
+			&i.ProjectID,
+			&i.BuildID,
+			&i.ImageID,
+			&i.VmID,
+			&i.PendingAt,
+			&i.BuildingAt,
+			&i.StartingAt,
+			&i.RunningAt,
+			&i.StoppingAt,
+			&i.StoppedAt,
+			&i.FailedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -57,7 +145,7 @@ func (q *Queries) DeploymentFind(ctx context.Context) ([]Deployment, error) {
 }
 
 const deploymentFindByBuildID = `-- name: DeploymentFindByBuildID :many
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at FROM deployments WHERE build_id = $1
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at FROM deployments WHERE build_id = $1
 `
 
 func (q *Queries) DeploymentFindByBuildID(ctx context.Context, buildID uuid.UUID) ([]Deployment, error) {
@@ -88,6 +176,12 @@ func (q *Queries) DeploymentFindByBuildID(ctx context.Context, buildID uuid.UUID
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -100,11 +194,15 @@ func (q *Queries) DeploymentFindByBuildID(ctx context.Context, buildID uuid.UUID
 }
 
 const deploymentFindByVMID = `-- name: DeploymentFindByVMID :one
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at FROM deployments WHERE vm_id = $1 LIMIT 1
+SELECT d.id, d.status, d.github_commit, d.project_id, d.build_id, d.image_id, d.vm_id, d.pending_at, d.building_at, d.starting_at, d.running_at, d.stopping_at, d.stopped_at, d.failed_at, d.organisation_id, d.created_at, d.updated_at, d.deleted_at, d.environment_id, d.release_vm_id, d.released_at, d.failed_reason, d.source_upload_id, d.release_started_at FROM deployments d
+INNER JOIN vms v ON v.deployment_id = d.id
+WHERE v.id = $1
+LIMIT 1
 `
 
-func (q *Queries) DeploymentFindByVMID(ctx context.Context, vmID uuid.UUID) (Deployment, error) {
-	row := q.db.QueryRow(ctx, deploymentFindByVMID, vmID)
+// Find the deployment a VM (any of its replicas) belongs to
+func (q *Queries) DeploymentFindByVMID(ctx context.Context, id uuid.UUID) (Deployment, error) {
+	row := q.db.QueryRow(ctx, deploymentFindByVMID, id)
 	var i Deployment
 	err := row.Scan(
 		&i.ID,
@@ -125,12 +223,18 @@ func (q *Queries) DeploymentFindByVMID(ctx context.Context, vmID uuid.UUID) (Dep
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
 const deploymentFindNewest = `-- name: DeploymentFindNewest :one
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at 
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at 
 FROM deployments 
 WHERE project_id = $1 
 ORDER BY id DESC 
@@ -159,28 +263,94 @@ func (q *Queries) DeploymentFindNewest(ctx context.Context, projectID uuid.UUID)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
 const deploymentFindRunningAndOlder = `-- name: DeploymentFindRunningAndOlder :many
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at FROM deployments
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at FROM deployments
+WHERE deployments.environment_id = $1
+  AND (deployments.build_id, deployments.id) < (SELECT d.build_id, d.id FROM deployments d WHERE d.id = $2)
+  AND deployments.running_at IS NOT NULL
+  AND deployments.stopping_at IS NULL
+  AND deployments.stopped_at IS NULL
+  AND deployments.failed_at IS NULL
+  AND deployments.deleted_at IS NULL
+ORDER BY build_id DESC, id DESC
+`
+
+type DeploymentFindRunningAndOlderParams struct {
+	EnvironmentID uuid.UUID `json:"environment_id"`
+	ID            uuid.UUID `json:"id"`
+}
+
+// Find all running deployments of an environment, older than the specified deployment (newest first).
+// Deployments are ordered by their build first: a redeployment of an environment reuses the build of
+// the deployment it replaces, and is older than deployments of new builds created before it.
+func (q *Queries) DeploymentFindRunningAndOlder(ctx context.Context, arg DeploymentFindRunningAndOlderParams) ([]Deployment, error) {
+	rows, err := q.db.Query(ctx, deploymentFindRunningAndOlder, arg.EnvironmentID, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Deployment{}
+	for rows.Next() {
+		var i Deployment
+		if err := rows.Scan(
+			&i.ID,
+			&i.Status,
+			&i.GithubCommit,
+			&i.ProjectID,
+			&i.BuildID,
+			&i.ImageID,
+			&i.VmID,
+			&i.PendingAt,
+			&i.BuildingAt,
+			&i.StartingAt,
+			&i.RunningAt,
+			&i.StoppingAt,
+			&i.StoppedAt,
+			&i.FailedAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deploymentFindRunningByProjectID = `-- name: DeploymentFindRunningByProjectID :many
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+FROM deployments
 WHERE project_id = $1
-  AND id < $2
   AND running_at IS NOT NULL
+  AND stopping_at IS NULL
   AND stopped_at IS NULL
   AND failed_at IS NULL
   AND deleted_at IS NULL
 `
 
-type DeploymentFindRunningAndOlderParams struct {
-	ProjectID uuid.UUID `json:"project_id"`
-	ID        uuid.UUID `json:"id"`
-}
-
-// Find all running deployments for a project, older than the specified deployment
-func (q *Queries) DeploymentFindRunningAndOlder(ctx context.Context, arg DeploymentFindRunningAndOlderParams) ([]Deployment, error) {
-	rows, err := q.db.Query(ctx, deploymentFindRunningAndOlder, arg.ProjectID, arg.ID)
+func (q *Queries) DeploymentFindRunningByProjectID(ctx context.Context, projectID uuid.UUID) ([]Deployment, error) {
+	rows, err := q.db.Query(ctx, deploymentFindRunningByProjectID, projectID)
 	if err != nil {
 		return nil, err
 	}
@@ -207,6 +377,12 @@ func (q *Queries) DeploymentFindRunningAndOlder(ctx context.Context, arg Deploym
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -219,14 +395,20 @@ func (q *Queries) DeploymentFindRunningAndOlder(ctx context.Context, arg Deploym
 }
 
 const deploymentFindRunningByServerID = `-- name: DeploymentFindRunningByServerID :many
-SELECT d.id, d.status, d.github_commit, d.project_id, d.build_id, d.image_id, d.vm_id, d.pending_at, d.building_at, d.starting_at, d.running_at, d.stopping_at, d.stopped_at, d.failed_at, d.organisation_id, d.created_at, d.updated_at, d.deleted_at FROM deployments d
-INNER JOIN vms v ON d.vm_id = v.id
-WHERE v.server_id = $1
-  AND d.status = 'running'
+SELECT d.id, d.status, d.github_commit, d.project_id, d.build_id, d.image_id, d.vm_id, d.pending_at, d.building_at, d.starting_at, d.running_at, d.stopping_at, d.stopped_at, d.failed_at, d.organisation_id, d.created_at, d.updated_at, d.deleted_at, d.environment_id, d.release_vm_id, d.released_at, d.failed_reason, d.source_upload_id, d.release_started_at FROM deployments d
+WHERE EXISTS (
+    SELECT 1 FROM vms v
+    WHERE v.deployment_id = d.id
+      AND v.server_id = $1
+      AND v.deleted_at IS NULL
+  )
+  AND d.running_at IS NOT NULL
+  AND d.stopped_at IS NULL
+  AND d.failed_at IS NULL
   AND d.deleted_at IS NULL
 `
 
-// Find all running deployments whose VM is on a specific server.
+// Find all running deployments with at least one replica on a specific server.
 func (q *Queries) DeploymentFindRunningByServerID(ctx context.Context, serverID uuid.UUID) ([]Deployment, error) {
 	rows, err := q.db.Query(ctx, deploymentFindRunningByServerID, serverID)
 	if err != nil {
@@ -255,6 +437,12 @@ func (q *Queries) DeploymentFindRunningByServerID(ctx context.Context, serverID
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.EnvironmentID,
+			&i.ReleaseVmID,
+			&i.ReleasedAt,
+			&i.FailedReason,
+			&i.SourceUploadID,
+			&i.ReleaseStartedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -267,7 +455,7 @@ func (q *Queries) DeploymentFindRunningByServerID(ctx context.Context, serverID
 }
 
 const deploymentFirstByID = `-- name: DeploymentFirstByID :one
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 FROM deployments
 WHERE id = $1
 LIMIT 1
@@ -295,12 +483,18 @@ func (q *Queries) DeploymentFirstByID(ctx context.Context, id uuid.UUID) (Deploy
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
 const deploymentFirstPending = `-- name: DeploymentFirstPending :one
-SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 FROM deployments WHERE status = 'pending'
 ORDER BY id DESC
 LIMIT 1
@@ -328,13 +522,183 @@ func (q *Queries) DeploymentFirstPending(ctx context.Context) (Deployment, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
+	)
+	return i, err
+}
+
+const deploymentLatestRunningByEnvironmentID = `-- name: DeploymentLatestRunningByEnvironmentID :one
+SELECT id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+FROM deployments
+WHERE environment_id = $1
+  AND running_at IS NOT NULL
+  AND stopping_at IS NULL
+  AND stopped_at IS NULL
+  AND failed_at IS NULL
+  AND deleted_at IS NULL
+ORDER BY id DESC
+LIMIT 1
+`
+
+// Find the newest deployment serving an environment
+func (q *Queries) DeploymentLatestRunningByEnvironmentID(ctx context.Context, environmentID uuid.UUID) (Deployment, error) {
+	row := q.db.QueryRow(ctx, deploymentLatestRunningByEnvironmentID, environmentID)
+	var i Deployment
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.GithubCommit,
+		&i.ProjectID,
+		&i.BuildID,
+		&i.ImageID,
+		&i.VmID,
+		&i.PendingAt,
+		&i.BuildingAt,
+		&i.StartingAt,
+		&i.RunningAt,
+		&i.StoppingAt,
+		&i.StoppedAt,
+		&i.FailedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
+	)
+	return i, err
+}
+
+const deploymentLogCreate = `-- name: DeploymentLogCreate :exec
+INSERT INTO deployment_logs (id, deployment_id, message, level, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, NOW())
+`
+
+type DeploymentLogCreateParams struct {
+	ID             uuid.UUID `json:"id"`
+	DeploymentID   uuid.UUID `json:"deployment_id"`
+	Message        string    `json:"message"`
+	Level          string    `json:"level"`
+	OrganisationID uuid.UUID `json:"organisation_id"`
+}
+
+func (q *Queries) DeploymentLogCreate(ctx context.Context, arg DeploymentLogCreateParams) error {
+	_, err := q.db.Exec(ctx, deploymentLogCreate,
+		arg.ID,
+		arg.DeploymentID,
+		arg.Message,
+		arg.Level,
+		arg.OrganisationID,
+	)
+	return err
+}
+
+const deploymentMarkFailed = `-- name: DeploymentMarkFailed :exec
+UPDATE deployments
+SET status = 'failed', failed_at = COALESCE(failed_at, now()), failed_reason = COALESCE(failed_reason, $2), updated_at = now()
+WHERE id = $1
+`
+
+type DeploymentMarkFailedParams struct {
+	ID           uuid.UUID   `json:"id"`
+	FailedReason pgtype.Text `json:"failed_reason"`
+}
+
+func (q *Queries) DeploymentMarkFailed(ctx context.Context, arg DeploymentMarkFailedParams) error {
+	_, err := q.db.Exec(ctx, deploymentMarkFailed, arg.ID, arg.FailedReason)
+	return err
+}
+
+const deploymentMarkReleaseStarted = `-- name: DeploymentMarkReleaseStarted :one
+UPDATE deployments
+SET release_started_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+`
+
+func (q *Queries) DeploymentMarkReleaseStarted(ctx context.Context, id uuid.UUID) (Deployment, error) {
+	row := q.db.QueryRow(ctx, deploymentMarkReleaseStarted, id)
+	var i Deployment
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.GithubCommit,
+		&i.ProjectID,
+		&i.BuildID,
+		&i.ImageID,
+		&i.VmID,
+		&i.PendingAt,
+		&i.BuildingAt,
+		&i.StartingAt,
+		&i.RunningAt,
+		&i.StoppingAt,
+		&i.StoppedAt,
+		&i.FailedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
+	)
+	return i, err
+}
+
+const deploymentMarkReleased = `-- name: DeploymentMarkReleased :one
+UPDATE deployments
+SET released_at = COALESCE(released_at, now()), updated_at = now()
+WHERE id = $1
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+`
+
+func (q *Queries) DeploymentMarkReleased(ctx context.Context, id uuid.UUID) (Deployment, error) {
+	row := q.db.QueryRow(ctx, deploymentMarkReleased, id)
+	var i Deployment
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.GithubCommit,
+		&i.ProjectID,
+		&i.BuildID,
+		&i.ImageID,
+		&i.VmID,
+		&i.PendingAt,
+		&i.BuildingAt,
+		&i.StartingAt,
+		&i.RunningAt,
+		&i.StoppingAt,
+		&i.StoppedAt,
+		&i.FailedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
 const deploymentMarkRunning = `-- name: DeploymentMarkRunning :exec
 UPDATE deployments
-SET running_at = COALESCE(running_at, now()), updated_at = now()
+SET status = 'running', running_at = COALESCE(running_at, now()), updated_at = now()
 WHERE id = $1
 `
 
@@ -345,7 +709,9 @@ func (q *Queries) DeploymentMarkRunning(ctx context.Context, id uuid.UUID) error
 
 const deploymentMarkStopped = `-- name: DeploymentMarkStopped :exec
 UPDATE deployments
-SET stopped_at = COALESCE(stopped_at, now()), updated_at = now()
+SET status = CASE WHEN failed_at IS NULL THEN 'stopped' ELSE status END,
+    stopped_at = COALESCE(stopped_at, now()),
+    updated_at = now()
 WHERE id = $1
 `
 
@@ -354,11 +720,25 @@ func (q *Queries) DeploymentMarkStopped(ctx context.Context, id uuid.UUID) error
 	return err
 }
 
+const deploymentMarkStopping = `-- name: DeploymentMarkStopping :exec
+UPDATE deployments
+SET status = CASE WHEN failed_at IS NULL THEN 'stopping' ELSE status END,
+    stopping_at = COALESCE(stopping_at, now()),
+    updated_at = now()
+WHERE id = $1
+`
+
+// Take a deployment out of edge routing. It is marked stopped once its VMs are drained.
+func (q *Queries) DeploymentMarkStopping(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deploymentMarkStopping, id)
+	return err
+}
+
 const deploymentUpdateBuild = `-- name: DeploymentUpdateBuild :one
 UPDATE deployments
-SET build_id = $2, building_at = COALESCE(building_at, now()), updated_at = now()
+SET build_id = $2, status = 'building', building_at = COALESCE(building_at, now()), updated_at = now()
 WHERE id = $1
-RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 `
 
 type DeploymentUpdateBuildParams struct {
@@ -388,26 +768,21 @@ func (q *Queries) DeploymentUpdateBuild(ctx context.Context, arg DeploymentUpdat
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
-const deploymentUpdateFailedAt = `-- name: DeploymentUpdateFailedAt :exec
-UPDATE deployments
-SET failed_at = COALESCE(failed_at, now()), updated_at = now()
-WHERE id = $1
-`
-
-func (q *Queries) DeploymentUpdateFailedAt(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.Exec(ctx, deploymentUpdateFailedAt, id)
-	return err
-}
-
 const deploymentUpdateImage = `-- name: DeploymentUpdateImage :one
 UPDATE deployments
 SET image_id = $2, updated_at = now()
 WHERE id = $1
-RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 `
 
 type DeploymentUpdateImageParams struct {
@@ -437,15 +812,68 @@ func (q *Queries) DeploymentUpdateImage(ctx context.Context, arg DeploymentUpdat
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
+	)
+	return i, err
+}
+
+const deploymentUpdateReleaseVM = `-- name: DeploymentUpdateReleaseVM :one
+UPDATE deployments
+SET release_vm_id = $2, updated_at = now()
+WHERE id = $1
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
+`
+
+type DeploymentUpdateReleaseVMParams struct {
+	ID          uuid.UUID `json:"id"`
+	ReleaseVmID uuid.UUID `json:"release_vm_id"`
+}
+
+func (q *Queries) DeploymentUpdateReleaseVM(ctx context.Context, arg DeploymentUpdateReleaseVMParams) (Deployment, error) {
+	row := q.db.QueryRow(ctx, deploymentUpdateReleaseVM, arg.ID, arg.ReleaseVmID)
+	var i Deployment
+	err := row.Scan(
+		&i.ID,
+		&i.Status,
+		&i.GithubCommit,
+		&i.ProjectID,
+		&i.BuildID,
+		&i.ImageID,
+		&i.VmID,
+		&i.PendingAt,
+		&i.BuildingAt,
+		&i.StartingAt,
+		&i.RunningAt,
+		&i.StoppingAt,
+		&i.StoppedAt,
+		&i.FailedAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
 
 const deploymentUpdateVM = `-- name: DeploymentUpdateVM :one
 UPDATE deployments
-SET vm_id = $2, starting_at = COALESCE(starting_at, now()), updated_at = now()
+SET vm_id = $2,
+    status = CASE WHEN running_at IS NULL THEN 'starting' ELSE status END,
+    starting_at = COALESCE(starting_at, now()),
+    updated_at = now()
 WHERE id = $1
-RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at
+RETURNING id, status, github_commit, project_id, build_id, image_id, vm_id, pending_at, building_at, starting_at, running_at, stopping_at, stopped_at, failed_at, organisation_id, created_at, updated_at, deleted_at, environment_id, release_vm_id, released_at, failed_reason, source_upload_id, release_started_at
 `
 
 type DeploymentUpdateVMParams struct {
@@ -453,6 +881,7 @@ type DeploymentUpdateVMParams struct {
 	VmID uuid.UUID `json:"vm_id"`
 }
 
+// Link the primary replica. Running deployments keep their status when a replica is replaced.
 func (q *Queries) DeploymentUpdateVM(ctx context.Context, arg DeploymentUpdateVMParams) (Deployment, error) {
 	row := q.db.QueryRow(ctx, deploymentUpdateVM, arg.ID, arg.VmID)
 	var i Deployment
@@ -475,6 +904,12 @@ func (q *Queries) DeploymentUpdateVM(ctx context.Context, arg DeploymentUpdateVM
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.EnvironmentID,
+		&i.ReleaseVmID,
+		&i.ReleasedAt,
+		&i.FailedReason,
+		&i.SourceUploadID,
+		&i.ReleaseStartedAt,
 	)
 	return i, err
 }
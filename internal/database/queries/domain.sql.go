@@ -12,7 +12,7 @@ import (
 )
 
 const domainFind = `-- name: DomainFind :many
-SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code
+SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code, environment_id, internal
 FROM domains
 `
 
@@ -38,6 +38,8 @@ func (q *Queries) DomainFind(ctx context.Context) ([]Domain, error) {
 			&i.TxtVerificationRequired,
 			&i.RedirectTo,
 			&i.RedirectStatusCode,
+			&i.EnvironmentID,
+			&i.Internal,
 		); err != nil {
 			return nil, err
 		}
@@ -50,7 +52,7 @@ func (q *Queries) DomainFind(ctx context.Context) ([]Domain, error) {
 }
 
 const domainFindActiveByName = `-- name: DomainFindActiveByName :many
-SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code
+SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code, environment_id, internal
 FROM domains
 WHERE name = $1 AND id != $2 AND deleted_at IS NULL
 `
@@ -83,6 +85,8 @@ func (q *Queries) DomainFindActiveByName(ctx context.Context, arg DomainFindActi
 			&i.TxtVerificationRequired,
 			&i.RedirectTo,
 			&i.RedirectStatusCode,
+			&i.EnvironmentID,
+			&i.Internal,
 		); err != nil {
 			return nil, err
 		}
@@ -95,7 +99,7 @@ func (q *Queries) DomainFindActiveByName(ctx context.Context, arg DomainFindActi
 }
 
 const domainFirstByID = `-- name: DomainFirstByID :one
-SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code
+SELECT id, name, project_id, deployment_id, verified_at, organisation_id, created_at, updated_at, deleted_at, txt_verification_required, redirect_to, redirect_status_code, environment_id, internal
 FROM domains
 WHERE id = $1
 LIMIT 1
@@ -117,25 +121,41 @@ func (q *Queries) DomainFirstByID(ctx context.Context, id uuid.UUID) (Domain, er
 		&i.TxtVerificationRequired,
 		&i.RedirectTo,
 		&i.RedirectStatusCode,
+		&i.EnvironmentID,
+		&i.Internal,
 	)
 	return i, err
 }
 
-const domainUpdateDeploymentForProject = `-- name: DomainUpdateDeploymentForProject :exec
+const domainSoftDeleteByEnvironmentID = `-- name: DomainSoftDeleteByEnvironmentID :exec
+UPDATE domains
+SET deleted_at = now(), verified_at = NULL, updated_at = now()
+WHERE environment_id = $1
+  AND deleted_at IS NULL
+`
+
+// Soft-delete all domains of an environment
+func (q *Queries) DomainSoftDeleteByEnvironmentID(ctx context.Context, environmentID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, domainSoftDeleteByEnvironmentID, environmentID)
+	return err
+}
+
+const domainUpdateDeploymentForEnvironment = `-- name: DomainUpdateDeploymentForEnvironment :exec
 UPDATE domains
 SET deployment_id = $1, updated_at = now()
-WHERE project_id = $2
-  AND name NOT LIKE '%.zeitwork.app'
+WHERE environment_id = $2
+  AND NOT internal
   AND deleted_at IS NULL
 `
 
-type DomainUpdateDeploymentForProjectParams struct {
-	DeploymentID uuid.UUID `json:"deployment_id"`
-	ProjectID    uuid.UUID `json:"project_id"`
+type DomainUpdateDeploymentForEnvironmentParams struct {
+	DeploymentID  uuid.UUID `json:"deployment_id"`
+	EnvironmentID uuid.UUID `json:"environment_id"`
 }
 
-// Update all custom domains (non-zeitwork.app) for a project to point to a new deployment
-func (q *Queries) DomainUpdateDeploymentForProject(ctx context.Context, arg DomainUpdateDeploymentForProjectParams) error {
-	_, err := q.db.Exec(ctx, domainUpdateDeploymentForProject, arg.DeploymentID, arg.ProjectID)
+// Update all domains of an environment, except the internal domains of single deployments,
+// to point to a new deployment
+func (q *Queries) DomainUpdateDeploymentForEnvironment(ctx context.Context, arg DomainUpdateDeploymentForEnvironmentParams) error {
+	_, err := q.db.Exec(ctx, domainUpdateDeploymentForEnvironment, arg.DeploymentID, arg.EnvironmentID)
 	return err
 }
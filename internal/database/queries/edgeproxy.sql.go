@@ -34,10 +34,21 @@ SELECT d.name       AS domain_name,
        v.ip_address AS vm_ip,
        v.server_id  AS server_id,
        d.redirect_to AS redirect_to,
-       d.redirect_status_code AS redirect_status_code
+       d.redirect_status_code AS redirect_status_code,
+       r.id         AS rollout_id,
+       r.step       AS rollout_step,
+       r.weight     AS rollout_weight,
+       cv.port      AS canary_vm_port,
+       cv.id        AS canary_vm_id,
+       cv.ip_address AS canary_vm_ip,
+       cv.server_id AS canary_server_id
 FROM domains d
-         LEFT JOIN deployments dep ON d.deployment_id = dep.id AND dep.stopped_at IS NULL AND dep.failed_at IS NULL AND dep.deleted_at IS NULL
-         LEFT JOIN vms v ON dep.vm_id = v.id AND v.deleted_at IS NULL
+         LEFT JOIN deployments dep ON d.deployment_id = dep.id AND dep.stopping_at IS NULL AND dep.stopped_at IS NULL AND dep.failed_at IS NULL AND dep.deleted_at IS NULL
+         LEFT JOIN vms v ON v.deployment_id = dep.id AND v.process = 'web' AND v.draining_at IS NULL AND v.deleted_at IS NULL
+         LEFT JOIN rollouts r ON r.from_deployment_id = dep.id AND r.status = 'in_progress' AND r.deleted_at IS NULL
+                                 AND NOT d.internal
+         LEFT JOIN deployments cdep ON r.to_deployment_id = cdep.id AND cdep.stopping_at IS NULL AND cdep.stopped_at IS NULL AND cdep.failed_at IS NULL AND cdep.deleted_at IS NULL
+         LEFT JOIN vms cv ON cv.deployment_id = cdep.id AND cv.process = 'web' AND cv.draining_at IS NULL AND cv.deleted_at IS NULL
 WHERE d.verified_at IS NOT NULL
   AND d.deleted_at IS NULL
   AND (v.id IS NOT NULL OR d.redirect_to IS NOT NULL)
@@ -52,11 +63,22 @@ type RouteFindActiveRow struct {
 	ServerID           uuid.UUID    `json:"server_id"`
 	RedirectTo         pgtype.Text  `json:"redirect_to"`
 	RedirectStatusCode pgtype.Int4  `json:"redirect_status_code"`
+	RolloutID          uuid.UUID    `json:"rollout_id"`
+	RolloutStep        pgtype.Int4  `json:"rollout_step"`
+	RolloutWeight      pgtype.Int4  `json:"rollout_weight"`
+	CanaryVmPort       pgtype.Int4  `json:"canary_vm_port"`
+	CanaryVmID         uuid.UUID    `json:"canary_vm_id"`
+	CanaryVmIp         netip.Prefix `json:"canary_vm_ip"`
+	CanaryServerID     uuid.UUID    `json:"canary_server_id"`
 }
 
-// Domains -> Deployment -> VM -> Server
-// Returns routes with server info so the edge proxy knows which server hosts each VM.
+// Domains -> Deployment -> VMs -> Server
+// Returns one row per replica with server info so the edge proxy knows which server hosts each VM.
+// Stopping deployments and draining replicas are left out so they only finish in-flight requests.
+// Only web processes are routed.
 // With L2 routing between servers, the edge proxy can reach any VM directly by IP.
+// Custom domains of a deployment with an in-progress rollout also carry the canary replicas
+// and the percentage of traffic they should receive.
 func (q *Queries) RouteFindActive(ctx context.Context) ([]RouteFindActiveRow, error) {
 	rows, err := q.db.Query(ctx, routeFindActive)
 	if err != nil {
@@ -74,6 +96,13 @@ func (q *Queries) RouteFindActive(ctx context.Context) ([]RouteFindActiveRow, er
 			&i.ServerID,
 			&i.RedirectTo,
 			&i.RedirectStatusCode,
+			&i.RolloutID,
+			&i.RolloutStep,
+			&i.RolloutWeight,
+			&i.CanaryVmPort,
+			&i.CanaryVmID,
+			&i.CanaryVmIp,
+			&i.CanaryServerID,
 		); err != nil {
 			return nil, err
 		}
@@ -84,3 +113,42 @@ func (q *Queries) RouteFindActive(ctx context.Context) ([]RouteFindActiveRow, er
 	}
 	return items, nil
 }
+
+const vMInflightRequestsDelete = `-- name: VMInflightRequestsDelete :exec
+DELETE FROM vm_inflight_requests
+WHERE server_id = $1 AND vm_id = $2
+`
+
+type VMInflightRequestsDeleteParams struct {
+	ServerID uuid.UUID `json:"server_id"`
+	VmID     uuid.UUID `json:"vm_id"`
+}
+
+func (q *Queries) VMInflightRequestsDelete(ctx context.Context, arg VMInflightRequestsDeleteParams) error {
+	_, err := q.db.Exec(ctx, vMInflightRequestsDelete, arg.ServerID, arg.VmID)
+	return err
+}
+
+const vMInflightRequestsUpsert = `-- name: VMInflightRequestsUpsert :exec
+INSERT INTO vm_inflight_requests (id, server_id, vm_id, requests, updated_at)
+VALUES ($1, $2, $3, $4, now())
+ON CONFLICT (server_id, vm_id) DO UPDATE SET requests = EXCLUDED.requests, updated_at = now()
+`
+
+type VMInflightRequestsUpsertParams struct {
+	ID       uuid.UUID `json:"id"`
+	ServerID uuid.UUID `json:"server_id"`
+	VmID     uuid.UUID `json:"vm_id"`
+	Requests int32     `json:"requests"`
+}
+
+// Report the in-flight requests this edge proxy has open to a VM
+func (q *Queries) VMInflightRequestsUpsert(ctx context.Context, arg VMInflightRequestsUpsertParams) error {
+	_, err := q.db.Exec(ctx, vMInflightRequestsUpsert,
+		arg.ID,
+		arg.ServerID,
+		arg.VmID,
+		arg.Requests,
+	)
+	return err
+}
@@ -0,0 +1,119 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: environment.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const environmentFindDeleted = `-- name: EnvironmentFindDeleted :many
+SELECT id, name, slug, project_id, branch, vcpus, memory, replicas, organisation_id, created_at, updated_at, deleted_at, preview, github_pull_request
+FROM environments
+WHERE deleted_at IS NOT NULL
+`
+
+// Find soft-deleted environments, e.g. previews of deleted branches, that may still need cleanup
+func (q *Queries) EnvironmentFindDeleted(ctx context.Context) ([]Environment, error) {
+	rows, err := q.db.Query(ctx, environmentFindDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Environment{}
+	for rows.Next() {
+		var i Environment
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Slug,
+			&i.ProjectID,
+			&i.Branch,
+			&i.Vcpus,
+			&i.Memory,
+			&i.Replicas,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Preview,
+			&i.GithubPullRequest,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const environmentFirstByID = `-- name: EnvironmentFirstByID :one
+SELECT id, name, slug, project_id, branch, vcpus, memory, replicas, organisation_id, created_at, updated_at, deleted_at, preview, github_pull_request
+FROM environments
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) EnvironmentFirstByID(ctx context.Context, id uuid.UUID) (Environment, error) {
+	row := q.db.QueryRow(ctx, environmentFirstByID, id)
+	var i Environment
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Slug,
+		&i.ProjectID,
+		&i.Branch,
+		&i.Vcpus,
+		&i.Memory,
+		&i.Replicas,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Preview,
+		&i.GithubPullRequest,
+	)
+	return i, err
+}
+
+const environmentFirstByProjectIDAndSlug = `-- name: EnvironmentFirstByProjectIDAndSlug :one
+SELECT id, name, slug, project_id, branch, vcpus, memory, replicas, organisation_id, created_at, updated_at, deleted_at, preview, github_pull_request
+FROM environments
+WHERE project_id = $1
+  AND slug = $2
+  AND deleted_at IS NULL
+LIMIT 1
+`
+
+type EnvironmentFirstByProjectIDAndSlugParams struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	Slug      string    `json:"slug"`
+}
+
+func (q *Queries) EnvironmentFirstByProjectIDAndSlug(ctx context.Context, arg EnvironmentFirstByProjectIDAndSlugParams) (Environment, error) {
+	row := q.db.QueryRow(ctx, environmentFirstByProjectIDAndSlug, arg.ProjectID, arg.Slug)
+	var i Environment
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Slug,
+		&i.ProjectID,
+		&i.Branch,
+		&i.Vcpus,
+		&i.Memory,
+		&i.Replicas,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Preview,
+		&i.GithubPullRequest,
+	)
+	return i, err
+}
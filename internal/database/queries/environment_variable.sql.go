@@ -11,25 +11,25 @@ import (
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
-const environmentVariableFindByProjectID = `-- name: EnvironmentVariableFindByProjectID :many
-SELECT name, value FROM environment_variables 
-WHERE project_id = $1 AND deleted_at IS NULL
+const environmentVariableFindByEnvironmentID = `-- name: EnvironmentVariableFindByEnvironmentID :many
+SELECT name, value FROM environment_variables
+WHERE environment_id = $1 AND deleted_at IS NULL
 `
 
-type EnvironmentVariableFindByProjectIDRow struct {
+type EnvironmentVariableFindByEnvironmentIDRow struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
 }
 
-func (q *Queries) EnvironmentVariableFindByProjectID(ctx context.Context, projectID uuid.UUID) ([]EnvironmentVariableFindByProjectIDRow, error) {
-	rows, err := q.db.Query(ctx, environmentVariableFindByProjectID, projectID)
+func (q *Queries) EnvironmentVariableFindByEnvironmentID(ctx context.Context, environmentID uuid.UUID) ([]EnvironmentVariableFindByEnvironmentIDRow, error) {
+	rows, err := q.db.Query(ctx, environmentVariableFindByEnvironmentID, environmentID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []EnvironmentVariableFindByProjectIDRow{}
+	items := []EnvironmentVariableFindByEnvironmentIDRow{}
 	for rows.Next() {
-		var i EnvironmentVariableFindByProjectIDRow
+		var i EnvironmentVariableFindByEnvironmentIDRow
 		if err := rows.Scan(&i.Name, &i.Value); err != nil {
 			return nil, err
 		}
@@ -7,15 +7,16 @@ package queries
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
 const imageCreate = `-- name: ImageCreate :one
-insert into images (id, registry, repository, tag)
-VALUES ($1, $2, $3, $4)
-RETURNING id, registry, repository, tag, created_at, updated_at, deleted_at
+insert into images (id, registry, repository, tag, digest)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, registry, repository, tag, created_at, updated_at, deleted_at, digest
 `
 
 type ImageCreateParams struct {
@@ -23,6 +24,7 @@ type ImageCreateParams struct {
 	Registry   string    `json:"registry"`
 	Repository string    `json:"repository"`
 	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest"`
 }
 
 func (q *Queries) ImageCreate(ctx context.Context, arg ImageCreateParams) (Image, error) {
@@ -31,6 +33,7 @@ func (q *Queries) ImageCreate(ctx context.Context, arg ImageCreateParams) (Image
 		arg.Registry,
 		arg.Repository,
 		arg.Tag,
+		arg.Digest,
 	)
 	var i Image
 	err := row.Scan(
@@ -41,12 +44,13 @@ func (q *Queries) ImageCreate(ctx context.Context, arg ImageCreateParams) (Image
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.Digest,
 	)
 	return i, err
 }
 
 const imageFind = `-- name: ImageFind :many
-select id, registry, repository, tag, created_at, updated_at, deleted_at from images
+select id, registry, repository, tag, created_at, updated_at, deleted_at, digest from images
 `
 
 func (q *Queries) ImageFind(ctx context.Context) ([]Image, error) {
@@ -66,6 +70,7 @@ func (q *Queries) ImageFind(ctx context.Context) ([]Image, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.Digest,
 		); err != nil {
 			return nil, err
 		}
@@ -78,7 +83,7 @@ func (q *Queries) ImageFind(ctx context.Context) ([]Image, error) {
 }
 
 const imageFindByID = `-- name: ImageFindByID :one
-select id, registry, repository, tag, created_at, updated_at, deleted_at from images where id=$1
+select id, registry, repository, tag, created_at, updated_at, deleted_at, digest from images where id=$1
 `
 
 func (q *Queries) ImageFindByID(ctx context.Context, id uuid.UUID) (Image, error) {
@@ -92,12 +97,13 @@ func (q *Queries) ImageFindByID(ctx context.Context, id uuid.UUID) (Image, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.Digest,
 	)
 	return i, err
 }
 
 const imageFindByRepositoryAndTag = `-- name: ImageFindByRepositoryAndTag :one
-select id, registry, repository, tag, created_at, updated_at, deleted_at
+select id, registry, repository, tag, created_at, updated_at, deleted_at, digest
 from images
 where registry = $1
   and repository = $2
@@ -122,21 +128,22 @@ func (q *Queries) ImageFindByRepositoryAndTag(ctx context.Context, arg ImageFind
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.Digest,
 	)
 	return i, err
 }
 
 const imageFindOrCreate = `-- name: ImageFindOrCreate :one
 WITH ins AS (
-    INSERT INTO images (id, registry, repository, tag)
-    VALUES ($1, $2, $3, $4)
-    ON CONFLICT (registry, repository, tag) DO NOTHING
-    RETURNING id, registry, repository, tag, created_at, updated_at, deleted_at
+    INSERT INTO images (id, registry, repository, tag, digest)
+    VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT (registry, repository, tag, digest) DO NOTHING
+    RETURNING id, registry, repository, tag, created_at, updated_at, deleted_at, digest
 )
-SELECT id, registry, repository, tag, created_at, updated_at, deleted_at FROM ins
+SELECT id, registry, repository, tag, created_at, updated_at, deleted_at, digest FROM ins
 UNION ALL
-SELECT id, registry, repository, tag, created_at, updated_at, deleted_at FROM images
-WHERE registry = $2 AND repository = $3 AND tag = $4
+SELECT id, registry, repository, tag, created_at, updated_at, deleted_at, digest FROM images
+WHERE registry = $2 AND repository = $3 AND tag = $4 AND digest = $5
   AND NOT EXISTS (SELECT 1 FROM ins)
 LIMIT 1
 `
@@ -146,6 +153,7 @@ type ImageFindOrCreateParams struct {
 	Registry   string    `json:"registry"`
 	Repository string    `json:"repository"`
 	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest"`
 }
 
 type ImageFindOrCreateRow struct {
@@ -156,6 +164,7 @@ type ImageFindOrCreateRow struct {
 	CreatedAt  pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
 	DeletedAt  pgtype.Timestamptz `json:"deleted_at"`
+	Digest     string             `json:"digest"`
 }
 
 func (q *Queries) ImageFindOrCreate(ctx context.Context, arg ImageFindOrCreateParams) (ImageFindOrCreateRow, error) {
@@ -164,6 +173,7 @@ func (q *Queries) ImageFindOrCreate(ctx context.Context, arg ImageFindOrCreatePa
 		arg.Registry,
 		arg.Repository,
 		arg.Tag,
+		arg.Digest,
 	)
 	var i ImageFindOrCreateRow
 	err := row.Scan(
@@ -174,6 +184,119 @@ func (q *Queries) ImageFindOrCreate(ctx context.Context, arg ImageFindOrCreatePa
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.Digest,
+	)
+	return i, err
+}
+
+const imageFindPinned = `-- name: ImageFindPinned :one
+SELECT i.id, i.registry, i.repository, i.tag, i.created_at, i.updated_at, i.deleted_at, i.digest
+FROM images i
+INNER JOIN images image ON image.id = $1
+WHERE i.registry = image.registry AND i.repository = image.repository AND i.tag = image.tag AND i.digest = $2
+LIMIT 1
+`
+
+type ImageFindPinnedParams struct {
+	ID     uuid.UUID `json:"id"`
+	Digest string    `json:"digest"`
+}
+
+// Find the image that pins the tag of an image to a digest
+func (q *Queries) ImageFindPinned(ctx context.Context, arg ImageFindPinnedParams) (Image, error) {
+	row := q.db.QueryRow(ctx, imageFindPinned, arg.ID, arg.Digest)
+	var i Image
+	err := row.Scan(
+		&i.ID,
+		&i.Registry,
+		&i.Repository,
+		&i.Tag,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Digest,
+	)
+	return i, err
+}
+
+const imagePinDigest = `-- name: ImagePinDigest :one
+UPDATE images
+SET digest = $2, updated_at = NOW()
+WHERE images.id = $1
+  AND images.digest = ''
+  AND NOT EXISTS (
+    SELECT 1 FROM images i
+    WHERE i.registry = images.registry AND i.repository = images.repository AND i.tag = images.tag AND i.digest = $2
+  )
+RETURNING id, registry, repository, tag, created_at, updated_at, deleted_at, digest
+`
+
+type ImagePinDigestParams struct {
+	ID     uuid.UUID `json:"id"`
+	Digest string    `json:"digest"`
+}
+
+// Pin an image created without a digest to the digest its tag resolves to, unless another
+// image already pins the same tag to it
+func (q *Queries) ImagePinDigest(ctx context.Context, arg ImagePinDigestParams) (Image, error) {
+	row := q.db.QueryRow(ctx, imagePinDigest, arg.ID, arg.Digest)
+	var i Image
+	err := row.Scan(
+		&i.ID,
+		&i.Registry,
+		&i.Repository,
+		&i.Tag,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Digest,
 	)
 	return i, err
 }
+
+const imageRepoint = `-- name: ImageRepoint :exec
+WITH d AS (
+    UPDATE deployments SET image_id = $1, updated_at = now() WHERE deployments.image_id = $2
+), b AS (
+    UPDATE builds SET image_id = $1, updated_at = now() WHERE builds.image_id = $2
+)
+UPDATE vms SET image_id = $1, updated_at = now() WHERE vms.image_id = $2
+`
+
+type ImageRepointParams struct {
+	ToID   uuid.UUID `json:"to_id"`
+	FromID uuid.UUID `json:"from_id"`
+}
+
+// Move everything that uses an image to another image, e.g. the image that pins the same tag to
+// its digest
+func (q *Queries) ImageRepoint(ctx context.Context, arg ImageRepointParams) error {
+	_, err := q.db.Exec(ctx, imageRepoint, arg.ToID, arg.FromID)
+	return err
+}
+
+const imageSBOMUpsert = `-- name: ImageSBOMUpsert :exec
+INSERT INTO image_sboms (id, image_id, format, document)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (image_id) DO UPDATE SET
+    format = EXCLUDED.format,
+    document = EXCLUDED.document,
+    updated_at = NOW()
+`
+
+type ImageSBOMUpsertParams struct {
+	ID       uuid.UUID       `json:"id"`
+	ImageID  uuid.UUID       `json:"image_id"`
+	Format   string          `json:"format"`
+	Document json.RawMessage `json:"document"`
+}
+
+func (q *Queries) ImageSBOMUpsert(ctx context.Context, arg ImageSBOMUpsertParams) error {
+	_, err := q.db.Exec(ctx, imageSBOMUpsert,
+		arg.ID,
+		arg.ImageID,
+		arg.Format,
+		arg.Document,
+	)
+	return err
+}
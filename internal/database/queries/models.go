@@ -6,6 +6,7 @@ package queries
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"net/netip"
 
@@ -13,6 +14,48 @@ import (
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
+type BuildMode string
+
+const (
+	BuildModeDockerfile BuildMode = "dockerfile"
+	BuildModeBuildpacks BuildMode = "buildpacks"
+)
+
+func (e *BuildMode) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = BuildMode(s)
+	case string:
+		*e = BuildMode(s)
+	default:
+		return fmt.Errorf("unsupported scan type for BuildMode: %T", src)
+	}
+	return nil
+}
+
+type NullBuildMode struct {
+	BuildMode BuildMode `json:"build_mode"`
+	Valid     bool      `json:"valid"` // Valid is true if BuildMode is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullBuildMode) Scan(value interface{}) error {
+	if value == nil {
+		ns.BuildMode, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.BuildMode.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullBuildMode) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.BuildMode), nil
+}
+
 type BuildStatus string
 
 const (
@@ -20,6 +63,7 @@ const (
 	BuildStatusBuilding  BuildStatus = "building"
 	BuildStatusSuccesful BuildStatus = "succesful"
 	BuildStatusFailed    BuildStatus = "failed"
+	BuildStatusCancelled BuildStatus = "cancelled"
 )
 
 func (e *BuildStatus) Scan(src interface{}) error {
@@ -57,6 +101,50 @@ func (ns NullBuildStatus) Value() (driver.Value, error) {
 	return string(ns.BuildStatus), nil
 }
 
+type CronJobRunStatus string
+
+const (
+	CronJobRunStatusPending   CronJobRunStatus = "pending"
+	CronJobRunStatusRunning   CronJobRunStatus = "running"
+	CronJobRunStatusSucceeded CronJobRunStatus = "succeeded"
+	CronJobRunStatusFailed    CronJobRunStatus = "failed"
+)
+
+func (e *CronJobRunStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = CronJobRunStatus(s)
+	case string:
+		*e = CronJobRunStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for CronJobRunStatus: %T", src)
+	}
+	return nil
+}
+
+type NullCronJobRunStatus struct {
+	CronJobRunStatus CronJobRunStatus `json:"cron_job_run_status"`
+	Valid            bool             `json:"valid"` // Valid is true if CronJobRunStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullCronJobRunStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.CronJobRunStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.CronJobRunStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullCronJobRunStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.CronJobRunStatus), nil
+}
+
 type DeploymentStatus string
 
 const (
@@ -104,6 +192,49 @@ func (ns NullDeploymentStatus) Value() (driver.Value, error) {
 	return string(ns.DeploymentStatus), nil
 }
 
+type RolloutStatus string
+
+const (
+	RolloutStatusInProgress RolloutStatus = "in_progress"
+	RolloutStatusCompleted  RolloutStatus = "completed"
+	RolloutStatusRolledBack RolloutStatus = "rolled_back"
+)
+
+func (e *RolloutStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = RolloutStatus(s)
+	case string:
+		*e = RolloutStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for RolloutStatus: %T", src)
+	}
+	return nil
+}
+
+type NullRolloutStatus struct {
+	RolloutStatus RolloutStatus `json:"rollout_status"`
+	Valid         bool          `json:"valid"` // Valid is true if RolloutStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullRolloutStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.RolloutStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.RolloutStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullRolloutStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.RolloutStatus), nil
+}
+
 type ServerStatus string
 
 const (
@@ -148,6 +279,50 @@ func (ns NullServerStatus) Value() (driver.Value, error) {
 	return string(ns.ServerStatus), nil
 }
 
+type SourceProvider string
+
+const (
+	SourceProviderGithub    SourceProvider = "github"
+	SourceProviderGitlab    SourceProvider = "gitlab"
+	SourceProviderBitbucket SourceProvider = "bitbucket"
+	SourceProviderGit       SourceProvider = "git"
+)
+
+func (e *SourceProvider) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = SourceProvider(s)
+	case string:
+		*e = SourceProvider(s)
+	default:
+		return fmt.Errorf("unsupported scan type for SourceProvider: %T", src)
+	}
+	return nil
+}
+
+type NullSourceProvider struct {
+	SourceProvider SourceProvider `json:"source_provider"`
+	Valid          bool           `json:"valid"` // Valid is true if SourceProvider is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullSourceProvider) Scan(value interface{}) error {
+	if value == nil {
+		ns.SourceProvider, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.SourceProvider.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullSourceProvider) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.SourceProvider), nil
+}
+
 type VmStatus string
 
 const (
@@ -194,6 +369,62 @@ func (ns NullVmStatus) Value() (driver.Value, error) {
 	return string(ns.VmStatus), nil
 }
 
+type VulnerabilitySeverity string
+
+const (
+	VulnerabilitySeverityLow      VulnerabilitySeverity = "low"
+	VulnerabilitySeverityMedium   VulnerabilitySeverity = "medium"
+	VulnerabilitySeverityHigh     VulnerabilitySeverity = "high"
+	VulnerabilitySeverityCritical VulnerabilitySeverity = "critical"
+)
+
+func (e *VulnerabilitySeverity) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = VulnerabilitySeverity(s)
+	case string:
+		*e = VulnerabilitySeverity(s)
+	default:
+		return fmt.Errorf("unsupported scan type for VulnerabilitySeverity: %T", src)
+	}
+	return nil
+}
+
+type NullVulnerabilitySeverity struct {
+	VulnerabilitySeverity VulnerabilitySeverity `json:"vulnerability_severity"`
+	Valid                 bool                  `json:"valid"` // Valid is true if VulnerabilitySeverity is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullVulnerabilitySeverity) Scan(value interface{}) error {
+	if value == nil {
+		ns.VulnerabilitySeverity, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.VulnerabilitySeverity.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullVulnerabilitySeverity) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.VulnerabilitySeverity), nil
+}
+
+type ApiToken struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	TokenHash      string             `json:"token_hash"`
+	UserID         uuid.UUID          `json:"user_id"`
+	LastUsedAt     pgtype.Timestamptz `json:"last_used_at"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
 type Build struct {
 	ID                  uuid.UUID          `json:"id"`
 	Status              BuildStatus        `json:"status"`
@@ -212,6 +443,10 @@ type Build struct {
 	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
 	ProcessingBy        uuid.UUID          `json:"processing_by"`
 	ProcessingStartedAt pgtype.Timestamptz `json:"processing_started_at"`
+	Priority            int32              `json:"priority"`
+	QueuePosition       pgtype.Int4        `json:"queue_position"`
+	CancelledAt         pgtype.Timestamptz `json:"cancelled_at"`
+	SourceUploadID      uuid.UUID          `json:"source_upload_id"`
 }
 
 type BuildLog struct {
@@ -223,6 +458,32 @@ type BuildLog struct {
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 }
 
+type BuildStep struct {
+	ID             uuid.UUID          `json:"id"`
+	BuildID        uuid.UUID          `json:"build_id"`
+	Vertex         string             `json:"vertex"`
+	Number         int32              `json:"number"`
+	Name           string             `json:"name"`
+	Cached         bool               `json:"cached"`
+	Error          string             `json:"error"`
+	StartedAt      pgtype.Timestamptz `json:"started_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type BuildVariable struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	Value          string             `json:"value"`
+	Secret         bool               `json:"secret"`
+	ProjectID      uuid.UUID          `json:"project_id"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
 type CertmagicDatum struct {
 	Key      string             `json:"key"`
 	Value    string             `json:"value"`
@@ -234,27 +495,82 @@ type CertmagicLock struct {
 	Expires pgtype.Timestamptz `json:"expires"`
 }
 
-type Deployment struct {
+type CronJob struct {
 	ID             uuid.UUID          `json:"id"`
-	Status         DeploymentStatus   `json:"status"`
-	GithubCommit   string             `json:"github_commit"`
+	Name           string             `json:"name"`
+	Schedule       string             `json:"schedule"`
+	Command        string             `json:"command"`
+	Timeout        int32              `json:"timeout"`
 	ProjectID      uuid.UUID          `json:"project_id"`
-	BuildID        uuid.UUID          `json:"build_id"`
-	ImageID        uuid.UUID          `json:"image_id"`
+	EnvironmentID  uuid.UUID          `json:"environment_id"`
+	NextRunAt      pgtype.Timestamptz `json:"next_run_at"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type CronJobRun struct {
+	ID             uuid.UUID          `json:"id"`
+	CronJobID      uuid.UUID          `json:"cron_job_id"`
+	DeploymentID   uuid.UUID          `json:"deployment_id"`
 	VmID           uuid.UUID          `json:"vm_id"`
-	PendingAt      pgtype.Timestamptz `json:"pending_at"`
-	BuildingAt     pgtype.Timestamptz `json:"building_at"`
-	StartingAt     pgtype.Timestamptz `json:"starting_at"`
-	RunningAt      pgtype.Timestamptz `json:"running_at"`
-	StoppingAt     pgtype.Timestamptz `json:"stopping_at"`
-	StoppedAt      pgtype.Timestamptz `json:"stopped_at"`
-	FailedAt       pgtype.Timestamptz `json:"failed_at"`
+	Status         CronJobRunStatus   `json:"status"`
+	ExitCode       pgtype.Int4        `json:"exit_code"`
+	FailedReason   pgtype.Text        `json:"failed_reason"`
+	StartedAt      pgtype.Timestamptz `json:"started_at"`
+	FinishedAt     pgtype.Timestamptz `json:"finished_at"`
 	OrganisationID uuid.UUID          `json:"organisation_id"`
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
 	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
 }
 
+type CronJobRunLog struct {
+	ID             uuid.UUID          `json:"id"`
+	CronJobRunID   uuid.UUID          `json:"cron_job_run_id"`
+	Message        string             `json:"message"`
+	Level          string             `json:"level"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type Deployment struct {
+	ID               uuid.UUID          `json:"id"`
+	Status           DeploymentStatus   `json:"status"`
+	GithubCommit     string             `json:"github_commit"`
+	ProjectID        uuid.UUID          `json:"project_id"`
+	BuildID          uuid.UUID          `json:"build_id"`
+	ImageID          uuid.UUID          `json:"image_id"`
+	VmID             uuid.UUID          `json:"vm_id"`
+	PendingAt        pgtype.Timestamptz `json:"pending_at"`
+	BuildingAt       pgtype.Timestamptz `json:"building_at"`
+	StartingAt       pgtype.Timestamptz `json:"starting_at"`
+	RunningAt        pgtype.Timestamptz `json:"running_at"`
+	StoppingAt       pgtype.Timestamptz `json:"stopping_at"`
+	StoppedAt        pgtype.Timestamptz `json:"stopped_at"`
+	FailedAt         pgtype.Timestamptz `json:"failed_at"`
+	OrganisationID   uuid.UUID          `json:"organisation_id"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt        pgtype.Timestamptz `json:"deleted_at"`
+	EnvironmentID    uuid.UUID          `json:"environment_id"`
+	ReleaseVmID      uuid.UUID          `json:"release_vm_id"`
+	ReleasedAt       pgtype.Timestamptz `json:"released_at"`
+	FailedReason     pgtype.Text        `json:"failed_reason"`
+	SourceUploadID   uuid.UUID          `json:"source_upload_id"`
+	ReleaseStartedAt pgtype.Timestamptz `json:"release_started_at"`
+}
+
+type DeploymentLog struct {
+	ID             uuid.UUID          `json:"id"`
+	DeploymentID   uuid.UUID          `json:"deployment_id"`
+	Message        string             `json:"message"`
+	Level          string             `json:"level"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
 type Domain struct {
 	ID                      uuid.UUID          `json:"id"`
 	Name                    string             `json:"name"`
@@ -268,6 +584,25 @@ type Domain struct {
 	TxtVerificationRequired bool               `json:"txt_verification_required"`
 	RedirectTo              pgtype.Text        `json:"redirect_to"`
 	RedirectStatusCode      pgtype.Int4        `json:"redirect_status_code"`
+	EnvironmentID           uuid.UUID          `json:"environment_id"`
+	Internal                bool               `json:"internal"`
+}
+
+type Environment struct {
+	ID                uuid.UUID          `json:"id"`
+	Name              string             `json:"name"`
+	Slug              string             `json:"slug"`
+	ProjectID         uuid.UUID          `json:"project_id"`
+	Branch            string             `json:"branch"`
+	Vcpus             int32              `json:"vcpus"`
+	Memory            int32              `json:"memory"`
+	Replicas          int32              `json:"replicas"`
+	OrganisationID    uuid.UUID          `json:"organisation_id"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
+	Preview           bool               `json:"preview"`
+	GithubPullRequest pgtype.Int4        `json:"github_pull_request"`
 }
 
 type EnvironmentVariable struct {
@@ -279,6 +614,7 @@ type EnvironmentVariable struct {
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
 	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+	EnvironmentID  uuid.UUID          `json:"environment_id"`
 }
 
 type GithubInstallation struct {
@@ -300,16 +636,30 @@ type Image struct {
 	CreatedAt  pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
 	DeletedAt  pgtype.Timestamptz `json:"deleted_at"`
+	Digest     string             `json:"digest"`
+}
+
+type ImageSbom struct {
+	ID        uuid.UUID          `json:"id"`
+	ImageID   uuid.UUID          `json:"image_id"`
+	Format    string             `json:"format"`
+	Document  json.RawMessage    `json:"document"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
 }
 
 type Organisation struct {
-	ID           uuid.UUID          `json:"id"`
-	Name         string             `json:"name"`
-	Slug         string             `json:"slug"`
-	CreatedAt    pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
-	DeletedAt    pgtype.Timestamptz `json:"deleted_at"`
-	ProjectLimit int32              `json:"project_limit"`
+	ID                uuid.UUID          `json:"id"`
+	Name              string             `json:"name"`
+	Slug              string             `json:"slug"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
+	ProjectLimit      int32              `json:"project_limit"`
+	BuildTimeoutLimit int32              `json:"build_timeout_limit"`
+	BuildVcpusLimit   int32              `json:"build_vcpus_limit"`
+	BuildMemoryLimit  int32              `json:"build_memory_limit"`
 }
 
 type OrganisationMember struct {
@@ -321,18 +671,76 @@ type OrganisationMember struct {
 	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
 }
 
+type ProcessType struct {
+	ID             uuid.UUID          `json:"id"`
+	Name           string             `json:"name"`
+	Command        string             `json:"command"`
+	Replicas       int32              `json:"replicas"`
+	ProjectID      uuid.UUID          `json:"project_id"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
 type Project struct {
-	ID                   uuid.UUID          `json:"id"`
-	Name                 string             `json:"name"`
-	Slug                 string             `json:"slug"`
-	GithubRepository     string             `json:"github_repository"`
-	GithubInstallationID uuid.UUID          `json:"github_installation_id"`
-	OrganisationID       uuid.UUID          `json:"organisation_id"`
-	CreatedAt            pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
-	DeletedAt            pgtype.Timestamptz `json:"deleted_at"`
-	RootDirectory        string             `json:"root_directory"`
-	DockerfilePath       string             `json:"dockerfile_path"`
+	ID                        uuid.UUID                 `json:"id"`
+	Name                      string                    `json:"name"`
+	Slug                      string                    `json:"slug"`
+	GithubRepository          string                    `json:"github_repository"`
+	GithubInstallationID      uuid.UUID                 `json:"github_installation_id"`
+	OrganisationID            uuid.UUID                 `json:"organisation_id"`
+	CreatedAt                 pgtype.Timestamptz        `json:"created_at"`
+	UpdatedAt                 pgtype.Timestamptz        `json:"updated_at"`
+	DeletedAt                 pgtype.Timestamptz        `json:"deleted_at"`
+	RootDirectory             string                    `json:"root_directory"`
+	DockerfilePath            string                    `json:"dockerfile_path"`
+	RolloutSteps              []int32                   `json:"rollout_steps"`
+	PreviewDeployments        bool                      `json:"preview_deployments"`
+	ReleaseCommand            string                    `json:"release_command"`
+	CancelSupersededBuilds    bool                      `json:"cancel_superseded_builds"`
+	BuildTimeout              int32                     `json:"build_timeout"`
+	BuildVcpus                int32                     `json:"build_vcpus"`
+	BuildMemory               int32                     `json:"build_memory"`
+	BuildMode                 BuildMode                 `json:"build_mode"`
+	BuildpackBuilder          string                    `json:"buildpack_builder"`
+	VulnerabilityScan         bool                      `json:"vulnerability_scan"`
+	VulnerabilityFailSeverity NullVulnerabilitySeverity `json:"vulnerability_fail_severity"`
+	AllowExternalImages       bool                      `json:"allow_external_images"`
+	SourceProvider            SourceProvider            `json:"source_provider"`
+	SourceUrl                 string                    `json:"source_url"`
+	SourceToken               string                    `json:"source_token"`
+	SourceDeployKey           string                    `json:"source_deploy_key"`
+}
+
+type RegistryCredential struct {
+	ID             uuid.UUID          `json:"id"`
+	Registry       string             `json:"registry"`
+	Username       string             `json:"username"`
+	Password       string             `json:"password"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type Rollout struct {
+	ID               uuid.UUID          `json:"id"`
+	ProjectID        uuid.UUID          `json:"project_id"`
+	FromDeploymentID uuid.UUID          `json:"from_deployment_id"`
+	ToDeploymentID   uuid.UUID          `json:"to_deployment_id"`
+	Status           RolloutStatus      `json:"status"`
+	Step             int32              `json:"step"`
+	Weight           int32              `json:"weight"`
+	Requests         int32              `json:"requests"`
+	Errors           int32              `json:"errors"`
+	StepStartedAt    pgtype.Timestamptz `json:"step_started_at"`
+	CompletedAt      pgtype.Timestamptz `json:"completed_at"`
+	RolledBackAt     pgtype.Timestamptz `json:"rolled_back_at"`
+	OrganisationID   uuid.UUID          `json:"organisation_id"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt        pgtype.Timestamptz `json:"deleted_at"`
 }
 
 type Server struct {
@@ -347,6 +755,18 @@ type Server struct {
 	DeletedAt       pgtype.Timestamptz `json:"deleted_at"`
 }
 
+type SourceUpload struct {
+	ID             uuid.UUID          `json:"id"`
+	ProjectID      uuid.UUID          `json:"project_id"`
+	Digest         string             `json:"digest"`
+	Size           int32              `json:"size"`
+	Data           []byte             `json:"data"`
+	OrganisationID uuid.UUID          `json:"organisation_id"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
 type User struct {
 	ID                uuid.UUID          `json:"id"`
 	Name              string             `json:"name"`
@@ -361,25 +781,43 @@ type User struct {
 }
 
 type Vm struct {
-	ID           uuid.UUID          `json:"id"`
-	Vcpus        int32              `json:"vcpus"`
-	Memory       int32              `json:"memory"`
-	Status       VmStatus           `json:"status"`
-	ImageID      uuid.UUID          `json:"image_id"`
-	Port         pgtype.Int4        `json:"port"`
-	IpAddress    netip.Prefix       `json:"ip_address"`
-	Metadata     []byte             `json:"metadata"`
-	CreatedAt    pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
-	DeletedAt    pgtype.Timestamptz `json:"deleted_at"`
-	PendingAt    pgtype.Timestamptz `json:"pending_at"`
-	StartingAt   pgtype.Timestamptz `json:"starting_at"`
-	RunningAt    pgtype.Timestamptz `json:"running_at"`
-	StoppingAt   pgtype.Timestamptz `json:"stopping_at"`
-	StoppedAt    pgtype.Timestamptz `json:"stopped_at"`
-	FailedAt     pgtype.Timestamptz `json:"failed_at"`
-	EnvVariables pgtype.Text        `json:"env_variables"`
-	ServerID     uuid.UUID          `json:"server_id"`
+	ID                  uuid.UUID          `json:"id"`
+	Vcpus               int32              `json:"vcpus"`
+	Memory              int32              `json:"memory"`
+	Status              VmStatus           `json:"status"`
+	ImageID             uuid.UUID          `json:"image_id"`
+	Port                pgtype.Int4        `json:"port"`
+	IpAddress           netip.Prefix       `json:"ip_address"`
+	Metadata            []byte             `json:"metadata"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt           pgtype.Timestamptz `json:"updated_at"`
+	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
+	PendingAt           pgtype.Timestamptz `json:"pending_at"`
+	StartingAt          pgtype.Timestamptz `json:"starting_at"`
+	RunningAt           pgtype.Timestamptz `json:"running_at"`
+	StoppingAt          pgtype.Timestamptz `json:"stopping_at"`
+	StoppedAt           pgtype.Timestamptz `json:"stopped_at"`
+	FailedAt            pgtype.Timestamptz `json:"failed_at"`
+	EnvVariables        pgtype.Text        `json:"env_variables"`
+	ServerID            uuid.UUID          `json:"server_id"`
+	DeploymentID        uuid.UUID          `json:"deployment_id"`
+	Idle                bool               `json:"idle"`
+	ExitCode            pgtype.Int4        `json:"exit_code"`
+	DrainingAt          pgtype.Timestamptz `json:"draining_at"`
+	Process             string             `json:"process"`
+	Command             pgtype.Text        `json:"command"`
+	Build               bool               `json:"build"`
+	OrganisationID      uuid.UUID          `json:"organisation_id"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
+	JoiningDeploymentID uuid.UUID          `json:"joining_deployment_id"`
+}
+
+type VmInflightRequest struct {
+	ID        uuid.UUID          `json:"id"`
+	ServerID  uuid.UUID          `json:"server_id"`
+	VmID      uuid.UUID          `json:"vm_id"`
+	Requests  int32              `json:"requests"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 }
 
 type VmLog struct {
@@ -0,0 +1,37 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: organisation.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const organisationFirstByID = `-- name: OrganisationFirstByID :one
+SELECT id, name, slug, created_at, updated_at, deleted_at, project_limit, build_timeout_limit, build_vcpus_limit, build_memory_limit
+FROM organisations
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) OrganisationFirstByID(ctx context.Context, id uuid.UUID) (Organisation, error) {
+	row := q.db.QueryRow(ctx, organisationFirstByID, id)
+	var i Organisation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Slug,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.ProjectLimit,
+		&i.BuildTimeoutLimit,
+		&i.BuildVcpusLimit,
+		&i.BuildMemoryLimit,
+	)
+	return i, err
+}
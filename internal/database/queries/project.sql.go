@@ -11,8 +11,127 @@ import (
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
+const processTypeFindByProjectID = `-- name: ProcessTypeFindByProjectID :many
+SELECT id, name, command, replicas, project_id, organisation_id, created_at, updated_at, deleted_at
+FROM process_types
+WHERE project_id = $1
+  AND deleted_at IS NULL
+ORDER BY id
+`
+
+func (q *Queries) ProcessTypeFindByProjectID(ctx context.Context, projectID uuid.UUID) ([]ProcessType, error) {
+	rows, err := q.db.Query(ctx, processTypeFindByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ProcessType{}
+	for rows.Next() {
+		var i ProcessType
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Command,
+			&i.Replicas,
+			&i.ProjectID,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const processTypeFirstByID = `-- name: ProcessTypeFirstByID :one
+SELECT id, name, command, replicas, project_id, organisation_id, created_at, updated_at, deleted_at
+FROM process_types
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) ProcessTypeFirstByID(ctx context.Context, id uuid.UUID) (ProcessType, error) {
+	row := q.db.QueryRow(ctx, processTypeFirstByID, id)
+	var i ProcessType
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Command,
+		&i.Replicas,
+		&i.ProjectID,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const projectFindBySlug = `-- name: ProjectFindBySlug :many
+SELECT id, name, slug, github_repository, github_installation_id, organisation_id, created_at, updated_at, deleted_at, root_directory, dockerfile_path, rollout_steps, preview_deployments, release_command, cancel_superseded_builds, build_timeout, build_vcpus, build_memory, build_mode, buildpack_builder, vulnerability_scan, vulnerability_fail_severity, allow_external_images, source_provider, source_url, source_token, source_deploy_key
+FROM projects
+WHERE slug = $1
+  AND deleted_at IS NULL
+ORDER BY id
+`
+
+// Slugs are unique per organisation only
+func (q *Queries) ProjectFindBySlug(ctx context.Context, slug string) ([]Project, error) {
+	rows, err := q.db.Query(ctx, projectFindBySlug, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Project{}
+	for rows.Next() {
+		var i Project
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Slug,
+			&i.GithubRepository,
+			&i.GithubInstallationID,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.RootDirectory,
+			&i.DockerfilePath,
+			&i.RolloutSteps,
+			&i.PreviewDeployments,
+			&i.ReleaseCommand,
+			&i.CancelSupersededBuilds,
+			&i.BuildTimeout,
+			&i.BuildVcpus,
+			&i.BuildMemory,
+			&i.BuildMode,
+			&i.BuildpackBuilder,
+			&i.VulnerabilityScan,
+			&i.VulnerabilityFailSeverity,
+			&i.AllowExternalImages,
+			&i.SourceProvider,
+			&i.SourceUrl,
+			&i.SourceToken,
+			&i.SourceDeployKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const projectFirstByID = `-- name: ProjectFirstByID :one
-SELECT id, name, slug, github_repository, github_installation_id, organisation_id, created_at, updated_at, deleted_at, root_directory, dockerfile_path
+SELECT id, name, slug, github_repository, github_installation_id, organisation_id, created_at, updated_at, deleted_at, root_directory, dockerfile_path, rollout_steps, preview_deployments, release_command, cancel_superseded_builds, build_timeout, build_vcpus, build_memory, build_mode, buildpack_builder, vulnerability_scan, vulnerability_fail_severity, allow_external_images, source_provider, source_url, source_token, source_deploy_key
 FROM projects
 WHERE id = $1
   AND deleted_at IS NULL
@@ -33,6 +152,22 @@ func (q *Queries) ProjectFirstByID(ctx context.Context, id uuid.UUID) (Project,
 		&i.DeletedAt,
 		&i.RootDirectory,
 		&i.DockerfilePath,
+		&i.RolloutSteps,
+		&i.PreviewDeployments,
+		&i.ReleaseCommand,
+		&i.CancelSupersededBuilds,
+		&i.BuildTimeout,
+		&i.BuildVcpus,
+		&i.BuildMemory,
+		&i.BuildMode,
+		&i.BuildpackBuilder,
+		&i.VulnerabilityScan,
+		&i.VulnerabilityFailSeverity,
+		&i.AllowExternalImages,
+		&i.SourceProvider,
+		&i.SourceUrl,
+		&i.SourceToken,
+		&i.SourceDeployKey,
 	)
 	return i, err
 }
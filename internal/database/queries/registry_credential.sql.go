@@ -0,0 +1,44 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: registry_credential.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const registryCredentialFindByOrganisationID = `-- name: RegistryCredentialFindByOrganisationID :many
+SELECT registry, username, password FROM registry_credentials
+WHERE organisation_id = $1 AND deleted_at IS NULL
+ORDER BY registry
+`
+
+type RegistryCredentialFindByOrganisationIDRow struct {
+	Registry string `json:"registry"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (q *Queries) RegistryCredentialFindByOrganisationID(ctx context.Context, organisationID uuid.UUID) ([]RegistryCredentialFindByOrganisationIDRow, error) {
+	rows, err := q.db.Query(ctx, registryCredentialFindByOrganisationID, organisationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RegistryCredentialFindByOrganisationIDRow{}
+	for rows.Next() {
+		var i RegistryCredentialFindByOrganisationIDRow
+		if err := rows.Scan(&i.Registry, &i.Username, &i.Password); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,234 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: rollout.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const rolloutAdvanceStep = `-- name: RolloutAdvanceStep :exec
+UPDATE rollouts
+SET step = $2, weight = $3, requests = 0, errors = 0, step_started_at = now(), updated_at = now()
+WHERE id = $1
+`
+
+type RolloutAdvanceStepParams struct {
+	ID     uuid.UUID `json:"id"`
+	Step   int32     `json:"step"`
+	Weight int32     `json:"weight"`
+}
+
+// Moves the rollout to the next step and resets the traffic counters for it
+func (q *Queries) RolloutAdvanceStep(ctx context.Context, arg RolloutAdvanceStepParams) error {
+	_, err := q.db.Exec(ctx, rolloutAdvanceStep, arg.ID, arg.Step, arg.Weight)
+	return err
+}
+
+const rolloutCreate = `-- name: RolloutCreate :one
+INSERT INTO rollouts (id, project_id, from_deployment_id, to_deployment_id, weight, organisation_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, project_id, from_deployment_id, to_deployment_id, status, step, weight, requests, errors, step_started_at, completed_at, rolled_back_at, organisation_id, created_at, updated_at, deleted_at
+`
+
+type RolloutCreateParams struct {
+	ID               uuid.UUID `json:"id"`
+	ProjectID        uuid.UUID `json:"project_id"`
+	FromDeploymentID uuid.UUID `json:"from_deployment_id"`
+	ToDeploymentID   uuid.UUID `json:"to_deployment_id"`
+	Weight           int32     `json:"weight"`
+	OrganisationID   uuid.UUID `json:"organisation_id"`
+}
+
+func (q *Queries) RolloutCreate(ctx context.Context, arg RolloutCreateParams) (Rollout, error) {
+	row := q.db.QueryRow(ctx, rolloutCreate,
+		arg.ID,
+		arg.ProjectID,
+		arg.FromDeploymentID,
+		arg.ToDeploymentID,
+		arg.Weight,
+		arg.OrganisationID,
+	)
+	var i Rollout
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.FromDeploymentID,
+		&i.ToDeploymentID,
+		&i.Status,
+		&i.Step,
+		&i.Weight,
+		&i.Requests,
+		&i.Errors,
+		&i.StepStartedAt,
+		&i.CompletedAt,
+		&i.RolledBackAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const rolloutFindInProgressByEnvironmentID = `-- name: RolloutFindInProgressByEnvironmentID :many
+SELECT r.id, r.project_id, r.from_deployment_id, r.to_deployment_id, r.status, r.step, r.weight, r.requests, r.errors, r.step_started_at, r.completed_at, r.rolled_back_at, r.organisation_id, r.created_at, r.updated_at, r.deleted_at
+FROM rollouts r
+INNER JOIN deployments d ON r.to_deployment_id = d.id
+WHERE d.environment_id = $1
+  AND r.status = 'in_progress'
+  AND r.deleted_at IS NULL
+`
+
+func (q *Queries) RolloutFindInProgressByEnvironmentID(ctx context.Context, environmentID uuid.UUID) ([]Rollout, error) {
+	rows, err := q.db.Query(ctx, rolloutFindInProgressByEnvironmentID, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Rollout{}
+	for rows.Next() {
+		var i Rollout
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.FromDeploymentID,
+			&i.ToDeploymentID,
+			&i.Status,
+			&i.Step,
+			&i.Weight,
+			&i.Requests,
+			&i.Errors,
+			&i.StepStartedAt,
+			&i.CompletedAt,
+			&i.RolledBackAt,
+			&i.OrganisationID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rolloutFirstByID = `-- name: RolloutFirstByID :one
+SELECT id, project_id, from_deployment_id, to_deployment_id, status, step, weight, requests, errors, step_started_at, completed_at, rolled_back_at, organisation_id, created_at, updated_at, deleted_at
+FROM rollouts
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) RolloutFirstByID(ctx context.Context, id uuid.UUID) (Rollout, error) {
+	row := q.db.QueryRow(ctx, rolloutFirstByID, id)
+	var i Rollout
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.FromDeploymentID,
+		&i.ToDeploymentID,
+		&i.Status,
+		&i.Step,
+		&i.Weight,
+		&i.Requests,
+		&i.Errors,
+		&i.StepStartedAt,
+		&i.CompletedAt,
+		&i.RolledBackAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const rolloutFirstInProgressByToDeploymentID = `-- name: RolloutFirstInProgressByToDeploymentID :one
+SELECT id, project_id, from_deployment_id, to_deployment_id, status, step, weight, requests, errors, step_started_at, completed_at, rolled_back_at, organisation_id, created_at, updated_at, deleted_at
+FROM rollouts
+WHERE to_deployment_id = $1
+  AND status = 'in_progress'
+  AND deleted_at IS NULL
+LIMIT 1
+`
+
+func (q *Queries) RolloutFirstInProgressByToDeploymentID(ctx context.Context, toDeploymentID uuid.UUID) (Rollout, error) {
+	row := q.db.QueryRow(ctx, rolloutFirstInProgressByToDeploymentID, toDeploymentID)
+	var i Rollout
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.FromDeploymentID,
+		&i.ToDeploymentID,
+		&i.Status,
+		&i.Step,
+		&i.Weight,
+		&i.Requests,
+		&i.Errors,
+		&i.StepStartedAt,
+		&i.CompletedAt,
+		&i.RolledBackAt,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const rolloutMarkCompleted = `-- name: RolloutMarkCompleted :exec
+UPDATE rollouts
+SET status = 'completed', weight = 100, completed_at = COALESCE(completed_at, now()), updated_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) RolloutMarkCompleted(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, rolloutMarkCompleted, id)
+	return err
+}
+
+const rolloutMarkRolledBack = `-- name: RolloutMarkRolledBack :exec
+UPDATE rollouts
+SET status = 'rolled_back', weight = 0, rolled_back_at = COALESCE(rolled_back_at, now()), updated_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) RolloutMarkRolledBack(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, rolloutMarkRolledBack, id)
+	return err
+}
+
+const rolloutRecordTraffic = `-- name: RolloutRecordTraffic :exec
+UPDATE rollouts
+SET requests = requests + $1, errors = errors + $2, updated_at = now()
+WHERE id = $3
+  AND step = $4
+  AND status = 'in_progress'
+`
+
+type RolloutRecordTrafficParams struct {
+	Requests int32     `json:"requests"`
+	Errors   int32     `json:"errors"`
+	ID       uuid.UUID `json:"id"`
+	Step     int32     `json:"step"`
+}
+
+// Adds canary traffic observed by an edge proxy. Counts for a step that already ended are dropped.
+func (q *Queries) RolloutRecordTraffic(ctx context.Context, arg RolloutRecordTrafficParams) error {
+	_, err := q.db.Exec(ctx, rolloutRecordTraffic,
+		arg.Requests,
+		arg.Errors,
+		arg.ID,
+		arg.Step,
+	)
+	return err
+}
@@ -50,7 +50,6 @@ SELECT COALESCE(
      LIMIT 1),
     '10.1.0.0/20'::cidr
 )::cidr AS next_range
-FROM lock
 `
 
 // Allocate the next available /20 IP range for a new server.
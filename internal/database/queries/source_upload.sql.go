@@ -0,0 +1,78 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: source_upload.sql
+
+package queries
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const sourceUploadFirstByID = `-- name: SourceUploadFirstByID :one
+SELECT id, project_id, digest, size, data, organisation_id, created_at, updated_at, deleted_at
+FROM source_uploads
+WHERE id = $1
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) SourceUploadFirstByID(ctx context.Context, id uuid.UUID) (SourceUpload, error) {
+	row := q.db.QueryRow(ctx, sourceUploadFirstByID, id)
+	var i SourceUpload
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Digest,
+		&i.Size,
+		&i.Data,
+		&i.OrganisationID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const sourceUploadPurgeExpired = `-- name: SourceUploadPurgeExpired :many
+UPDATE source_uploads su
+SET data = NULL, deleted_at = now(), updated_at = now()
+WHERE su.created_at < $1
+  AND su.deleted_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM deployments d
+    WHERE d.source_upload_id = su.id
+      AND d.status IN ('pending', 'building')
+      AND d.deleted_at IS NULL
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM builds b
+    WHERE b.source_upload_id = su.id
+      AND b.status IN ('pending', 'building')
+      AND b.deleted_at IS NULL
+  )
+RETURNING su.id
+`
+
+// Clear the tarballs of uploads created before $1, unless a build of them is yet to run
+func (q *Queries) SourceUploadPurgeExpired(ctx context.Context, createdAt pgtype.Timestamptz) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, sourceUploadPurgeExpired, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -13,23 +13,52 @@ import (
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
 )
 
+const vMAllowsUnsignedImage = `-- name: VMAllowsUnsignedImage :one
+SELECT EXISTS (
+    SELECT 1 FROM projects p
+    INNER JOIN deployments d ON d.project_id = p.id
+    INNER JOIN vms v ON v.id = $1
+    WHERE p.allow_external_images
+      AND (d.id = v.deployment_id
+           OR (v.deployment_id IS NULL AND d.image_id = v.image_id AND p.organisation_id = v.organisation_id))
+)::boolean
+`
+
+// Whether a VM may boot an image without the cluster's signature: the project of its deployment,
+// or for VMs outside of deployments (release, cron, one-off) a project of the VM's organisation
+// deploying its image, allows external images
+func (q *Queries) VMAllowsUnsignedImage(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, vMAllowsUnsignedImage, id)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const vMCreate = `-- name: VMCreate :one
-INSERT INTO vms (id, vcpus, memory, status, image_id, server_id, port, ip_address, env_variables, metadata)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-RETURNING id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id
+INSERT INTO vms (id, vcpus, memory, status, image_id, server_id, port, ip_address, env_variables, metadata, deployment_id, idle, process, command, build, organisation_id, expires_at, joining_deployment_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+RETURNING id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id
 `
 
 type VMCreateParams struct {
-	ID           uuid.UUID    `json:"id"`
-	Vcpus        int32        `json:"vcpus"`
-	Memory       int32        `json:"memory"`
-	Status       VmStatus     `json:"status"`
-	ImageID      uuid.UUID    `json:"image_id"`
-	ServerID     uuid.UUID    `json:"server_id"`
-	Port         pgtype.Int4  `json:"port"`
-	IpAddress    netip.Prefix `json:"ip_address"`
-	EnvVariables pgtype.Text  `json:"env_variables"`
-	Metadata     []byte       `json:"metadata"`
+	ID                  uuid.UUID          `json:"id"`
+	Vcpus               int32              `json:"vcpus"`
+	Memory              int32              `json:"memory"`
+	Status              VmStatus           `json:"status"`
+	ImageID             uuid.UUID          `json:"image_id"`
+	ServerID            uuid.UUID          `json:"server_id"`
+	Port                pgtype.Int4        `json:"port"`
+	IpAddress           netip.Prefix       `json:"ip_address"`
+	EnvVariables        pgtype.Text        `json:"env_variables"`
+	Metadata            []byte             `json:"metadata"`
+	DeploymentID        uuid.UUID          `json:"deployment_id"`
+	Idle                bool               `json:"idle"`
+	Process             string             `json:"process"`
+	Command             pgtype.Text        `json:"command"`
+	Build               bool               `json:"build"`
+	OrganisationID      uuid.UUID          `json:"organisation_id"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
+	JoiningDeploymentID uuid.UUID          `json:"joining_deployment_id"`
 }
 
 func (q *Queries) VMCreate(ctx context.Context, arg VMCreateParams) (Vm, error) {
@@ -44,6 +73,14 @@ func (q *Queries) VMCreate(ctx context.Context, arg VMCreateParams) (Vm, error)
 		arg.IpAddress,
 		arg.EnvVariables,
 		arg.Metadata,
+		arg.DeploymentID,
+		arg.Idle,
+		arg.Process,
+		arg.Command,
+		arg.Build,
+		arg.OrganisationID,
+		arg.ExpiresAt,
+		arg.JoiningDeploymentID,
 	)
 	var i Vm
 	err := row.Scan(
@@ -66,12 +103,40 @@ func (q *Queries) VMCreate(ctx context.Context, arg VMCreateParams) (Vm, error)
 		&i.FailedAt,
 		&i.EnvVariables,
 		&i.ServerID,
+		&i.DeploymentID,
+		&i.Idle,
+		&i.ExitCode,
+		&i.DrainingAt,
+		&i.Process,
+		&i.Command,
+		&i.Build,
+		&i.OrganisationID,
+		&i.ExpiresAt,
+		&i.JoiningDeploymentID,
 	)
 	return i, err
 }
 
+const vMExtendExpiry = `-- name: VMExtendExpiry :exec
+UPDATE vms
+SET expires_at = $2, updated_at = now()
+WHERE id = $1
+  AND deleted_at IS NULL
+`
+
+type VMExtendExpiryParams struct {
+	ID        uuid.UUID          `json:"id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+// Push back the expiry of a VM that is still in use
+func (q *Queries) VMExtendExpiry(ctx context.Context, arg VMExtendExpiryParams) error {
+	_, err := q.db.Exec(ctx, vMExtendExpiry, arg.ID, arg.ExpiresAt)
+	return err
+}
+
 const vMFind = `-- name: VMFind :many
-SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id
 FROM vms
 `
 
@@ -104,6 +169,71 @@ func (q *Queries) VMFind(ctx context.Context) ([]Vm, error) {
 			&i.FailedAt,
 			&i.EnvVariables,
 			&i.ServerID,
+			&i.DeploymentID,
+			&i.Idle,
+			&i.ExitCode,
+			&i.DrainingAt,
+			&i.Process,
+			&i.Command,
+			&i.Build,
+			&i.OrganisationID,
+			&i.ExpiresAt,
+			&i.JoiningDeploymentID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const vMFindByDeploymentID = `-- name: VMFindByDeploymentID :many
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id FROM vms WHERE deployment_id = $1 AND deleted_at IS NULL ORDER BY id
+`
+
+// Find the live replicas of a deployment, oldest first
+func (q *Queries) VMFindByDeploymentID(ctx context.Context, deploymentID uuid.UUID) ([]Vm, error) {
+	rows, err := q.db.Query(ctx, vMFindByDeploymentID, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Vm{}
+	for rows.Next() {
+		var i Vm
+		if err := rows.Scan(
+			&i.ID,
+			&i.Vcpus,
+			&i.Memory,
+			&i.Status,
+			&i.ImageID,
+			&i.Port,
+			&i.IpAddress,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.PendingAt,
+			&i.StartingAt,
+			&i.RunningAt,
+			&i.StoppingAt,
+			&i.StoppedAt,
+			&i.FailedAt,
+			&i.EnvVariables,
+			&i.ServerID,
+			&i.DeploymentID,
+			&i.Idle,
+			&i.ExitCode,
+			&i.DrainingAt,
+			&i.Process,
+			&i.Command,
+			&i.Build,
+			&i.OrganisationID,
+			&i.ExpiresAt,
+			&i.JoiningDeploymentID,
 		); err != nil {
 			return nil, err
 		}
@@ -116,7 +246,7 @@ func (q *Queries) VMFind(ctx context.Context) ([]Vm, error) {
 }
 
 const vMFindByImageID = `-- name: VMFindByImageID :many
-SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id FROM vms WHERE image_id = $1
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id FROM vms WHERE image_id = $1
 `
 
 func (q *Queries) VMFindByImageID(ctx context.Context, imageID uuid.UUID) ([]Vm, error) {
@@ -148,6 +278,16 @@ func (q *Queries) VMFindByImageID(ctx context.Context, imageID uuid.UUID) ([]Vm,
 			&i.FailedAt,
 			&i.EnvVariables,
 			&i.ServerID,
+			&i.DeploymentID,
+			&i.Idle,
+			&i.ExitCode,
+			&i.DrainingAt,
+			&i.Process,
+			&i.Command,
+			&i.Build,
+			&i.OrganisationID,
+			&i.ExpiresAt,
+			&i.JoiningDeploymentID,
 		); err != nil {
 			return nil, err
 		}
@@ -160,7 +300,7 @@ func (q *Queries) VMFindByImageID(ctx context.Context, imageID uuid.UUID) ([]Vm,
 }
 
 const vMFindByServerID = `-- name: VMFindByServerID :many
-SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id FROM vms WHERE server_id = $1 AND deleted_at IS NULL
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id FROM vms WHERE server_id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) VMFindByServerID(ctx context.Context, serverID uuid.UUID) ([]Vm, error) {
@@ -192,6 +332,71 @@ func (q *Queries) VMFindByServerID(ctx context.Context, serverID uuid.UUID) ([]V
 			&i.FailedAt,
 			&i.EnvVariables,
 			&i.ServerID,
+			&i.DeploymentID,
+			&i.Idle,
+			&i.ExitCode,
+			&i.DrainingAt,
+			&i.Process,
+			&i.Command,
+			&i.Build,
+			&i.OrganisationID,
+			&i.ExpiresAt,
+			&i.JoiningDeploymentID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const vMFindJoiningByDeploymentID = `-- name: VMFindJoiningByDeploymentID :many
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id FROM vms WHERE joining_deployment_id = $1 AND deleted_at IS NULL ORDER BY id
+`
+
+// Find the new replicas of a running deployment that join it once healthy, oldest first
+func (q *Queries) VMFindJoiningByDeploymentID(ctx context.Context, joiningDeploymentID uuid.UUID) ([]Vm, error) {
+	rows, err := q.db.Query(ctx, vMFindJoiningByDeploymentID, joiningDeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Vm{}
+	for rows.Next() {
+		var i Vm
+		if err := rows.Scan(
+			&i.ID,
+			&i.Vcpus,
+			&i.Memory,
+			&i.Status,
+			&i.ImageID,
+			&i.Port,
+			&i.IpAddress,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.PendingAt,
+			&i.StartingAt,
+			&i.RunningAt,
+			&i.StoppingAt,
+			&i.StoppedAt,
+			&i.FailedAt,
+			&i.EnvVariables,
+			&i.ServerID,
+			&i.DeploymentID,
+			&i.Idle,
+			&i.ExitCode,
+			&i.DrainingAt,
+			&i.Process,
+			&i.Command,
+			&i.Build,
+			&i.OrganisationID,
+			&i.ExpiresAt,
+			&i.JoiningDeploymentID,
 		); err != nil {
 			return nil, err
 		}
@@ -204,7 +409,7 @@ func (q *Queries) VMFindByServerID(ctx context.Context, serverID uuid.UUID) ([]V
 }
 
 const vMFirstByID = `-- name: VMFirstByID :one
-SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id
+SELECT id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id
 FROM vms
 WHERE id = $1
 LIMIT 1
@@ -233,10 +438,77 @@ func (q *Queries) VMFirstByID(ctx context.Context, id uuid.UUID) (Vm, error) {
 		&i.FailedAt,
 		&i.EnvVariables,
 		&i.ServerID,
+		&i.DeploymentID,
+		&i.Idle,
+		&i.ExitCode,
+		&i.DrainingAt,
+		&i.Process,
+		&i.Command,
+		&i.Build,
+		&i.OrganisationID,
+		&i.ExpiresAt,
+		&i.JoiningDeploymentID,
 	)
 	return i, err
 }
 
+const vMInflightRequestsSum = `-- name: VMInflightRequestsSum :one
+SELECT COALESCE(SUM(requests), 0)::integer AS requests
+FROM vm_inflight_requests
+WHERE vm_id = $1
+  AND updated_at > now() - interval '30 seconds'
+`
+
+// Sum the in-flight requests to a VM over all edge proxies, ignoring reports of proxies that went away
+func (q *Queries) VMInflightRequestsSum(ctx context.Context, vmID uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, vMInflightRequestsSum, vmID)
+	var requests int32
+	err := row.Scan(&requests)
+	return requests, err
+}
+
+const vMJoinDeployment = `-- name: VMJoinDeployment :execrows
+UPDATE vms
+SET deployment_id = joining_deployment_id, joining_deployment_id = NULL, expires_at = NULL, updated_at = now()
+WHERE id = $1
+  AND joining_deployment_id IS NOT NULL
+  AND deleted_at IS NULL
+`
+
+// Add a healthy new replica to the deployment it was created for
+func (q *Queries) VMJoinDeployment(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, vMJoinDeployment, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const vMMarkDraining = `-- name: VMMarkDraining :exec
+UPDATE vms
+SET draining_at = COALESCE(draining_at, now()), updated_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) VMMarkDraining(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, vMMarkDraining, id)
+	return err
+}
+
+const vMMarkDrainingByDeploymentID = `-- name: VMMarkDrainingByDeploymentID :exec
+UPDATE vms
+SET draining_at = now(), updated_at = now()
+WHERE deployment_id = $1
+  AND draining_at IS NULL
+  AND deleted_at IS NULL
+`
+
+// Take all live replicas of a deployment out of edge routing
+func (q *Queries) VMMarkDrainingByDeploymentID(ctx context.Context, deploymentID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, vMMarkDrainingByDeploymentID, deploymentID)
+	return err
+}
+
 const vMNextIPAddress = `-- name: VMNextIPAddress :one
 SELECT set_masklen((network($1::inet) + gs)::inet, 31) AS free_ip
 FROM generate_series(1, (2 ^ (32 - masklen($1::inet)))::int - 2, 2) gs
@@ -276,8 +548,70 @@ func (q *Queries) VMSoftDelete(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const vMSoftDeleteExpired = `-- name: VMSoftDeleteExpired :many
+UPDATE vms
+SET deleted_at = now(), updated_at = now()
+WHERE expires_at < now()
+  AND deleted_at IS NULL
+RETURNING id
+`
+
+// Delete VMs whose expiry has passed, e.g. one-off VMs whose session went away
+func (q *Queries) VMSoftDeleteExpired(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, vMSoftDeleteExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const vMUpdateDeployment = `-- name: VMUpdateDeployment :exec
+UPDATE vms
+SET deployment_id = $2, updated_at = now()
+WHERE id = $1
+`
+
+type VMUpdateDeploymentParams struct {
+	ID           uuid.UUID `json:"id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+}
+
+func (q *Queries) VMUpdateDeployment(ctx context.Context, arg VMUpdateDeploymentParams) error {
+	_, err := q.db.Exec(ctx, vMUpdateDeployment, arg.ID, arg.DeploymentID)
+	return err
+}
+
+const vMUpdateExitCode = `-- name: VMUpdateExitCode :exec
+UPDATE vms
+SET exit_code = $2, updated_at = now()
+WHERE id = $1
+`
+
+type VMUpdateExitCodeParams struct {
+	ID       uuid.UUID   `json:"id"`
+	ExitCode pgtype.Int4 `json:"exit_code"`
+}
+
+// Record the exit code of the app, reported by the guest before it powers off
+func (q *Queries) VMUpdateExitCode(ctx context.Context, arg VMUpdateExitCodeParams) error {
+	_, err := q.db.Exec(ctx, vMUpdateExitCode, arg.ID, arg.ExitCode)
+	return err
+}
+
 const vMUpdateStatus = `-- name: VMUpdateStatus :one
-update vms set status = $1 where id=$2 returning id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id
+update vms set status = $1 where id=$2 returning id, vcpus, memory, status, image_id, port, ip_address, metadata, created_at, updated_at, deleted_at, pending_at, starting_at, running_at, stopping_at, stopped_at, failed_at, env_variables, server_id, deployment_id, idle, exit_code, draining_at, process, command, build, organisation_id, expires_at, joining_deployment_id
 `
 
 type VMUpdateStatusParams struct {
@@ -308,6 +642,16 @@ func (q *Queries) VMUpdateStatus(ctx context.Context, arg VMUpdateStatusParams)
 		&i.FailedAt,
 		&i.EnvVariables,
 		&i.ServerID,
+		&i.DeploymentID,
+		&i.Idle,
+		&i.ExitCode,
+		&i.DrainingAt,
+		&i.Process,
+		&i.Command,
+		&i.Build,
+		&i.OrganisationID,
+		&i.ExpiresAt,
+		&i.JoiningDeploymentID,
 	)
 	return i, err
 }
@@ -11,12 +11,12 @@ LIMIT 1;
 
 -- name: BuildClaimLease :one
 -- Atomically claim a build lease for processing on a server.
--- Succeeds if the build is pending/building and either unclaimed, already
--- claimed by this server, or the previous lease is stale.
+-- Succeeds if the build is pending/building (or cancelled, to release its VM) and
+-- either unclaimed, already claimed by this server, or the previous lease is stale.
 UPDATE builds
 SET processing_by = $2, processing_started_at = now()
 WHERE id = $1
-  AND status IN ('pending', 'building')
+  AND status IN ('pending', 'building', 'cancelled')
   AND deleted_at IS NULL
   AND (
     processing_by IS NULL
@@ -39,11 +39,13 @@ INSERT INTO builds (
     project_id,
     github_commit,
     github_branch,
+    priority,
     organisation_id,
+    source_upload_id,
     created_at,
     updated_at
 )
-VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 RETURNING *;
 
 
@@ -56,27 +58,95 @@ LIMIT 1;
 -- name: BuildMarkBuilding :exec
 UPDATE builds
 SET status = 'building', building_at = now(), vm_id = $2
-WHERE id = $1;
+WHERE id = $1
+  AND status = 'pending';
+
+-- name: BuildResetPending :exec
+-- Start a build over on a new VM, e.g. after the server of its VM went away
+UPDATE builds
+SET status = 'pending', building_at = NULL, vm_id = NULL
+WHERE id = $1
+  AND status IN ('pending', 'building');
 
 -- name: BuildMarkSuccessful :exec
+-- A cancelled build stays cancelled
 UPDATE builds
 SET status = 'succesful', successful_at = now(), image_id = $2
-WHERE id = $1;
+WHERE id = $1
+  AND status IN ('pending', 'building');
 
 -- name: BuildMarkFailed :exec
 UPDATE builds
 SET status = 'failed', failed_at = now()
-WHERE id = $1;
+WHERE id = $1
+  AND status IN ('pending', 'building');
+
+-- name: BuildCancelSuperseded :many
+-- Cancel the in-flight builds of a project branch that were created before the given build
+UPDATE builds
+SET status = 'cancelled', cancelled_at = now()
+WHERE project_id = $1
+  AND github_branch = $2
+  AND id < $3
+  AND status IN ('pending', 'building')
+  AND deleted_at IS NULL
+RETURNING *;
 
 -- name: BuildLogCreate :exec
 INSERT INTO build_logs (id, build_id, message, level, organisation_id, created_at)
 VALUES ($1, $2, $3, $4, $5, NOW());
 
+-- name: BuildStepUpsert :exec
+INSERT INTO build_steps (id, build_id, vertex, number, name, cached, error, started_at, completed_at, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+ON CONFLICT (build_id, vertex) DO UPDATE SET
+    cached = EXCLUDED.cached,
+    error = EXCLUDED.error,
+    started_at = COALESCE(EXCLUDED.started_at, build_steps.started_at),
+    completed_at = COALESCE(EXCLUDED.completed_at, build_steps.completed_at);
+
 -- name: BuildFindByVMID :many
 SELECT * FROM builds WHERE vm_id = $1;
 
+-- name: BuildFindRunningByServerID :many
+-- Builds with a VM on a server, which runs them
+SELECT b.* FROM builds b
+JOIN vms v ON v.id = b.vm_id
+WHERE v.server_id = $1
+  AND v.deleted_at IS NULL
+  AND b.status IN ('pending', 'building', 'cancelled')
+  AND b.deleted_at IS NULL;
+
 -- name: BuildFindWaitingForBuildImage :many
 SELECT * FROM builds 
 WHERE status IN ('pending', 'building') 
   AND image_id IS NULL 
   AND deleted_at IS NULL;
+
+-- name: BuildFindQueued :many
+-- Pending builds in queue order: higher priority first, then first in first out
+SELECT *
+FROM builds
+WHERE status = 'pending'
+  AND deleted_at IS NULL
+ORDER BY priority DESC, id;
+
+-- name: BuildCountBuildingByOrganisation :many
+SELECT organisation_id, count(*)::integer AS builds
+FROM builds
+WHERE status = 'building'
+  AND deleted_at IS NULL
+GROUP BY organisation_id;
+
+-- name: BuildUpdateQueuePosition :exec
+UPDATE builds
+SET queue_position = $2
+WHERE id = $1;
+
+-- name: BuildExistsByImageIDAndOrganisationID :one
+-- Whether the cluster built an image for an organisation
+SELECT EXISTS (
+    SELECT 1 FROM builds
+    WHERE image_id = $1
+      AND organisation_id = $2
+)::boolean;
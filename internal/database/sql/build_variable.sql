@@ -0,0 +1,4 @@
+-- name: BuildVariableFindByProjectID :many
+SELECT name, value, secret FROM build_variables
+WHERE project_id = $1 AND deleted_at IS NULL
+ORDER BY name;
@@ -0,0 +1,65 @@
+-- name: CronJobFirstByID :one
+SELECT *
+FROM cron_jobs
+WHERE id = $1
+LIMIT 1;
+
+-- name: CronJobFindActive :many
+SELECT *
+FROM cron_jobs
+WHERE deleted_at IS NULL;
+
+-- name: CronJobUpdateNextRun :exec
+UPDATE cron_jobs
+SET next_run_at = $2, updated_at = now()
+WHERE id = $1;
+
+-- name: CronJobRunCreate :one
+INSERT INTO cron_job_runs (id, cron_job_id, deployment_id, status, organisation_id)
+VALUES ($1, $2, $3, 'pending', $4)
+RETURNING *;
+
+-- name: CronJobRunFirstByID :one
+SELECT *
+FROM cron_job_runs
+WHERE id = $1
+LIMIT 1;
+
+-- name: CronJobRunFindUnfinished :many
+SELECT *
+FROM cron_job_runs
+WHERE finished_at IS NULL
+  AND deleted_at IS NULL;
+
+-- name: CronJobRunFindUnfinishedByCronJobID :many
+SELECT *
+FROM cron_job_runs
+WHERE cron_job_id = $1
+  AND finished_at IS NULL
+  AND deleted_at IS NULL;
+
+-- name: CronJobRunUpdateVM :one
+UPDATE cron_job_runs
+SET vm_id = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: CronJobRunMarkRunning :one
+UPDATE cron_job_runs
+SET status = 'running', started_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: CronJobRunMarkSucceeded :exec
+UPDATE cron_job_runs
+SET status = 'succeeded', exit_code = $2, finished_at = now(), updated_at = now()
+WHERE id = $1;
+
+-- name: CronJobRunMarkFailed :exec
+UPDATE cron_job_runs
+SET status = 'failed', exit_code = $2, failed_reason = $3, finished_at = now(), updated_at = now()
+WHERE id = $1;
+
+-- name: CronJobRunLogCreate :exec
+INSERT INTO cron_job_run_logs (id, cron_job_run_id, message, level, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, now());
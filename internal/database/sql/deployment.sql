@@ -16,7 +16,7 @@ LIMIT 1;
 
 -- name: DeploymentUpdateBuild :one
 UPDATE deployments
-SET build_id = $2, building_at = COALESCE(building_at, now()), updated_at = now()
+SET build_id = $2, status = 'building', building_at = COALESCE(building_at, now()), updated_at = now()
 WHERE id = $1
 RETURNING *;
 
@@ -27,41 +27,99 @@ WHERE id = $1
 RETURNING *;
 
 -- name: DeploymentUpdateVM :one
+-- Link the primary replica. Running deployments keep their status when a replica is replaced.
 UPDATE deployments
-SET vm_id = $2, starting_at = COALESCE(starting_at, now()), updated_at = now()
+SET vm_id = $2,
+    status = CASE WHEN running_at IS NULL THEN 'starting' ELSE status END,
+    starting_at = COALESCE(starting_at, now()),
+    updated_at = now()
 WHERE id = $1
 RETURNING *;
 
 -- name: DeploymentMarkRunning :exec
 UPDATE deployments
-SET running_at = COALESCE(running_at, now()), updated_at = now()
+SET status = 'running', running_at = COALESCE(running_at, now()), updated_at = now()
 WHERE id = $1;
 
--- name: DeploymentUpdateFailedAt :exec
+-- name: DeploymentUpdateReleaseVM :one
 UPDATE deployments
-SET failed_at = COALESCE(failed_at, now()), updated_at = now()
+SET release_vm_id = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeploymentMarkReleaseStarted :one
+UPDATE deployments
+SET release_started_at = now(), updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeploymentMarkReleased :one
+UPDATE deployments
+SET released_at = COALESCE(released_at, now()), updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeploymentLogCreate :exec
+INSERT INTO deployment_logs (id, deployment_id, message, level, organisation_id, created_at)
+VALUES ($1, $2, $3, $4, $5, NOW());
+
+-- name: DeploymentMarkFailed :exec
+UPDATE deployments
+SET status = 'failed', failed_at = COALESCE(failed_at, now()), failed_reason = COALESCE(failed_reason, $2), updated_at = now()
 WHERE id = $1;
 
 -- name: DeploymentFindByBuildID :many
 SELECT * FROM deployments WHERE build_id = $1;
 
 -- name: DeploymentFindByVMID :one
-SELECT * FROM deployments WHERE vm_id = $1 LIMIT 1;
+-- Find the deployment a VM (any of its replicas) belongs to
+SELECT d.* FROM deployments d
+INNER JOIN vms v ON v.deployment_id = d.id
+WHERE v.id = $1
+LIMIT 1;
 
 -- name: DeploymentFindRunningAndOlder :many
--- Find all running deployments for a project, older than the specified deployment
+-- Find all running deployments of an environment, older than the specified deployment (newest first).
+-- Deployments are ordered by their build first: a redeployment of an environment reuses the build of
+-- the deployment it replaces, and is older than deployments of new builds created before it.
 SELECT * FROM deployments
-WHERE project_id = $1
-  AND id < $2
-  AND running_at IS NOT NULL
-  AND stopped_at IS NULL
-  AND failed_at IS NULL
-  AND deleted_at IS NULL;
+WHERE deployments.environment_id = $1
+  AND (deployments.build_id, deployments.id) < (SELECT d.build_id, d.id FROM deployments d WHERE d.id = $2)
+  AND deployments.running_at IS NOT NULL
+  AND deployments.stopping_at IS NULL
+  AND deployments.stopped_at IS NULL
+  AND deployments.failed_at IS NULL
+  AND deployments.deleted_at IS NULL
+ORDER BY build_id DESC, id DESC;
+
+-- name: DeploymentExistsRunningAndNewer :one
+-- Whether a running deployment of an environment is newer than the specified deployment, in the order
+-- of DeploymentFindRunningAndOlder
+SELECT EXISTS (
+    SELECT 1 FROM deployments
+    WHERE deployments.environment_id = $1
+      AND (deployments.build_id, deployments.id) > (SELECT d.build_id, d.id FROM deployments d WHERE d.id = $2)
+      AND deployments.running_at IS NOT NULL
+      AND deployments.stopping_at IS NULL
+      AND deployments.stopped_at IS NULL
+      AND deployments.failed_at IS NULL
+      AND deployments.deleted_at IS NULL
+);
 
 
+-- name: DeploymentMarkStopping :exec
+-- Take a deployment out of edge routing. It is marked stopped once its VMs are drained.
+UPDATE deployments
+SET status = CASE WHEN failed_at IS NULL THEN 'stopping' ELSE status END,
+    stopping_at = COALESCE(stopping_at, now()),
+    updated_at = now()
+WHERE id = $1;
+
 -- name: DeploymentMarkStopped :exec
 UPDATE deployments
-SET stopped_at = COALESCE(stopped_at, now()), updated_at = now()
+SET status = CASE WHEN failed_at IS NULL THEN 'stopped' ELSE status END,
+    stopped_at = COALESCE(stopped_at, now()),
+    updated_at = now()
 WHERE id = $1;
 
 -- name: VMLogCreate :exec
@@ -69,11 +127,17 @@ INSERT INTO vm_logs (id, vm_id, message, level, created_at)
 VALUES ($1, $2, $3, $4, NOW());
 
 -- name: DeploymentFindRunningByServerID :many
--- Find all running deployments whose VM is on a specific server.
+-- Find all running deployments with at least one replica on a specific server.
 SELECT d.* FROM deployments d
-INNER JOIN vms v ON d.vm_id = v.id
-WHERE v.server_id = $1
-  AND d.status = 'running'
+WHERE EXISTS (
+    SELECT 1 FROM vms v
+    WHERE v.deployment_id = d.id
+      AND v.server_id = $1
+      AND v.deleted_at IS NULL
+  )
+  AND d.running_at IS NOT NULL
+  AND d.stopped_at IS NULL
+  AND d.failed_at IS NULL
   AND d.deleted_at IS NULL;
 
 -- name: DeploymentFindNewest :one
@@ -81,4 +145,36 @@ SELECT *
 FROM deployments 
 WHERE project_id = $1 
 ORDER BY id DESC 
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+
+-- name: DeploymentLatestRunningByEnvironmentID :one
+-- Find the newest deployment serving an environment
+SELECT *
+FROM deployments
+WHERE environment_id = $1
+  AND running_at IS NOT NULL
+  AND stopping_at IS NULL
+  AND stopped_at IS NULL
+  AND failed_at IS NULL
+  AND deleted_at IS NULL
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: DeploymentFindRunningByProjectID :many
+SELECT *
+FROM deployments
+WHERE project_id = $1
+  AND running_at IS NOT NULL
+  AND stopping_at IS NULL
+  AND stopped_at IS NULL
+  AND failed_at IS NULL
+  AND deleted_at IS NULL;
+
+-- name: DeploymentFindActiveByEnvironmentID :many
+-- Find all deployments of an environment that are not in a terminal state
+SELECT *
+FROM deployments
+WHERE environment_id = $1
+  AND stopped_at IS NULL
+  AND failed_at IS NULL
+  AND deleted_at IS NULL;
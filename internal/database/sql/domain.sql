@@ -15,10 +15,18 @@ SELECT *
 FROM domains
 WHERE name = $1 AND id != $2 AND deleted_at IS NULL;
 
--- name: DomainUpdateDeploymentForProject :exec
--- Update all custom domains (non-zeitwork.app) for a project to point to a new deployment
+-- name: DomainUpdateDeploymentForEnvironment :exec
+-- Update all domains of an environment, except the internal domains of single deployments,
+-- to point to a new deployment
 UPDATE domains
 SET deployment_id = $1, updated_at = now()
-WHERE project_id = $2
-  AND name NOT LIKE '%.zeitwork.app'
+WHERE environment_id = $2
+  AND NOT internal
+  AND deleted_at IS NULL;
+
+-- name: DomainSoftDeleteByEnvironmentID :exec
+-- Soft-delete all domains of an environment
+UPDATE domains
+SET deleted_at = now(), verified_at = NULL, updated_at = now()
+WHERE environment_id = $1
   AND deleted_at IS NULL;
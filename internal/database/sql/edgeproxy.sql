@@ -1,17 +1,32 @@
 -- name: RouteFindActive :many
--- Domains -> Deployment -> VM -> Server
--- Returns routes with server info so the edge proxy knows which server hosts each VM.
+-- Domains -> Deployment -> VMs -> Server
+-- Returns one row per replica with server info so the edge proxy knows which server hosts each VM.
+-- Stopping deployments and draining replicas are left out so they only finish in-flight requests.
+-- Only web processes are routed.
 -- With L2 routing between servers, the edge proxy can reach any VM directly by IP.
+-- Custom domains of a deployment with an in-progress rollout also carry the canary replicas
+-- and the percentage of traffic they should receive.
 SELECT d.name       AS domain_name,
        v.port       AS vm_port,
        v.id         AS vm_id,
        v.ip_address AS vm_ip,
        v.server_id  AS server_id,
        d.redirect_to AS redirect_to,
-       d.redirect_status_code AS redirect_status_code
+       d.redirect_status_code AS redirect_status_code,
+       r.id         AS rollout_id,
+       r.step       AS rollout_step,
+       r.weight     AS rollout_weight,
+       cv.port      AS canary_vm_port,
+       cv.id        AS canary_vm_id,
+       cv.ip_address AS canary_vm_ip,
+       cv.server_id AS canary_server_id
 FROM domains d
-         LEFT JOIN deployments dep ON d.deployment_id = dep.id AND dep.stopped_at IS NULL AND dep.failed_at IS NULL AND dep.deleted_at IS NULL
-         LEFT JOIN vms v ON dep.vm_id = v.id AND v.deleted_at IS NULL
+         LEFT JOIN deployments dep ON d.deployment_id = dep.id AND dep.stopping_at IS NULL AND dep.stopped_at IS NULL AND dep.failed_at IS NULL AND dep.deleted_at IS NULL
+         LEFT JOIN vms v ON v.deployment_id = dep.id AND v.process = 'web' AND v.draining_at IS NULL AND v.deleted_at IS NULL
+         LEFT JOIN rollouts r ON r.from_deployment_id = dep.id AND r.status = 'in_progress' AND r.deleted_at IS NULL
+                                 AND NOT d.internal
+         LEFT JOIN deployments cdep ON r.to_deployment_id = cdep.id AND cdep.stopping_at IS NULL AND cdep.stopped_at IS NULL AND cdep.failed_at IS NULL AND cdep.deleted_at IS NULL
+         LEFT JOIN vms cv ON cv.deployment_id = cdep.id AND cv.process = 'web' AND cv.draining_at IS NULL AND cv.deleted_at IS NULL
 WHERE d.verified_at IS NOT NULL
   AND d.deleted_at IS NULL
   AND (v.id IS NOT NULL OR d.redirect_to IS NOT NULL)
@@ -22,3 +37,13 @@ ORDER BY d.name;
 SELECT verified_at
 FROM domains
 WHERE name = $1 AND deleted_at IS NULL;
+
+-- name: VMInflightRequestsUpsert :exec
+-- Report the in-flight requests this edge proxy has open to a VM
+INSERT INTO vm_inflight_requests (id, server_id, vm_id, requests, updated_at)
+VALUES ($1, $2, $3, $4, now())
+ON CONFLICT (server_id, vm_id) DO UPDATE SET requests = EXCLUDED.requests, updated_at = now();
+
+-- name: VMInflightRequestsDelete :exec
+DELETE FROM vm_inflight_requests
+WHERE server_id = $1 AND vm_id = $2;
@@ -0,0 +1,19 @@
+-- name: EnvironmentFirstByID :one
+SELECT *
+FROM environments
+WHERE id = $1
+LIMIT 1;
+
+-- name: EnvironmentFindDeleted :many
+-- Find soft-deleted environments, e.g. previews of deleted branches, that may still need cleanup
+SELECT *
+FROM environments
+WHERE deleted_at IS NOT NULL;
+
+-- name: EnvironmentFirstByProjectIDAndSlug :one
+SELECT *
+FROM environments
+WHERE project_id = $1
+  AND slug = $2
+  AND deleted_at IS NULL
+LIMIT 1;
@@ -1,3 +1,3 @@
--- name: EnvironmentVariableFindByProjectID :many
-SELECT name, value FROM environment_variables 
-WHERE project_id = $1 AND deleted_at IS NULL;
+-- name: EnvironmentVariableFindByEnvironmentID :many
+SELECT name, value FROM environment_variables
+WHERE environment_id = $1 AND deleted_at IS NULL;
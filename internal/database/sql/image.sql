@@ -13,21 +13,60 @@ where registry = $1
 limit 1;
 
 -- name: ImageCreate :one
-insert into images (id, registry, repository, tag)
-VALUES ($1, $2, $3, $4)
+insert into images (id, registry, repository, tag, digest)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING *;
 
 
 -- name: ImageFindOrCreate :one
 WITH ins AS (
-    INSERT INTO images (id, registry, repository, tag)
-    VALUES ($1, $2, $3, $4)
-    ON CONFLICT (registry, repository, tag) DO NOTHING
+    INSERT INTO images (id, registry, repository, tag, digest)
+    VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT (registry, repository, tag, digest) DO NOTHING
     RETURNING *
 )
 SELECT * FROM ins
 UNION ALL
 SELECT * FROM images
-WHERE registry = $2 AND repository = $3 AND tag = $4
+WHERE registry = $2 AND repository = $3 AND tag = $4 AND digest = $5
   AND NOT EXISTS (SELECT 1 FROM ins)
 LIMIT 1;
+
+-- name: ImagePinDigest :one
+-- Pin an image created without a digest to the digest its tag resolves to, unless another
+-- image already pins the same tag to it
+UPDATE images
+SET digest = $2, updated_at = NOW()
+WHERE images.id = $1
+  AND images.digest = ''
+  AND NOT EXISTS (
+    SELECT 1 FROM images i
+    WHERE i.registry = images.registry AND i.repository = images.repository AND i.tag = images.tag AND i.digest = $2
+  )
+RETURNING *;
+
+-- name: ImageFindPinned :one
+-- Find the image that pins the tag of an image to a digest
+SELECT i.*
+FROM images i
+INNER JOIN images image ON image.id = @id
+WHERE i.registry = image.registry AND i.repository = image.repository AND i.tag = image.tag AND i.digest = @digest
+LIMIT 1;
+
+-- name: ImageRepoint :exec
+-- Move everything that uses an image to another image, e.g. the image that pins the same tag to
+-- its digest
+WITH d AS (
+    UPDATE deployments SET image_id = @to_id, updated_at = now() WHERE deployments.image_id = @from_id
+), b AS (
+    UPDATE builds SET image_id = @to_id, updated_at = now() WHERE builds.image_id = @from_id
+)
+UPDATE vms SET image_id = @to_id, updated_at = now() WHERE vms.image_id = @from_id;
+
+-- name: ImageSBOMUpsert :exec
+INSERT INTO image_sboms (id, image_id, format, document)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (image_id) DO UPDATE SET
+    format = EXCLUDED.format,
+    document = EXCLUDED.document,
+    updated_at = NOW();
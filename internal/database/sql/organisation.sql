@@ -0,0 +1,5 @@
+-- name: OrganisationFirstByID :one
+SELECT *
+FROM organisations
+WHERE id = $1
+LIMIT 1;
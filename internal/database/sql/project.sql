@@ -3,3 +3,24 @@ SELECT *
 FROM projects
 WHERE id = $1
   AND deleted_at IS NULL;
+
+-- name: ProcessTypeFirstByID :one
+SELECT *
+FROM process_types
+WHERE id = $1
+LIMIT 1;
+
+-- name: ProcessTypeFindByProjectID :many
+SELECT *
+FROM process_types
+WHERE project_id = $1
+  AND deleted_at IS NULL
+ORDER BY id;
+
+-- name: ProjectFindBySlug :many
+-- Slugs are unique per organisation only
+SELECT *
+FROM projects
+WHERE slug = $1
+  AND deleted_at IS NULL
+ORDER BY id;
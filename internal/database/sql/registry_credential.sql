@@ -0,0 +1,4 @@
+-- name: RegistryCredentialFindByOrganisationID :many
+SELECT registry, username, password FROM registry_credentials
+WHERE organisation_id = $1 AND deleted_at IS NULL
+ORDER BY registry;
@@ -0,0 +1,50 @@
+-- name: RolloutCreate :one
+INSERT INTO rollouts (id, project_id, from_deployment_id, to_deployment_id, weight, organisation_id)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: RolloutFirstByID :one
+SELECT *
+FROM rollouts
+WHERE id = $1
+LIMIT 1;
+
+-- name: RolloutFirstInProgressByToDeploymentID :one
+SELECT *
+FROM rollouts
+WHERE to_deployment_id = $1
+  AND status = 'in_progress'
+  AND deleted_at IS NULL
+LIMIT 1;
+
+-- name: RolloutFindInProgressByEnvironmentID :many
+SELECT r.*
+FROM rollouts r
+INNER JOIN deployments d ON r.to_deployment_id = d.id
+WHERE d.environment_id = $1
+  AND r.status = 'in_progress'
+  AND r.deleted_at IS NULL;
+
+-- name: RolloutAdvanceStep :exec
+-- Moves the rollout to the next step and resets the traffic counters for it
+UPDATE rollouts
+SET step = $2, weight = $3, requests = 0, errors = 0, step_started_at = now(), updated_at = now()
+WHERE id = $1;
+
+-- name: RolloutMarkCompleted :exec
+UPDATE rollouts
+SET status = 'completed', weight = 100, completed_at = COALESCE(completed_at, now()), updated_at = now()
+WHERE id = $1;
+
+-- name: RolloutMarkRolledBack :exec
+UPDATE rollouts
+SET status = 'rolled_back', weight = 0, rolled_back_at = COALESCE(rolled_back_at, now()), updated_at = now()
+WHERE id = $1;
+
+-- name: RolloutRecordTraffic :exec
+-- Adds canary traffic observed by an edge proxy. Counts for a step that already ended are dropped.
+UPDATE rollouts
+SET requests = requests + sqlc.arg(requests), errors = errors + sqlc.arg(errors), updated_at = now()
+WHERE id = sqlc.arg(id)
+  AND step = sqlc.arg(step)
+  AND status = 'in_progress';
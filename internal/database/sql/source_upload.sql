@@ -0,0 +1,25 @@
+-- name: SourceUploadFirstByID :one
+SELECT *
+FROM source_uploads
+WHERE id = $1
+  AND deleted_at IS NULL;
+
+-- name: SourceUploadPurgeExpired :many
+-- Clear the tarballs of uploads created before $1, unless a build of them is yet to run
+UPDATE source_uploads su
+SET data = NULL, deleted_at = now(), updated_at = now()
+WHERE su.created_at < $1
+  AND su.deleted_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM deployments d
+    WHERE d.source_upload_id = su.id
+      AND d.status IN ('pending', 'building')
+      AND d.deleted_at IS NULL
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM builds b
+    WHERE b.source_upload_id = su.id
+      AND b.status IN ('pending', 'building')
+      AND b.deleted_at IS NULL
+  )
+RETURNING su.id;
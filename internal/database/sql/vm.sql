@@ -12,8 +12,8 @@ LIMIT 1;
 update vms set status = $1 where id=$2 returning *;
 
 -- name: VMCreate :one
-INSERT INTO vms (id, vcpus, memory, status, image_id, server_id, port, ip_address, env_variables, metadata)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+INSERT INTO vms (id, vcpus, memory, status, image_id, server_id, port, ip_address, env_variables, metadata, deployment_id, idle, process, command, build, organisation_id, expires_at, joining_deployment_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 RETURNING *;
 
 -- name: VMNextIPAddress :one
@@ -31,6 +31,12 @@ WHERE NOT EXISTS (
 ORDER BY gs
 LIMIT 1;
 
+-- name: VMUpdateExitCode :exec
+-- Record the exit code of the app, reported by the guest before it powers off
+UPDATE vms
+SET exit_code = $2, updated_at = now()
+WHERE id = $1;
+
 -- name: VMSoftDelete :exec
 UPDATE vms
 SET deleted_at = COALESCE(deleted_at, now())
@@ -41,3 +47,72 @@ SELECT * FROM vms WHERE image_id = $1;
 
 -- name: VMFindByServerID :many
 SELECT * FROM vms WHERE server_id = $1 AND deleted_at IS NULL;
+
+-- name: VMFindByDeploymentID :many
+-- Find the live replicas of a deployment, oldest first
+SELECT * FROM vms WHERE deployment_id = $1 AND deleted_at IS NULL ORDER BY id;
+
+-- name: VMFindJoiningByDeploymentID :many
+-- Find the new replicas of a running deployment that join it once healthy, oldest first
+SELECT * FROM vms WHERE joining_deployment_id = $1 AND deleted_at IS NULL ORDER BY id;
+
+-- name: VMJoinDeployment :execrows
+-- Add a healthy new replica to the deployment it was created for
+UPDATE vms
+SET deployment_id = joining_deployment_id, joining_deployment_id = NULL, expires_at = NULL, updated_at = now()
+WHERE id = $1
+  AND joining_deployment_id IS NOT NULL
+  AND deleted_at IS NULL;
+
+-- name: VMMarkDraining :exec
+UPDATE vms
+SET draining_at = COALESCE(draining_at, now()), updated_at = now()
+WHERE id = $1;
+
+-- name: VMMarkDrainingByDeploymentID :exec
+-- Take all live replicas of a deployment out of edge routing
+UPDATE vms
+SET draining_at = now(), updated_at = now()
+WHERE deployment_id = $1
+  AND draining_at IS NULL
+  AND deleted_at IS NULL;
+
+-- name: VMInflightRequestsSum :one
+-- Sum the in-flight requests to a VM over all edge proxies, ignoring reports of proxies that went away
+SELECT COALESCE(SUM(requests), 0)::integer AS requests
+FROM vm_inflight_requests
+WHERE vm_id = $1
+  AND updated_at > now() - interval '30 seconds';
+
+-- name: VMUpdateDeployment :exec
+UPDATE vms
+SET deployment_id = $2, updated_at = now()
+WHERE id = $1;
+
+-- name: VMAllowsUnsignedImage :one
+-- Whether a VM may boot an image without the cluster's signature: the project of its deployment,
+-- or for VMs outside of deployments (release, cron, one-off) a project of the VM's organisation
+-- deploying its image, allows external images
+SELECT EXISTS (
+    SELECT 1 FROM projects p
+    INNER JOIN deployments d ON d.project_id = p.id
+    INNER JOIN vms v ON v.id = $1
+    WHERE p.allow_external_images
+      AND (d.id = v.deployment_id
+           OR (v.deployment_id IS NULL AND d.image_id = v.image_id AND p.organisation_id = v.organisation_id))
+)::boolean;
+
+-- name: VMExtendExpiry :exec
+-- Push back the expiry of a VM that is still in use
+UPDATE vms
+SET expires_at = $2, updated_at = now()
+WHERE id = $1
+  AND deleted_at IS NULL;
+
+-- name: VMSoftDeleteExpired :many
+-- Delete VMs whose expiry has passed, e.g. one-off VMs whose session went away
+UPDATE vms
+SET deleted_at = now(), updated_at = now()
+WHERE expires_at < now()
+  AND deleted_at IS NULL
+RETURNING id;
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -28,21 +29,37 @@ type Config struct {
 	// and zeitwork service coordinate route-change notifications through the same DB.
 	DB *database.DB
 
+	// ServerID identifies this edge proxy when reporting in-flight requests, so VMs
+	// being replaced are only deleted once no edge proxy is still using them.
+	ServerID uuid.UUID
+
 	// RouteChangeNotify receives signals when routes may have changed
 	// (from the WAL listener). The edge proxy debounces these and reloads.
 	RouteChangeNotify <-chan struct{}
 }
 
-// Route represents routing information for a domain.
+// Backend is a single VM replica serving a route.
 // With L2 routing between servers, the edge proxy proxies directly to the VM IP.
 // The kernel routing table handles cross-server delivery via VLAN host routes.
+type Backend struct {
+	Port     int32     // VM's port
+	IP       string    // VM's IP address
+	ServerID uuid.UUID // Server hosting the VM
+	VmID     uuid.UUID // VM serving this route
+}
+
+// Route represents routing information for a domain.
 type Route struct {
-	Port               int32     // VM's port
-	IP                 string    // VM's IP address
-	ServerID           uuid.UUID // Server hosting the VM
-	VmID               uuid.UUID // VM serving this route
+	Backends           []Backend // Replicas of the deployment, requests are spread randomly
 	RedirectTo         string    // Optional redirect URL
 	RedirectStatusCode int32     // Optional redirect status code
+
+	// Canary is set while a rollout shifts traffic from this route's deployment
+	// to a new one. CanaryWeight percent of requests are sent to the canary replicas.
+	Canary       []Backend
+	CanaryWeight int32
+	RolloutID    uuid.UUID
+	RolloutStep  int32
 }
 
 // Service is the edgeproxy service
@@ -54,8 +71,19 @@ type Service struct {
 	httpsServer *http.Server
 	certmagic   *certmagic.Config
 	routes      map[string]Route // domain -> route info
+	routedVMs   map[uuid.UUID]struct{}
 	mu          sync.RWMutex
 	cancel      context.CancelFunc
+
+	// Canary traffic counters, flushed to the rollouts table periodically
+	rolloutStatsMu sync.Mutex
+	rolloutStats   map[rolloutStatsKey]*rolloutStatsCounter
+
+	// In-flight requests per VM, flushed to the vm_inflight_requests table periodically
+	inflightMu sync.Mutex
+	inflight   map[uuid.UUID]int32
+	// VMs with a row in vm_inflight_requests, only used by the flush loop
+	inflightReported map[uuid.UUID]struct{}
 }
 
 // NewService creates a new edgeproxy service
@@ -129,11 +157,15 @@ func NewService(cfg Config, logger *slog.Logger) (*Service, error) {
 	}
 
 	s := &Service{
-		cfg:       cfg,
-		db:        db,
-		logger:    logger,
-		certmagic: certmagicConfig,
-		routes:    make(map[string]Route),
+		cfg:          cfg,
+		db:           db,
+		logger:       logger,
+		certmagic:    certmagicConfig,
+		routes:       make(map[string]Route),
+		rolloutStats: make(map[rolloutStatsKey]*rolloutStatsCounter),
+		inflight:     make(map[uuid.UUID]int32),
+
+		inflightReported: make(map[uuid.UUID]struct{}),
 	}
 
 	s.httpServer = &http.Server{
@@ -159,6 +191,12 @@ func (s *Service) Start(ctx context.Context) error {
 	// Start WAL-driven route refresh with fallback polling
 	go s.refreshRoutesLoop(ctx)
 
+	// Report canary traffic for in-progress rollouts
+	go s.flushRolloutStatsLoop(ctx)
+
+	// Report in-flight requests so draining VMs are deleted once idle
+	go s.flushInflightLoop(ctx)
+
 	s.httpsServer = &http.Server{
 		Addr:         s.cfg.HTTPSAddr,
 		Handler:      http.HandlerFunc(s.serveHTTPS),
@@ -212,6 +250,7 @@ func (s *Service) loadRoutes(ctx context.Context) error {
 	}
 
 	newRoutes := make(map[string]Route)
+	routedVMs := make(map[uuid.UUID]struct{})
 	for _, row := range rows {
 		// Handle redirects first (doesn't need a VM IP)
 		if row.RedirectTo.Valid {
@@ -227,24 +266,56 @@ func (s *Service) loadRoutes(ctx context.Context) error {
 			continue
 		}
 
+		// Rows are returned per replica (and per canary replica during a rollout),
+		// so collect the distinct VMs of each domain.
+		route := newRoutes[row.DomainName]
+
 		// With L2 routing, we proxy directly to the VM IP regardless of which
 		// server it's on. The kernel routing table (host routes per-server)
 		// delivers packets across the VLAN transparently.
-		newRoutes[row.DomainName] = Route{
+		route.Backends = appendBackend(route.Backends, Backend{
 			IP:       row.VmIp.Addr().String(),
 			Port:     row.VmPort.Int32,
 			ServerID: row.ServerID,
 			VmID:     row.VmID,
+		})
+		routedVMs[row.VmID] = struct{}{}
+
+		// Split traffic with the canary replicas of an in-progress rollout, once they have an IP
+		if row.RolloutID.Valid && row.CanaryVmIp.IsValid() {
+			route.Canary = appendBackend(route.Canary, Backend{
+				IP:       row.CanaryVmIp.Addr().String(),
+				Port:     row.CanaryVmPort.Int32,
+				ServerID: row.CanaryServerID,
+				VmID:     row.CanaryVmID,
+			})
+			routedVMs[row.CanaryVmID] = struct{}{}
+			route.CanaryWeight = row.RolloutWeight.Int32
+			route.RolloutID = row.RolloutID
+			route.RolloutStep = row.RolloutStep.Int32
 		}
+
+		newRoutes[row.DomainName] = route
 	}
 
 	s.mu.Lock()
 	s.routes = newRoutes
+	s.routedVMs = routedVMs
 	s.mu.Unlock()
 
 	return nil
 }
 
+// appendBackend adds a backend unless a backend for the same VM is already present.
+func appendBackend(backends []Backend, backend Backend) []Backend {
+	for _, b := range backends {
+		if b.VmID == backend.VmID {
+			return backends
+		}
+	}
+	return append(backends, backend)
+}
+
 // refreshRoutesLoop reloads routes when notified via WAL changes,
 // with a 100ms debounce window and a 60-second fallback poll.
 func (s *Service) refreshRoutesLoop(ctx context.Context) {
@@ -327,9 +398,18 @@ func (s *Service) serveHTTPS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Pick a replica. During a rollout a weighted share of requests goes to the canary.
+	backends := route.Backends
+	canary := len(route.Canary) > 0 && rand.Int32N(100) < route.CanaryWeight
+	if canary {
+		backends = route.Canary
+		s.recordRolloutTraffic(route.RolloutID, route.RolloutStep, 1, 0)
+	}
+	backend := backends[rand.IntN(len(backends))]
+
 	// Proxy directly to the VM. With L2 routing, the kernel routing table
 	// handles delivery to VMs on other servers via VLAN host routes.
-	targetURL := fmt.Sprintf("http://%s:%d", route.IP, route.Port)
+	targetURL := fmt.Sprintf("http://%s:%d", backend.IP, backend.Port)
 
 	target, err := url.Parse(targetURL)
 	if err != nil {
@@ -349,9 +429,12 @@ func (s *Service) serveHTTPS(w http.ResponseWriter, r *http.Request) {
 		req.Header.Set("X-Real-IP", r.RemoteAddr)
 	}
 
-	zeitworkID := base58.Encode(route.ServerID.Bytes[:]) + ":" + base58.Encode(route.VmID.Bytes[:])
+	zeitworkID := base58.Encode(backend.ServerID.Bytes[:]) + ":" + base58.Encode(backend.VmID.Bytes[:])
 
 	proxy.ModifyResponse = func(resp *http.Response) error {
+		if canary && resp.StatusCode >= 500 {
+			s.recordRolloutTraffic(route.RolloutID, route.RolloutStep, 0, 1)
+		}
 		resp.Header.Set("Server", "Zeitwork")
 		resp.Header.Set("X-Zeitwork-Id", zeitworkID)
 		return nil
@@ -359,10 +442,16 @@ func (s *Service) serveHTTPS(w http.ResponseWriter, r *http.Request) {
 
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		s.logger.Warn("proxy error", "host", host, "target", targetURL, "error", err)
+		if canary {
+			s.recordRolloutTraffic(route.RolloutID, route.RolloutStep, 0, 1)
+		}
 		w.Header().Set("Server", "Zeitwork")
 		w.Header().Set("X-Zeitwork-Id", zeitworkID)
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 	}
 
+	s.trackInflight(backend.VmID, 1)
+	defer s.trackInflight(backend.VmID, -1)
+
 	proxy.ServeHTTP(w, r)
 }
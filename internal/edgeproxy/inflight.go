@@ -0,0 +1,85 @@
+package edgeproxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// trackInflight adjusts the number of requests currently proxied to a VM.
+func (s *Service) trackInflight(vmID uuid.UUID, delta int32) {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+
+	s.inflight[vmID] += delta
+}
+
+// flushInflightLoop periodically reports the in-flight requests to draining VMs to the
+// database, where the VM reconciler uses them to tell when a draining VM is idle.
+// Draining VMs are the ones the route table no longer has. VMs that serve traffic are not
+// reported, so edge nodes only write while a drain is in progress.
+// Reports are refreshed on every flush, the reconciler ignores reports that went stale.
+func (s *Service) flushInflightLoop(ctx context.Context) {
+	const flushInterval = 2 * time.Second
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushInflight(ctx)
+		}
+	}
+}
+
+func (s *Service) flushInflight(ctx context.Context) {
+	s.inflightMu.Lock()
+	inflight := make(map[uuid.UUID]int32, len(s.inflight))
+	for vmID, requests := range s.inflight {
+		inflight[vmID] = requests
+		if requests == 0 {
+			delete(s.inflight, vmID)
+		}
+	}
+	s.inflightMu.Unlock()
+
+	s.mu.RLock()
+	routedVMs := s.routedVMs
+	s.mu.RUnlock()
+
+	for vmID, requests := range inflight {
+		_, routed := routedVMs[vmID]
+		if requests == 0 || routed {
+			// Only clear reports this proxy made
+			if _, ok := s.inflightReported[vmID]; !ok {
+				continue
+			}
+			delete(s.inflightReported, vmID)
+			err := s.db.VMInflightRequestsDelete(ctx, queries.VMInflightRequestsDeleteParams{
+				ServerID: s.cfg.ServerID,
+				VmID:     vmID,
+			})
+			if err != nil {
+				s.logger.Error("failed to clear in-flight requests", "vm_id", vmID, "error", err)
+			}
+			continue
+		}
+
+		err := s.db.VMInflightRequestsUpsert(ctx, queries.VMInflightRequestsUpsertParams{
+			ID:       uuid.New(),
+			ServerID: s.cfg.ServerID,
+			VmID:     vmID,
+			Requests: requests,
+		})
+		if err != nil {
+			s.logger.Error("failed to report in-flight requests", "vm_id", vmID, "error", err)
+			continue
+		}
+		s.inflightReported[vmID] = struct{}{}
+	}
+}
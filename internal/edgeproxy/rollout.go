@@ -0,0 +1,75 @@
+package edgeproxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// rolloutStatsKey identifies the step of a rollout that traffic was observed for.
+// Counts are kept per step so that traffic from a previous step is never
+// attributed to the next one.
+type rolloutStatsKey struct {
+	RolloutID uuid.UUID
+	Step      int32
+}
+
+type rolloutStatsCounter struct {
+	Requests int32
+	Errors   int32
+}
+
+// recordRolloutTraffic counts requests and errors (5xx or proxy failures)
+// served by the canary of a rollout.
+func (s *Service) recordRolloutTraffic(rolloutID uuid.UUID, step int32, requests, errors int32) {
+	s.rolloutStatsMu.Lock()
+	defer s.rolloutStatsMu.Unlock()
+
+	key := rolloutStatsKey{RolloutID: rolloutID, Step: step}
+	counter, ok := s.rolloutStats[key]
+	if !ok {
+		counter = &rolloutStatsCounter{}
+		s.rolloutStats[key] = counter
+	}
+	counter.Requests += requests
+	counter.Errors += errors
+}
+
+// flushRolloutStatsLoop periodically writes the canary traffic counters to the
+// database, where the deployment reconciler uses them to promote or roll back.
+func (s *Service) flushRolloutStatsLoop(ctx context.Context) {
+	const flushInterval = 10 * time.Second
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushRolloutStats(ctx)
+		}
+	}
+}
+
+func (s *Service) flushRolloutStats(ctx context.Context) {
+	s.rolloutStatsMu.Lock()
+	stats := s.rolloutStats
+	s.rolloutStats = make(map[rolloutStatsKey]*rolloutStatsCounter)
+	s.rolloutStatsMu.Unlock()
+
+	for key, counter := range stats {
+		err := s.db.RolloutRecordTraffic(ctx, queries.RolloutRecordTrafficParams{
+			ID:       key.RolloutID,
+			Step:     key.Step,
+			Requests: counter.Requests,
+			Errors:   counter.Errors,
+		})
+		if err != nil {
+			s.logger.Error("failed to record rollout traffic", "rollout_id", key.RolloutID, "error", err)
+		}
+	}
+}
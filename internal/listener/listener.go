@@ -25,11 +25,16 @@ type Config struct {
 	PublicationName     string
 
 	// Handlers for each table
-	OnDeployment Handler
-	OnBuild      Handler
-	OnVM         Handler
-	OnDomain     Handler
-	OnServer     Handler
+	OnDeployment  Handler
+	OnBuild       Handler
+	OnVM          Handler
+	OnDomain      Handler
+	OnServer      Handler
+	OnRollout     Handler
+	OnEnvironment Handler
+	OnCronJob     Handler
+	OnCronJobRun  Handler
+	OnProcessType Handler
 }
 
 // Listener streams PostgreSQL WAL changes and dispatches to handlers
@@ -108,7 +113,12 @@ func (l *Listener) setupReplication(ctx context.Context) error {
 			images,
 			vms,
 			domains,
-			servers
+			servers,
+			rollouts,
+			environments,
+			cron_jobs,
+			cron_job_runs,
+			process_types
 		`, l.config.PublicationName)
 
 	// Drop and recreate publication (idempotent setup)
@@ -364,6 +374,26 @@ func (l *Listener) handleChange(ctx context.Context, relationID uint32, tuple *p
 		if l.config.OnServer != nil {
 			l.config.OnServer(ctx, id)
 		}
+	case "rollouts":
+		if l.config.OnRollout != nil {
+			l.config.OnRollout(ctx, id)
+		}
+	case "environments":
+		if l.config.OnEnvironment != nil {
+			l.config.OnEnvironment(ctx, id)
+		}
+	case "cron_jobs":
+		if l.config.OnCronJob != nil {
+			l.config.OnCronJob(ctx, id)
+		}
+	case "cron_job_runs":
+		if l.config.OnCronJobRun != nil {
+			l.config.OnCronJobRun(ctx, id)
+		}
+	case "process_types":
+		if l.config.OnProcessType != nil {
+			l.config.OnProcessType(ctx, id)
+		}
 	default:
 		slog.Debug("ignoring change for unhandled table", "table", relation.RelationName)
 	}
@@ -0,0 +1,168 @@
+// Package registry handles OCI distribution registries: the credentials of the registries images
+// are pulled from and pushed to, and the registry a zeitwork daemon can serve itself.
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// dockerHub is the host Docker Hub images are referred to by. Docker Hub is also reached as
+// index.docker.io and registry-1.docker.io.
+const dockerHub = "docker.io"
+
+// Credentials authenticate against a registry. Insecure registries are reached over plain HTTP.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// String formats the credentials for skopeo's --creds flags.
+func (c Credentials) String() string {
+	return c.Username + ":" + c.Password
+}
+
+// Host returns the registry host of an image reference, or of a registry URL with a path. Like
+// docker, the first path component is a host if it contains a dot or a colon or is localhost,
+// otherwise the image is on Docker Hub.
+func Host(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker://")
+	first, _, found := strings.Cut(ref, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return dockerHub
+	}
+	return normalizeHost(first)
+}
+
+// normalizeHost maps the aliases of Docker Hub to docker.io.
+func normalizeHost(host string) string {
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHub
+	}
+	return host
+}
+
+// Auth holds the credentials of registries by host, and of repositories by name prefix, e.g.
+// ghcr.io/zeitwork/app. Repository credentials apply to images under that prefix only.
+type Auth map[string]Credentials
+
+// ParseAuth parses registry credentials from JSON, e.g.
+// {"registry.example.com": {"username": "ci", "password": "..."}}.
+func ParseAuth(s string) (Auth, error) {
+	a := Auth{}
+	if strings.TrimSpace(s) == "" {
+		return a, nil
+	}
+	var parsed map[string]Credentials
+	if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid registry credentials: %w", err)
+	}
+	for host, c := range parsed {
+		a.Set(host, c)
+	}
+	return a, nil
+}
+
+// URLHost returns the registry host of a registry URL, e.g. https://index.docker.io/v1/ or
+// ghcr.io/zeitwork.
+func URLHost(url string) string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	host, _, _ := strings.Cut(url, "/")
+	return normalizeHost(host)
+}
+
+// Set sets the credentials of a registry, given by host or URL.
+func (a Auth) Set(host string, c Credentials) {
+	a[URLHost(host)] = c
+}
+
+// SetRepository sets the credentials of the images under a repository name prefix, e.g.
+// ghcr.io/zeitwork/app.
+func (a Auth) SetRepository(repository string, c Credentials) {
+	a[repositoryName(repository)] = c
+}
+
+// Lookup returns the credentials of a registry host.
+func (a Auth) Lookup(host string) (Credentials, bool) {
+	c, ok := a[normalizeHost(host)]
+	return c, ok
+}
+
+// LookupImage returns the credentials of an image reference: those of the longest repository
+// prefix it is under, or else those of its registry host.
+func (a Auth) LookupImage(ref string) (Credentials, bool) {
+	name := repositoryName(ref)
+	best := ""
+	for key := range a {
+		if strings.Contains(key, "/") && (name == key || strings.HasPrefix(name, key+"/")) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best != "" {
+		return a[best], true
+	}
+	return a.Lookup(Host(ref))
+}
+
+// repositoryName returns the repository of an image reference with its registry host, without
+// tag or digest, e.g. docker.io/library/alpine for alpine:3.
+func repositoryName(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker://")
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	host := Host(ref)
+	path := ref
+	if first, rest, ok := strings.Cut(ref, "/"); ok && normalizeHost(first) == host {
+		path = rest
+	}
+	if host == dockerHub && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	return host + "/" + strings.Trim(path, "/")
+}
+
+// Repository returns the repository of an image reference in its registry, without host, tag or
+// digest, e.g. zeitwork/0a1b for ghcr.io/zeitwork/0a1b:abc123.
+func Repository(ref string) string {
+	_, path, _ := strings.Cut(repositoryName(ref), "/")
+	return path
+}
+
+// With returns a copy of the credentials with other's added, replacing those of the same host.
+func (a Auth) With(other Auth) Auth {
+	merged := make(Auth, len(a)+len(other))
+	for host, c := range a {
+		merged[host] = c
+	}
+	for host, c := range other {
+		merged[host] = c
+	}
+	return merged
+}
+
+// DockerConfig returns the credentials in the format of docker's config.json, e.g. for tools
+// that read them from DOCKER_AUTH_CONFIG.
+func (a Auth) DockerConfig() ([]byte, error) {
+	type authEntry struct {
+		Auth string `json:"auth"`
+	}
+	auths := make(map[string]authEntry, len(a))
+	for host, c := range a {
+		// docker config has no repository credentials, tools fall back to anonymous access
+		if strings.Contains(host, "/") {
+			continue
+		}
+		// docker keys Docker Hub credentials by its v1 index URL
+		if host == dockerHub {
+			host = "https://index.docker.io/v1/"
+		}
+		auths[host] = authEntry{Auth: base64.StdEncoding.EncodeToString([]byte(c.String()))}
+	}
+	return json.Marshal(map[string]any{"auths": auths})
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"alpine", "docker.io"},
+		{"library/alpine:3.20", "docker.io"},
+		{"docker.io/library/alpine", "docker.io"},
+		{"index.docker.io/library/alpine", "docker.io"},
+		{"ghcr.io/zeitwork/app:abc", "ghcr.io"},
+		{"10.0.0.1:5000/zeitwork/app@sha256:abc", "10.0.0.1:5000"},
+		{"localhost/app", "localhost"},
+		{"docker://registry.example.com/app", "registry.example.com"},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.ref); got != tt.want {
+			t.Errorf("Host(%q): expected %q, got %q", tt.ref, tt.want, got)
+		}
+	}
+
+	if got := URLHost("ghcr.io"); got != "ghcr.io" {
+		t.Errorf("URLHost(ghcr.io): expected ghcr.io, got %q", got)
+	}
+	if got := URLHost("https://index.docker.io/v1/"); got != "docker.io" {
+		t.Errorf("URLHost(https://index.docker.io/v1/): expected docker.io, got %q", got)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	a, err := ParseAuth(`{"https://index.docker.io/v1/": {"username": "hub", "password": "a"}, "ghcr.io/zeitwork": {"username": "gh", "password": "b"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, ok := a.Lookup(Host("library/alpine")); !ok || c.Username != "hub" {
+		t.Errorf("expected Docker Hub credentials, got %+v", c)
+	}
+	if c, ok := a.Lookup(Host("ghcr.io/acme/app")); !ok || c.Username != "gh" {
+		t.Errorf("expected ghcr.io credentials, got %+v", c)
+	}
+	if _, ok := a.Lookup("quay.io"); ok {
+		t.Error("expected no quay.io credentials")
+	}
+
+	merged := a.With(Auth{"ghcr.io": {Username: "org", Password: "c"}})
+	if c, _ := merged.Lookup("ghcr.io"); c.Username != "org" {
+		t.Errorf("expected the added credentials to replace, got %+v", c)
+	}
+	if c, _ := a.Lookup("ghcr.io"); c.Username != "gh" {
+		t.Error("expected With to leave the original unchanged")
+	}
+
+	config, err := a.DockerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.Auths["https://index.docker.io/v1/"]; !ok {
+		t.Errorf("expected Docker Hub credentials under the index URL, got %v", parsed.Auths)
+	}
+	if _, ok := parsed.Auths["ghcr.io"]; !ok {
+		t.Errorf("expected ghcr.io credentials, got %v", parsed.Auths)
+	}
+}
+
+func TestAuthRepository(t *testing.T) {
+	a := Auth{}
+	a.Set("ghcr.io", Credentials{Username: "org", Password: "a"})
+	a.SetRepository("ghcr.io/zeitwork/0a1b", Credentials{Username: "cluster", Password: "b"})
+
+	if c, ok := a.LookupImage("ghcr.io/zeitwork/0a1b:abc123"); !ok || c.Username != "cluster" {
+		t.Errorf("expected repository credentials, got %+v", c)
+	}
+	if c, ok := a.LookupImage("docker://ghcr.io/zeitwork/0a1b@sha256:0123"); !ok || c.Username != "cluster" {
+		t.Errorf("expected repository credentials for a digest reference, got %+v", c)
+	}
+	if c, ok := a.LookupImage("ghcr.io/zeitwork/0a1bc:abc123"); !ok || c.Username != "org" {
+		t.Errorf("expected host credentials outside the repository, got %+v", c)
+	}
+	if _, ok := a.LookupImage("alpine:3"); ok {
+		t.Error("expected no Docker Hub credentials")
+	}
+	if got := Repository("ghcr.io/zeitwork/0a1b:abc123"); got != "zeitwork/0a1b" {
+		t.Errorf("Repository: expected zeitwork/0a1b, got %q", got)
+	}
+	if got := Repository("alpine:3"); got != "library/alpine" {
+		t.Errorf("Repository: expected library/alpine, got %q", got)
+	}
+	if c, _ := a.Lookup("ghcr.io"); c.Username != "org" {
+		t.Errorf("expected repository credentials not to apply to the host, got %+v", c)
+	}
+
+	config, err := a.DockerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "0a1b") {
+		t.Errorf("expected no repository credentials in the docker config, got %s", config)
+	}
+}
+
+func TestRepositoryCredentials(t *testing.T) {
+	var served []string
+	handler := basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, r.Method+" "+r.URL.String())
+	}), "zeitwork", "secret")
+
+	push := RepositoryCredentials("secret", "zeitwork/0a1b", true)
+	pull := RepositoryCredentials("secret", "zeitwork/0a1b", false)
+	forged := RepositoryCredentials("other", "zeitwork/0a1b", true)
+
+	tests := []struct {
+		method string
+		path   string
+		creds  Credentials
+		want   int
+	}{
+		{"GET", "/v2/", pull, http.StatusOK},
+		{"GET", "/v2/zeitwork/0a1b/manifests/abc123", pull, http.StatusOK},
+		{"HEAD", "/v2/zeitwork/0a1b/blobs/sha256:0123", pull, http.StatusOK},
+		{"GET", "/v2/zeitwork/0a1b/tags/list", pull, http.StatusOK},
+		{"PUT", "/v2/zeitwork/0a1b/manifests/abc123", pull, http.StatusForbidden},
+		{"PUT", "/v2/zeitwork/0a1b/manifests/abc123", push, http.StatusOK},
+		{"POST", "/v2/zeitwork/0a1b/blobs/uploads/", push, http.StatusOK},
+		{"PATCH", "/v2/zeitwork/0a1b/blobs/uploads/5f1c", push, http.StatusOK},
+		{"GET", "/v2/zeitwork/0a1c/manifests/abc123", push, http.StatusForbidden},
+		{"GET", "/v2/zeitwork/0a1b/manifests/x/manifests/abc123", push, http.StatusForbidden},
+		{"GET", "/v2/_catalog", push, http.StatusForbidden},
+		{"GET", "/v2/zeitwork/0a1b/manifests/abc123", forged, http.StatusUnauthorized},
+		{"GET", "/v2/zeitwork/0a1c/manifests/abc123", Credentials{Username: "zeitwork", Password: "secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.SetBasicAuth(tt.creds.Username, tt.creds.Password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s as %s: expected %d, got %d", tt.method, tt.path, tt.creds.Username, tt.want, rec.Code)
+		}
+	}
+
+	served = nil
+	req := httptest.NewRequest("POST", "/v2/zeitwork/0a1b/blobs/uploads/?mount=sha256:0123&from=zeitwork/0a1c", nil)
+	req.SetBasicAuth(push.Username, push.Password)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if len(served) != 1 || served[0] != "POST /v2/zeitwork/0a1b/blobs/uploads/" {
+		t.Errorf("expected the cross-repository mount to be dropped, got %v", served)
+	}
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Usernames of repository credentials, followed by the repository, e.g. push/zeitwork/0a1b.
+const (
+	pullScope = "pull/"
+	pushScope = "push/"
+)
+
+// RepositoryCredentials returns credentials of the embedded registry that only access one
+// repository, e.g. zeitwork/0a1b: pull only, or push and pull. They are derived from the
+// registry's password, so every server can mint and check them without storing them.
+func RepositoryCredentials(password, repository string, push bool) Credentials {
+	username := pullScope + repository
+	if push {
+		username = pushScope + repository
+	}
+	return Credentials{Username: username, Password: scopedPassword(password, username)}
+}
+
+func scopedPassword(password, username string) string {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte("zeitwork-registry-scope:" + username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// repositoryScope returns the repository and access of repository credentials, false if they
+// aren't valid repository credentials of the registry.
+func repositoryScope(password, username, scoped string) (repository string, push bool, ok bool) {
+	switch {
+	case strings.HasPrefix(username, pullScope):
+		repository = strings.TrimPrefix(username, pullScope)
+	case strings.HasPrefix(username, pushScope):
+		repository, push = strings.TrimPrefix(username, pushScope), true
+	default:
+		return "", false, false
+	}
+	if repository == "" || subtle.ConstantTimeCompare([]byte(scoped), []byte(scopedPassword(password, username))) != 1 {
+		return "", false, false
+	}
+	return repository, push, true
+}
+
+// scopeAllows reports whether repository credentials allow a registry API request: the API
+// version check, and the manifests, blobs and tags of their repository. Pull credentials only
+// read.
+func scopeAllows(r *http.Request, repository string, push bool) bool {
+	if !push && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		return true
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v2/"+repository+"/")
+	if !ok {
+		return false
+	}
+	// References and digests have no slashes, so a longer path names another repository
+	route, ref, _ := strings.Cut(rest, "/")
+	switch route {
+	case "manifests":
+		return ref != "" && !strings.Contains(ref, "/")
+	case "blobs":
+		upload, ok := strings.CutPrefix(ref, "uploads/")
+		if ok || ref == "uploads" {
+			return !strings.Contains(upload, "/")
+		}
+		return ref != "" && !strings.Contains(ref, "/")
+	case "tags":
+		return ref == "list"
+	}
+	return false
+}
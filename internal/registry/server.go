@@ -0,0 +1,156 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
+	_ "github.com/distribution/distribution/v3/registry/storage/driver/s3-aws"
+)
+
+// ServerConfig configures the embedded registry.
+type ServerConfig struct {
+	Addr string // listen address, e.g. ":5000"
+
+	// Images are stored in S3-compatible storage if S3Bucket is set, so every server can serve
+	// the cluster's images, and in RootDirectory on local disk otherwise.
+	RootDirectory string
+	S3Endpoint    string
+	S3Bucket      string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3UseSSL      bool
+
+	// Clients authenticate with HTTP basic auth.
+	Username string
+	Password string
+}
+
+// Server is an OCI distribution registry served by the zeitwork daemon, so a cluster can run
+// without an external registry. It serves plain HTTP on the internal network.
+type Server struct {
+	cfg        ServerConfig
+	httpServer *http.Server
+}
+
+func NewServer(ctx context.Context, cfg ServerConfig) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = ":5000"
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, fmt.Errorf("registry credentials are required")
+	}
+
+	storage := configuration.Storage{
+		"filesystem": configuration.Parameters{"rootdirectory": cfg.RootDirectory},
+	}
+	if cfg.S3Bucket != "" {
+		scheme := "http"
+		if cfg.S3UseSSL {
+			scheme = "https"
+		}
+		storage = configuration.Storage{
+			"s3": configuration.Parameters{
+				"regionendpoint": scheme + "://" + cfg.S3Endpoint,
+				"region":         "us-east-1",
+				"bucket":         cfg.S3Bucket,
+				"accesskey":      cfg.S3AccessKey,
+				"secretkey":      cfg.S3SecretKey,
+				"secure":         cfg.S3UseSSL,
+				"forcepathstyle": true,
+				"rootdirectory":  "/registry",
+			},
+			// clients may not reach the storage, e.g. from firewalled build VMs
+			"redirect": configuration.Parameters{"disable": true},
+		}
+	}
+
+	config := &configuration.Configuration{Storage: storage}
+	config.Log.Level = "warn"
+	// Uploads may continue on another server behind the same address, so all servers share the
+	// secret their upload state is signed with
+	secret := sha256.Sum256([]byte("zeitwork-registry:" + cfg.Password))
+	config.HTTP.Secret = hex.EncodeToString(secret[:])
+
+	app, err := newApp(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		cfg: cfg,
+		httpServer: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           basicAuth(app, cfg.Username, cfg.Password),
+			ReadHeaderTimeout: 30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		},
+	}, nil
+}
+
+// newApp creates the registry application, which panics on invalid storage configuration.
+func newApp(ctx context.Context, config *configuration.Configuration) (app *handlers.App, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to create registry: %v", r)
+		}
+	}()
+	return handlers.NewApp(ctx, config), nil
+}
+
+// basicAuth requires the registry credentials, or repository credentials for requests of their
+// repository, see RepositoryCredentials.
+func basicAuth(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if ok &&
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if repository, push, scoped := repositoryScope(password, u, p); ok && scoped {
+			if !scopeAllows(r, repository, push) {
+				w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+				http.Error(w, "denied", http.StatusForbidden)
+				return
+			}
+			// Blobs are mounted from other repositories without reading them, the upload
+			// starts without the mount instead
+			if q := r.URL.Query(); q.Has("mount") || q.Has("from") {
+				q.Del("mount")
+				q.Del("from")
+				r.URL.RawQuery = q.Encode()
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="zeitwork"`)
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// Start serves the registry until Stop is called.
+func (s *Server) Start() error {
+	slog.Info("starting embedded registry", "addr", s.cfg.Addr)
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown registry: %w", err)
+	}
+	return nil
+}
@@ -8,6 +8,19 @@ type ConfigResponse struct {
 	IPAddr   string   `json:"ip_addr"`
 	IPGW     string   `json:"ip_gw"`
 	Hostname string   `json:"hostname"`
+	// Idle tells the guest to keep the VM up without starting the image command.
+	// Commands are run through exec instead, e.g. release commands.
+	Idle bool `json:"idle"`
+	// Command overrides the image command when set, e.g. for worker processes.
+	Command []string `json:"command,omitempty"`
+	// ExposeDockerSocket tells the guest to expose the image's docker socket on a VSOCK port,
+	// for build VMs whose daemon must not listen on the VM network.
+	ExposeDockerSocket bool `json:"expose_docker_socket,omitempty"`
+}
+
+// ExitRequest is the JSON body for POST /exit (guest -> host), sent when the app exits.
+type ExitRequest struct {
+	ExitCode int `json:"exit_code"`
 }
 
 // ExecRequest is the initial WebSocket text message for an exec session.
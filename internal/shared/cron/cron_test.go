@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2026, time.January, 14, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.January, 14, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.January, 14, 10, 45, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2026, time.January, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, time.January, 15, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.January, 14, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, time.January, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.January, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2026, time.January, 14, 10, 45, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)},
+		// Day of month and day of week match either when both are restricted
+		{"0 0 20 * fri", time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.spec, err)
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.spec, tt.want, got)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -153,3 +155,15 @@ func Decrypt(ciphertext string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// MAC returns the hex-encoded HMAC-SHA256 of a message, keyed with the encryption key, e.g. to
+// tell whether secrets changed without revealing them.
+func MAC(message string) (string, error) {
+	key, err := getKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
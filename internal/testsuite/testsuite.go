@@ -144,6 +144,7 @@ func (s *Suite) SetupSuite() {
 		ACMEEmail:         s.Cfg.EdgeProxyACMEEmail,
 		ACMEStaging:       s.Cfg.EdgeProxyACMEStaging,
 		DB:                s.DB,
+		ServerID:          serverID,
 		RouteChangeNotify: routeChangeNotify,
 	}, slog.Default())
 	if err != nil {
@@ -6,13 +6,12 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -29,8 +28,9 @@ import (
 )
 
 func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error {
-	if !s.isControlPlaneLeader() {
-		return nil
+	owner, err := s.ownsBuild(ctx, objectID)
+	if err != nil || !owner {
+		return err
 	}
 
 	build, err := s.db.BuildClaimLease(ctx, queries.BuildClaimLeaseParams{
@@ -53,12 +53,25 @@ func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error
 		return nil
 	}
 
-	// Check for stuck builds - if building for more than 15 minutes, mark as failed
+	// Cancelled - a running build has stopped by now, release its VM
+	if build.Status == queries.BuildStatusCancelled {
+		if build.VmID.Valid {
+			s.cleanupBuildVM(ctx, build.VmID)
+		}
+		return nil
+	}
+
+	resources, err := s.buildResources(ctx, build)
+	if err != nil {
+		return err
+	}
+
+	// Check for stuck builds - if building for longer than the project's build timeout, mark as failed
 	if build.Status == queries.BuildStatusBuilding && build.BuildingAt.Valid {
 		buildingDuration := time.Since(build.BuildingAt.Time)
-		if buildingDuration > 15*time.Minute {
+		if buildingDuration > resources.timeout {
 			slog.Warn("build stuck, marking as failed", "build_id", build.ID, "building_for", buildingDuration)
-			return s.db.BuildMarkFailed(ctx, build.ID)
+			return s.failBuildTimeout(ctx, build, resources.timeout)
 		}
 	}
 
@@ -79,24 +92,39 @@ func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error
 		s.activeBuildsMu.Unlock()
 	}()
 
-	// reconcile build image for build vm (atomic find-or-create to avoid race conditions)
-	buildImage, err := s.db.ImageFindOrCreate(ctx, queries.ImageFindOrCreateParams{
-		ID:         uuid.New(),
-		Registry:   "ghcr.io",
-		Repository: "tomhaerter/dind",
-		Tag:        "latest",
-	})
-	if err != nil {
-		return err
-	}
-
-	// if we dont have a vm create one
+	// if we dont have a vm create one, once the build queue admits the build
 	if !build.VmID.Valid {
+		s.buildQueueMu.Lock()
+		defer s.buildQueueMu.Unlock()
+
+		if build.Status == queries.BuildStatusPending {
+			admitted, position, err := s.admitBuild(ctx, build)
+			if err != nil {
+				return err
+			}
+			if !admitted {
+				if err := s.updateBuildQueuePosition(ctx, build, position); err != nil {
+					return err
+				}
+				s.buildScheduler.Schedule(build.ID, time.Now().Add(buildQueuePollInterval))
+				return nil
+			}
+			if err := s.updateBuildQueuePosition(ctx, build, 0); err != nil {
+				return err
+			}
+		}
+
+		buildImage, err := s.buildVMImage(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Placed like other VMs, the build then runs on the VM's server, see ownsBuild
 		vm, err := s.VMCreate(ctx, VMCreateParams{
-			VCPUs:   2,
-			Memory:  4 * 1024,
+			VCPUs:   resources.vcpus,
+			Memory:  resources.memory,
 			ImageID: buildImage.ID,
-			Port:    2375,
+			Build:   true,
 		})
 		if err != nil {
 			return err
@@ -127,6 +155,21 @@ func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error
 		return nil
 	}
 
+	// The VM was deleted, e.g. as its server went away, start over on a new VM
+	if vm.DeletedAt.Valid {
+		slog.Warn("build VM is gone, restarting build", "build_id", build.ID, "vm_id", vm.ID)
+		if err := s.db.BuildResetPending(ctx, build.ID); err != nil {
+			return err
+		}
+		s.buildScheduler.Schedule(build.ID, time.Now())
+		return nil
+	}
+
+	// The VM's docker daemon is only reachable from its server, which runs the build
+	if vm.ServerID != s.serverID {
+		return nil
+	}
+
 	// VM not running yet, wait
 	if vm.Status != queries.VmStatusRunning {
 		slog.Info("build VM not ready yet", "build_id", build.ID, "vm_id", vm.ID, "status", vm.Status)
@@ -136,7 +179,26 @@ func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error
 	// VM is running and we don't have an output image yet - execute the build
 	if !build.ImageID.Valid {
 		slog.Info("starting build execution", "build_id", build.ID, "vm_id", vm.ID)
-		err = s.executeBuild(ctx, build, vm)
+
+		// The timeout counts from when the build VM was created
+		deadline := time.Now().Add(resources.timeout)
+		if build.BuildingAt.Valid {
+			deadline = build.BuildingAt.Time.Add(resources.timeout)
+		}
+		buildCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		go s.watchBuildCancellation(buildCtx, build.ID, cancel)
+
+		err = s.executeBuild(buildCtx, build, vm)
+		if err != nil && errors.Is(buildCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			// The solve was stopped with the cancelled context
+			return s.failBuildTimeout(ctx, build, resources.timeout)
+		}
+		if err != nil && buildCtx.Err() != nil && ctx.Err() == nil {
+			// Cancelled - the reconcile following the cancellation releases the VM
+			slog.Info("build execution stopped after cancellation", "build_id", build.ID)
+			return nil
+		}
 		if err != nil {
 			slog.Error("build execution failed", "build_id", build.ID, "error", err)
 
@@ -161,6 +223,29 @@ func (s *Service) reconcileBuild(ctx context.Context, objectID uuid.UUID) error
 	return nil
 }
 
+// ownsBuild reports whether this server reconciles a build. The leader admits builds and creates
+// their VMs. A build then runs on the server of its VM, as the VM's docker daemon is only
+// reachable over VSOCK, and returns to the leader if the VM fails or is deleted.
+func (s *Service) ownsBuild(ctx context.Context, buildID uuid.UUID) (bool, error) {
+	build, err := s.db.BuildFirstByID(ctx, buildID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if build.VmID.Valid {
+		vm, err := s.db.VMFirstByID(ctx, build.VmID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, err
+		}
+		if err == nil && !vm.DeletedAt.Valid && vm.Status != queries.VmStatusFailed {
+			return vm.ServerID == s.serverID, nil
+		}
+	}
+	return s.isControlPlaneLeader(), nil
+}
+
 func (s *Service) releaseBuildLease(buildID uuid.UUID) {
 	releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -173,6 +258,50 @@ func (s *Service) releaseBuildLease(buildID uuid.UUID) {
 	}
 }
 
+// buildResourceSettings are the build VM resources and the build timeout of a project.
+type buildResourceSettings struct {
+	vcpus   int32
+	memory  int32 // MB
+	timeout time.Duration
+}
+
+// buildResources returns the build settings of a build's project, capped by the limits of its
+// organisation in case the limits were lowered after the project was configured.
+func (s *Service) buildResources(ctx context.Context, build queries.Build) (buildResourceSettings, error) {
+	project, err := s.db.ProjectFirstByID(ctx, build.ProjectID)
+	if err != nil {
+		return buildResourceSettings{}, fmt.Errorf("failed to get project: %w", err)
+	}
+	organisation, err := s.db.OrganisationFirstByID(ctx, build.OrganisationID)
+	if err != nil {
+		return buildResourceSettings{}, fmt.Errorf("failed to get organisation: %w", err)
+	}
+
+	return buildResourceSettings{
+		vcpus:   min(project.BuildVcpus, organisation.BuildVcpusLimit),
+		memory:  min(project.BuildMemory, organisation.BuildMemoryLimit),
+		timeout: time.Duration(min(project.BuildTimeout, organisation.BuildTimeoutLimit)) * time.Second,
+	}, nil
+}
+
+// failBuildTimeout marks a build that ran out of time as failed and releases its VM.
+func (s *Service) failBuildTimeout(ctx context.Context, build queries.Build, timeout time.Duration) error {
+	s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+		ID:             uuid.New(),
+		BuildID:        build.ID,
+		Message:        fmt.Sprintf("Build failed: timed out after %s", formatDuration(timeout)),
+		Level:          "error",
+		OrganisationID: build.OrganisationID,
+	})
+	if err := s.db.BuildMarkFailed(ctx, build.ID); err != nil {
+		return err
+	}
+	if build.VmID.Valid {
+		s.cleanupBuildVM(ctx, build.VmID)
+	}
+	return nil
+}
+
 // executeBuild performs the actual build process inside the VM
 func (s *Service) executeBuild(ctx context.Context, build queries.Build, vm queries.Vm) error {
 	// 1. Get project info
@@ -181,21 +310,17 @@ func (s *Service) executeBuild(ctx context.Context, build queries.Build, vm quer
 		return fmt.Errorf("failed to get project: %w", err)
 	}
 
-	// 2. Check if GitHub token service is available
-	if s.githubTokenService == nil {
-		return fmt.Errorf("github token service not configured")
-	}
-
-	// 3. Get GitHub installation token
-	token, err := s.githubTokenService.GetInstallationToken(ctx, project.GithubInstallationID)
+	// 2. Get the build's source, an upload or the project's source provider, e.g. GitHub with
+	// an installation token
+	source, err := s.buildSource(ctx, build, project)
 	if err != nil {
-		return fmt.Errorf("failed to get github token: %w", err)
+		return err
 	}
 
-	slog.Info("got github token", "build_id", build.ID, "repo", project.GithubRepository)
+	slog.Info("got build source", "build_id", build.ID, "provider", project.SourceProvider, "upload", build.SourceUploadID.Valid)
 
-	// 4. Download source tarball from GitHub
-	tarballReader, err := s.downloadSourceTarball(ctx, token, project.GithubRepository, build.GithubCommit)
+	// 3-4. Download source tarball
+	tarballReader, err := source.DownloadTarball(ctx, build.GithubCommit)
 	if err != nil {
 		return fmt.Errorf("failed to download source: %w", err)
 	}
@@ -203,10 +328,12 @@ func (s *Service) executeBuild(ctx context.Context, build queries.Build, vm quer
 
 	slog.Info("downloaded source tarball", "build_id", build.ID)
 
-	// 5. Connect to Docker daemon in VM
-	dockerHost := fmt.Sprintf("tcp://%s:2375", vm.IpAddress.Addr())
+	// 5. Connect to Docker daemon in VM, its socket is exposed over VSOCK only
 	dockerClient, err := client.NewClientWithOpts(
-		client.WithHost(dockerHost),
+		client.WithHost("unix:///var/run/docker.sock"),
+		client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return DialGuest(vm.ID, dockerPort)
+		}),
 		client.WithAPIVersionNegotiation(),
 	)
 	if err != nil {
@@ -219,53 +346,129 @@ func (s *Service) executeBuild(ctx context.Context, build queries.Build, vm quer
 		return fmt.Errorf("docker daemon not ready: %w", err)
 	}
 
-	slog.Info("connected to docker daemon", "build_id", build.ID, "host", dockerHost)
+	slog.Info("connected to docker daemon", "build_id", build.ID, "vm_id", vm.ID)
 
 	// 6. Prepare build context from tarball (convert gzip tarball to Docker-compatible tar)
 	dockerfilePath := project.DockerfilePath
 	if dockerfilePath == "" {
 		dockerfilePath = "Dockerfile"
 	}
-	buildContext, err := s.prepareBuildContext(ctx, build, tarballReader, project.RootDirectory, dockerfilePath)
+	buildContext, err := s.prepareBuildContext(ctx, build, tarballReader, project.RootDirectory, dockerfilePath, project.BuildMode)
 	if err != nil {
 		return fmt.Errorf("failed to prepare build context: %w", err)
 	}
 
 	// 7. Build the image
-	imageTag := fmt.Sprintf("%s/%s/%s:%s",
-		s.cfg.DockerRegistryURL,                 // e.g., "ghcr.io"
-		s.cfg.DockerRegistryUsername,            // e.g., "zeitwork"
-		hex.EncodeToString(project.ID.Bytes[:]), // unique project identifier (lowercase hex)
-		build.GithubCommit,                      // commit sha as tag
+	buildVars, err := s.prepareBuildVariables(ctx, project.ID)
+	if err != nil {
+		return err
+	}
+	tag, err := buildImageTag(build.GithubCommit, buildVars)
+	if err != nil {
+		return err
+	}
+	imageTag := fmt.Sprintf("%s/%s:%s",
+		s.cfg.DockerRegistryURL,      // e.g., "ghcr.io"
+		s.projectRepository(project), // e.g., "zeitwork/<project id as lowercase hex>"
+		tag,                          // commit sha, and a hash of the build variables if any
 	)
 
-	slog.Info("building docker image with buildx", "build_id", build.ID, "tag", imageTag)
-
-	// Check if the image already exists in the registry (e.g. from a previous build of the same commit)
-	srcCreds := fmt.Sprintf("%s:%s", s.cfg.DockerRegistryUsername, s.cfg.DockerRegistryPAT)
-	if err := s.runCommand(ctx, "skopeo", "inspect", "--creds", srcCreds, "docker://"+imageTag); err == nil {
+	// Check if the image already exists in the registry (e.g. from a previous build of the same
+	// commit with the same build variables)
+	inspectArgs := append([]string{"inspect"}, s.skopeoRegistryFlags(s.clusterRegistryAuth, "", imageTag)...)
+	if err := s.runCommand(ctx, "skopeo", append(inspectArgs, "docker://"+imageTag)...); err == nil {
 		slog.Info("image already exists in registry, skipping build", "build_id", build.ID, "tag", imageTag)
 	} else {
-		// Build and push using docker buildx with OCI media types
-		// We run a container with the docker CLI to execute buildx build
-		if err := s.runBuildxBuild(ctx, dockerClient, build, buildContext, imageTag, dockerfilePath); err != nil {
-			return fmt.Errorf("buildx build failed: %w", err)
+		// base and builder images may be in the organisation's private registries, the image is
+		// pushed to the project's repository only
+		auth, err := s.buildRegistryAuth(ctx, project)
+		if err != nil {
+			return err
+		}
+
+		switch project.BuildMode {
+		case queries.BuildModeBuildpacks:
+			// Build and push using the CNB lifecycle, run by the pack CLI in a container
+			builder := s.buildpackBuilder(project)
+			s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+				ID:             uuid.New(),
+				BuildID:        build.ID,
+				Message:        fmt.Sprintf("Building with Cloud Native Buildpacks (builder %s)", builder),
+				Level:          "info",
+				OrganisationID: build.OrganisationID,
+			})
+			if err := s.runPackBuild(ctx, dockerClient, build, buildContext, imageTag, builder, s.buildpacksCacheRef(project), buildVars, auth); err != nil {
+				return fmt.Errorf("buildpacks build failed: %w", err)
+			}
+		default:
+			// Build and push with the VM's BuildKit, driven over the docker API connection
+			slog.Info("building docker image with buildkit", "build_id", build.ID, "tag", imageTag)
+			if err := s.runBuildkitBuild(ctx, dockerClient, build, buildContext, imageTag, dockerfilePath, s.buildCacheRef(project), buildVars, auth); err != nil {
+				return fmt.Errorf("buildkit build failed: %w", err)
+			}
 		}
 		slog.Info("docker build and push completed", "build_id", build.ID)
 	}
 
-	// 9. Create image record in DB (use find-or-create to handle concurrent builds for same commit)
+	// 8. Generate the image's SBOM and enforce the project's vulnerability policy
+	sbom, err := s.generateSBOM(ctx, dockerClient, build, imageTag)
+	if err != nil {
+		return err
+	}
+	if project.VulnerabilityScan {
+		summary, err := s.scanSBOM(ctx, dockerClient, build, sbom)
+		if err != nil {
+			return err
+		}
+		s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+			ID:             uuid.New(),
+			BuildID:        build.ID,
+			Message:        summary.String(),
+			Level:          "info",
+			OrganisationID: build.OrganisationID,
+		})
+		if project.VulnerabilityFailSeverity.Valid {
+			severity := project.VulnerabilityFailSeverity.VulnerabilitySeverity
+			if n := summary.atOrAbove(severity); n > 0 {
+				return fmt.Errorf("%d vulnerabilities of %s severity or above, the project's vulnerability policy fails the build", n, severity)
+			}
+		}
+	}
+
+	// Sign the image with the cluster's key once it passed the checks, VMs refuse to boot
+	// unsigned images
+	if err := s.signImage(ctx, imageTag); err != nil {
+		return err
+	}
+
+	// 9. Create image record in DB, pinned to the pushed manifest digest (use find-or-create to
+	// handle concurrent builds for same commit)
+	imageDigest, err := s.resolveImageDigest(ctx, imageTag, s.clusterRegistryAuth)
+	if err != nil {
+		return err
+	}
 	outputImage, err := s.db.ImageFindOrCreate(ctx, queries.ImageFindOrCreateParams{
 		ID:         uuid.New(),
 		Registry:   s.cfg.DockerRegistryURL,
-		Repository: fmt.Sprintf("%s/%s", s.cfg.DockerRegistryUsername, hex.EncodeToString(project.ID.Bytes[:])),
-		Tag:        build.GithubCommit,
+		Repository: s.projectRepository(project),
+		Tag:        tag,
+		Digest:     imageDigest,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to find or create image record: %w", err)
 	}
 
-	slog.Info("created output image record", "build_id", build.ID, "image_id", outputImage.ID)
+	slog.Info("created output image record", "build_id", build.ID, "image_id", outputImage.ID, "digest", outputImage.Digest)
+
+	err = s.db.ImageSBOMUpsert(ctx, queries.ImageSBOMUpsertParams{
+		ID:       uuid.New(),
+		ImageID:  outputImage.ID,
+		Format:   sbomFormat,
+		Document: sbom,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store SBOM: %w", err)
+	}
 
 	// 10. Mark build as successful (only if not already successful)
 	if build.Status != queries.BuildStatusSuccesful {
@@ -286,40 +489,15 @@ func (s *Service) executeBuild(ctx context.Context, build queries.Build, vm quer
 	return nil
 }
 
-// downloadSourceTarball downloads the source code as a tarball from GitHub
-func (s *Service) downloadSourceTarball(ctx context.Context, token, repo, commit string) (io.ReadCloser, error) {
-	// GitHub tarball URL format: https://api.github.com/repos/{owner}/{repo}/tarball/{ref}
-	url := fmt.Sprintf("https://api.github.com/repos/%s/tarball/%s", repo, commit)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("github returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	return resp.Body, nil
-}
-
-// prepareBuildContext converts a GitHub gzip tarball to a Docker build context
-// GitHub tarballs have a top-level directory like "owner-repo-sha/" that we need to strip
+// prepareBuildContext converts a source gzip tarball to a Docker build context
+// Source tarballs have a top-level directory like "owner-repo-sha/" that we need to strip
 // rootDir specifies the subdirectory to use as build context (e.g., "/" for repo root, "/apps/web" for monorepo)
 //
 // If no Dockerfile is found, the function attempts to detect the framework from
 // well-known files (nuxt.config.ts, Gemfile, artisan, etc.) and injects a
-// framework-specific Dockerfile into the build context.
-func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build, gzipReader io.Reader, rootDir string, dockerfilePath string) (io.Reader, error) {
+// framework-specific Dockerfile into the build context. In buildpacks mode the
+// buildpacks detect the app themselves, so no Dockerfile is needed.
+func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build, gzipReader io.Reader, rootDir string, dockerfilePath string, buildMode queries.BuildMode) (io.Reader, error) {
 	// Create a pipe for streaming the output
 	pr, pw := io.Pipe()
 
@@ -398,25 +576,6 @@ func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build,
 				foundDockerfile = true
 			}
 
-			// Collect framework indicator signals from filenames
-			if !strings.Contains(pathAfterGitHub, "/") {
-				// Root-level files
-				switch pathAfterGitHub {
-				case "nuxt.config.ts", "nuxt.config.js":
-					signals.hasNuxtConfig = true
-				case "next.config.ts", "next.config.js", "next.config.mjs":
-					signals.hasNextConfig = true
-				case "Gemfile":
-					signals.hasGemfile = true
-				case "Rakefile":
-					signals.hasRakefile = true
-				case "artisan":
-					signals.hasArtisan = true
-				}
-			} else if pathAfterGitHub == "config/routes.rb" {
-				signals.hasRailsRoutes = true
-			}
-
 			// Create new header with the final stripped name
 			newHeader := *header
 			newHeader.Name = pathAfterGitHub
@@ -426,45 +585,37 @@ func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build,
 				return
 			}
 
-			if header.Typeflag == tar.TypeReg {
-				// For root-level manifest files, buffer content for framework detection
-				var bufferDest *[]byte
-				if !strings.Contains(pathAfterGitHub, "/") {
-					switch pathAfterGitHub {
-					case "package.json":
-						bufferDest = &signals.packageJSON
-					case "Gemfile":
-						bufferDest = &signals.gemfileContent
-					case "composer.json":
-						bufferDest = &signals.composerJSON
-					}
-				}
+			if header.Typeflag != tar.TypeReg {
+				signals.observe(pathAfterGitHub, nil)
+				continue
+			}
 
-				if bufferDest != nil {
-					content, err := io.ReadAll(tr)
-					if err != nil {
-						pw.CloseWithError(fmt.Errorf("failed to read file content: %w", err))
-						return
-					}
-					if _, err := tw.Write(content); err != nil {
-						pw.CloseWithError(fmt.Errorf("failed to write tar content: %w", err))
-						return
-					}
-					*bufferDest = content
-				} else {
-					if _, err := io.Copy(tw, tr); err != nil {
-						pw.CloseWithError(fmt.Errorf("failed to copy tar content: %w", err))
-						return
-					}
+			// For root-level manifest files, buffer content for framework detection
+			if frameworkManifests[pathAfterGitHub] {
+				content, err := io.ReadAll(tr)
+				if err != nil {
+					pw.CloseWithError(fmt.Errorf("failed to read file content: %w", err))
+					return
+				}
+				if _, err := tw.Write(content); err != nil {
+					pw.CloseWithError(fmt.Errorf("failed to write tar content: %w", err))
+					return
+				}
+				signals.observe(pathAfterGitHub, content)
+			} else {
+				if _, err := io.Copy(tw, tr); err != nil {
+					pw.CloseWithError(fmt.Errorf("failed to copy tar content: %w", err))
+					return
 				}
+				signals.observe(pathAfterGitHub, nil)
 			}
 		}
 
-		if !foundDockerfile {
+		if !foundDockerfile && buildMode == queries.BuildModeDockerfile {
 			// Attempt to detect the framework and inject a Dockerfile
-			framework := detectFramework(signals)
-			if framework == "" {
-				msg := "No Dockerfile found and could not detect a supported framework. Please add a Dockerfile to your repository or use one of the supported frameworks: Nuxt, Next.js, Rails, Laravel."
+			detection := detectFramework(signals)
+			if detection.framework == "" {
+				msg := "No Dockerfile found and could not detect a supported framework. Please add a Dockerfile to your repository, use one of the supported frameworks: " + supportedFrameworks + ", or switch the project to buildpacks mode."
 				s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
 					ID:             uuid.New(),
 					BuildID:        build.ID,
@@ -476,17 +627,17 @@ func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build,
 				return
 			}
 
-			content := dockerfiles.Get(framework)
+			content := dockerfiles.Get(detection.framework)
 			if content == nil {
-				pw.CloseWithError(fmt.Errorf("no Dockerfile template for detected framework %q", framework))
+				pw.CloseWithError(fmt.Errorf("no Dockerfile template for detected framework %q", detection.framework))
 				return
 			}
 
-			slog.Info("no Dockerfile found, injecting framework Dockerfile", "framework", framework)
+			slog.Info("no Dockerfile found, injecting framework Dockerfile", "framework", detection.framework, "reason", detection.reason, "package_manager", detection.packageManager)
 			s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
 				ID:             uuid.New(),
 				BuildID:        build.ID,
-				Message:        fmt.Sprintf("No Dockerfile found. Detected framework: %s - injecting default Dockerfile.", framework),
+				Message:        fmt.Sprintf("No Dockerfile found. %s - injecting default Dockerfile.", detection),
 				Level:          "info",
 				OrganisationID: build.OrganisationID,
 			})
@@ -510,83 +661,6 @@ func (s *Service) prepareBuildContext(ctx context.Context, build queries.Build,
 	return pr, nil
 }
 
-// frameworkSignals collects indicators observed while iterating the source tarball.
-type frameworkSignals struct {
-	// Strong signals (config file presence)
-	hasNuxtConfig  bool // nuxt.config.ts or nuxt.config.js
-	hasNextConfig  bool // next.config.ts, next.config.js, or next.config.mjs
-	hasGemfile     bool // Gemfile
-	hasRakefile    bool // Rakefile
-	hasRailsRoutes bool // config/routes.rb
-	hasArtisan     bool // artisan (Laravel CLI)
-
-	// Buffered file contents for fallback parsing
-	packageJSON    []byte // package.json content
-	gemfileContent []byte // Gemfile content
-	composerJSON   []byte // composer.json content
-}
-
-// detectFramework resolves the framework from collected signals.
-// Strong signals (config files) take priority; file-content parsing is a fallback.
-func detectFramework(s frameworkSignals) string {
-	// 1. Strong config-file signals
-	if s.hasNuxtConfig {
-		return "nuxt"
-	}
-	if s.hasNextConfig {
-		return "nextjs"
-	}
-	if s.hasArtisan {
-		return "laravel"
-	}
-	if s.hasRailsRoutes || (s.hasGemfile && s.hasRakefile) {
-		return "rails"
-	}
-
-	// 2. Fallback: parse manifest file contents
-	if s.packageJSON != nil {
-		var pkg struct {
-			Dependencies    map[string]string `json:"dependencies"`
-			DevDependencies map[string]string `json:"devDependencies"`
-		}
-		if json.Unmarshal(s.packageJSON, &pkg) == nil {
-			// Check nuxt before next (nuxt depends on vue, not next)
-			if _, ok := pkg.Dependencies["nuxt"]; ok {
-				return "nuxt"
-			}
-			if _, ok := pkg.DevDependencies["nuxt"]; ok {
-				return "nuxt"
-			}
-			if _, ok := pkg.Dependencies["next"]; ok {
-				return "nextjs"
-			}
-			if _, ok := pkg.DevDependencies["next"]; ok {
-				return "nextjs"
-			}
-		}
-	}
-
-	if s.gemfileContent != nil {
-		content := string(s.gemfileContent)
-		if strings.Contains(content, "'rails'") || strings.Contains(content, "\"rails\"") {
-			return "rails"
-		}
-	}
-
-	if s.composerJSON != nil {
-		var composer struct {
-			Require map[string]string `json:"require"`
-		}
-		if json.Unmarshal(s.composerJSON, &composer) == nil {
-			if _, ok := composer.Require["laravel/framework"]; ok {
-				return "laravel"
-			}
-		}
-	}
-
-	return ""
-}
-
 // waitForDockerReady waits for the Docker daemon to be ready
 func (s *Service) waitForDockerReady(ctx context.Context, dockerClient *client.Client) error {
 	for i := 0; i < 30; i++ { // Wait up to 30 seconds
@@ -655,11 +729,13 @@ func (s *Service) streamBuildLogs(ctx context.Context, build queries.Build, read
 
 // logWriter writes Docker log output line-by-line to the database in real-time
 type logWriter struct {
-	ctx   context.Context
-	s     *Service
-	build queries.Build
-	level string
-	buf   []byte
+	ctx     context.Context
+	s       *Service
+	build   queries.Build
+	level   string
+	buf     []byte
+	prefix  string          // Optional, prepended to every line
+	secrets []buildVariable // Build secrets whose values are masked
 }
 
 func (w *logWriter) Write(p []byte) (n int, err error) {
@@ -676,6 +752,7 @@ func (w *logWriter) Write(p []byte) (n int, err error) {
 		w.buf = w.buf[idx+1:]
 
 		if line = strings.TrimSpace(line); line != "" {
+			line = w.prefix + redactBuildSecrets(line, w.secrets)
 			w.s.db.BuildLogCreate(w.ctx, queries.BuildLogCreateParams{
 				ID:             uuid.New(),
 				BuildID:        w.build.ID,
@@ -692,6 +769,7 @@ func (w *logWriter) Write(p []byte) (n int, err error) {
 // Flush writes any remaining buffered content
 func (w *logWriter) Flush() {
 	if line := strings.TrimSpace(string(w.buf)); line != "" {
+		line = w.prefix + redactBuildSecrets(line, w.secrets)
 		w.s.db.BuildLogCreate(w.ctx, queries.BuildLogCreateParams{
 			ID:             uuid.New(),
 			BuildID:        w.build.ID,
@@ -703,30 +781,37 @@ func (w *logWriter) Flush() {
 	w.buf = nil
 }
 
-// runBuildxBuild executes docker buildx build inside a container to build and push with OCI media types
-func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Client, build queries.Build, buildContext io.Reader, imageTag string, dockerfilePath string) error {
+// builderContainer is a container in the build VM that builds and pushes the image of a build.
+// It runs with the build context at /build and the VM's docker socket. Registry credentials are
+// passed in env, they aren't written to its filesystem.
+type builderContainer struct {
+	image string
+	cmd   []string
+	env   []string
+	user  string // empty = image default
+}
+
+// runBuilderContainer runs a builder container to completion, streaming its output to stdoutWriter
+// and stderrWriter. buildContext is a tar copied to /build, nil for none.
+func (s *Service) runBuilderContainer(ctx context.Context, dockerClient *client.Client, build queries.Build, bc builderContainer, buildContext io.Reader, stdoutWriter, stderrWriter io.Writer) error {
 	// Read build context into memory (needed to copy to container)
-	buildContextBytes, err := io.ReadAll(buildContext)
-	if err != nil {
-		return fmt.Errorf("failed to read build context: %w", err)
+	var buildContextBytes []byte
+	if buildContext != nil {
+		var err error
+		buildContextBytes, err = io.ReadAll(buildContext)
+		if err != nil {
+			return fmt.Errorf("failed to read build context: %w", err)
+		}
 	}
 
-	// Create a container with docker CLI to run buildx
-	// Using docker:cli image which has docker and buildx
 	containerConfig := &container.Config{
-		Image:      "docker:cli",
+		Image:      bc.image,
+		User:       bc.user,
 		WorkingDir: "/build",
-		Env: []string{
+		Env: append([]string{
 			"DOCKER_HOST=unix:///var/run/docker.sock",
-		},
-		Cmd: []string{
-			"docker", "buildx", "build",
-			"--build-arg", "ZEITWORK=1",
-			"--output", "type=image,push=true,oci-mediatypes=true",
-			"-t", imageTag,
-			"-f", dockerfilePath,
-			".",
-		},
+		}, bc.env...),
+		Cmd: bc.cmd,
 	}
 
 	hostConfig := &container.HostConfig{
@@ -739,11 +824,11 @@ func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Clien
 		},
 	}
 
-	// Pull the docker:cli image first (in case it's not present)
-	slog.Info("pulling docker:cli image", "build_id", build.ID)
-	pullResp, err := dockerClient.ImagePull(ctx, "docker:cli", image.PullOptions{})
+	// Pull the builder image first (in case it's not present)
+	slog.Info("pulling builder image", "build_id", build.ID, "image", bc.image)
+	pullResp, err := dockerClient.ImagePull(ctx, bc.image, image.PullOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to pull docker:cli image: %w", err)
+		return fmt.Errorf("failed to pull %s image: %w", bc.image, err)
 	}
 	io.Copy(io.Discard, pullResp)
 	pullResp.Close()
@@ -756,45 +841,22 @@ func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Clien
 	}
 	containerID := createResp.ID
 
-	// Ensure cleanup
+	// Ensure cleanup, also when the build was cancelled
 	defer func() {
-		dockerClient.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+		dockerClient.ContainerRemove(context.WithoutCancel(ctx), containerID, container.RemoveOptions{Force: true})
 	}()
 
 	// Copy build context into container at /build
-	slog.Info("copying build context to container", "build_id", build.ID, "size", len(buildContextBytes))
-	err = dockerClient.CopyToContainer(ctx, containerID, "/build", bytes.NewReader(buildContextBytes), container.CopyToContainerOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to copy build context: %w", err)
-	}
-
-	// Configure registry auth for buildx by creating docker config
-	dockerConfigJSON := fmt.Sprintf(`{"auths":{"%s":{"username":"%s","password":"%s"}}}`,
-		s.cfg.DockerRegistryURL,
-		s.cfg.DockerRegistryUsername,
-		s.cfg.DockerRegistryPAT,
-	)
-
-	// Create a tar archive with the docker config (include .docker directory in path)
-	var configTar bytes.Buffer
-	tw := tar.NewWriter(&configTar)
-	configBytes := []byte(dockerConfigJSON)
-	tw.WriteHeader(&tar.Header{
-		Name: ".docker/config.json",
-		Mode: 0600,
-		Size: int64(len(configBytes)),
-	})
-	tw.Write(configBytes)
-	tw.Close()
-
-	// Copy docker config to /root (tar will create .docker/ subdirectory)
-	err = dockerClient.CopyToContainer(ctx, containerID, "/root", &configTar, container.CopyToContainerOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to copy docker config: %w", err)
+	if buildContext != nil {
+		slog.Info("copying build context to container", "build_id", build.ID, "size", len(buildContextBytes))
+		err = dockerClient.CopyToContainer(ctx, containerID, "/build", bytes.NewReader(buildContextBytes), container.CopyToContainerOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to copy build context: %w", err)
+		}
 	}
 
 	// Start the container
-	slog.Info("starting buildx build", "build_id", build.ID, "tag", imageTag, "container_id", containerID)
+	slog.Info("starting builder container", "build_id", build.ID, "container_id", containerID)
 	if err := dockerClient.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("failed to start builder container: %w", err)
 	}
@@ -812,10 +874,6 @@ func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Clien
 		return fmt.Errorf("failed to attach to container logs: %w", err)
 	}
 
-	// Create writers that insert logs to database in real-time
-	stdoutWriter := &logWriter{ctx: ctx, s: s, build: build, level: "info"}
-	stderrWriter := &logWriter{ctx: ctx, s: s, build: build, level: "error"}
-
 	// Stream logs in a goroutine
 	var wg sync.WaitGroup
 	var logErr error
@@ -825,9 +883,6 @@ func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Clien
 		defer logReader.Close()
 		// stdcopy.StdCopy demuxes docker's multiplexed stdout/stderr stream
 		_, logErr = stdcopy.StdCopy(stdoutWriter, stderrWriter, logReader)
-		// Flush any remaining partial lines
-		stdoutWriter.Flush()
-		stderrWriter.Flush()
 	}()
 
 	// Wait for container to finish
@@ -852,10 +907,8 @@ func (s *Service) runBuildxBuild(ctx context.Context, dockerClient *client.Clien
 	}
 
 	if exitCode != 0 {
-		return fmt.Errorf("buildx build failed with exit code %d", exitCode)
+		return fmt.Errorf("builder container failed with exit code %d", exitCode)
 	}
-
-	slog.Info("buildx build completed successfully", "build_id", build.ID)
 	return nil
 }
 
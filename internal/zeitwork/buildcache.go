@@ -0,0 +1,56 @@
+package zeitwork
+
+import (
+	"fmt"
+	"regexp"
+
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+)
+
+// buildCacheRef is the registry reference BuildKit imports and exports the layer cache of a
+// project's builds from, next to the project's images. Every build VM starts without a local
+// cache, so this is what lets dependency-install layers be reused across builds.
+func (s *Service) buildCacheRef(project queries.Project) string {
+	return fmt.Sprintf("%s/%s:buildcache", s.cfg.DockerRegistryURL, s.projectRepository(project))
+}
+
+// buildStepPattern matches Dockerfile steps like "[2/4] RUN npm ci" or "[builder 3/6] COPY . .",
+// not [internal] work.
+var buildStepPattern = regexp.MustCompile(`^\[(?:[^\]]+ )?\d+/\d+\] `)
+
+// buildCacheStats counts the Dockerfile steps of a build and how many of them were served
+// from cache.
+type buildCacheStats struct {
+	completed map[digest.Digest]bool
+	steps     int
+	cached    int
+}
+
+// update records the build steps that completed in a status update of BuildKit's solve stream.
+// BuildKit repeats vertexes in later updates, each step counts once.
+func (c *buildCacheStats) update(status *bkclient.SolveStatus) {
+	for _, v := range status.Vertexes {
+		if v.Completed == nil || c.completed[v.Digest] || !buildStepPattern.MatchString(v.Name) {
+			continue
+		}
+		if c.completed == nil {
+			c.completed = make(map[digest.Digest]bool)
+		}
+		c.completed[v.Digest] = true
+		c.steps++
+		if v.Cached {
+			c.cached++
+		}
+	}
+}
+
+// summary describes the cache hit ratio, e.g. "Build cache: 3/4 steps cached (75%)".
+func (c *buildCacheStats) summary() string {
+	if c.steps == 0 {
+		return "Build cache: no build steps"
+	}
+	return fmt.Sprintf("Build cache: %d/%d steps cached (%d%%)", c.cached, c.steps, c.cached*100/c.steps)
+}
@@ -0,0 +1,69 @@
+package zeitwork
+
+import (
+	"testing"
+	"time"
+
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBuildCacheStats(t *testing.T) {
+	started := time.Now()
+	completed := started.Add(time.Second)
+	vertex := func(name string, cached, done bool) *bkclient.Vertex {
+		v := &bkclient.Vertex{Digest: digest.FromString(name), Name: name, Started: &started, Cached: cached}
+		if done {
+			v.Completed = &completed
+		}
+		return v
+	}
+
+	tests := []struct {
+		name    string
+		updates [][]*bkclient.Vertex
+		summary string
+	}{
+		{
+			name:    "no steps",
+			updates: [][]*bkclient.Vertex{{vertex("[internal] load build definition from Dockerfile", false, true)}},
+			summary: "Build cache: no build steps",
+		},
+		{
+			name: "cached and built steps",
+			updates: [][]*bkclient.Vertex{{
+				vertex("[internal] load metadata for docker.io/library/node:22-alpine", true, true),
+				vertex("[base 1/4] FROM docker.io/library/node:22-alpine", true, true),
+				vertex("[deps 2/4] COPY package.json package-lock.json ./", true, true),
+				vertex("[deps 3/4] RUN npm ci", true, true),
+				vertex("[build 4/4] RUN npm run build", false, true),
+			}},
+			summary: "Build cache: 3/4 steps cached (75%)",
+		},
+		{
+			name: "steps repeated in later updates count once",
+			updates: [][]*bkclient.Vertex{
+				{vertex("[1/2] COPY . .", false, false), vertex("[2/2] RUN make", false, false)},
+				{vertex("[1/2] COPY . .", true, true)},
+				{vertex("[1/2] COPY . .", true, true), vertex("[2/2] RUN make", false, true)},
+			},
+			summary: "Build cache: 1/2 steps cached (50%)",
+		},
+		{
+			name:    "unfinished steps don't count",
+			updates: [][]*bkclient.Vertex{{vertex("[1/2] COPY . .", true, true), vertex("[2/2] RUN make", false, false)}},
+			summary: "Build cache: 1/1 steps cached (100%)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats buildCacheStats
+			for _, vertexes := range tt.updates {
+				stats.update(&bkclient.SolveStatus{Vertexes: vertexes})
+			}
+			if got := stats.summary(); got != tt.summary {
+				t.Errorf("expected %q, got %q", tt.summary, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// cancelSupersededBuilds cancels the in-flight builds of the same project branch that were
+// created before a new build, if the project opted in. Their deployments fail with the build.
+func (s *Service) cancelSupersededBuilds(ctx context.Context, build queries.Build) error {
+	project, err := s.db.ProjectFirstByID(ctx, build.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to find project: %w", err)
+	}
+	if !project.CancelSupersededBuilds {
+		return nil
+	}
+
+	cancelled, err := s.db.BuildCancelSuperseded(ctx, queries.BuildCancelSupersededParams{
+		ProjectID:    build.ProjectID,
+		GithubBranch: build.GithubBranch,
+		ID:           build.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel superseded builds: %w", err)
+	}
+
+	for _, b := range cancelled {
+		slog.InfoContext(ctx, "cancelled superseded build", "build_id", b.ID, "superseded_by", build.ID)
+		s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+			ID:             uuid.New(),
+			BuildID:        b.ID,
+			Message:        fmt.Sprintf("Build cancelled: superseded by build %s of commit %s", build.ID, build.GithubCommit),
+			Level:          "info",
+			OrganisationID: b.OrganisationID,
+		})
+	}
+
+	return nil
+}
+
+// watchBuildCancellation cancels a running build's context once the build is cancelled, which
+// stops its BuildKit solve or builder container. Returns when ctx is done.
+func (s *Service) watchBuildCancellation(ctx context.Context, buildID uuid.UUID, cancel context.CancelFunc) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			build, err := s.db.BuildFirstByID(ctx, buildID)
+			if err != nil {
+				continue
+			}
+			if build.Status == queries.BuildStatusCancelled {
+				slog.InfoContext(ctx, "build cancelled, stopping", "build_id", buildID)
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package zeitwork
+
+import (
+	"context"
+	"log/slog"
+)
+
+// buildVMSet is the nftables set of the tap devices of build VMs, declared in the node's
+// nftables.conf. Traffic between its members and the VM network is dropped, so builds of
+// untrusted code can reach the internet but no other VM.
+const buildVMSet = "build_vms"
+
+// firewallBuildVM adds the tap device of a build VM to the build VM set. Must succeed before
+// the VM boots.
+func (s *Service) firewallBuildVM(ctx context.Context, tap string) error {
+	return s.runCommand(ctx, "nft", "add", "element", "inet", "filter", buildVMSet, "{ "+tap+" }")
+}
+
+// unfirewallBuildVM removes the tap device of a build VM from the build VM set, since tap
+// names are reused by later VMs.
+func (s *Service) unfirewallBuildVM(ctx context.Context, tap string) {
+	if err := s.runCommand(ctx, "nft", "delete", "element", "inet", "filter", buildVMSet, "{ "+tap+" }"); err != nil {
+		slog.WarnContext(ctx, "failed to remove build VM from firewall set", "tap", tap, "err", err)
+	}
+}
+
+// resetBuildVMFirewall empties the build VM set, for when stale tap devices are cleaned up on
+// startup.
+func (s *Service) resetBuildVMFirewall(ctx context.Context) {
+	if err := s.runCommand(ctx, "nft", "flush", "set", "inet", "filter", buildVMSet); err != nil {
+		slog.WarnContext(ctx, "failed to reset build VM firewall set", "err", err)
+	}
+}
@@ -0,0 +1,276 @@
+package zeitwork
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/tonistiigi/fsutil"
+	"google.golang.org/grpc"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/registry"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// newBuildkitClient connects to the BuildKit daemon embedded in the build VM's dockerd. The
+// docker API upgrades /grpc and /session to BuildKit's control and session protocols, so no
+// extra port has to be exposed by the VM.
+func newBuildkitClient(ctx context.Context, dockerClient *client.Client) (*bkclient.Client, error) {
+	return bkclient.New(ctx, "",
+		bkclient.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return dockerClient.DialHijack(ctx, "/grpc", "h2c", nil)
+		}),
+		bkclient.WithSessionDialer(func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+			return dockerClient.DialHijack(ctx, "/session", proto, meta)
+		}),
+	)
+}
+
+// registryAuthProvider is a session attachable that answers BuildKit's credential requests for
+// registries, so registry credentials never have to be written to disk in the build VM.
+type registryAuthProvider struct {
+	auth.UnimplementedAuthServer
+	auth registry.Auth
+}
+
+func (p *registryAuthProvider) Register(server *grpc.Server) {
+	auth.RegisterAuthServer(server, p)
+}
+
+// Credentials returns the credentials of the requested registry host, and anonymous access for
+// registries without credentials, e.g. for public base images from Docker Hub.
+func (p *registryAuthProvider) Credentials(ctx context.Context, req *auth.CredentialsRequest) (*auth.CredentialsResponse, error) {
+	c, ok := p.auth.Lookup(req.Host)
+	if !ok {
+		return &auth.CredentialsResponse{}, nil
+	}
+	return &auth.CredentialsResponse{Username: c.Username, Secret: c.Password}, nil
+}
+
+// runBuildkitBuild builds the build context with BuildKit's Dockerfile frontend and pushes the
+// image with OCI media types. The layer cache is imported from and exported to cacheRef in the
+// registry. Solve progress is recorded as build steps and build logs.
+func (s *Service) runBuildkitBuild(ctx context.Context, dockerClient *client.Client, build queries.Build, buildContext io.Reader, imageTag string, dockerfilePath string, cacheRef string, vars []buildVariable, auth registry.Auth) error {
+	// BuildKit syncs local sources from the client, so the context has to be on disk
+	dir, err := os.MkdirTemp("", "zeitwork-build-")
+	if err != nil {
+		return fmt.Errorf("failed to create build context directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractBuildContext(buildContext, dir); err != nil {
+		return fmt.Errorf("failed to extract build context: %w", err)
+	}
+
+	contextFS, err := fsutil.NewFS(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open build context: %w", err)
+	}
+	dockerfileFS, err := fsutil.NewFS(filepath.Join(dir, filepath.Dir(dockerfilePath)))
+	if err != nil {
+		return fmt.Errorf("failed to open Dockerfile directory: %w", err)
+	}
+
+	bk, err := newBuildkitClient(ctx, dockerClient)
+	if err != nil {
+		return fmt.Errorf("failed to connect to buildkit: %w", err)
+	}
+	defer bk.Close()
+
+	frontendAttrs := map[string]string{
+		"filename":           filepath.Base(dockerfilePath),
+		"build-arg:ZEITWORK": "1",
+	}
+	// Build secrets are only available to RUN --mount=type=secret and never end up in image layers
+	buildSecrets := make(map[string][]byte)
+	for _, v := range vars {
+		if v.secret {
+			buildSecrets[v.name] = []byte(v.value)
+		} else {
+			frontendAttrs["build-arg:"+v.name] = v.value
+		}
+	}
+
+	exportAttrs := map[string]string{
+		"name":           imageTag,
+		"push":           "true",
+		"oci-mediatypes": "true",
+	}
+	cacheImportAttrs := map[string]string{"ref": cacheRef}
+	cacheExportAttrs := map[string]string{
+		"ref":            cacheRef,
+		"mode":           "max",
+		"image-manifest": "true",
+		"oci-mediatypes": "true",
+		"ignore-error":   "true",
+	}
+	if s.cfg.DockerRegistryInsecure {
+		exportAttrs["registry.insecure"] = "true"
+		cacheImportAttrs["registry.insecure"] = "true"
+		cacheExportAttrs["registry.insecure"] = "true"
+	}
+
+	solveOpt := bkclient.SolveOpt{
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: frontendAttrs,
+		LocalMounts: map[string]fsutil.FS{
+			"context":    contextFS,
+			"dockerfile": dockerfileFS,
+		},
+		Exports: []bkclient.ExportEntry{{
+			Type:  bkclient.ExporterImage,
+			Attrs: exportAttrs,
+		}},
+		CacheImports: []bkclient.CacheOptionsEntry{{
+			Type:  "registry",
+			Attrs: cacheImportAttrs,
+		}},
+		CacheExports: []bkclient.CacheOptionsEntry{{
+			Type:  "registry",
+			Attrs: cacheExportAttrs,
+		}},
+		Session: []session.Attachable{
+			&registryAuthProvider{auth: auth},
+			secretsprovider.FromMap(buildSecrets),
+		},
+	}
+
+	progress := newBuildProgress(ctx, s, build, vars)
+	statusCh := make(chan *bkclient.SolveStatus)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for status := range statusCh {
+			progress.update(status)
+		}
+	}()
+
+	slog.Info("starting buildkit solve", "build_id", build.ID, "tag", imageTag)
+	_, err = bk.Solve(ctx, nil, solveOpt, statusCh)
+	<-done
+	progress.flush()
+	if err != nil {
+		return fmt.Errorf("solve failed: %w", err)
+	}
+
+	s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+		ID:             uuid.New(),
+		BuildID:        build.ID,
+		Message:        progress.cache.summary(),
+		Level:          "info",
+		OrganisationID: build.OrganisationID,
+	})
+
+	slog.Info("buildkit solve completed successfully", "build_id", build.ID)
+	return nil
+}
+
+// extractBuildContext writes the build context tar produced by prepareBuildContext to dir.
+func extractBuildContext(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar: %w", err)
+		}
+
+		target, err := buildContextPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(header.Mode).Perm()
+
+		// Replace rather than follow an existing entry, which may be a symlink
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+			os.Remove(target)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Symlinks are recreated as-is; BuildKit resolves them inside the context
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := buildContextPath(dir, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// buildContextPath resolves a tar entry name inside dir, rejecting names that escape it, directly
+// or through a symlink extracted earlier.
+func buildContextPath(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in build context: %s", name)
+	}
+
+	parent, err := filepath.Rel(dir, filepath.Dir(target))
+	if err != nil {
+		return "", err
+	}
+	current := dir
+	for _, part := range strings.Split(parent, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid path in build context: %s is below a symlink", name)
+		}
+	}
+	return target, nil
+}
@@ -0,0 +1,89 @@
+package zeitwork
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractBuildContext(t *testing.T) {
+	type entry struct {
+		name     string
+		typeflag byte
+		linkname string
+		content  string
+	}
+	tests := []struct {
+		name    string
+		entries []entry
+		wantErr bool
+	}{
+		{
+			name: "files and directories",
+			entries: []entry{
+				{name: "src", typeflag: tar.TypeDir},
+				{name: "src/index.ts", typeflag: tar.TypeReg, content: "export {}"},
+				{name: "Dockerfile", typeflag: tar.TypeReg, content: "FROM scratch"},
+				{name: "current", typeflag: tar.TypeSymlink, linkname: "src"},
+			},
+		},
+		{
+			name:    "parent directory",
+			entries: []entry{{name: "../escape", typeflag: tar.TypeReg, content: "x"}},
+			wantErr: true,
+		},
+		{
+			name: "write through symlink",
+			entries: []entry{
+				{name: "link", typeflag: tar.TypeSymlink, linkname: "/tmp"},
+				{name: "link/escape", typeflag: tar.TypeReg, content: "x"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, e := range tt.entries {
+				tw.WriteHeader(&tar.Header{
+					Name:     e.name,
+					Typeflag: e.typeflag,
+					Linkname: e.linkname,
+					Mode:     0644,
+					Size:     int64(len(e.content)),
+				})
+				tw.Write([]byte(e.content))
+			}
+			tw.Close()
+
+			dir := t.TempDir()
+			err := extractBuildContext(&buf, dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range tt.entries {
+				if e.typeflag != tar.TypeReg {
+					continue
+				}
+				content, err := os.ReadFile(filepath.Join(dir, e.name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != e.content {
+					t.Errorf("%s: expected %q, got %q", e.name, e.content, content)
+				}
+			}
+		})
+	}
+}
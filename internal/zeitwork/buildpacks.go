@@ -0,0 +1,88 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/docker/docker/client"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/registry"
+)
+
+// packImage is the pack CLI that runs the CNB lifecycle against the build VM's docker daemon.
+const packImage = "buildpacksio/pack:latest"
+
+// buildpackBuilder returns the CNB builder image of a project in buildpacks mode.
+func (s *Service) buildpackBuilder(project queries.Project) string {
+	if project.BuildpackBuilder != "" {
+		return project.BuildpackBuilder
+	}
+	return s.cfg.BuildpackBuilder
+}
+
+// buildpacksCacheRef is the registry reference of the CNB layer cache of a project's builds.
+// The lifecycle's cache format differs from BuildKit's, so it is kept apart from buildCacheRef.
+func (s *Service) buildpacksCacheRef(project queries.Project) string {
+	return fmt.Sprintf("%s/%s:buildpacks-cache", s.cfg.DockerRegistryURL, s.projectRepository(project))
+}
+
+// packVariableFlags returns the pack flags for build variables. Buildpacks have no secret
+// mounts, so build secrets are passed like build args: as build-time environment of the
+// lifecycle, which is not exported into the image. Their values are redacted from the logs.
+func packVariableFlags(vars []buildVariable) []string {
+	var flags []string
+	for _, v := range vars {
+		flags = append(flags, "--env", v.name+"="+v.value)
+	}
+	return flags
+}
+
+// runPackBuild builds the build context with Cloud Native Buildpacks and publishes the image
+// to imageTag, like runBuildkitBuild does for Dockerfile builds. The builder isn't trusted, as
+// projects pick their own: pack then runs each lifecycle phase in its own container, and only the
+// phases that access the registry get its credentials, not the one running the app's build.
+func (s *Service) runPackBuild(ctx context.Context, dockerClient *client.Client, build queries.Build, buildContext io.Reader, imageTag string, builder string, cacheRef string, vars []buildVariable, auth registry.Auth) error {
+	cmd := []string{
+		"build", imageTag,
+		"--builder", builder,
+		"--path", "/build",
+		"--publish",
+		"--cache-image", cacheRef,
+		// VMs serve on port 3000; Paketo buildpacks default the app's PORT to this
+		"--env", "BPE_DEFAULT_PORT=3000",
+		"--env", "ZEITWORK=1",
+	}
+	if s.cfg.DockerRegistryInsecure {
+		cmd = append(cmd, "--insecure-registry", s.clusterRegistryHost())
+	}
+	cmd = append(cmd, packVariableFlags(vars)...)
+
+	stdoutWriter := &logWriter{ctx: ctx, s: s, build: build, level: "info", secrets: vars}
+	stderrWriter := &logWriter{ctx: ctx, s: s, build: build, level: "error", secrets: vars}
+	// Flush any remaining partial lines
+	defer stdoutWriter.Flush()
+	defer stderrWriter.Flush()
+
+	slog.Info("starting buildpacks build", "build_id", build.ID, "tag", imageTag, "builder", builder)
+	// pack reads docker credentials from DOCKER_AUTH_CONFIG, and hands the lifecycle phases
+	// that pull and push those of their images
+	dockerConfig, err := auth.DockerConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create docker config: %w", err)
+	}
+	err = s.runBuilderContainer(ctx, dockerClient, build, builderContainer{
+		image: packImage,
+		cmd:   cmd,
+		env:   []string{"DOCKER_AUTH_CONFIG=" + string(dockerConfig)},
+		// pack needs the docker socket
+		user: "root",
+	}, buildContext, stdoutWriter, stderrWriter)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("buildpacks build completed successfully", "build_id", build.ID)
+	return nil
+}
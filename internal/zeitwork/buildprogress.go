@@ -0,0 +1,153 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// buildProgress turns BuildKit's solve status stream into build steps with timings and cache
+// hits, and into build logs in the style of buildx's plain progress output.
+type buildProgress struct {
+	ctx     context.Context
+	s       *Service
+	build   queries.Build
+	secrets []buildVariable
+	steps   map[digest.Digest]*buildProgressStep
+	cache   buildCacheStats
+}
+
+type buildProgressStep struct {
+	number    int
+	name      string
+	announced bool
+	completed bool
+	logs      *logWriter // output of the step, prefixed with its number
+}
+
+func newBuildProgress(ctx context.Context, s *Service, build queries.Build, secrets []buildVariable) *buildProgress {
+	return &buildProgress{
+		ctx:     ctx,
+		s:       s,
+		build:   build,
+		secrets: secrets,
+		steps:   make(map[digest.Digest]*buildProgressStep),
+	}
+}
+
+func (p *buildProgress) update(status *bkclient.SolveStatus) {
+	p.cache.update(status)
+	for _, v := range status.Vertexes {
+		p.vertex(v)
+	}
+	for _, l := range status.Logs {
+		if step, ok := p.steps[l.Vertex]; ok {
+			step.logs.Write(l.Data)
+		}
+	}
+	for _, w := range status.Warnings {
+		prefix := ""
+		if step, ok := p.steps[w.Vertex]; ok {
+			prefix = fmt.Sprintf("#%d ", step.number)
+		}
+		p.log(prefix+"WARN: "+string(w.Short), "info")
+	}
+}
+
+func (p *buildProgress) vertex(v *bkclient.Vertex) {
+	step, ok := p.steps[v.Digest]
+	if !ok {
+		number := len(p.steps) + 1
+		step = &buildProgressStep{
+			number: number,
+			name:   redactBuildSecrets(v.Name, p.secrets),
+			logs: &logWriter{
+				ctx:     p.ctx,
+				s:       p.s,
+				build:   p.build,
+				level:   "info",
+				prefix:  fmt.Sprintf("#%d ", number),
+				secrets: p.secrets,
+			},
+		}
+		p.steps[v.Digest] = step
+	}
+
+	// BuildKit repeats vertexes in later updates; only new starts and completions are logged
+	if step.completed || (v.Started == nil && v.Completed == nil) {
+		return
+	}
+	if step.announced && v.Completed == nil {
+		return
+	}
+
+	if !step.announced {
+		step.announced = true
+		p.log(fmt.Sprintf("#%d %s", step.number, step.name), "info")
+	}
+
+	if v.Completed != nil && !step.completed {
+		step.completed = true
+		step.logs.Flush()
+		switch {
+		case v.Error != "":
+			p.log(fmt.Sprintf("#%d ERROR: %s", step.number, redactBuildSecrets(v.Error, p.secrets)), "error")
+		case v.Cached:
+			p.log(fmt.Sprintf("#%d CACHED", step.number), "info")
+		default:
+			var took time.Duration
+			if v.Started != nil {
+				took = v.Completed.Sub(*v.Started)
+			}
+			p.log(fmt.Sprintf("#%d DONE %.1fs", step.number, took.Seconds()), "info")
+		}
+	}
+
+	err := p.s.db.BuildStepUpsert(p.ctx, queries.BuildStepUpsertParams{
+		ID:             uuid.New(),
+		BuildID:        p.build.ID,
+		Vertex:         v.Digest.String(),
+		Number:         int32(step.number),
+		Name:           step.name,
+		Cached:         v.Cached,
+		Error:          redactBuildSecrets(v.Error, p.secrets),
+		StartedAt:      buildStepTime(v.Started),
+		CompletedAt:    buildStepTime(v.Completed),
+		OrganisationID: p.build.OrganisationID,
+	})
+	if err != nil {
+		slog.Warn("failed to record build step", "build_id", p.build.ID, "step", step.number, "error", err)
+	}
+}
+
+// flush writes the remaining output of steps that didn't complete, e.g. when the build failed.
+func (p *buildProgress) flush() {
+	for _, step := range p.steps {
+		step.logs.Flush()
+	}
+}
+
+func (p *buildProgress) log(message, level string) {
+	p.s.db.BuildLogCreate(p.ctx, queries.BuildLogCreateParams{
+		ID:             uuid.New(),
+		BuildID:        p.build.ID,
+		Message:        message,
+		Level:          level,
+		OrganisationID: p.build.OrganisationID,
+	})
+}
+
+func buildStepTime(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
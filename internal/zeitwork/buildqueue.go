@@ -0,0 +1,97 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// Build priorities, higher starts first. Preview builds yield to builds of regular environments.
+const (
+	buildPriorityPreview = 0
+	buildPriorityDefault = 1
+)
+
+// buildQueuePollInterval is how often a queued build checks whether it may start.
+const buildQueuePollInterval = 5 * time.Second
+
+func buildPriority(environment queries.Environment) int32 {
+	if environment.Preview {
+		return buildPriorityPreview
+	}
+	return buildPriorityDefault
+}
+
+// admitBuild reports whether a pending build may start now under the global and per-organisation
+// build concurrency caps, or else its position in the queue. Pending builds are admitted by
+// priority, then first in first out. A build of an organisation that is at its cap does not hold
+// up builds of other organisations. The caller holds buildQueueMu until the build is marked building.
+func (s *Service) admitBuild(ctx context.Context, build queries.Build) (bool, int, error) {
+	running, err := s.db.BuildCountBuildingByOrganisation(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to count running builds: %w", err)
+	}
+	queued, err := s.db.BuildFindQueued(ctx)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to find queued builds: %w", err)
+	}
+
+	free := s.cfg.BuildConcurrency
+	perOrganisation := make(map[uuid.UUID]int, len(running))
+	for _, r := range running {
+		free -= int(r.Builds)
+		perOrganisation[r.OrganisationID] = int(r.Builds)
+	}
+
+	for i, b := range queued {
+		admitted := free > 0 && perOrganisation[b.OrganisationID] < s.cfg.BuildOrganisationConcurrency
+		if b.ID == build.ID {
+			return admitted, i + 1, nil
+		}
+		if admitted {
+			free--
+			perOrganisation[b.OrganisationID]++
+		}
+	}
+
+	// Not pending anymore, e.g. deleted meanwhile
+	return false, 0, nil
+}
+
+// updateBuildQueuePosition records a changed queue position in the build logs.
+// A zero position means the build left the queue.
+func (s *Service) updateBuildQueuePosition(ctx context.Context, build queries.Build, position int) error {
+	if position == 0 && !build.QueuePosition.Valid {
+		return nil
+	}
+	if build.QueuePosition.Valid && int(build.QueuePosition.Int32) == position {
+		return nil
+	}
+
+	err := s.db.BuildUpdateQueuePosition(ctx, queries.BuildUpdateQueuePositionParams{
+		ID:            build.ID,
+		QueuePosition: pgtype.Int4{Int32: int32(position), Valid: position > 0},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update queue position: %w", err)
+	}
+
+	message := fmt.Sprintf("Queued: position %d in the build queue", position)
+	if position == 0 {
+		message = "Leaving the build queue, starting build"
+	}
+	slog.InfoContext(ctx, "build queue position changed", "build_id", build.ID, "position", position)
+	s.db.BuildLogCreate(ctx, queries.BuildLogCreateParams{
+		ID:             uuid.New(),
+		BuildID:        build.ID,
+		Message:        message,
+		Level:          "info",
+		OrganisationID: build.OrganisationID,
+	})
+	return nil
+}
@@ -0,0 +1,66 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/zeitwork/zeitwork/internal/shared/crypto"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// buildVariable is a decrypted build arg or build secret of a project.
+type buildVariable struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// prepareBuildVariables fetches and decrypts the build args and build secrets of a project.
+func (s *Service) prepareBuildVariables(ctx context.Context, projectID uuid.UUID) ([]buildVariable, error) {
+	rows, err := s.db.BuildVariableFindByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch build variables: %w", err)
+	}
+
+	vars := make([]buildVariable, 0, len(rows))
+	for _, row := range rows {
+		value, err := crypto.Decrypt(row.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt build variable %s: %w", row.Name, err)
+		}
+		vars = append(vars, buildVariable{name: row.Name, value: value, secret: row.Secret})
+	}
+	return vars, nil
+}
+
+// buildImageTag returns the tag of the image built from a commit with the given build variables.
+// Builds with variables get a keyed hash of them appended, so a commit is built again when they
+// change, without the tag revealing secrets.
+func buildImageTag(commit string, vars []buildVariable) (string, error) {
+	if len(vars) == 0 {
+		return commit, nil
+	}
+	lines := make([]string, 0, len(vars))
+	for _, v := range vars {
+		lines = append(lines, fmt.Sprintf("%s\x00%t\x00%s", v.name, v.secret, v.value))
+	}
+	slices.Sort(lines)
+	mac, err := crypto.MAC(strings.Join(lines, "\x00\x00"))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash build variables: %w", err)
+	}
+	return commit + "-" + mac[:16], nil
+}
+
+// redactBuildSecrets masks the values of build secrets in a build log line, in case a build
+// step prints one.
+func redactBuildSecrets(line string, vars []buildVariable) string {
+	for _, v := range vars {
+		if v.secret && v.value != "" {
+			line = strings.ReplaceAll(line, v.value, "********")
+		}
+	}
+	return line
+}
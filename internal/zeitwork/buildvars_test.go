@@ -0,0 +1,40 @@
+package zeitwork
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildImageTag(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", strings.Repeat("ab", 32))
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+
+	tag := func(vars ...buildVariable) string {
+		t.Helper()
+		tag, err := buildImageTag(commit, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tag
+	}
+
+	if got := tag(); got != commit {
+		t.Errorf("without build variables: expected %s, got %s", commit, got)
+	}
+
+	apiURL := buildVariable{name: "API_URL", value: "https://api.example.com"}
+	token := buildVariable{name: "NPM_TOKEN", value: "secret", secret: true}
+	withVars := tag(apiURL, token)
+	if !strings.HasPrefix(withVars, commit+"-") || strings.Contains(withVars, "secret") {
+		t.Errorf("with build variables: unexpected tag %s", withVars)
+	}
+	if got := tag(token, apiURL); got != withVars {
+		t.Errorf("reordered build variables: expected %s, got %s", withVars, got)
+	}
+
+	changed := token
+	changed.value = "rotated"
+	if got := tag(apiURL, changed); got == withVars {
+		t.Errorf("changed build secret: expected a tag other than %s", withVars)
+	}
+}
@@ -0,0 +1,323 @@
+package zeitwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/cron"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// cronJobBootTimeout is how long a cron job VM may take to accept exec sessions
+const cronJobBootTimeout = 2 * time.Minute
+
+// reconcileCronJob starts a run of a cron job when it is due and schedules the next one.
+// Schedules are evaluated in UTC.
+func (s *Service) reconcileCronJob(ctx context.Context, objectID uuid.UUID) error {
+	if !s.isControlPlaneLeader() {
+		return nil
+	}
+
+	job, err := s.db.CronJobFirstByID(ctx, objectID)
+	if err != nil {
+		return err
+	}
+	if job.DeletedAt.Valid {
+		return nil
+	}
+
+	logger := slog.With("cron_job_id", job.ID)
+
+	schedule, err := cron.Parse(job.Schedule)
+	if err != nil {
+		logger.WarnContext(ctx, "invalid cron schedule", "schedule", job.Schedule, "error", err)
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	if job.NextRunAt.Valid && job.NextRunAt.Time.After(now) {
+		s.cronJobScheduler.Schedule(job.ID, job.NextRunAt.Time)
+		return nil
+	}
+
+	// Due (or never scheduled) - runs missed while no leader was around are started once
+	if job.NextRunAt.Valid {
+		if err := s.startCronJobRun(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		logger.WarnContext(ctx, "cron schedule never matches", "schedule", job.Schedule)
+		return nil
+	}
+	err = s.db.CronJobUpdateNextRun(ctx, queries.CronJobUpdateNextRunParams{
+		ID:        job.ID,
+		NextRunAt: pgtype.Timestamptz{Time: next, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update next run: %w", err)
+	}
+	s.cronJobScheduler.Schedule(job.ID, next)
+	logger.InfoContext(ctx, "scheduled next cron job run", "next_run_at", next)
+
+	return nil
+}
+
+// startCronJobRun records a run of a cron job against the current deployment of its environment.
+// A run is skipped while the previous one is still in progress.
+func (s *Service) startCronJobRun(ctx context.Context, job queries.CronJob) error {
+	unfinished, err := s.db.CronJobRunFindUnfinishedByCronJobID(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find unfinished runs: %w", err)
+	}
+	if len(unfinished) > 0 {
+		slog.InfoContext(ctx, "previous cron job run still in progress, skipping", "cron_job_id", job.ID, "run_id", unfinished[0].ID)
+		return nil
+	}
+
+	deployment, err := s.db.DeploymentLatestRunningByEnvironmentID(ctx, job.EnvironmentID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to find running deployment: %w", err)
+	}
+
+	run, err := s.db.CronJobRunCreate(ctx, queries.CronJobRunCreateParams{
+		ID:             uuid.New(),
+		CronJobID:      job.ID,
+		DeploymentID:   deployment.ID,
+		OrganisationID: job.OrganisationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cron job run: %w", err)
+	}
+
+	if !deployment.ID.Valid {
+		return s.failCronJobRun(ctx, run, pgtype.Int4{}, "no running deployment")
+	}
+
+	slog.InfoContext(ctx, "started cron job run", "cron_job_id", job.ID, "run_id", run.ID, "deployment_id", deployment.ID)
+	s.cronJobRunScheduler.Schedule(run.ID, time.Now())
+	return nil
+}
+
+// reconcileCronJobRun runs the command of a cron job in an ephemeral VM from the image of the
+// run's deployment, with the environment variables of its environment. Like release commands,
+// the VM is created on this server since exec sessions are dialed through the local VSOCK socket.
+func (s *Service) reconcileCronJobRun(ctx context.Context, objectID uuid.UUID) error {
+	if !s.isControlPlaneLeader() {
+		return nil
+	}
+
+	run, err := s.db.CronJobRunFirstByID(ctx, objectID)
+	if err != nil {
+		return err
+	}
+
+	// Finished - make sure the VM is gone
+	if run.FinishedAt.Valid || run.DeletedAt.Valid {
+		if run.VmID.Valid {
+			return s.db.VMSoftDelete(ctx, run.VmID)
+		}
+		return nil
+	}
+
+	// The command is running on this server
+	s.activeCronJobRunsMu.Lock()
+	active := s.activeCronJobRuns[run.ID]
+	s.activeCronJobRunsMu.Unlock()
+	if active {
+		return nil
+	}
+
+	// The command was started by a process that went away before it finished
+	if run.Status == queries.CronJobRunStatusRunning {
+		return s.failCronJobRun(ctx, run, pgtype.Int4{}, "interrupted")
+	}
+
+	job, err := s.db.CronJobFirstByID(ctx, run.CronJobID)
+	if err != nil {
+		return fmt.Errorf("failed to find cron job: %w", err)
+	}
+
+	logger := slog.With("cron_job_id", job.ID, "run_id", run.ID)
+
+	if !run.VmID.Valid {
+		deployment, err := s.db.DeploymentFirstByID(ctx, run.DeploymentID)
+		if err != nil {
+			return fmt.Errorf("failed to find deployment: %w", err)
+		}
+		environment, err := s.db.EnvironmentFirstByID(ctx, job.EnvironmentID)
+		if err != nil {
+			return fmt.Errorf("failed to find environment: %w", err)
+		}
+		encryptedEnvVars, err := s.prepareEnvVariablesForVM(ctx, job.EnvironmentID)
+		if err != nil {
+			return fmt.Errorf("failed to prepare environment variables: %w", err)
+		}
+
+		vm, err := s.VMCreate(ctx, VMCreateParams{
+			VCPUs:        environment.Vcpus,
+			Memory:       environment.Memory,
+			ImageID:      deployment.ImageID,
+			Port:         3000,
+			EnvVariables: encryptedEnvVars,
+			ServerID:     s.serverID,
+			Idle:         true,
+
+			OrganisationID: deployment.OrganisationID,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.CronJobRunUpdateVM(ctx, queries.CronJobRunUpdateVMParams{ID: run.ID, VmID: vm.ID}); err != nil {
+			return err
+		}
+		logger.InfoContext(ctx, "created cron job VM", "vm_id", vm.ID)
+		s.cronJobRunScheduler.Schedule(run.ID, time.Now().Add(5*time.Second))
+		return nil
+	}
+
+	vm, err := s.db.VMFirstByID(ctx, run.VmID)
+	if err != nil {
+		return err
+	}
+
+	// Leadership moved before the command was started, start over on this server
+	if vm.ServerID != s.serverID {
+		if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+			return err
+		}
+		_, err = s.db.CronJobRunUpdateVM(ctx, queries.CronJobRunUpdateVMParams{ID: run.ID, VmID: uuid.UUID{}})
+		return err
+	}
+
+	if vm.Status == queries.VmStatusFailed {
+		return s.failCronJobRun(ctx, run, pgtype.Int4{}, "VM failed to start")
+	}
+
+	if vm.Status != queries.VmStatusRunning {
+		s.cronJobRunScheduler.Schedule(run.ID, time.Now().Add(5*time.Second))
+		return nil
+	}
+
+	conn, err := DialExec(ctx, vm.ID)
+	if err != nil {
+		if vm.RunningAt.Valid && time.Since(vm.RunningAt.Time) > cronJobBootTimeout {
+			return s.failCronJobRun(ctx, run, pgtype.Int4{}, "VM did not become reachable")
+		}
+		// The guest is still booting
+		logger.DebugContext(ctx, "cron job VM not reachable yet", "vm_id", vm.ID, "error", err)
+		s.cronJobRunScheduler.Schedule(run.ID, time.Now().Add(5*time.Second))
+		return nil
+	}
+
+	// The command runs in the background until the job's timeout, which may be a day, so the
+	// scheduler's workers stay free for other runs
+	s.activeCronJobRunsMu.Lock()
+	s.activeCronJobRuns[run.ID] = true
+	s.activeCronJobRunsMu.Unlock()
+
+	run, err = s.db.CronJobRunMarkRunning(ctx, objectID)
+	if err != nil {
+		conn.CloseNow()
+		s.finishCronJobRunCommand(objectID)
+		return fmt.Errorf("failed to mark cron job run as running: %w", err)
+	}
+	s.cronJobRunLog(ctx, run, "info", fmt.Sprintf("Running: %s", job.Command))
+
+	go func() {
+		defer s.finishCronJobRunCommand(run.ID)
+		if err := s.runCronJobCommand(context.WithoutCancel(ctx), run, job, vm, conn); err != nil {
+			logger.ErrorContext(ctx, "cron job run failed to finish", "error", err)
+			s.cronJobRunScheduler.Schedule(run.ID, time.Now().Add(5*time.Second))
+		}
+	}()
+	return nil
+}
+
+// runCronJobCommand runs the command of a cron job run over an exec session of its VM, and
+// records the result.
+func (s *Service) runCronJobCommand(ctx context.Context, run queries.CronJobRun, job queries.CronJob, vm queries.Vm, conn *websocket.Conn) error {
+	logger := slog.With("cron_job_id", job.ID, "run_id", run.ID)
+
+	timeout := time.Duration(job.Timeout) * time.Second
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output := &lineWriter{write: func(line string) {
+		s.cronJobRunLog(ctx, run, "info", line)
+	}}
+	exitCode, err := RunExec(runCtx, conn, []string{"/bin/sh", "-c", job.Command}, output)
+	output.Flush()
+
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		return s.failCronJobRun(ctx, run, pgtype.Int4{}, fmt.Sprintf("timed out after %s", formatDuration(timeout)))
+	case err != nil:
+		return s.failCronJobRun(ctx, run, pgtype.Int4{}, fmt.Sprintf("command failed: %s", err))
+	case exitCode != 0:
+		return s.failCronJobRun(ctx, run, pgtype.Int4{Int32: int32(exitCode), Valid: true}, fmt.Sprintf("command exited with code %d", exitCode))
+	}
+
+	err = s.db.CronJobRunMarkSucceeded(ctx, queries.CronJobRunMarkSucceededParams{
+		ID:       run.ID,
+		ExitCode: pgtype.Int4{Int32: 0, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark cron job run as succeeded: %w", err)
+	}
+	s.cronJobRunLog(ctx, run, "info", "Succeeded")
+	logger.InfoContext(ctx, "cron job run succeeded")
+
+	return s.db.VMSoftDelete(ctx, vm.ID)
+}
+
+// finishCronJobRunCommand forgets the command of a run once it stopped running on this server.
+func (s *Service) finishCronJobRunCommand(runID uuid.UUID) {
+	s.activeCronJobRunsMu.Lock()
+	delete(s.activeCronJobRuns, runID)
+	s.activeCronJobRunsMu.Unlock()
+}
+
+// failCronJobRun marks a run as failed, records the reason in its logs and releases its VM.
+func (s *Service) failCronJobRun(ctx context.Context, run queries.CronJobRun, exitCode pgtype.Int4, reason string) error {
+	slog.WarnContext(ctx, "cron job run failed", "cron_job_id", run.CronJobID, "run_id", run.ID, "reason", reason)
+	s.cronJobRunLog(ctx, run, "error", fmt.Sprintf("Failed: %s", reason))
+
+	err := s.db.CronJobRunMarkFailed(ctx, queries.CronJobRunMarkFailedParams{
+		ID:           run.ID,
+		ExitCode:     exitCode,
+		FailedReason: pgtype.Text{String: reason, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark cron job run as failed: %w", err)
+	}
+
+	if run.VmID.Valid {
+		return s.db.VMSoftDelete(ctx, run.VmID)
+	}
+	return nil
+}
+
+// cronJobRunLog writes a message to cron_job_run_logs so it is visible to the user.
+func (s *Service) cronJobRunLog(ctx context.Context, run queries.CronJobRun, level, message string) {
+	err := s.db.CronJobRunLogCreate(ctx, queries.CronJobRunLogCreateParams{
+		ID:             uuid.New(),
+		CronJobRunID:   run.ID,
+		Message:        message,
+		Level:          level,
+		OrganisationID: run.OrganisationID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to write cron job run log", "run_id", run.ID, "error", err)
+	}
+}
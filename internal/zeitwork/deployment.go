@@ -3,13 +3,15 @@ package zeitwork
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/database"
 	"github.com/zeitwork/zeitwork/internal/database/queries"
 	"github.com/zeitwork/zeitwork/internal/shared/crypto"
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
@@ -31,34 +33,27 @@ func (s *Service) reconcileDeployment(ctx context.Context, objectID uuid.UUID) e
 	if deployment.DeletedAt.Valid || deployment.FailedAt.Valid || deployment.StoppedAt.Valid {
 		logger.InfoContext(ctx, "deployment in terminal state, skipping")
 
-		if !deployment.VmID.Valid {
-			return nil
-		}
-
-		// Ensure if the deployment is in a terminal state, the VM is also deleted
-		vm, err := s.db.VMFirstByID(ctx, deployment.VmID)
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-		if vm.DeletedAt.Valid {
-			return nil
-		}
+		// Ensure if the deployment is in a terminal state, its VMs are also deleted
+		return s.deleteDeploymentVMs(ctx, deployment)
+	}
 
-		err = s.db.VMSoftDelete(ctx, deployment.VmID)
-		if err != nil {
-			return err
-		}
-		logger.InfoContext(ctx, "deleted VM for terminal deployment", "deployment_id", deployment.ID, "vm_id", deployment.VmID)
+	// Stopping - wait for the replicas to finish their in-flight requests
+	if deployment.StoppingAt.Valid {
+		return s.reconcileDeploymentStopping(ctx, deployment)
+	}
 
-		return nil
+	environment, err := s.db.EnvironmentFirstByID(ctx, deployment.EnvironmentID)
+	if err != nil {
+		return fmt.Errorf("failed to find environment: %w", err)
 	}
 
-	// Already running - nothing to reconcile
+	// Already running - keep the replica count in line with the environment and
+	// drive an in-progress rollout to this deployment
 	if deployment.RunningAt.Valid {
-		return nil
+		if _, err := s.reconcileDeploymentReplicas(ctx, &deployment, environment); err != nil {
+			return err
+		}
+		return s.reconcileRollout(ctx, deployment)
 	}
 
 	// Deployments should have a build
@@ -69,8 +64,10 @@ func (s *Service) reconcileDeployment(ctx context.Context, objectID uuid.UUID) e
 			Status:         queries.BuildStatusPending,
 			ProjectID:      deployment.ProjectID,
 			GithubCommit:   deployment.GithubCommit,
-			GithubBranch:   "main", // TODO: later we will have environments where you can define the branch
+			GithubBranch:   environment.Branch,
+			Priority:       buildPriority(environment),
 			OrganisationID: deployment.OrganisationID,
+			SourceUploadID: deployment.SourceUploadID,
 		})
 		if err != nil {
 			return err
@@ -84,6 +81,10 @@ func (s *Service) reconcileDeployment(ctx context.Context, objectID uuid.UUID) e
 			return err
 		}
 		logger.InfoContext(ctx, "updated deployment with build", "build_id", build.ID)
+		// Best effort, the deployment does not depend on it
+		if err := s.cancelSupersededBuilds(ctx, build); err != nil {
+			logger.ErrorContext(ctx, "failed to cancel superseded builds", "build_id", build.ID, "error", err)
+		}
 	}
 
 	build, err := s.db.BuildFirstByID(ctx, deployment.BuildID)
@@ -95,12 +96,10 @@ func (s *Service) reconcileDeployment(ctx context.Context, objectID uuid.UUID) e
 
 	// If build failed, mark the deployment as failed
 	if build.FailedAt.Valid {
-		err = s.db.DeploymentUpdateFailedAt(ctx, deployment.ID)
-		if err != nil {
-			return err
-		}
-		logger.InfoContext(ctx, "marked deployment as failed", "build_id", build.ID)
-		return nil
+		return s.failDeployment(ctx, deployment, "build failed")
+	}
+	if build.CancelledAt.Valid {
+		return s.failDeployment(ctx, deployment, "build cancelled")
 	}
 
 	if !build.ImageID.Valid {
@@ -121,89 +120,324 @@ func (s *Service) reconcileDeployment(ctx context.Context, objectID uuid.UUID) e
 		logger.InfoContext(ctx, "updated deployment with new image", "image_id", build.ImageID, "build_id", build.ID)
 	}
 
-	// If the deployment does not have a VM, create one
-	if !deployment.VmID.Valid {
-		// Fetch and prepare environment variables for the VM
-		encryptedEnvVars, err := s.prepareEnvVariablesForVM(ctx, deployment.ProjectID)
-		if err != nil {
-			return fmt.Errorf("failed to prepare environment variables: %w", err)
+	// Run the project's release command before any replica serves the new image
+	released, err := s.reconcileDeploymentRelease(ctx, &deployment, environment)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return nil
+	}
+
+	// Ensure the deployment has a VM for every replica of its environment
+	vms, err := s.reconcileDeploymentReplicas(ctx, &deployment, environment)
+	if err != nil {
+		return err
+	}
+
+	// Check the health of every replica before marking as running
+	for _, vm := range vms {
+		if vm.ExitCode.Valid {
+			return s.failDeployment(ctx, deployment, fmt.Sprintf("VM exited with code %d", vm.ExitCode.Int32))
+		}
+		if vm.Status == queries.VmStatusFailed {
+			return s.failDeployment(ctx, deployment, "VM failed")
 		}
 
-		// Create a VM for this deployment
-		vm, err := s.VMCreate(ctx, VMCreateParams{
-			VCPUs:        1,
-			Memory:       2 * 1024,
-			ImageID:      deployment.ImageID,
-			Port:         3000,
-			EnvVariables: encryptedEnvVars,
-		})
-		if err != nil {
-			return err
+		// Processes other than web don't serve HTTP, they are healthy while they run
+		healthy := vm.Status == queries.VmStatusRunning
+		if vm.Process == webProcess {
+			healthy = s.checkDeploymentHealth(vm.IpAddress.Addr().String(), vm.Port.Int32)
 		}
-		deployment, err = s.db.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
-			ID:   deployment.ID,
-			VmID: vm.ID,
-		})
-		if err != nil {
-			return err
+		if !healthy {
+			// Give up once the deployment has been starting for longer than the deadline
+			timeout := s.cfg.DeploymentStartupTimeout
+			if deployment.StartingAt.Valid && time.Since(deployment.StartingAt.Time) > timeout {
+				return s.failDeployment(ctx, deployment, fmt.Sprintf("health check timed out after %s", formatDuration(timeout)))
+			}
+			logger.InfoContext(ctx, "deployment health check failed, will retry", "vm_id", vm.ID)
+			return fmt.Errorf("health check failed, will retry")
 		}
-		logger.InfoContext(ctx, "linked vm to deployment", "vm_id", vm.ID)
 	}
 
-	// If the deployment has a VM, check if it is healthy
-	vm, err := s.db.VMFirstByID(ctx, deployment.VmID)
+	// Mark the deployment as running
+	err = s.db.DeploymentMarkRunning(ctx, deployment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark deployment as running: %w", err)
+	}
+	logger.InfoContext(ctx, "marked deployment as running")
+
+	// Move traffic to this deployment, at once or through a progressive rollout
+	err = s.promoteDeployment(ctx, deployment)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to promote deployment: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileDeploymentReplicas creates or removes VMs until the deployment has as many live
+// replicas of every process type as asked for, and keeps deployments.vm_id pointing at a web replica.
+// Returns the live replicas, oldest first. Draining replicas are on their way out and don't count.
+func (s *Service) reconcileDeploymentReplicas(ctx context.Context, deployment *queries.Deployment, environment queries.Environment) ([]queries.Vm, error) {
+	processes, err := s.deploymentProcesses(ctx, *deployment, environment)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := s.db.VMFindByDeploymentID(ctx, deployment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deployment VMs: %w", err)
+	}
+	vms = slices.DeleteFunc(vms, func(vm queries.Vm) bool { return vm.DrainingAt.Valid })
+
+	// New replicas of a running deployment that have yet to become healthy
+	joining, err := s.db.VMFindJoiningByDeploymentID(ctx, deployment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find joining VMs: %w", err)
+	}
+
+	// Drain replicas of process types that were removed, and delete those that have yet to join
+	for _, vm := range joining {
+		if slices.ContainsFunc(processes, func(p deploymentProcess) bool { return p.Name == vm.Process }) {
+			continue
+		}
+		if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, vm := range vms {
+		if slices.ContainsFunc(processes, func(p deploymentProcess) bool { return p.Name == vm.Process }) {
+			continue
+		}
+		if err := s.db.VMMarkDraining(ctx, vm.ID); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "draining replica of removed process", "deployment_id", deployment.ID, "vm_id", vm.ID, "process", vm.Process)
 	}
 
-	// If the VM is deleted, reset the VM of the deployment
-	if vm.DeletedAt.Valid {
-		deployment, err = s.db.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
+	var encryptedEnvVars string
+	var live, pending []queries.Vm
+	for _, process := range processes {
+		replicas := slices.DeleteFunc(slices.Clone(vms), func(vm queries.Vm) bool { return vm.Process != process.Name })
+		waiting := slices.DeleteFunc(slices.Clone(joining), func(vm queries.Vm) bool { return vm.Process != process.Name })
+
+		// Scale down by deleting replicas that have yet to join, then draining the newest replicas
+		for len(waiting) > 0 && len(replicas)+len(waiting) > process.Replicas {
+			extra := waiting[len(waiting)-1]
+			if err := s.db.VMSoftDelete(ctx, extra.ID); err != nil {
+				return nil, err
+			}
+			waiting = waiting[:len(waiting)-1]
+		}
+		for len(replicas) > process.Replicas {
+			extra := replicas[len(replicas)-1]
+			if err := s.db.VMMarkDraining(ctx, extra.ID); err != nil {
+				return nil, err
+			}
+			replicas = replicas[:len(replicas)-1]
+			slog.InfoContext(ctx, "draining replica of deployment", "deployment_id", deployment.ID, "vm_id", extra.ID, "process", process.Name)
+		}
+
+		pending = append(pending, waiting...)
+
+		// Scale up
+		for n := len(replicas) + len(waiting); n < process.Replicas; n++ {
+			// Fetch and prepare environment variables for the VMs
+			if encryptedEnvVars == "" {
+				encryptedEnvVars, err = s.prepareEnvVariablesForVM(ctx, deployment.EnvironmentID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to prepare environment variables: %w", err)
+				}
+			}
+
+			// Replicas of a running deployment would get traffic as soon as they join it, so
+			// they only join once healthy, like replacements of drained VMs. The cluster leader
+			// deletes them if they don't in time, the next reconcile creates new ones.
+			params := VMCreateParams{
+				VCPUs:        environment.Vcpus,
+				Memory:       environment.Memory,
+				ImageID:      deployment.ImageID,
+				Port:         3000,
+				EnvVariables: encryptedEnvVars,
+				Process:      process.Name,
+				Command:      process.Command,
+
+				OrganisationID: deployment.OrganisationID,
+			}
+			if deployment.RunningAt.Valid {
+				params.JoiningID = deployment.ID
+				params.ExpiresAt = time.Now().Add(drainHealthCheckTimeout)
+			} else {
+				params.DeploymentID = deployment.ID
+			}
+			vm, err := s.VMCreate(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+			if deployment.RunningAt.Valid {
+				pending = append(pending, *vm)
+				continue
+			}
+			replicas = append(replicas, *vm)
+			slog.InfoContext(ctx, "added replica to deployment", "deployment_id", deployment.ID, "vm_id", vm.ID, "process", process.Name)
+		}
+
+		live = append(live, replicas...)
+	}
+
+	if len(pending) > 0 {
+		added, err := s.attachDeploymentReplicas(ctx, *deployment, pending)
+		live = append(live, added...)
+		if err != nil {
+			return nil, err
+		}
+		// Check the others again shortly
+		if len(added) < len(pending) {
+			s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(2*time.Second))
+		}
+	}
+
+	// The deployment's VM is its primary web replica, e.g. for logs
+	if !slices.ContainsFunc(live, func(vm queries.Vm) bool { return vm.ID == deployment.VmID && vm.Process == webProcess }) {
+		*deployment, err = s.db.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
 			ID:   deployment.ID,
-			VmID: uuid.Nil(),
+			VmID: live[0].ID,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
-		logger.InfoContext(ctx, "reset VM for deleted deployment", "vm_id", deployment.VmID)
-		s.deploymentScheduler.Schedule(deployment.ID, time.Now())
-		return nil
+		slog.InfoContext(ctx, "linked vm to deployment", "deployment_id", deployment.ID, "vm_id", live[0].ID)
+	}
+
+	return live, nil
+}
+
+// attachDeploymentReplicas adds the new replicas of a running deployment that are healthy, or just
+// run for processes other than web, to the deployment. It doesn't wait for the others, the caller
+// checks them again later.
+// Returns the replicas that joined the deployment.
+func (s *Service) attachDeploymentReplicas(ctx context.Context, deployment queries.Deployment, vms []queries.Vm) ([]queries.Vm, error) {
+	var attached []queries.Vm
+	for _, vm := range vms {
+		if vm.Status == queries.VmStatusFailed || vm.ExitCode.Valid {
+			if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+				return attached, err
+			}
+			slog.WarnContext(ctx, "deleted replica that failed to start", "deployment_id", deployment.ID, "vm_id", vm.ID, "process", vm.Process)
+			continue
+		}
+
+		// Processes other than web don't serve HTTP, they are healthy while they run
+		healthy := vm.Status == queries.VmStatusRunning
+		if healthy && vm.Process == webProcess {
+			healthy = s.checkDeploymentHealth(vm.IpAddress.Addr().String(), vm.Port.Int32)
+		}
+		if !healthy {
+			continue
+		}
+
+		// Zero rows when the cluster leader deleted the replica for not joining in time
+		joined, err := s.db.VMJoinDeployment(ctx, vm.ID)
+		if err != nil {
+			return attached, err
+		}
+		if joined == 0 {
+			continue
+		}
+		vm.DeploymentID = deployment.ID
+		attached = append(attached, vm)
+		slog.InfoContext(ctx, "added replica to deployment", "deployment_id", deployment.ID, "vm_id", vm.ID, "process", vm.Process)
 	}
 
-	// Perform HTTP health check before marking as running
-	healthy := s.checkDeploymentHealth(vm.IpAddress.Addr().String(), vm.Port.Int32)
-	if !healthy {
-		logger.InfoContext(ctx, "deployment health check failed, will retry", "vm_id", deployment.VmID)
-		return fmt.Errorf("health check failed, will retry")
+	if len(attached) > 0 {
+		s.notifyRouteChange()
 	}
+	return attached, nil
+}
 
-	// Mark the deployment as running
-	err = s.db.DeploymentMarkRunning(ctx, deployment.ID)
+// failDeployment marks a deployment as failed, records the reason in deployment_logs and releases its VMs.
+// Traffic stays on the previous deployment.
+func (s *Service) failDeployment(ctx context.Context, deployment queries.Deployment, reason string) error {
+	slog.WarnContext(ctx, "deployment failed", "deployment_id", deployment.ID, "reason", reason)
+	s.deploymentLog(ctx, deployment, "error", fmt.Sprintf("Deployment failed: %s", reason))
+
+	err := s.db.DeploymentMarkFailed(ctx, queries.DeploymentMarkFailedParams{
+		ID:           deployment.ID,
+		FailedReason: pgtype.Text{String: reason, Valid: true},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to mark deployment as running: %w", err)
+		return fmt.Errorf("failed to mark deployment as failed: %w", err)
 	}
-	logger.InfoContext(ctx, "marked deployment as running")
 
-	// Point custom domains to this new deployment
-	err = s.pointCustomDomainsToDeployment(ctx, deployment)
+	return s.deleteDeploymentVMs(ctx, deployment)
+}
+
+// deploymentLog writes a message to deployment_logs so it is visible to the user.
+func (s *Service) deploymentLog(ctx context.Context, deployment queries.Deployment, level, message string) {
+	err := s.db.DeploymentLogCreate(ctx, queries.DeploymentLogCreateParams{
+		ID:             uuid.New(),
+		DeploymentID:   deployment.ID,
+		Message:        message,
+		Level:          level,
+		OrganisationID: deployment.OrganisationID,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to write deployment log", "deployment_id", deployment.ID, "error", err)
+	}
+}
+
+// formatDuration renders a duration without trailing zero units, e.g. "5m" instead of "5m0s".
+func formatDuration(d time.Duration) string {
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+// deleteDeploymentVMs soft-deletes every replica and the release VM of a deployment.
+// The VM reconciler stops the processes.
+func (s *Service) deleteDeploymentVMs(ctx context.Context, deployment queries.Deployment) error {
+	if deployment.ReleaseVmID.Valid {
+		if err := s.db.VMSoftDelete(ctx, deployment.ReleaseVmID); err != nil {
+			return err
+		}
+	}
+
+	vms, err := s.db.VMFindByDeploymentID(ctx, deployment.ID)
 	if err != nil {
-		return fmt.Errorf("failed to point custom domains to deployment: %w", err)
+		return fmt.Errorf("failed to find deployment VMs: %w", err)
 	}
 
-	// Stop older deployments for this project now that the new one is healthy
-	err = s.stopOldDeployments(ctx, deployment)
+	joining, err := s.db.VMFindJoiningByDeploymentID(ctx, deployment.ID)
 	if err != nil {
-		return fmt.Errorf("failed to stop old deployments: %w", err)
+		return fmt.Errorf("failed to find joining VMs: %w", err)
+	}
+
+	for _, vm := range append(vms, joining...) {
+		if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "deleted VM for deployment", "deployment_id", deployment.ID, "vm_id", vm.ID)
 	}
 
 	return nil
 }
 
-// prepareEnvVariablesForVM fetches environment variables for a project,
+// prepareEnvVariablesForVM fetches environment variables for an environment,
 // decrypts them, formats as "KEY=value" strings, and re-encrypts as JSON.
 // Returns an encrypted JSON array string suitable for storing in vms.env_variables.
-func (s *Service) prepareEnvVariablesForVM(ctx context.Context, projectID uuid.UUID) (string, error) {
-	envVars, err := s.db.EnvironmentVariableFindByProjectID(ctx, projectID)
+func (s *Service) prepareEnvVariablesForVM(ctx context.Context, environmentID uuid.UUID) (string, error) {
+	return prepareEnvVariables(ctx, s.db, environmentID)
+}
+
+// prepareEnvVariables is prepareEnvVariablesForVM for callers without a Service, e.g. zeitworkctl.
+func prepareEnvVariables(ctx context.Context, db *database.DB, environmentID uuid.UUID) (string, error) {
+	envVars, err := db.EnvironmentVariableFindByEnvironmentID(ctx, environmentID)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch environment variables: %w", err)
 	}
@@ -230,7 +464,7 @@ func (s *Service) prepareEnvVariablesForVM(ctx context.Context, projectID uuid.U
 		return "", fmt.Errorf("failed to encrypt environment variables: %w", err)
 	}
 
-	slog.Info("prepared environment variables for VM", "projectID", projectID, "count", len(envStrings))
+	slog.Info("prepared environment variables for VM", "environmentID", environmentID, "count", len(envStrings))
 	return encryptedEnvVars, nil
 }
 
@@ -254,11 +488,11 @@ func (s *Service) checkDeploymentHealth(ip string, port int32) bool {
 	return healthy
 }
 
-// pointCustomDomainsToDeployment updates all custom domains for the project to point to this deployment
+// pointCustomDomainsToDeployment updates all custom domains of the deployment's environment to point to this deployment
 func (s *Service) pointCustomDomainsToDeployment(ctx context.Context, deployment queries.Deployment) error {
-	err := s.db.DomainUpdateDeploymentForProject(ctx, queries.DomainUpdateDeploymentForProjectParams{
-		DeploymentID: deployment.ID,
-		ProjectID:    deployment.ProjectID,
+	err := s.db.DomainUpdateDeploymentForEnvironment(ctx, queries.DomainUpdateDeploymentForEnvironmentParams{
+		DeploymentID:  deployment.ID,
+		EnvironmentID: deployment.EnvironmentID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to update domains: %w", err)
@@ -266,11 +500,12 @@ func (s *Service) pointCustomDomainsToDeployment(ctx context.Context, deployment
 	return nil
 }
 
-// stopOldDeployments finds and stops all other running deployments for the same project
+// stopOldDeployments takes all other running deployments in the same environment out of edge routing.
+// They are marked stopped once their in-flight requests have finished.
 func (s *Service) stopOldDeployments(ctx context.Context, currentDeployment queries.Deployment) error {
 	oldDeployments, err := s.db.DeploymentFindRunningAndOlder(ctx, queries.DeploymentFindRunningAndOlderParams{
-		ProjectID: currentDeployment.ProjectID,
-		ID:        currentDeployment.ID,
+		EnvironmentID: currentDeployment.EnvironmentID,
+		ID:            currentDeployment.ID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to find old deployments: %w", err)
@@ -283,21 +518,12 @@ func (s *Service) stopOldDeployments(ctx context.Context, currentDeployment quer
 
 	slog.Info("stopping old deployments", "deployment_id", currentDeployment.ID, "old_deployment_count", len(oldDeployments))
 	for _, oldDep := range oldDeployments {
-		// We deleted the VM, the reconciler will stop the process
-		if oldDep.VmID.Valid {
-			if err := s.db.VMSoftDelete(ctx, oldDep.VmID); err != nil {
-				slog.Error("failed to soft delete VM for old deployment", "deployment_id", oldDep.ID, "vm_id", oldDep.VmID, "error", err)
-				continue
-			}
-			slog.Info("soft deleted VM for old deployment", "deployment_id", oldDep.ID, "vm_id", oldDep.VmID)
-		}
-
-		// Mark the deployment as stopped
-		if err := s.db.DeploymentMarkStopped(ctx, oldDep.ID); err != nil {
-			slog.Error("failed to mark old deployment as stopped", "deployment_id", oldDep.ID, "error", err)
+		// The deployment reconciler drains its VMs before marking it stopped
+		if err := s.db.DeploymentMarkStopping(ctx, oldDep.ID); err != nil {
+			slog.Error("failed to mark old deployment as stopping", "deployment_id", oldDep.ID, "error", err)
 			continue
 		}
-		slog.Info("marked old deployment as stopped", "deployment_id", oldDep.ID)
+		slog.Info("marked old deployment as stopping", "deployment_id", oldDep.ID)
 	}
 
 	return nil
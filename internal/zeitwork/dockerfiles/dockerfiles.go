@@ -8,12 +8,42 @@ var nuxtDockerfile []byte
 //go:embed nextjs.Dockerfile
 var nextjsDockerfile []byte
 
+//go:embed sveltekit.Dockerfile
+var sveltekitDockerfile []byte
+
+//go:embed remix.Dockerfile
+var remixDockerfile []byte
+
+//go:embed astro.Dockerfile
+var astroDockerfile []byte
+
+//go:embed vite.Dockerfile
+var viteDockerfile []byte
+
+//go:embed bun.Dockerfile
+var bunDockerfile []byte
+
 //go:embed rails.Dockerfile
 var railsDockerfile []byte
 
 //go:embed laravel.Dockerfile
 var laravelDockerfile []byte
 
+//go:embed django.Dockerfile
+var djangoDockerfile []byte
+
+//go:embed fastapi.Dockerfile
+var fastapiDockerfile []byte
+
+//go:embed flask.Dockerfile
+var flaskDockerfile []byte
+
+//go:embed go.Dockerfile
+var goDockerfile []byte
+
+//go:embed phoenix.Dockerfile
+var phoenixDockerfile []byte
+
 // Get returns the Dockerfile content for a given framework name.
 // Returns nil if the framework is not supported.
 func Get(framework string) []byte {
@@ -22,10 +52,30 @@ func Get(framework string) []byte {
 		return nuxtDockerfile
 	case "nextjs":
 		return nextjsDockerfile
+	case "sveltekit":
+		return sveltekitDockerfile
+	case "remix":
+		return remixDockerfile
+	case "astro":
+		return astroDockerfile
+	case "vite":
+		return viteDockerfile
+	case "bun":
+		return bunDockerfile
 	case "rails":
 		return railsDockerfile
 	case "laravel":
 		return laravelDockerfile
+	case "django":
+		return djangoDockerfile
+	case "fastapi":
+		return fastapiDockerfile
+	case "flask":
+		return flaskDockerfile
+	case "go":
+		return goDockerfile
+	case "phoenix":
+		return phoenixDockerfile
 	default:
 		return nil
 	}
@@ -0,0 +1,86 @@
+package dockerfiles
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/linter"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+var frameworks = []string{
+	"nuxt", "nextjs", "sveltekit", "remix", "astro", "vite", "bun",
+	"rails", "laravel", "django", "fastapi", "flask", "go", "phoenix",
+}
+
+func TestGet(t *testing.T) {
+	for _, framework := range frameworks {
+		content := string(Get(framework))
+		if content == "" {
+			t.Errorf("%s: no Dockerfile", framework)
+			continue
+		}
+		if !strings.HasPrefix(content, "FROM ") {
+			t.Errorf("%s: Dockerfile does not start with FROM", framework)
+		}
+		// VMs route traffic to port 3000
+		if !strings.Contains(content, "EXPOSE 3000\n") {
+			t.Errorf("%s: Dockerfile does not expose port 3000", framework)
+		}
+		if !strings.Contains(content, "\nCMD [") {
+			t.Errorf("%s: Dockerfile has no exec-form CMD", framework)
+		}
+	}
+
+	if Get("cobol") != nil {
+		t.Error("expected no Dockerfile for an unsupported framework")
+	}
+}
+
+// The Dockerfiles are built with BuildKit, so they are parsed with its parser, and the images they
+// use are pinned to a tag, so a release of one doesn't change builds unnoticed
+func TestParse(t *testing.T) {
+	for _, framework := range frameworks {
+		result, err := parser.Parse(bytes.NewReader(Get(framework)))
+		if err != nil {
+			t.Errorf("%s: %v", framework, err)
+			continue
+		}
+		for _, warning := range result.Warnings {
+			t.Errorf("%s: %s", framework, warning.Short)
+		}
+
+		lint := linter.New(&linter.Config{
+			Warn: func(rule, _, _, message string, _ []parser.Range) {
+				t.Errorf("%s: %s: %s", framework, rule, message)
+			},
+		})
+		stages, _, err := instructions.Parse(result.AST, lint)
+		if err != nil {
+			t.Errorf("%s: %v", framework, err)
+			continue
+		}
+
+		names := map[string]bool{}
+		for _, stage := range stages {
+			images := []string{stage.BaseName}
+			for _, command := range stage.Commands {
+				if c, ok := command.(*instructions.CopyCommand); ok && c.From != "" {
+					images = append(images, c.From)
+				}
+			}
+			for _, image := range images {
+				if names[image] {
+					continue
+				}
+				name := image[strings.LastIndex(image, "/")+1:]
+				if _, tag, ok := strings.Cut(name, ":"); !ok || tag == "latest" {
+					t.Errorf("%s: image %s is not pinned to a tag", framework, image)
+				}
+			}
+			names[stage.Name] = true
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// vmDrainGracePeriod gives every edge proxy time to reload its routes and report the requests
+// it still has open, before a draining VM without reported requests counts as drained.
+const vmDrainGracePeriod = 5 * time.Second
+
+// reconcileDeploymentStopping takes the replicas of a stopping deployment out of edge routing
+// and marks the deployment stopped once the VM reconciler has drained and deleted all of them.
+func (s *Service) reconcileDeploymentStopping(ctx context.Context, deployment queries.Deployment) error {
+	if err := s.db.VMMarkDrainingByDeploymentID(ctx, deployment.ID); err != nil {
+		return fmt.Errorf("failed to drain deployment VMs: %w", err)
+	}
+
+	vms, err := s.db.VMFindByDeploymentID(ctx, deployment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find deployment VMs: %w", err)
+	}
+	if len(vms) > 0 {
+		// Deleting a drained VM schedules the deployment again
+		slog.InfoContext(ctx, "waiting for deployment VMs to drain", "deployment_id", deployment.ID, "vm_count", len(vms))
+		return nil
+	}
+
+	if err := s.db.DeploymentMarkStopped(ctx, deployment.ID); err != nil {
+		return fmt.Errorf("failed to mark deployment as stopped: %w", err)
+	}
+	slog.InfoContext(ctx, "marked deployment as stopped", "deployment_id", deployment.ID)
+
+	return nil
+}
+
+// reconcileVMDrain soft-deletes a draining VM once it is drained, and checks again later otherwise.
+func (s *Service) reconcileVMDrain(ctx context.Context, vm queries.Vm) error {
+	drained, err := s.vmDrained(ctx, vm)
+	if err != nil {
+		return err
+	}
+	if !drained {
+		s.vmScheduler.Schedule(vm.ID, time.Now().Add(2*time.Second))
+		return nil
+	}
+
+	slog.InfoContext(ctx, "vm drained, deleting", "vm_id", vm.ID)
+	return s.db.VMSoftDelete(ctx, vm.ID)
+}
+
+// waitForVMDrain blocks until a draining VM is drained and deleted.
+func (s *Service) waitForVMDrain(ctx context.Context, vmID uuid.UUID) error {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			vm, err := s.db.VMFirstByID(ctx, vmID)
+			if err != nil {
+				return err
+			}
+			if vm.DeletedAt.Valid {
+				return nil
+			}
+
+			drained, err := s.vmDrained(ctx, vm)
+			if err != nil {
+				return err
+			}
+			if drained {
+				return s.db.VMSoftDelete(ctx, vm.ID)
+			}
+		}
+	}
+}
+
+// vmDrained reports whether no edge proxy has requests open to a draining VM anymore,
+// or the VM has been draining for longer than the drain timeout.
+func (s *Service) vmDrained(ctx context.Context, vm queries.Vm) (bool, error) {
+	draining := time.Since(vm.DrainingAt.Time)
+	if draining < vmDrainGracePeriod {
+		return false, nil
+	}
+	if draining > s.cfg.DeploymentDrainTimeout {
+		slog.WarnContext(ctx, "vm drain timed out", "vm_id", vm.ID, "timeout", s.cfg.DeploymentDrainTimeout)
+		return true, nil
+	}
+
+	requests, err := s.db.VMInflightRequestsSum(ctx, vm.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to sum in-flight requests: %w", err)
+	}
+	return requests == 0, nil
+}
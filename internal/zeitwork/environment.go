@@ -0,0 +1,46 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// reconcileEnvironment tears down deleted environments, e.g. preview environments whose
+// branch was deleted or whose pull request was closed. Their deployments are stopped, which
+// releases the VMs on the next deployment reconcile, and their domains are removed from routing.
+func (s *Service) reconcileEnvironment(ctx context.Context, objectID uuid.UUID) error {
+	if !s.isControlPlaneLeader() {
+		return nil
+	}
+
+	environment, err := s.db.EnvironmentFirstByID(ctx, objectID)
+	if err != nil {
+		return err
+	}
+
+	if !environment.DeletedAt.Valid {
+		return nil
+	}
+
+	deployments, err := s.db.DeploymentFindActiveByEnvironmentID(ctx, environment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find deployments: %w", err)
+	}
+	for _, deployment := range deployments {
+		if err := s.db.DeploymentMarkStopping(ctx, deployment.ID); err != nil {
+			return fmt.Errorf("failed to stop deployment: %w", err)
+		}
+	}
+
+	if err := s.db.DomainSoftDeleteByEnvironmentID(ctx, environment.ID); err != nil {
+		return fmt.Errorf("failed to delete domains: %w", err)
+	}
+
+	if len(deployments) > 0 {
+		slog.InfoContext(ctx, "stopped deployments of deleted environment", "environment_id", environment.ID, "count", len(deployments))
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package zeitwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// frameworkManifests are the root-level files whose content is buffered for framework detection.
+var frameworkManifests = map[string]bool{
+	"package.json":     true,
+	"Gemfile":          true,
+	"composer.json":    true,
+	"requirements.txt": true,
+	"pyproject.toml":   true,
+	"mix.exs":          true,
+}
+
+// frameworkSignals collects indicators observed while iterating the source tarball.
+type frameworkSignals struct {
+	files          map[string]bool   // root-level file names
+	manifests      map[string][]byte // content of root-level frameworkManifests
+	hasRailsRoutes bool              // config/routes.rb
+}
+
+// observe records a file of the build context, and its content if it is a root-level manifest.
+func (s *frameworkSignals) observe(path string, content []byte) {
+	if s.files == nil {
+		s.files = make(map[string]bool)
+		s.manifests = make(map[string][]byte)
+	}
+	if path == "config/routes.rb" {
+		s.hasRailsRoutes = true
+	}
+	if strings.Contains(path, "/") {
+		return
+	}
+	s.files[path] = true
+	if content != nil {
+		s.manifests[path] = content
+	}
+}
+
+// firstFile returns the first of the given root-level files that exists.
+func (s *frameworkSignals) firstFile(names ...string) string {
+	for _, name := range names {
+		if s.files[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// frameworkDetection is the result of detectFramework, with the reasoning behind it.
+type frameworkDetection struct {
+	framework string // dockerfiles template name, empty if no framework was detected
+	reason    string
+
+	packageManager       string // empty if not applicable
+	packageManagerReason string
+}
+
+// String describes the detection for the build logs.
+func (d frameworkDetection) String() string {
+	str := fmt.Sprintf("Detected framework: %s (%s)", frameworkNames[d.framework], d.reason)
+	if d.packageManager != "" {
+		str += fmt.Sprintf(", package manager: %s (%s)", d.packageManager, d.packageManagerReason)
+	}
+	return str
+}
+
+// frameworkNames are the display names of the frameworks with a default Dockerfile.
+var frameworkNames = map[string]string{
+	"nuxt":      "Nuxt",
+	"nextjs":    "Next.js",
+	"sveltekit": "SvelteKit",
+	"remix":     "Remix",
+	"astro":     "Astro",
+	"vite":      "Vite",
+	"bun":       "Bun",
+	"rails":     "Rails",
+	"laravel":   "Laravel",
+	"django":    "Django",
+	"fastapi":   "FastAPI",
+	"flask":     "Flask",
+	"go":        "Go",
+	"phoenix":   "Phoenix",
+}
+
+// supportedFrameworks lists the display names of supported frameworks for error messages.
+const supportedFrameworks = "Nuxt, Next.js, SvelteKit, Remix, Astro, Vite, Bun, Rails, Laravel, Django, FastAPI, Flask, Go, Phoenix"
+
+// detectFramework resolves the framework from collected signals.
+// Strong signals (config files) take priority; file-content parsing is a fallback.
+func detectFramework(s frameworkSignals) frameworkDetection {
+	d := detectFrameworkName(s)
+	if d.framework == "" {
+		return d
+	}
+
+	switch d.framework {
+	case "nuxt", "nextjs", "sveltekit", "remix", "astro", "vite", "bun":
+		d.packageManager, d.packageManagerReason = detectNodePackageManager(s)
+	case "django", "fastapi", "flask":
+		d.packageManager, d.packageManagerReason = detectPythonPackageManager(s)
+	}
+	return d
+}
+
+func detectFrameworkName(s frameworkSignals) frameworkDetection {
+	found := func(framework, file string) frameworkDetection {
+		return frameworkDetection{framework: framework, reason: "found " + file}
+	}
+
+	// 1. Strong config-file signals
+	if f := s.firstFile("nuxt.config.ts", "nuxt.config.js"); f != "" {
+		return found("nuxt", f)
+	}
+	if f := s.firstFile("next.config.ts", "next.config.js", "next.config.mjs"); f != "" {
+		return found("nextjs", f)
+	}
+	if f := s.firstFile("svelte.config.js", "svelte.config.ts"); f != "" && s.nodeDependency("@sveltejs/kit") {
+		return frameworkDetection{framework: "sveltekit", reason: "found " + f + " and package.json depends on @sveltejs/kit"}
+	}
+	if f := s.firstFile("remix.config.js", "remix.config.mjs"); f != "" {
+		return found("remix", f)
+	}
+	if f := s.firstFile("astro.config.mjs", "astro.config.ts", "astro.config.js"); f != "" {
+		return found("astro", f)
+	}
+	if s.files["artisan"] {
+		return found("laravel", "artisan")
+	}
+	if s.hasRailsRoutes {
+		return found("rails", "config/routes.rb")
+	}
+	if s.files["Gemfile"] && s.files["Rakefile"] {
+		return found("rails", "Gemfile and Rakefile")
+	}
+	if s.files["manage.py"] {
+		return found("django", "manage.py")
+	}
+	if s.files["go.mod"] {
+		return found("go", "go.mod")
+	}
+
+	// 2. Fallback: parse manifest file contents
+	for _, dep := range []struct{ name, framework string }{
+		// Check nuxt before next (nuxt depends on vue, not next)
+		{"nuxt", "nuxt"},
+		{"next", "nextjs"},
+		{"@sveltejs/kit", "sveltekit"},
+		{"@remix-run/node", "remix"},
+		{"@remix-run/serve", "remix"},
+		{"astro", "astro"},
+	} {
+		if s.nodeDependency(dep.name) {
+			return frameworkDetection{framework: dep.framework, reason: "package.json depends on " + dep.name}
+		}
+	}
+
+	if gemfile := s.manifests["Gemfile"]; gemfile != nil {
+		content := string(gemfile)
+		if strings.Contains(content, "'rails'") || strings.Contains(content, "\"rails\"") {
+			return frameworkDetection{framework: "rails", reason: "Gemfile requires rails"}
+		}
+	}
+
+	if composerJSON := s.manifests["composer.json"]; composerJSON != nil {
+		var composer struct {
+			Require map[string]string `json:"require"`
+		}
+		if json.Unmarshal(composerJSON, &composer) == nil {
+			if _, ok := composer.Require["laravel/framework"]; ok {
+				return frameworkDetection{framework: "laravel", reason: "composer.json requires laravel/framework"}
+			}
+		}
+	}
+
+	for _, framework := range []string{"django", "fastapi", "flask"} {
+		if file := s.pythonDependency(framework); file != "" {
+			return frameworkDetection{framework: framework, reason: file + " depends on " + framework}
+		}
+	}
+
+	if mixExs := s.manifests["mix.exs"]; mixExs != nil && strings.Contains(string(mixExs), ":phoenix") {
+		return frameworkDetection{framework: "phoenix", reason: "mix.exs depends on phoenix"}
+	}
+
+	// 3. Static sites and plain runtimes
+	if f := s.firstFile("vite.config.ts", "vite.config.js", "vite.config.mjs"); f != "" {
+		return found("vite", f)
+	}
+	if s.nodeDependency("vite") {
+		return frameworkDetection{framework: "vite", reason: "package.json depends on vite"}
+	}
+	if f := s.firstFile("bun.lock", "bun.lockb", "bunfig.toml"); f != "" {
+		return found("bun", f)
+	}
+
+	return frameworkDetection{}
+}
+
+// nodeDependency reports whether package.json lists a dependency or dev dependency.
+func (s *frameworkSignals) nodeDependency(name string) bool {
+	packageJSON := s.manifests["package.json"]
+	if packageJSON == nil {
+		return false
+	}
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if json.Unmarshal(packageJSON, &pkg) != nil {
+		return false
+	}
+	_, dep := pkg.Dependencies[name]
+	_, devDep := pkg.DevDependencies[name]
+	return dep || devDep
+}
+
+// pythonDependency returns the manifest that lists a Python package, or an empty string.
+// Package names are matched case-insensitively, followed by a version specifier or the end of the entry.
+func (s *frameworkSignals) pythonDependency(name string) string {
+	pattern := regexp.MustCompile(`(?im)(^|["'\s])` + regexp.QuoteMeta(name) + `\s*(\[[^\]]*\])?\s*([<>=~!;,"']|$)`)
+	for _, file := range []string{"requirements.txt", "pyproject.toml"} {
+		if content := s.manifests[file]; content != nil && pattern.Match(content) {
+			return file
+		}
+	}
+	return ""
+}
+
+func detectNodePackageManager(s frameworkSignals) (string, string) {
+	if f := s.firstFile("bun.lock", "bun.lockb"); f != "" {
+		return "bun", "found " + f
+	}
+	if s.files["pnpm-lock.yaml"] {
+		return "pnpm", "found pnpm-lock.yaml"
+	}
+	if s.files["yarn.lock"] {
+		return "yarn", "found yarn.lock"
+	}
+	if s.files["package-lock.json"] {
+		return "npm", "found package-lock.json"
+	}
+	return "npm", "no lockfile found"
+}
+
+func detectPythonPackageManager(s frameworkSignals) (string, string) {
+	if s.files["uv.lock"] {
+		return "uv", "found uv.lock"
+	}
+	if s.files["poetry.lock"] {
+		return "poetry", "found poetry.lock"
+	}
+	if s.files["requirements.txt"] {
+		return "pip", "found requirements.txt"
+	}
+	return "pip", "installing pyproject.toml"
+}
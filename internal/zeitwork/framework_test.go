@@ -0,0 +1,140 @@
+package zeitwork
+
+import (
+	"testing"
+
+	"github.com/zeitwork/zeitwork/internal/zeitwork/dockerfiles"
+)
+
+func TestDetectFramework(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          map[string]string // path -> content
+		framework      string
+		packageManager string
+	}{
+		{
+			name:           "nuxt config",
+			files:          map[string]string{"nuxt.config.ts": "", "package.json": "{}", "pnpm-lock.yaml": ""},
+			framework:      "nuxt",
+			packageManager: "pnpm",
+		},
+		{
+			name:           "next dependency",
+			files:          map[string]string{"package.json": `{"dependencies":{"next":"15.0.0"}}`, "yarn.lock": ""},
+			framework:      "nextjs",
+			packageManager: "yarn",
+		},
+		{
+			name:           "sveltekit",
+			files:          map[string]string{"svelte.config.js": "", "package.json": `{"devDependencies":{"@sveltejs/kit":"2.0.0"}}`, "bun.lockb": ""},
+			framework:      "sveltekit",
+			packageManager: "bun",
+		},
+		{
+			name:           "remix with vite",
+			files:          map[string]string{"vite.config.ts": "", "package.json": `{"dependencies":{"@remix-run/node":"2.0.0"}}`, "package-lock.json": ""},
+			framework:      "remix",
+			packageManager: "npm",
+		},
+		{
+			name:           "astro",
+			files:          map[string]string{"astro.config.mjs": "", "package.json": "{}"},
+			framework:      "astro",
+			packageManager: "npm",
+		},
+		{
+			name:           "static vite app",
+			files:          map[string]string{"vite.config.ts": "", "package.json": `{"devDependencies":{"vite":"6.0.0"}}`},
+			framework:      "vite",
+			packageManager: "npm",
+		},
+		{
+			name:           "bun server",
+			files:          map[string]string{"package.json": "{}", "bun.lock": "", "index.ts": ""},
+			framework:      "bun",
+			packageManager: "bun",
+		},
+		{
+			name:      "rails routes",
+			files:     map[string]string{"Gemfile": "", "config/routes.rb": ""},
+			framework: "rails",
+		},
+		{
+			name:      "laravel composer",
+			files:     map[string]string{"composer.json": `{"require":{"laravel/framework":"^11.0"}}`},
+			framework: "laravel",
+		},
+		{
+			name:           "django manage.py",
+			files:          map[string]string{"manage.py": "", "requirements.txt": "Django>=5.0\n"},
+			framework:      "django",
+			packageManager: "pip",
+		},
+		{
+			name:           "fastapi with uv",
+			files:          map[string]string{"pyproject.toml": "dependencies = [\n  \"fastapi[standard]>=0.115\",\n]\n", "uv.lock": ""},
+			framework:      "fastapi",
+			packageManager: "uv",
+		},
+		{
+			name:           "flask with poetry",
+			files:          map[string]string{"pyproject.toml": "[tool.poetry.dependencies]\nflask = \"^3.0\"\n", "poetry.lock": ""},
+			framework:      "flask",
+			packageManager: "poetry",
+		},
+		{
+			name:           "flask extension is not flask",
+			files:          map[string]string{"requirements.txt": "flask-cors==4.0\nfastapi==0.115\n"},
+			framework:      "fastapi",
+			packageManager: "pip",
+		},
+		{
+			name:      "go module",
+			files:     map[string]string{"go.mod": "module example.com/app\n", "main.go": ""},
+			framework: "go",
+		},
+		{
+			name:      "phoenix",
+			files:     map[string]string{"mix.exs": `{:phoenix, "~> 1.7"}`},
+			framework: "phoenix",
+		},
+		{
+			name:  "unknown",
+			files: map[string]string{"README.md": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signals frameworkSignals
+			for path, content := range tt.files {
+				var buffered []byte
+				if frameworkManifests[path] {
+					buffered = []byte(content)
+				}
+				signals.observe(path, buffered)
+			}
+
+			d := detectFramework(signals)
+			if d.framework != tt.framework {
+				t.Fatalf("expected framework %q, got %q (%s)", tt.framework, d.framework, d.reason)
+			}
+			if d.packageManager != tt.packageManager {
+				t.Errorf("expected package manager %q, got %q (%s)", tt.packageManager, d.packageManager, d.packageManagerReason)
+			}
+			if d.framework == "" {
+				return
+			}
+			if d.reason == "" {
+				t.Error("expected a reason")
+			}
+			if frameworkNames[d.framework] == "" {
+				t.Errorf("no display name for %q", d.framework)
+			}
+			if dockerfiles.Get(d.framework) == nil {
+				t.Errorf("no Dockerfile for %q", d.framework)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package zeitwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/opencontainers/go-digest"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/registry"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// Build VMs boot the docker-in-docker image, pinned to the digest its tag resolves to when
+// the VM is created.
+const (
+	buildVMImageRegistry   = "ghcr.io"
+	buildVMImageRepository = "tomhaerter/dind"
+	buildVMImageTag        = "latest"
+)
+
+// resolveImageDigest returns the manifest digest a tag currently resolves to.
+func (s *Service) resolveImageDigest(ctx context.Context, imageRef string, auth registry.Auth) (string, error) {
+	args := []string{"inspect", "--no-tags", "--format", "{{.Digest}}"}
+	args = append(args, s.skopeoRegistryFlags(auth, "", imageRef)...)
+	args = append(args, "docker://"+imageRef)
+
+	out, err := exec.CommandContext(ctx, "skopeo", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to resolve digest of %s: %w: %s", imageRef, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to resolve digest of %s: %w", imageRef, err)
+	}
+
+	d, err := digest.Parse(strings.TrimSpace(string(out)))
+	if err != nil {
+		return "", fmt.Errorf("invalid digest of %s: %w", imageRef, err)
+	}
+	return d.String(), nil
+}
+
+// buildVMImage returns the image record of the build VM image at the digest its tag currently
+// resolves to.
+func (s *Service) buildVMImage(ctx context.Context) (queries.ImageFindOrCreateRow, error) {
+	ref := fmt.Sprintf("%s/%s:%s", buildVMImageRegistry, buildVMImageRepository, buildVMImageTag)
+	d, err := s.resolveImageDigest(ctx, ref, s.clusterRegistryAuth)
+	if err != nil {
+		return queries.ImageFindOrCreateRow{}, err
+	}
+
+	// atomic find-or-create to avoid race conditions
+	return s.db.ImageFindOrCreate(ctx, queries.ImageFindOrCreateParams{
+		ID:         uuid.New(),
+		Registry:   buildVMImageRegistry,
+		Repository: buildVMImageRepository,
+		Tag:        buildVMImageTag,
+		Digest:     d,
+	})
+}
+
+// pinnedImageDigest returns the digest an image is pulled by. Images created before digests
+// were recorded are pinned to the digest their tag resolves to on their first pull, so every
+// server boots the same bits from then on. If another image already pins the tag to that digest,
+// deployments, builds and VMs move over to it.
+func (s *Service) pinnedImageDigest(ctx context.Context, image queries.Image, auth registry.Auth) (string, error) {
+	if image.Digest != "" {
+		return image.Digest, nil
+	}
+
+	d, err := s.resolveImageDigest(ctx, fmt.Sprintf("%s/%s:%s", image.Registry, image.Repository, image.Tag), auth)
+	if err != nil {
+		return "", err
+	}
+
+	pinned, err := s.db.ImagePinDigest(ctx, queries.ImagePinDigestParams{ID: image.ID, Digest: d})
+	if err == nil {
+		slog.InfoContext(ctx, "pinned image to digest", "image_id", image.ID, "digest", d)
+		return pinned.Digest, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	// another server pinned it first
+	image, err = s.db.ImageFindByID(ctx, image.ID)
+	if err != nil {
+		return "", err
+	}
+	if image.Digest != "" {
+		return image.Digest, nil
+	}
+
+	// another image already pins the tag to this digest, use that one from now on
+	existing, err := s.db.ImageFindPinned(ctx, queries.ImageFindPinnedParams{ID: image.ID, Digest: d})
+	if err != nil {
+		return "", fmt.Errorf("failed to find image pinned to %s: %w", d, err)
+	}
+	err = s.db.ImageRepoint(ctx, queries.ImageRepointParams{FromID: image.ID, ToID: existing.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to move image %s to image %s: %w", image.ID, existing.ID, err)
+	}
+	slog.InfoContext(ctx, "moved image to the image pinning its digest", "image_id", image.ID, "pinned_image_id", existing.ID, "digest", d)
+	return existing.Digest, nil
+}
@@ -0,0 +1,121 @@
+package zeitwork
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+)
+
+// sigstoreRegistriesConfig makes skopeo store and look up signatures as sigstore attachments
+// next to the image in its registry, the layout cosign uses.
+const sigstoreRegistriesConfig = "default-docker:\n  use-sigstore-attachments: true\n"
+
+// writeSigstoreRegistriesConfig writes the registries.d config for signing and verifying
+// images to dir, and returns the directory to pass as --registries.d.
+func writeSigstoreRegistriesConfig(dir string) (string, error) {
+	registriesDir := filepath.Join(dir, "registries.d")
+	if err := os.MkdirAll(registriesDir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(registriesDir, "sigstore.yaml"), []byte(sigstoreRegistriesConfig), 0600); err != nil {
+		return "", err
+	}
+	return registriesDir, nil
+}
+
+// writeImagePolicy writes a containers policy that only accepts images signed with the
+// cluster's key to dir, and returns its path to pass as --policy. Signatures are accepted for
+// any tag of the image's repository, and skopeo checks that they match the pulled manifest
+// digest.
+func (s *Service) writeImagePolicy(dir string) (string, error) {
+	policy := map[string]any{
+		"default": []map[string]any{{
+			"type":           "sigstoreSigned",
+			"keyPath":        s.cfg.ImageVerificationKey,
+			"signedIdentity": map[string]string{"type": "matchRepository"},
+		}},
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	policyPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(policyPath, data, 0600); err != nil {
+		return "", err
+	}
+	return policyPath, nil
+}
+
+// signImage signs a pushed image with the cluster's key. skopeo copies the image onto itself,
+// which keeps its manifest digest and attaches a cosign-compatible signature.
+func (s *Service) signImage(ctx context.Context, imageRef string) error {
+	if s.cfg.ImageSigningKey == "" {
+		return nil
+	}
+
+	tmpdir, err := os.MkdirTemp("", "sign")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	registriesDir, err := writeSigstoreRegistriesConfig(tmpdir)
+	if err != nil {
+		return err
+	}
+	passphrasePath := filepath.Join(tmpdir, "passphrase")
+	if err := os.WriteFile(passphrasePath, []byte(s.cfg.ImageSigningPassphrase), 0600); err != nil {
+		return err
+	}
+
+	args := []string{"copy", "--registries.d", registriesDir}
+	args = append(args, s.skopeoRegistryFlags(s.clusterRegistryAuth, "src-", imageRef)...)
+	args = append(args, s.skopeoRegistryFlags(s.clusterRegistryAuth, "dest-", imageRef)...)
+	args = append(args,
+		"--preserve-digests",
+		"--sign-by-sigstore-private-key", s.cfg.ImageSigningKey,
+		"--sign-passphrase-file", passphrasePath,
+		"docker://"+imageRef, "docker://"+imageRef,
+	)
+	err = s.runCommand(ctx, "skopeo", args...)
+	if err != nil {
+		return fmt.Errorf("failed to sign image: %w", err)
+	}
+	return nil
+}
+
+// imageVerificationArgs returns the skopeo flags to pull the image of a VM. With a
+// verification key, images must be signed with the cluster's key, except the cluster's build
+// image and the images of projects that allow external images.
+func (s *Service) imageVerificationArgs(ctx context.Context, vm queries.Vm, dir string) ([]string, error) {
+	if s.cfg.ImageVerificationKey == "" {
+		return nil, nil
+	}
+	if vm.Build {
+		return nil, nil
+	}
+
+	allowUnsigned, err := s.db.VMAllowsUnsignedImage(ctx, vm.ID)
+	if err != nil {
+		return nil, err
+	}
+	if allowUnsigned {
+		slog.InfoContext(ctx, "project allows external images, skipping signature verification", "vm_id", vm.ID)
+		return nil, nil
+	}
+
+	registriesDir, err := writeSigstoreRegistriesConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	policyPath, err := s.writeImagePolicy(dir)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"--registries.d", registriesDir, "--policy", policyPath}, nil
+}
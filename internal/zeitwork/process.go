@@ -0,0 +1,46 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+)
+
+// webProcess is the process type that serves HTTP. Its replicas are routed by the edge proxy
+// and health checked, other process types (e.g. queue workers) only have to stay alive.
+const webProcess = "web"
+
+// deploymentProcess is a process type with the number of replicas a deployment should run of it.
+type deploymentProcess struct {
+	Name     string
+	Command  string // empty = image command
+	Replicas int
+}
+
+// deploymentProcesses returns the process types of a deployment, web first. The web process
+// always runs and is scaled per environment, other process types with their own replica count.
+func (s *Service) deploymentProcesses(ctx context.Context, deployment queries.Deployment, environment queries.Environment) ([]deploymentProcess, error) {
+	processTypes, err := s.db.ProcessTypeFindByProjectID(ctx, deployment.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find process types: %w", err)
+	}
+
+	processes := []deploymentProcess{{
+		Name:     webProcess,
+		Replicas: max(int(environment.Replicas), 1),
+	}}
+	for _, processType := range processTypes {
+		if processType.Name == webProcess {
+			processes[0].Command = processType.Command
+			continue
+		}
+		processes = append(processes, deploymentProcess{
+			Name:     processType.Name,
+			Command:  processType.Command,
+			Replicas: max(int(processType.Replicas), 0),
+		})
+	}
+
+	return processes, nil
+}
@@ -0,0 +1,113 @@
+package zeitwork
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/registry"
+	"github.com/zeitwork/zeitwork/internal/shared/crypto"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// clusterRegistryHost is the host of the registry built images are pushed to.
+func (s *Service) clusterRegistryHost() string {
+	return registry.URLHost(s.cfg.DockerRegistryURL)
+}
+
+// projectRepository is the repository of a project's images and build caches in the cluster's
+// registry, e.g. zeitwork/0a1b.
+func (s *Service) projectRepository(project queries.Project) string {
+	return s.cfg.DockerRegistryUsername + "/" + hex.EncodeToString(project.ID.Bytes[:])
+}
+
+// buildRegistryAuth returns the registry credentials of a project's builds: push access to the
+// project's repository of the cluster's registry, and the organisation's own credentials, e.g.
+// for private base images.
+func (s *Service) buildRegistryAuth(ctx context.Context, project queries.Project) (registry.Auth, error) {
+	own, err := s.organisationRegistryAuth(ctx, project.OrganisationID)
+	if err != nil {
+		return nil, err
+	}
+	// the cluster's registry credentials can't be replaced, images are pushed with them
+	delete(own, s.clusterRegistryHost())
+	return own.With(s.repositoryAuth(s.projectRepository(project), true)), nil
+}
+
+// repositoryAuth returns credentials of the cluster's registry for one of its repositories, with
+// push access or pull only. Only the embedded registry has such credentials, other registries
+// get the cluster's.
+func (s *Service) repositoryAuth(repository string, push bool) registry.Auth {
+	host := s.clusterRegistryHost()
+	cluster, _ := s.clusterRegistryAuth.Lookup(host)
+	if s.cfg.DockerRegistryEmbedded {
+		scoped := registry.RepositoryCredentials(s.cfg.DockerRegistryPAT, repository, push)
+		scoped.Insecure = cluster.Insecure
+		cluster = scoped
+	}
+	auth := registry.Auth{}
+	auth.Set(host, cluster)
+	return auth
+}
+
+// organisationRegistryAuth returns the registry credentials an organisation added itself.
+func (s *Service) organisationRegistryAuth(ctx context.Context, organisationID uuid.UUID) (registry.Auth, error) {
+	rows, err := s.db.RegistryCredentialFindByOrganisationID(ctx, organisationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registry credentials: %w", err)
+	}
+
+	own := registry.Auth{}
+	for _, row := range rows {
+		password, err := crypto.Decrypt(row.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt registry credentials of %s: %w", row.Registry, err)
+		}
+		own.Set(row.Registry, registry.Credentials{Username: row.Username, Password: password})
+	}
+	return own, nil
+}
+
+// imagePullAuth returns the registry credentials a VM's image is pulled with. VMs of an
+// organisation get its own credentials, and the cluster's for the repository of an image the
+// cluster built for it only, so they can't pull other images with them. Built images are pulled
+// from the registry host they were pushed to, which is the cluster's registry even if it was
+// since reached by another address. Cluster VMs, e.g. build VMs, get the cluster's credentials.
+func (s *Service) imagePullAuth(ctx context.Context, vm queries.Vm, image queries.Image) (registry.Auth, error) {
+	if vm.OrganisationID.IsNil() {
+		return s.clusterRegistryAuth, nil
+	}
+
+	auth, err := s.organisationRegistryAuth(ctx, vm.OrganisationID)
+	if err != nil {
+		return nil, err
+	}
+
+	built, err := s.db.BuildExistsByImageIDAndOrganisationID(ctx, queries.BuildExistsByImageIDAndOrganisationIDParams{
+		ImageID:        image.ID,
+		OrganisationID: vm.OrganisationID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find builds of image: %w", err)
+	}
+	if cluster, ok := s.clusterRegistryAuth.Lookup(s.clusterRegistryHost()); ok && built {
+		auth.SetRepository(image.Registry+"/"+image.Repository, cluster)
+	}
+	return auth, nil
+}
+
+// skopeoRegistryFlags returns the skopeo flags to access the registry of an image reference:
+// its credentials, and plain HTTP for insecure registries. prefix selects the flags of one side
+// of skopeo copy, "src-" or "dest-".
+func (s *Service) skopeoRegistryFlags(auth registry.Auth, prefix string, imageRef string) []string {
+	c, ok := auth.LookupImage(imageRef)
+	if !ok {
+		return nil
+	}
+	flags := []string{"--" + prefix + "creds", c.String()}
+	if c.Insecure {
+		flags = append(flags, "--"+prefix+"tls-verify=false")
+	}
+	return flags
+}
@@ -0,0 +1,204 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const (
+	// releaseTimeout bounds how long a release command may run
+	releaseTimeout = 15 * time.Minute
+	// releaseBootTimeout is how long a release VM may take to accept exec sessions
+	releaseBootTimeout = 2 * time.Minute
+)
+
+// reconcileDeploymentRelease runs the project's release command (e.g. database migrations) in an
+// ephemeral VM from the deployment's image before any replica is started. The VM is created on this
+// server, since exec sessions are dialed through the local VSOCK socket.
+// Returns true once the deployment is released. A failing command fails the deployment, which
+// leaves the previous deployment serving.
+func (s *Service) reconcileDeploymentRelease(ctx context.Context, deployment *queries.Deployment, environment queries.Environment) (bool, error) {
+	if deployment.ReleasedAt.Valid {
+		return true, nil
+	}
+
+	project, err := s.db.ProjectFirstByID(ctx, deployment.ProjectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to find project: %w", err)
+	}
+	if project.ReleaseCommand == "" {
+		return true, nil
+	}
+
+	logger := slog.With("deployment_id", deployment.ID)
+
+	if !deployment.ReleaseVmID.Valid {
+		encryptedEnvVars, err := s.prepareEnvVariablesForVM(ctx, deployment.EnvironmentID)
+		if err != nil {
+			return false, fmt.Errorf("failed to prepare environment variables: %w", err)
+		}
+
+		vm, err := s.VMCreate(ctx, VMCreateParams{
+			VCPUs:        environment.Vcpus,
+			Memory:       environment.Memory,
+			ImageID:      deployment.ImageID,
+			Port:         3000,
+			EnvVariables: encryptedEnvVars,
+			ServerID:     s.serverID,
+			Idle:         true,
+
+			OrganisationID: deployment.OrganisationID,
+		})
+		if err != nil {
+			return false, err
+		}
+		*deployment, err = s.db.DeploymentUpdateReleaseVM(ctx, queries.DeploymentUpdateReleaseVMParams{
+			ID:          deployment.ID,
+			ReleaseVmID: vm.ID,
+		})
+		if err != nil {
+			return false, err
+		}
+		logger.InfoContext(ctx, "created release VM", "vm_id", vm.ID)
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(5*time.Second))
+		return false, nil
+	}
+
+	vm, err := s.db.VMFirstByID(ctx, deployment.ReleaseVmID)
+	if err != nil {
+		return false, err
+	}
+
+	// Leadership moved while the command was running on the previous leader. It must not run twice,
+	// so wait for the previous leader to record its result, as long as the command may still run.
+	if vm.ServerID != s.serverID && deployment.ReleaseStartedAt.Valid {
+		if vm.DeletedAt.Valid || vm.Status == queries.VmStatusFailed ||
+			time.Since(deployment.ReleaseStartedAt.Time) > releaseTimeout+time.Minute {
+			return false, s.failDeployment(ctx, *deployment, "release command was interrupted")
+		}
+		logger.InfoContext(ctx, "waiting for release on previous leader", "vm_id", vm.ID, "server_id", vm.ServerID)
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(5*time.Second))
+		return false, nil
+	}
+
+	// Leadership moved since the release VM was created, start over on this server
+	if vm.ServerID != s.serverID {
+		if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+			return false, err
+		}
+		_, err = s.db.DeploymentUpdateReleaseVM(ctx, queries.DeploymentUpdateReleaseVMParams{
+			ID:          deployment.ID,
+			ReleaseVmID: uuid.UUID{},
+		})
+		return false, err
+	}
+
+	if vm.Status == queries.VmStatusFailed {
+		return false, s.failDeployment(ctx, *deployment, "release VM failed to start")
+	}
+
+	if vm.Status != queries.VmStatusRunning {
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(5*time.Second))
+		return false, nil
+	}
+
+	// The command runs on the release scheduler, which schedules the deployment once it's done,
+	// so long releases don't hold up the deployment scheduler's workers
+	s.releaseScheduler.Schedule(deployment.ID, time.Now())
+	return false, nil
+}
+
+// reconcileRelease runs the release command of a deployment in its release VM, once the
+// deployment reconciler has the VM running on this server.
+func (s *Service) reconcileRelease(ctx context.Context, objectID uuid.UUID) error {
+	if !s.isControlPlaneLeader() {
+		return nil
+	}
+
+	deployment, err := s.db.DeploymentFirstByID(ctx, objectID)
+	if err != nil {
+		return err
+	}
+	if !deployment.ReleaseVmID.Valid || deployment.DeletedAt.Valid || deployment.FailedAt.Valid ||
+		deployment.StoppingAt.Valid || deployment.StoppedAt.Valid {
+		return nil
+	}
+	// Released - make sure the VM is gone, the command must not run twice
+	if deployment.ReleasedAt.Valid {
+		return s.db.VMSoftDelete(ctx, deployment.ReleaseVmID)
+	}
+
+	logger := slog.With("deployment_id", deployment.ID)
+
+	// The command was started by a process that went away before it finished, it may have partially run
+	if deployment.ReleaseStartedAt.Valid {
+		return s.failDeployment(ctx, deployment, "release command was interrupted")
+	}
+
+	project, err := s.db.ProjectFirstByID(ctx, deployment.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to find project: %w", err)
+	}
+	vm, err := s.db.VMFirstByID(ctx, deployment.ReleaseVmID)
+	if err != nil {
+		return err
+	}
+	if vm.ServerID != s.serverID || vm.Status != queries.VmStatusRunning {
+		// Not ours to run (anymore), the deployment reconciler sorts it out
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now())
+		return nil
+	}
+
+	conn, err := DialExec(ctx, vm.ID)
+	if err != nil {
+		if vm.RunningAt.Valid && time.Since(vm.RunningAt.Time) > releaseBootTimeout {
+			return s.failDeployment(ctx, deployment, "release VM did not become reachable")
+		}
+		// The guest is still booting
+		logger.DebugContext(ctx, "release VM not reachable yet", "vm_id", vm.ID, "error", err)
+		s.releaseScheduler.Schedule(deployment.ID, time.Now().Add(5*time.Second))
+		return nil
+	}
+
+	deployment, err = s.db.DeploymentMarkReleaseStarted(ctx, deployment.ID)
+	if err != nil {
+		conn.CloseNow()
+		return fmt.Errorf("failed to mark release as started: %w", err)
+	}
+	s.deploymentLog(ctx, deployment, "info", fmt.Sprintf("Running release command: %s", project.ReleaseCommand))
+
+	runCtx, cancel := context.WithTimeout(ctx, releaseTimeout)
+	defer cancel()
+
+	output := &lineWriter{write: func(line string) {
+		s.deploymentLog(ctx, deployment, "info", line)
+	}}
+	exitCode, err := RunExec(runCtx, conn, []string{"/bin/sh", "-c", project.ReleaseCommand}, output)
+	output.Flush()
+	if err != nil {
+		return s.failDeployment(ctx, deployment, fmt.Sprintf("release command failed: %s", err))
+	}
+	if exitCode != 0 {
+		return s.failDeployment(ctx, deployment, fmt.Sprintf("release command exited with code %d", exitCode))
+	}
+
+	deployment, err = s.db.DeploymentMarkReleased(ctx, deployment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark deployment as released: %w", err)
+	}
+	if err := s.db.VMSoftDelete(ctx, vm.ID); err != nil {
+		logger.ErrorContext(ctx, "failed to delete release VM", "vm_id", vm.ID, "error", err)
+		s.releaseScheduler.Schedule(deployment.ID, time.Now().Add(5*time.Second))
+	}
+	s.deploymentLog(ctx, deployment, "info", "Release command succeeded")
+	logger.InfoContext(ctx, "released deployment")
+
+	// Carry on with starting the replicas
+	s.deploymentScheduler.Schedule(deployment.ID, time.Now())
+	return nil
+}
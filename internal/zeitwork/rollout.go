@@ -0,0 +1,173 @@
+package zeitwork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+const (
+	// rolloutStepDuration is how long each rollout step is observed before traffic is shifted further
+	rolloutStepDuration = 2 * time.Minute
+	// rolloutCheckInterval is how often an in-progress rollout is re-evaluated
+	rolloutCheckInterval = 15 * time.Second
+	// rolloutMinRequests is the number of canary requests needed before the error rate is trusted
+	rolloutMinRequests = 20
+	// rolloutMaxErrorRate is the share of failed canary requests that triggers a rollback
+	rolloutMaxErrorRate = 0.05
+)
+
+// promoteDeployment shifts the environment's custom domains to a deployment that just became healthy.
+// Without rollout steps configured on the project, traffic is moved at once and older deployments
+// are stopped. Otherwise a rollout is started and the previous deployment keeps serving until it completes.
+func (s *Service) promoteDeployment(ctx context.Context, deployment queries.Deployment) error {
+	project, err := s.db.ProjectFirstByID(ctx, deployment.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to find project: %w", err)
+	}
+
+	// A redeployment reuses an older build, and is superseded by a deployment of a newer build that
+	// became healthy first
+	superseded, err := s.db.DeploymentExistsRunningAndNewer(ctx, queries.DeploymentExistsRunningAndNewerParams{
+		EnvironmentID: deployment.EnvironmentID,
+		ID:            deployment.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find newer deployments: %w", err)
+	}
+	if superseded {
+		slog.Info("deployment superseded by a newer running deployment", "deployment_id", deployment.ID)
+		return s.db.DeploymentMarkStopping(ctx, deployment.ID)
+	}
+
+	// A newer deployment supersedes rollouts that are still in progress in its environment
+	rollouts, err := s.db.RolloutFindInProgressByEnvironmentID(ctx, deployment.EnvironmentID)
+	if err != nil {
+		return fmt.Errorf("failed to find in-progress rollouts: %w", err)
+	}
+	for _, rollout := range rollouts {
+		if rollout.ToDeploymentID == deployment.ID {
+			// Already rolling out this deployment
+			return nil
+		}
+		if err := s.db.RolloutMarkRolledBack(ctx, rollout.ID); err != nil {
+			return fmt.Errorf("failed to roll back superseded rollout: %w", err)
+		}
+		if err := s.db.DeploymentMarkStopping(ctx, rollout.ToDeploymentID); err != nil {
+			return fmt.Errorf("failed to stop superseded deployment: %w", err)
+		}
+		slog.Info("superseded in-progress rollout", "rollout_id", rollout.ID, "deployment_id", rollout.ToDeploymentID)
+	}
+
+	// The deployment currently serving the environment is the newest running one older than this deployment
+	previous, err := s.db.DeploymentFindRunningAndOlder(ctx, queries.DeploymentFindRunningAndOlderParams{
+		EnvironmentID: deployment.EnvironmentID,
+		ID:            deployment.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find old deployments: %w", err)
+	}
+
+	if len(project.RolloutSteps) == 0 || len(previous) == 0 {
+		// Point custom domains to this new deployment
+		err = s.pointCustomDomainsToDeployment(ctx, deployment)
+		if err != nil {
+			return fmt.Errorf("failed to point custom domains to deployment: %w", err)
+		}
+
+		// Stop older deployments for this project now that the new one is healthy
+		err = s.stopOldDeployments(ctx, deployment)
+		if err != nil {
+			return fmt.Errorf("failed to stop old deployments: %w", err)
+		}
+		return nil
+	}
+
+	rollout, err := s.db.RolloutCreate(ctx, queries.RolloutCreateParams{
+		ID:               uuid.New(),
+		ProjectID:        deployment.ProjectID,
+		FromDeploymentID: previous[0].ID,
+		ToDeploymentID:   deployment.ID,
+		Weight:           project.RolloutSteps[0],
+		OrganisationID:   deployment.OrganisationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create rollout: %w", err)
+	}
+	slog.Info("started rollout", "rollout_id", rollout.ID, "from_deployment_id", previous[0].ID, "to_deployment_id", deployment.ID, "weight", rollout.Weight)
+
+	s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(rolloutCheckInterval))
+	return nil
+}
+
+// reconcileRollout drives an in-progress rollout towards a running deployment.
+// Each step is observed for rolloutStepDuration; if the canary's error rate reported by the
+// edge proxies exceeds rolloutMaxErrorRate the rollout is rolled back, otherwise traffic moves
+// to the next step. Steps without enough traffic to judge are promoted once their time is up.
+func (s *Service) reconcileRollout(ctx context.Context, deployment queries.Deployment) error {
+	rollout, err := s.db.RolloutFirstInProgressByToDeploymentID(ctx, deployment.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger := slog.With("deployment_id", deployment.ID, "rollout_id", rollout.ID)
+
+	if rollout.Requests >= rolloutMinRequests && float64(rollout.Errors)/float64(rollout.Requests) > rolloutMaxErrorRate {
+		if err := s.db.RolloutMarkRolledBack(ctx, rollout.ID); err != nil {
+			return fmt.Errorf("failed to roll back rollout: %w", err)
+		}
+		logger.WarnContext(ctx, "rolled back deployment", "requests", rollout.Requests, "errors", rollout.Errors, "weight", rollout.Weight)
+		return s.failDeployment(ctx, deployment, fmt.Sprintf("rolled back after %d of %d requests failed at %d%% traffic", rollout.Errors, rollout.Requests, rollout.Weight))
+	}
+
+	if time.Since(rollout.StepStartedAt.Time) < rolloutStepDuration {
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(rolloutCheckInterval))
+		return nil
+	}
+
+	project, err := s.db.ProjectFirstByID(ctx, deployment.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to find project: %w", err)
+	}
+
+	next := int(rollout.Step) + 1
+	if next < len(project.RolloutSteps) {
+		weight := project.RolloutSteps[next]
+		err = s.db.RolloutAdvanceStep(ctx, queries.RolloutAdvanceStepParams{
+			ID:     rollout.ID,
+			Step:   int32(next),
+			Weight: weight,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to advance rollout: %w", err)
+		}
+		logger.InfoContext(ctx, "advanced rollout", "step", next, "weight", weight, "requests", rollout.Requests, "errors", rollout.Errors)
+		s.deploymentScheduler.Schedule(deployment.ID, time.Now().Add(rolloutCheckInterval))
+		return nil
+	}
+
+	// All steps passed. Point the domains first so routes never fall back to the old deployment.
+	err = s.pointCustomDomainsToDeployment(ctx, deployment)
+	if err != nil {
+		return fmt.Errorf("failed to point custom domains to deployment: %w", err)
+	}
+	if err := s.db.RolloutMarkCompleted(ctx, rollout.ID); err != nil {
+		return fmt.Errorf("failed to complete rollout: %w", err)
+	}
+	logger.InfoContext(ctx, "completed rollout")
+
+	err = s.stopOldDeployments(ctx, deployment)
+	if err != nil {
+		return fmt.Errorf("failed to stop old deployments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package zeitwork
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/database"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// RunVMLease is how long a one-off VM outlives its session. The session extends the lease with
+// RunVMExtend while it is open, the cluster leader deletes VMs whose lease ran out.
+const RunVMLease = 2 * time.Minute
+
+// RunVMCreate creates an idle VM on a server from the image of a deployment, with the current
+// environment variables of its environment, to run a one-off command in (zeitworkctl run).
+// The VM is not a replica of the deployment, so it receives no traffic and the caller deletes it.
+// It expires after RunVMLease unless extended, so VMs of sessions that went away are deleted too.
+func RunVMCreate(ctx context.Context, db *database.DB, serverID uuid.UUID, deployment queries.Deployment) (*queries.Vm, error) {
+	environment, err := db.EnvironmentFirstByID(ctx, deployment.EnvironmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find environment: %w", err)
+	}
+	encryptedEnvVars, err := prepareEnvVariables(ctx, db, environment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare environment variables: %w", err)
+	}
+
+	return createVM(ctx, db, VMCreateParams{
+		VCPUs:        environment.Vcpus,
+		Memory:       environment.Memory,
+		ImageID:      deployment.ImageID,
+		Port:         3000,
+		EnvVariables: encryptedEnvVars,
+		ServerID:     serverID,
+		Idle:         true,
+		ExpiresAt:    time.Now().Add(RunVMLease),
+
+		OrganisationID: deployment.OrganisationID,
+	})
+}
+
+// RunVMExtend renews the lease of a one-off VM, see RunVMLease.
+func RunVMExtend(ctx context.Context, db *database.DB, vmID uuid.UUID) error {
+	return db.VMExtendExpiry(ctx, queries.VMExtendExpiryParams{
+		ID:        vmID,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(RunVMLease), Valid: true},
+	})
+}
@@ -0,0 +1,168 @@
+package zeitwork
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/registry"
+)
+
+const (
+	// scannerImage generates the SBOMs of built images and scans them for vulnerabilities,
+	// in the build VM.
+	scannerImage = "aquasec/trivy:0.58.1"
+
+	// sbomFormat is the format of the SBOMs of built images.
+	sbomFormat = "spdx-json"
+)
+
+// generateSBOM generates the SBOM of a pushed image. The image is read from the build VM's
+// docker daemon, or from the registry if it was built before.
+func (s *Service) generateSBOM(ctx context.Context, dockerClient *client.Client, build queries.Build, imageTag string) ([]byte, error) {
+	var sbom bytes.Buffer
+	stderrWriter := &logWriter{ctx: ctx, s: s, build: build, level: "info"}
+	defer stderrWriter.Flush()
+
+	slog.Info("generating SBOM", "build_id", build.ID, "tag", imageTag)
+	cmd := []string{"image", "--quiet", "--format", sbomFormat, "--image-src", "docker,remote"}
+	if s.cfg.DockerRegistryInsecure {
+		cmd = append(cmd, "--insecure")
+	}
+	err := s.runBuilderContainer(ctx, dockerClient, build, builderContainer{
+		image: scannerImage,
+		cmd:   append(cmd, imageTag),
+		env:   s.scannerCredentialEnv(imageTag),
+	}, nil, &sbom, stderrWriter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SBOM: %w", err)
+	}
+	if !json.Valid(sbom.Bytes()) {
+		return nil, fmt.Errorf("scanner returned an invalid SBOM")
+	}
+	return sbom.Bytes(), nil
+}
+
+// scanSBOM scans an SBOM for known vulnerabilities. The vulnerability database is downloaded
+// from VulnerabilityDBRepository if configured, e.g. a mirror in the cluster's registry, so
+// scans don't depend on the scanner's public database.
+func (s *Service) scanSBOM(ctx context.Context, dockerClient *client.Client, build queries.Build, sbom []byte) (vulnerabilitySummary, error) {
+	var sbomTar bytes.Buffer
+	tw := tar.NewWriter(&sbomTar)
+	tw.WriteHeader(&tar.Header{
+		Name: "sbom.json",
+		Mode: 0644,
+		Size: int64(len(sbom)),
+	})
+	tw.Write(sbom)
+	tw.Close()
+
+	cmd := []string{"sbom", "--quiet", "--format", "json", "--scanners", "vuln"}
+	var env []string
+	if s.cfg.VulnerabilityDBRepository != "" {
+		env = s.scannerCredentialEnv(s.cfg.VulnerabilityDBRepository)
+		cmd = append(cmd, "--db-repository", s.cfg.VulnerabilityDBRepository)
+		if s.cfg.DockerRegistryInsecure && registry.Host(s.cfg.VulnerabilityDBRepository) == s.clusterRegistryHost() {
+			cmd = append(cmd, "--insecure")
+		}
+	}
+	cmd = append(cmd, "/build/sbom.json")
+
+	var report bytes.Buffer
+	stderrWriter := &logWriter{ctx: ctx, s: s, build: build, level: "info"}
+	defer stderrWriter.Flush()
+
+	slog.Info("scanning SBOM for vulnerabilities", "build_id", build.ID)
+	err := s.runBuilderContainer(ctx, dockerClient, build, builderContainer{
+		image: scannerImage,
+		cmd:   cmd,
+		env:   env,
+	}, &sbomTar, &report, stderrWriter)
+	if err != nil {
+		return vulnerabilitySummary{}, fmt.Errorf("failed to scan for vulnerabilities: %w", err)
+	}
+
+	return parseVulnerabilityReport(report.Bytes())
+}
+
+// scannerCredentialEnv returns the scanner's environment to read a repository of the cluster's
+// registry, with credentials that only pull that repository where the registry has them, see
+// repositoryAuth. Other registries are read anonymously.
+func (s *Service) scannerCredentialEnv(ref string) []string {
+	if registry.Host(ref) != s.clusterRegistryHost() {
+		return nil
+	}
+	c, ok := s.repositoryAuth(registry.Repository(ref), false).Lookup(s.clusterRegistryHost())
+	if !ok {
+		return nil
+	}
+	return []string{"TRIVY_USERNAME=" + c.Username, "TRIVY_PASSWORD=" + c.Password}
+}
+
+// vulnerabilitySummary counts the vulnerabilities of an image by severity.
+type vulnerabilitySummary struct {
+	critical int
+	high     int
+	medium   int
+	low      int
+	unknown  int
+}
+
+// parseVulnerabilityReport summarizes the scanner's JSON report.
+func parseVulnerabilityReport(report []byte) (vulnerabilitySummary, error) {
+	var parsed struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(report, &parsed); err != nil {
+		return vulnerabilitySummary{}, fmt.Errorf("failed to parse vulnerability report: %w", err)
+	}
+
+	var summary vulnerabilitySummary
+	for _, result := range parsed.Results {
+		for _, v := range result.Vulnerabilities {
+			switch strings.ToUpper(v.Severity) {
+			case "CRITICAL":
+				summary.critical++
+			case "HIGH":
+				summary.high++
+			case "MEDIUM":
+				summary.medium++
+			case "LOW":
+				summary.low++
+			default:
+				summary.unknown++
+			}
+		}
+	}
+	return summary, nil
+}
+
+// String describes the summary for the build logs.
+func (v vulnerabilitySummary) String() string {
+	return fmt.Sprintf("Vulnerabilities: %d critical, %d high, %d medium, %d low, %d unknown",
+		v.critical, v.high, v.medium, v.low, v.unknown)
+}
+
+// atOrAbove counts the vulnerabilities of the given severity or worse.
+func (v vulnerabilitySummary) atOrAbove(severity queries.VulnerabilitySeverity) int {
+	switch severity {
+	case queries.VulnerabilitySeverityCritical:
+		return v.critical
+	case queries.VulnerabilitySeverityHigh:
+		return v.critical + v.high
+	case queries.VulnerabilitySeverityMedium:
+		return v.critical + v.high + v.medium
+	default:
+		return v.critical + v.high + v.medium + v.low
+	}
+}
@@ -0,0 +1,41 @@
+package zeitwork
+
+import (
+	"testing"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+)
+
+func TestParseVulnerabilityReport(t *testing.T) {
+	report := []byte(`{
+		"Results": [
+			{"Vulnerabilities": [{"Severity": "CRITICAL"}, {"Severity": "HIGH"}, {"Severity": "LOW"}]},
+			{"Vulnerabilities": [{"Severity": "MEDIUM"}, {"Severity": "HIGH"}, {"Severity": "UNKNOWN"}]},
+			{}
+		]
+	}`)
+
+	summary, err := parseVulnerabilityReport(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vulnerabilitySummary{critical: 1, high: 2, medium: 1, low: 1, unknown: 1}
+	if summary != want {
+		t.Fatalf("expected %+v, got %+v", want, summary)
+	}
+
+	tests := []struct {
+		severity queries.VulnerabilitySeverity
+		want     int
+	}{
+		{queries.VulnerabilitySeverityCritical, 1},
+		{queries.VulnerabilitySeverityHigh, 3},
+		{queries.VulnerabilitySeverityMedium, 4},
+		{queries.VulnerabilitySeverityLow, 5},
+	}
+	for _, tt := range tests {
+		if got := summary.atOrAbove(tt.severity); got != tt.want {
+			t.Errorf("atOrAbove(%s): expected %d, got %d", tt.severity, tt.want, got)
+		}
+	}
+}
@@ -49,6 +49,20 @@ func LoadOrCreateServerID() (uuid.UUID, error) {
 	return id, nil
 }
 
+// LoadServerID reads the server ID of this node from disk, without generating one.
+// Used by zeitworkctl to place VMs on the server it runs on.
+func LoadServerID() (uuid.UUID, error) {
+	data, err := os.ReadFile(serverIDPath)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("failed to read server-id: %w", err)
+	}
+	id, err := uuid.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("corrupt server-id file at %s: %w", serverIDPath, err)
+	}
+	return id, nil
+}
+
 // registerServer upserts this server into the servers table and allocates an IP range
 // if this is a first-time registration.
 func (s *Service) registerServer(ctx context.Context) (queries.Server, error) {
@@ -189,10 +203,29 @@ func (s *Service) tryBecomeClusterLeader(ctx context.Context) {
 			if err := s.detectAndFailoverDeadServers(ctx); err != nil {
 				slog.Error("dead server detection failed", "err", err)
 			}
+			if err := s.deleteExpiredVMs(ctx); err != nil {
+				slog.Error("expired VM cleanup failed", "err", err)
+			}
+			if err := s.purgeSourceUploads(ctx); err != nil {
+				slog.Error("source upload cleanup failed", "err", err)
+			}
 		}
 	}
 }
 
+// deleteExpiredVMs deletes VMs past their expiry, e.g. zeitworkctl run VMs whose session
+// ended without deleting them. Only called by the cluster leader.
+func (s *Service) deleteExpiredVMs(ctx context.Context) error {
+	ids, err := s.db.VMSoftDeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		slog.Info("deleted expired VM", "vm_id", id)
+	}
+	return nil
+}
+
 // detectAndFailoverDeadServers finds dead servers and replaces their VMs.
 // Only called by the cluster leader. Everything runs in a single transaction:
 // if any step fails, the whole operation rolls back and will be retried on
@@ -263,7 +296,7 @@ func (s *Service) replaceDeadServerVMs(ctx context.Context, q *queries.Queries,
 }
 
 // replaceVM soft-deletes an old VM, creates a replacement on the least loaded
-// server, and updates the deployment pointer.
+// server, and updates the deployment pointer if the old VM was the primary replica.
 func (s *Service) replaceVM(ctx context.Context, q *queries.Queries, oldVM queries.Vm, deadServerID uuid.UUID) error {
 	err := q.AdvisoryLock(ctx, "VMNextIPAddress")
 	if err != nil {
@@ -292,23 +325,30 @@ func (s *Service) replaceVM(ctx context.Context, q *queries.Queries, oldVM queri
 
 	// Create replacement VM
 	newVM, err := q.VMCreate(ctx, queries.VMCreateParams{
-		ID:           uuid.New(),
-		Vcpus:        oldVM.Vcpus,
-		Memory:       oldVM.Memory,
-		Status:       queries.VmStatusPending,
-		ImageID:      oldVM.ImageID,
-		ServerID:     target.ID,
-		Port:         oldVM.Port,
-		IpAddress:    ipAddress,
-		EnvVariables: oldVM.EnvVariables,
-		Metadata:     nil,
+		ID:             uuid.New(),
+		Vcpus:          oldVM.Vcpus,
+		Memory:         oldVM.Memory,
+		Status:         queries.VmStatusPending,
+		ImageID:        oldVM.ImageID,
+		ServerID:       target.ID,
+		Port:           oldVM.Port,
+		IpAddress:      ipAddress,
+		EnvVariables:   oldVM.EnvVariables,
+		Metadata:       nil,
+		DeploymentID:   oldVM.DeploymentID,
+		Idle:           oldVM.Idle,
+		Process:        oldVM.Process,
+		Command:        oldVM.Command,
+		Build:          oldVM.Build,
+		OrganisationID: oldVM.OrganisationID,
+		ExpiresAt:      oldVM.ExpiresAt,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create replacement VM: %w", err)
 	}
 
 	// Update deployment to point to the new VM (if one exists)
-	if dep, err := q.DeploymentFindByVMID(ctx, oldVM.ID); err == nil {
+	if dep, err := q.DeploymentFindByVMID(ctx, oldVM.ID); err == nil && dep.VmID == oldVM.ID {
 		_, err = q.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
 			ID:   dep.ID,
 			VmID: newVM.ID,
@@ -392,17 +432,33 @@ func (s *Service) drainServer(ctx context.Context) {
 	slog.InfoContext(ctx, "server drain complete", "server_id", s.serverID)
 }
 
-// drainDeployment creates a replacement VM on another server, waits for health, then swaps.
+// drainDeployment replaces every replica of the deployment that runs on this server.
 func (s *Service) drainDeployment(ctx context.Context, dep queries.Deployment) error {
-	if !dep.VmID.Valid || !dep.ImageID.Valid {
+	if !dep.ImageID.Valid {
 		return nil
 	}
 
-	oldVM, err := s.db.VMFirstByID(ctx, dep.VmID)
+	vms, err := s.db.VMFindByDeploymentID(ctx, dep.ID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch old VM: %w", err)
+		return fmt.Errorf("failed to fetch deployment VMs: %w", err)
+	}
+
+	for _, vm := range vms {
+		if vm.ServerID != s.serverID || vm.DrainingAt.Valid {
+			continue
+		}
+		if err := s.drainDeploymentVM(ctx, dep, vm); err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// drainDeploymentVM creates a replacement VM on another server, waits for health, then swaps.
+// The replacement only joins the deployment once healthy, so it never receives traffic before.
+// The old VM is deleted once it has finished its in-flight requests.
+func (s *Service) drainDeploymentVM(ctx context.Context, dep queries.Deployment, oldVM queries.Vm) error {
 	// Create a replacement VM on a healthy server
 	newVM, err := s.VMCreate(ctx, VMCreateParams{
 		VCPUs:        oldVM.Vcpus,
@@ -410,6 +466,10 @@ func (s *Service) drainDeployment(ctx context.Context, dep queries.Deployment) e
 		ImageID:      oldVM.ImageID,
 		Port:         oldVM.Port.Int32,
 		EnvVariables: oldVM.EnvVariables.String,
+		Process:      oldVM.Process,
+		Command:      oldVM.Command.String,
+
+		OrganisationID: oldVM.OrganisationID,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create replacement VM: %w", err)
@@ -421,25 +481,48 @@ func (s *Service) drainDeployment(ctx context.Context, dep queries.Deployment) e
 		"new_vm", newVM.ID,
 		"new_server", newVM.ServerID)
 
-	// Wait for the replacement VM to pass health checks
-	if err := s.waitForVMHealth(ctx, newVM, drainHealthCheckTimeout); err != nil {
+	// Wait for the replacement VM to pass health checks, or just to run for non-web processes
+	waitForVM := s.waitForVMHealth
+	if newVM.Process != webProcess {
+		waitForVM = s.waitForVMRunning
+	}
+	if err := waitForVM(ctx, newVM, drainHealthCheckTimeout); err != nil {
 		// Cleanup the failed replacement
 		_ = s.db.VMSoftDelete(ctx, newVM.ID)
 		return fmt.Errorf("replacement VM failed health check: %w", err)
 	}
 
-	// Atomic swap: point the deployment to the new VM
-	_, err = s.db.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
-		ID:   dep.ID,
-		VmID: newVM.ID,
+	// Atomic swap: add the new VM to the deployment and take the old one out of edge
+	// routing, so the replica count never changes.
+	err = s.db.WithTx(ctx, func(q *queries.Queries) error {
+		if err := q.VMUpdateDeployment(ctx, queries.VMUpdateDeploymentParams{
+			ID:           newVM.ID,
+			DeploymentID: dep.ID,
+		}); err != nil {
+			return err
+		}
+		if err := q.VMMarkDraining(ctx, oldVM.ID); err != nil {
+			return err
+		}
+		if dep.VmID != oldVM.ID {
+			return nil
+		}
+		_, err := q.DeploymentUpdateVM(ctx, queries.DeploymentUpdateVMParams{
+			ID:   dep.ID,
+			VmID: newVM.ID,
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to swap deployment VM: %w", err)
 	}
 
-	// Soft-delete the old VM (triggers cleanup via reconciler)
-	if err := s.db.VMSoftDelete(ctx, oldVM.ID); err != nil {
-		slog.Error("failed to soft-delete old VM after drain swap", "vm_id", oldVM.ID, "err", err)
+	// Notify route change so edge proxy picks up the new VM
+	s.notifyRouteChange()
+
+	// Wait for the old VM so the server is only marked drained once nothing is served from it
+	if err := s.waitForVMDrain(ctx, oldVM.ID); err != nil {
+		return fmt.Errorf("failed to drain old VM: %w", err)
 	}
 
 	slog.InfoContext(ctx, "drained deployment",
@@ -447,9 +530,6 @@ func (s *Service) drainDeployment(ctx context.Context, dep queries.Deployment) e
 		"old_vm", oldVM.ID,
 		"new_vm", newVM.ID)
 
-	// Notify route change so edge proxy picks up the new VM
-	s.notifyRouteChange()
-
 	return nil
 }
 
@@ -473,6 +553,30 @@ func (s *Service) waitForVMHealth(ctx context.Context, vm *queries.Vm, timeout t
 	}
 }
 
+// waitForVMRunning polls the VM's status until it is running or times out.
+func (s *Service) waitForVMRunning(ctx context.Context, vm *queries.Vm, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("VM did not start within %s", timeout)
+		case <-ticker.C:
+			current, err := s.db.VMFirstByID(ctx, vm.ID)
+			if err != nil {
+				return err
+			}
+			if current.Status == queries.VmStatusRunning {
+				return nil
+			}
+		}
+	}
+}
+
 // notifyRouteChange sends a non-blocking signal on the route change channel.
 func (s *Service) notifyRouteChange() {
 	if s.routeChangeNotify != nil {
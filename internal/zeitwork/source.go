@@ -0,0 +1,413 @@
+package zeitwork
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/crypto"
+)
+
+// SourceProvider downloads the source of a project's commit as a gzip tarball with a single
+// top-level directory, the layout prepareBuildContext consumes.
+type SourceProvider interface {
+	DownloadTarball(ctx context.Context, commit string) (io.ReadCloser, error)
+}
+
+// scpHostPattern matches the [user@]host part of scp-like git URLs.
+var scpHostPattern = regexp.MustCompile(`^([A-Za-z0-9._-]+@)?[A-Za-z0-9.-]+$`)
+
+// commitPattern matches full SHA-1 and SHA-256 commit hashes.
+var commitPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// sharedAddressSpace is the carrier-grade NAT range, private like the RFC 1918 ranges.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// sourceHTTPClient downloads source tarballs. It only connects to public addresses, so repository
+// URLs can't reach the cluster's internal services, whatever their host resolves to.
+var sourceHTTPClient = func() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("connecting to non-public address %s is not allowed", addrPort.Addr())
+			}
+			return nil
+		},
+	}).DialContext
+	return &http.Client{
+		Transport: transport,
+		// tokens must not be sent in cleartext
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s URL refused", req.URL.Scheme)
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}()
+
+// isPublicAddr reports whether an address is reachable on the internet, as opposed to loopback,
+// private, link-local (e.g. cloud metadata services) and other special addresses.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// resolvePublicHost resolves a host, and refuses hosts that are, or resolve to, non-public
+// addresses. Connections must go to the returned address, resolving the host again could
+// return another one.
+func resolvePublicHost(ctx context.Context, host string) (netip.Addr, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return netip.Addr{}, fmt.Errorf("%s resolves to non-public address %s", host, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+	return addrs[0].Unmap(), nil
+}
+
+// gitPinnedAddress returns the git config and ssh options that make git connect to addr, the
+// resolved address of the URL's host, instead of resolving the host itself.
+func gitPinnedAddress(rawURL, host string, addr netip.Addr) (config []string, sshOptions string) {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == "https" {
+		ip := addr.String()
+		if addr.Is6() {
+			ip = "[" + ip + "]"
+		}
+		return []string{"-c", fmt.Sprintf("http.curloptResolve=%s:%s:%s", host, cmp.Or(u.Port(), "443"), ip)}, ""
+	}
+	// host keys stay stored under the host's name
+	return nil, fmt.Sprintf("-o HostName=%s -o HostKeyAlias=%s -o CheckHostIP=no", addr, host)
+}
+
+// isPrivateHostname reports whether a URL's hostname is an IP literal of a non-public address or
+// localhost, so such URLs are refused before anything is resolved.
+func isPrivateHostname(hostname string) bool {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hostname, "[]"))
+	return err == nil && !isPublicAddr(addr)
+}
+
+// sourceProvider returns the provider a project's source is downloaded from.
+func (s *Service) sourceProvider(ctx context.Context, project queries.Project) (SourceProvider, error) {
+	switch project.SourceProvider {
+	case queries.SourceProviderGithub:
+		if s.githubTokenService == nil {
+			return nil, fmt.Errorf("github token service not configured")
+		}
+		if project.GithubInstallationID.IsNil() {
+			return nil, fmt.Errorf("project has no github installation")
+		}
+		token, err := s.githubTokenService.GetInstallationToken(ctx, project.GithubInstallationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get github token: %w", err)
+		}
+		return githubSource{token: token, repository: project.GithubRepository}, nil
+
+	case queries.SourceProviderGitlab, queries.SourceProviderBitbucket:
+		base, path, err := parseRepositoryURL(project.SourceUrl)
+		if err != nil {
+			return nil, err
+		}
+		token, err := decryptOptional(project.SourceToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt source token: %w", err)
+		}
+		if project.SourceProvider == queries.SourceProviderGitlab {
+			return gitlabSource{baseURL: base, project: path, token: token}, nil
+		}
+		return bitbucketSource{baseURL: base, repository: path, token: token}, nil
+
+	case queries.SourceProviderGit:
+		if err := validateGitURL(project.SourceUrl); err != nil {
+			return nil, err
+		}
+		deployKey, err := decryptOptional(project.SourceDeployKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt deploy key: %w", err)
+		}
+		return gitSource{url: project.SourceUrl, deployKey: deployKey, knownHosts: s.cfg.GitKnownHosts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown source provider %q", project.SourceProvider)
+}
+
+// decryptOptional decrypts a credential column, which is empty for public repositories.
+func decryptOptional(ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	return crypto.Decrypt(ciphertext)
+}
+
+// parseRepositoryURL splits the web URL of a GitLab or Bitbucket repository, e.g.
+// https://gitlab.com/group/subgroup/app, into the server's base URL and the repository path.
+// Only https URLs of public hosts are accepted, tokens are sent to them.
+func parseRepositoryURL(rawURL string) (base string, path string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid repository URL %q: must be an https URL", rawURL)
+	}
+	if isPrivateHostname(u.Hostname()) {
+		return "", "", fmt.Errorf("invalid repository URL %q: host is not public", rawURL)
+	}
+	path = strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("invalid repository URL %q: missing repository path", rawURL)
+	}
+	return u.Scheme + "://" + u.Host, path, nil
+}
+
+// validateGitURL accepts ssh and https repository URLs of public hosts, including the scp-like
+// git@host:path form. Other transports, e.g. file://, would read from the server itself.
+func validateGitURL(rawURL string) error {
+	host, err := gitURLHost(rawURL)
+	if err != nil {
+		return err
+	}
+	if isPrivateHostname(host) {
+		return fmt.Errorf("invalid git URL %q: host is not public", rawURL)
+	}
+	return nil
+}
+
+// gitURLHost returns the hostname of an ssh, https or scp-like git URL.
+func gitURLHost(rawURL string) (string, error) {
+	if strings.HasPrefix(rawURL, "-") {
+		return "", fmt.Errorf("invalid git URL %q", rawURL)
+	}
+	if strings.HasPrefix(rawURL, "ssh://") || strings.HasPrefix(rawURL, "https://") {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			return "", fmt.Errorf("invalid git URL %q", rawURL)
+		}
+		return u.Hostname(), nil
+	}
+	// scp-like: [user@]host:path, without a scheme. transport::address would run a remote helper
+	host, path, ok := strings.Cut(rawURL, ":")
+	if ok && scpHostPattern.MatchString(host) && path != "" && !strings.HasPrefix(path, ":") && !strings.HasPrefix(path, "//") {
+		if _, hostname, found := strings.Cut(host, "@"); found {
+			return hostname, nil
+		}
+		return host, nil
+	}
+	return "", fmt.Errorf("invalid git URL %q: must be an ssh or https URL", rawURL)
+}
+
+// githubSource downloads tarballs from GitHub with a GitHub App installation token.
+type githubSource struct {
+	token      string
+	repository string // owner/repo
+}
+
+func (g githubSource) DownloadTarball(ctx context.Context, commit string) (io.ReadCloser, error) {
+	// GitHub tarball URL format: https://api.github.com/repos/{owner}/{repo}/tarball/{ref}
+	tarballURL := fmt.Sprintf("https://api.github.com/repos/%s/tarball/%s", g.repository, commit)
+	return downloadTarball(ctx, "github", tarballURL, map[string]string{
+		"Authorization": "Bearer " + g.token,
+		"Accept":        "application/vnd.github+json",
+	})
+}
+
+// gitlabSource downloads tarballs from gitlab.com or a self-managed GitLab with a project or
+// personal access token. Public projects need no token.
+type gitlabSource struct {
+	baseURL string
+	project string // group/subgroup/app
+	token   string
+}
+
+func (g gitlabSource) DownloadTarball(ctx context.Context, commit string) (io.ReadCloser, error) {
+	tarballURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/archive.tar.gz?sha=%s",
+		g.baseURL, url.PathEscape(g.project), url.QueryEscape(commit))
+	headers := map[string]string{}
+	if g.token != "" {
+		headers["PRIVATE-TOKEN"] = g.token
+	}
+	return downloadTarball(ctx, "gitlab", tarballURL, headers)
+}
+
+// bitbucketSource downloads tarballs from Bitbucket Cloud with a repository access token.
+// Public repositories need no token.
+type bitbucketSource struct {
+	baseURL    string
+	repository string // workspace/repo
+	token      string
+}
+
+func (b bitbucketSource) DownloadTarball(ctx context.Context, commit string) (io.ReadCloser, error) {
+	tarballURL := fmt.Sprintf("%s/%s/get/%s.tar.gz", b.baseURL, b.repository, url.PathEscape(commit))
+	headers := map[string]string{}
+	if b.token != "" {
+		headers["Authorization"] = "Bearer " + b.token
+	}
+	return downloadTarball(ctx, "bitbucket", tarballURL, headers)
+}
+
+// downloadTarball downloads a tarball over HTTPS. Responses other than the tarball are reported by
+// status only, their body is the upstream's and ends up in build logs.
+func downloadTarball(ctx context.Context, provider, tarballURL string, headers map[string]string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", tarballURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := sourceHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned status %d", provider, resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// gitSource fetches a commit from any git server, e.g. a self-hosted Gitea, over SSH with a
+// deploy key, or over HTTPS for public repositories, and archives it with git.
+type gitSource struct {
+	url        string
+	deployKey  string // SSH private key, empty for https URLs
+	knownHosts string // known_hosts file, empty trusts the server's key on first use
+}
+
+func (g gitSource) DownloadTarball(ctx context.Context, commit string) (io.ReadCloser, error) {
+	if !commitPattern.MatchString(commit) {
+		return nil, fmt.Errorf("invalid commit %q", commit)
+	}
+	host, err := gitURLHost(g.url)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := resolvePublicHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	pinConfig, sshOptions := gitPinnedAddress(g.url, host, addr)
+
+	dir, err := os.MkdirTemp("", "source")
+	if err != nil {
+		return nil, err
+	}
+	repoDir := filepath.Join(dir, "repo")
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	sshCommand := "ssh -o BatchMode=yes " + sshOptions
+	if g.deployKey != "" {
+		keyPath := filepath.Join(dir, "deploy_key")
+		key := strings.TrimSpace(g.deployKey) + "\n" // ssh rejects keys without a final newline
+		if err := os.WriteFile(keyPath, []byte(key), 0600); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		knownHosts := "-o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + g.knownHosts
+		if g.knownHosts == "" {
+			knownHosts = "-o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=" + filepath.Join(dir, "known_hosts")
+		}
+		sshCommand += " -i " + keyPath + " -o IdentitiesOnly=yes " + knownHosts
+	}
+	env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+
+	git := func(subcommand string, args ...string) error {
+		// only the transports validateGitURL accepts, file:// and ext:: would run on the server.
+		// Redirects would lead to hosts that weren't checked.
+		config := append([]string{"-c", "protocol.allow=never", "-c", "protocol.ssh.allow=always",
+			"-c", "protocol.https.allow=always", "-c", "http.followRedirects=false"}, pinConfig...)
+		args = append(append(config, "-C", repoDir, subcommand), args...)
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %w: %s", subcommand, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(repoDir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := git("init", "--bare", "--quiet"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// Fetch only the commit. Servers that don't allow fetching commits by hash get a full fetch
+	if err := git("fetch", "--quiet", "--depth", "1", "--", g.url, commit); err != nil {
+		if err := git("fetch", "--quiet", "--", g.url, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to fetch source: %w", err)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "archive", "--format=tar.gz", "--prefix=source/", commit)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &gitArchiveReader{ReadCloser: stdout, cmd: cmd, stderr: &stderr, dir: dir}, nil
+}
+
+// gitArchiveReader streams the output of git archive, and removes the fetched repository
+// once closed.
+type gitArchiveReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	dir    string
+}
+
+func (r *gitArchiveReader) Close() error {
+	r.ReadCloser.Close()
+	err := r.cmd.Wait()
+	os.RemoveAll(r.dir)
+	if err != nil {
+		return fmt.Errorf("git archive: %w: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
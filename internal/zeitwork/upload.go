@@ -0,0 +1,68 @@
+package zeitwork
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/zeitwork/zeitwork/internal/database"
+	"github.com/zeitwork/zeitwork/internal/database/queries"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// MaxSourceUploadSize caps the size of uploaded source tarballs, which are stored in the
+// database. The dashboard's uploads API has the same limit.
+const MaxSourceUploadSize = 100 << 20 // 100 MB
+
+// sourceUploadRetention is how long uploaded tarballs are kept. Their images stay, so
+// redeployments still work after the tarball is gone.
+const sourceUploadRetention = 7 * 24 * time.Hour
+
+// uploadSource reads a source tarball uploaded with zeitworkctl deploy from the database.
+type uploadSource struct {
+	db *database.DB
+	id uuid.UUID
+}
+
+func (u uploadSource) DownloadTarball(ctx context.Context, _ string) (io.ReadCloser, error) {
+	upload, err := u.db.SourceUploadFirstByID(ctx, u.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find source upload: %w", err)
+	}
+	data := upload.Data
+	if data == nil {
+		return nil, fmt.Errorf("source upload %s was purged", upload.ID)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != upload.Digest {
+		return nil, fmt.Errorf("source upload %s does not match its digest", upload.ID)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// buildSource returns the source of a build: its uploaded tarball, or the commit from the
+// project's source provider.
+func (s *Service) buildSource(ctx context.Context, build queries.Build, project queries.Project) (SourceProvider, error) {
+	if build.SourceUploadID.Valid {
+		return uploadSource{db: s.db, id: build.SourceUploadID}, nil
+	}
+	return s.sourceProvider(ctx, project)
+}
+
+// purgeSourceUploads clears the tarballs of uploads past their retention, whose builds ran.
+func (s *Service) purgeSourceUploads(ctx context.Context) error {
+	createdBefore := pgtype.Timestamptz{Time: time.Now().Add(-sourceUploadRetention), Valid: true}
+	ids, err := s.db.SourceUploadPurgeExpired(ctx, createdBefore)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		slog.Info("purged source upload", "source_upload_id", id)
+	}
+	return nil
+}
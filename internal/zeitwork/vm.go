@@ -1,6 +1,7 @@
 package zeitwork
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,12 +11,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"slices"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/vishvananda/netlink"
+	"github.com/zeitwork/zeitwork/internal/database"
 	"github.com/zeitwork/zeitwork/internal/database/queries"
 	"github.com/zeitwork/zeitwork/internal/shared/crypto"
 	"github.com/zeitwork/zeitwork/internal/shared/uuid"
@@ -28,6 +29,15 @@ type VMCreateParams struct {
 	Port         int32
 	EnvVariables string    // Encrypted JSON array of "KEY=value" strings
 	ServerID     uuid.UUID // Explicit server placement (zero value = auto-place)
+	DeploymentID uuid.UUID // Deployment this VM is a replica of (zero value = none, e.g. build VMs)
+	JoiningID    uuid.UUID // Running deployment this VM joins once healthy (zero value = none)
+	Idle         bool      // Boot without starting the image command, e.g. to run a release command via exec
+	Process      string    // Process type of a deployment replica (empty = web)
+	Command      string    // Overrides the image command, run with /bin/sh -c (empty = image command)
+	Build        bool      // Build VM: docker socket over VSOCK only, firewalled from other VMs
+	ExpiresAt    time.Time // Deleted by the cluster leader once past, unless extended (zero value = never)
+
+	OrganisationID uuid.UUID // Organisation whose registry credentials pull the image (zero value = cluster image)
 }
 
 func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
@@ -45,6 +55,11 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 		return s.reconcileVmDelete(ctx, vm)
 	}
 
+	// Keep a draining VM running until its in-flight requests have finished
+	if vm.DrainingAt.Valid {
+		return s.reconcileVMDrain(ctx, vm)
+	}
+
 	// ensure the image has a disk image
 	image, err := s.db.ImageFindByID(ctx, vm.ImageID)
 	if err != nil {
@@ -121,7 +136,13 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 	// Register VM with VSOCK manager (sets up UDS listener for guest-initiated connections)
 	vsockPath := VSocketPath(vm.ID)
 	hostname := fmt.Sprintf("zeit-%s", vm.ID.String())
-	if err := s.vsockManager.RegisterVM(vm.ID, envVars, vmIp.String(), hostIp.Addr().String(), hostname); err != nil {
+	// Process types may override the image command
+	var command []string
+	if vm.Command.Valid && vm.Command.String != "" {
+		command = []string{"/bin/sh", "-c", vm.Command.String}
+	}
+
+	if err := s.vsockManager.RegisterVM(vm.ID, envVars, vmIp.String(), hostIp.Addr().String(), hostname, vm.Idle, command, vm.Build); err != nil {
 		return fmt.Errorf("failed to register VM with VSOCK manager: %w", err)
 	}
 
@@ -138,6 +159,9 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 		if link, err := netlink.LinkByName(oldTap); err == nil {
 			netlink.LinkDel(link)
 		}
+		if vm.Build {
+			s.unfirewallBuildVM(ctx, oldTap)
+		}
 	}
 	if hadCmd && oldCmd.Process != nil {
 		oldCmd.Process.Kill()
@@ -145,6 +169,13 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 
 	tapName := fmt.Sprintf("ztap%d", s.nextTap.Add(1))
 
+	// Build VMs run untrusted code, cut them off from other VMs before they boot
+	if vm.Build {
+		if err := s.firewallBuildVM(ctx, tapName); err != nil {
+			return fmt.Errorf("failed to firewall build VM: %w", err)
+		}
+	}
+
 	slog.InfoContext(ctx, "starting DA VM", "id", vm.ID, "hostIp", hostIp, "vmIp", vmIp, "vcpus", vm.Vcpus, "memory_mb", vm.Memory, "envVarsCount", len(envVars))
 
 	cmd := exec.Command("/data/cloud-hypervisor", "--kernel", "/data/vmlinuz.bin",
@@ -231,6 +262,9 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 			if link, err := netlink.LinkByName(exitTap); err == nil {
 				netlink.LinkDel(link)
 			}
+			if vm.Build {
+				s.unfirewallBuildVM(context.Background(), exitTap)
+			}
 		}
 
 		s.vmScheduler.Schedule(vm.ID, time.Now().Add(5*time.Second))
@@ -240,13 +274,19 @@ func (s *Service) reconcileVM(ctx context.Context, objectID uuid.UUID) error {
 }
 
 func (s *Service) VMCreate(ctx context.Context, params VMCreateParams) (*queries.Vm, error) {
+	return createVM(ctx, s.db, params)
+}
+
+// createVM places a VM on a server and allocates its IP address. The VM reconciler of that server
+// starts it.
+func createVM(ctx context.Context, db *database.DB, params VMCreateParams) (*queries.Vm, error) {
 	// Determine target server for placement
 	targetServerID := params.ServerID
 	var targetIPRange netip.Prefix
 
 	if !targetServerID.Valid {
 		// Auto-place on least loaded server
-		target, err := s.db.ServerFindLeastLoaded(ctx)
+		target, err := db.ServerFindLeastLoaded(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find server for VM placement: %w", err)
 		}
@@ -254,7 +294,7 @@ func (s *Service) VMCreate(ctx context.Context, params VMCreateParams) (*queries
 		targetIPRange = target.IpRange
 	} else {
 		// Explicit placement — look up the server's IP range
-		server, err := s.db.ServerFindByID(ctx, targetServerID)
+		server, err := db.ServerFindByID(ctx, targetServerID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find target server: %w", err)
 		}
@@ -264,7 +304,7 @@ func (s *Service) VMCreate(ctx context.Context, params VMCreateParams) (*queries
 	// Allocate IP and create VM in a single transaction so the
 	// pg_advisory_xact_lock in VMNextIPAddress serializes correctly.
 	var vm queries.Vm
-	err := s.db.WithTx(ctx, func(q *queries.Queries) error {
+	err := db.WithTx(ctx, func(q *queries.Queries) error {
 		err := q.AdvisoryLock(ctx, "VMNextIPAddress")
 		if err != nil {
 			return err
@@ -279,16 +319,25 @@ func (s *Service) VMCreate(ctx context.Context, params VMCreateParams) (*queries
 		}
 
 		vm, err = q.VMCreate(ctx, queries.VMCreateParams{
-			ID:           uuid.New(),
-			Vcpus:        params.VCPUs,
-			Memory:       params.Memory,
-			Status:       queries.VmStatusPending,
-			ImageID:      params.ImageID,
-			ServerID:     targetServerID,
-			Port:         pgtype.Int4{Int32: params.Port, Valid: true},
-			IpAddress:    ipAddress,
-			EnvVariables: pgtype.Text{String: params.EnvVariables, Valid: true},
-			Metadata:     nil,
+			ID:             uuid.New(),
+			Vcpus:          params.VCPUs,
+			Memory:         params.Memory,
+			Status:         queries.VmStatusPending,
+			ImageID:        params.ImageID,
+			ServerID:       targetServerID,
+			Port:           pgtype.Int4{Int32: params.Port, Valid: true},
+			IpAddress:      ipAddress,
+			EnvVariables:   pgtype.Text{String: params.EnvVariables, Valid: true},
+			Metadata:       nil,
+			DeploymentID:   params.DeploymentID,
+			Idle:           params.Idle,
+			Process:        cmp.Or(params.Process, webProcess),
+			Command:        pgtype.Text{String: params.Command, Valid: params.Command != ""},
+			Build:          params.Build,
+			OrganisationID: params.OrganisationID,
+			ExpiresAt:      pgtype.Timestamptz{Time: params.ExpiresAt, Valid: !params.ExpiresAt.IsZero()},
+
+			JoiningDeploymentID: params.JoiningID,
 		})
 		return err
 	})
@@ -327,6 +376,9 @@ func (s *Service) reconcileVmDelete(ctx context.Context, vm queries.Vm) error {
 				slog.ErrorContext(ctx, "failed to delete tap device", "vm_id", vm.ID.String(), "tap", delTap, "err", err)
 			}
 		}
+		if vm.Build {
+			s.unfirewallBuildVM(ctx, delTap)
+		}
 	}
 
 	// Cleanup the work disk
@@ -381,14 +433,30 @@ func (s *Service) reconcileVMBaseImage(ctx context.Context, vm queries.Vm, image
 
 	imageRef := fmt.Sprintf("%s/%s:%s", image.Registry, image.Repository, image.Tag)
 	ociPath := filepath.Join(tmpdir, "oci")
-	if strings.Index(imageRef, "ghcr.io/zeitwork") == 0 {
-		srcCreds := fmt.Sprintf("%s:%s", s.cfg.DockerRegistryUsername, s.cfg.DockerRegistryPAT)
-		err = s.runCommand(ctx, "skopeo", "copy", "--src-creds", srcCreds, fmt.Sprintf("docker://%s", imageRef), fmt.Sprintf("oci:%s:latest", ociPath))
-	} else {
-		err = s.runCommand(ctx, "skopeo", "copy", fmt.Sprintf("docker://%s", imageRef), fmt.Sprintf("oci:%s:latest", ociPath))
+
+	// verify the image's signature while pulling, before it is converted and booted
+	args, err := s.imageVerificationArgs(ctx, vm, tmpdir)
+	if err != nil {
+		return err
+	}
+	// pull with the credentials of the VM's organisation, e.g. for private customer images
+	auth, err := s.imagePullAuth(ctx, vm, image)
+	if err != nil {
+		return err
+	}
+	args = append([]string{"copy"}, args...)
+	args = append(args, s.skopeoRegistryFlags(auth, "src-", imageRef)...)
+
+	// pull by digest, so the image boots the same bits on every server. skopeo fails if the
+	// registry serves a manifest that doesn't match it
+	imageDigest, err := s.pinnedImageDigest(ctx, image, auth)
+	if err != nil {
+		return err
 	}
+	pullRef := fmt.Sprintf("%s/%s@%s", image.Registry, image.Repository, imageDigest)
+	err = s.runCommand(ctx, "skopeo", append(args, fmt.Sprintf("docker://%s", pullRef), fmt.Sprintf("oci:%s:latest", ociPath))...)
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+		return fmt.Errorf("failed to pull image %s pinned to %s: %w", imageRef, imageDigest, err)
 	}
 
 	// unpack the oci image
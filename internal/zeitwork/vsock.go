@@ -26,6 +26,9 @@ const (
 	// execPort is the VSOCK port the guest listens on for exec connections.
 	// The host connects via the base VSOCK UDS with "CONNECT 1025\n".
 	execPort = 1025
+
+	// dockerPort is the VSOCK port build VMs expose their docker socket on.
+	dockerPort = 1026
 )
 
 // VSockManager manages per-VM HTTP servers over VSOCK UDS sockets.
@@ -42,9 +45,12 @@ type VSockManager struct {
 type vmState struct {
 	vmID     uuid.UUID
 	envVars  []string
-	ipAddr   string // e.g. "10.0.0.1/31"
-	ipGw     string // e.g. "10.0.0.0"
-	hostname string // e.g. "zeit-{vm_id}"
+	ipAddr   string   // e.g. "10.0.0.1/31"
+	ipGw     string   // e.g. "10.0.0.0"
+	hostname string   // e.g. "zeit-{vm_id}"
+	idle     bool     // don't start the image command
+	command  []string // overrides the image command
+	build    bool     // build VM, exposes its docker socket over VSOCK
 }
 
 // NewVSockManager creates a new VSOCK manager.
@@ -71,7 +77,7 @@ func VSocketGuestPath(vmID uuid.UUID) string {
 
 // RegisterVM sets up the UDS listener and HTTP server for a VM.
 // Must be called BEFORE starting the Cloud Hypervisor process.
-func (m *VSockManager) RegisterVM(vmID uuid.UUID, envVars []string, ipAddr, ipGw, hostname string) error {
+func (m *VSockManager) RegisterVM(vmID uuid.UUID, envVars []string, ipAddr, ipGw, hostname string, idle bool, command []string, build bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -81,6 +87,9 @@ func (m *VSockManager) RegisterVM(vmID uuid.UUID, envVars []string, ipAddr, ipGw
 		ipAddr:   ipAddr,
 		ipGw:     ipGw,
 		hostname: hostname,
+		idle:     idle,
+		command:  command,
+		build:    build,
 	}
 
 	m.vms[vmID] = state
@@ -102,6 +111,7 @@ func (m *VSockManager) RegisterVM(vmID uuid.UUID, envVars []string, ipAddr, ipGw
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /config", m.handleConfig(state))
 	mux.HandleFunc("POST /logs", m.handleLogs(state))
+	mux.HandleFunc("POST /exit", m.handleExit(state))
 
 	srv := &http.Server{Handler: mux}
 
@@ -156,7 +166,36 @@ func (m *VSockManager) handleConfig(state *vmState) http.HandlerFunc {
 			IPAddr:   state.ipAddr,
 			IPGW:     state.ipGw,
 			Hostname: state.hostname,
+			Idle:     state.idle,
+			Command:  state.command,
+
+			ExposeDockerSocket: state.build,
+		})
+	}
+}
+
+// handleExit records the exit code of the app, so deployments can report why they failed.
+func (m *VSockManager) handleExit(state *vmState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.ExitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		slog.Info("VM app exited", "vm_id", state.vmID, "exit_code", req.ExitCode)
+
+		err := m.db.VMUpdateExitCode(r.Context(), queries.VMUpdateExitCodeParams{
+			ID:       state.vmID,
+			ExitCode: pgtype.Int4{Int32: int32(req.ExitCode), Valid: true},
 		})
+		if err != nil {
+			slog.Error("failed to record VM exit code", "vm_id", state.vmID, "err", err)
+			http.Error(w, "failed to record exit code", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -0,0 +1,118 @@
+package zeitwork
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/coder/websocket"
+	"github.com/zeitwork/zeitwork/internal/rpc"
+	"github.com/zeitwork/zeitwork/internal/shared/uuid"
+)
+
+// DialExec opens an exec session with the guest agent of a VM on this server.
+// It fails while the guest is still booting.
+func DialExec(ctx context.Context, vmID uuid.UUID) (*websocket.Conn, error) {
+	rawConn, err := DialGuest(vmID, execPort)
+	if err != nil {
+		return nil, err
+	}
+
+	// WebSocket upgrade over the raw VSOCK connection.
+	conn, _, err := websocket.Dial(ctx, "ws://guest/exec", &websocket.DialOptions{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return rawConn, nil
+				},
+			},
+		},
+	})
+	if err != nil {
+		rawConn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %w", err)
+	}
+
+	// Disable read limit (default is 32KB which is too small for large outputs)
+	conn.SetReadLimit(-1)
+
+	return conn, nil
+}
+
+// RunExec runs a non-interactive command over an exec session, copying its
+// merged stdout/stderr to output. Returns the command's exit code.
+func RunExec(ctx context.Context, conn *websocket.Conn, command []string, output io.Writer) (int, error) {
+	defer conn.CloseNow()
+
+	reqData, err := json.Marshal(rpc.ExecRequest{Command: command})
+	if err != nil {
+		return 0, err
+	}
+	if err := conn.Write(ctx, websocket.MessageText, reqData); err != nil {
+		return 0, fmt.Errorf("failed to send exec request: %w", err)
+	}
+
+	var exitCode *int
+	for {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) || websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				break
+			}
+			return 0, fmt.Errorf("exec stream failed: %w", err)
+		}
+
+		switch typ {
+		case websocket.MessageBinary:
+			// stdout/stderr data
+			output.Write(data)
+		case websocket.MessageText:
+			// control message (exit code)
+			var ctrl rpc.ExecControl
+			if err := json.Unmarshal(data, &ctrl); err != nil {
+				continue
+			}
+			if ctrl.Exit != nil {
+				exitCode = ctrl.Exit
+			}
+		}
+	}
+
+	if exitCode == nil {
+		return 0, fmt.Errorf("exec session ended without exit code")
+	}
+	return *exitCode, nil
+}
+
+// lineWriter passes every line of exec output to write, e.g. to store it as logs.
+type lineWriter struct {
+	write func(line string)
+	buf   []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.write(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes a trailing line without newline.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.write(strings.TrimSuffix(string(w.buf), "\r"))
+		w.buf = nil
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/zeitwork/zeitwork/internal/database"
 	"github.com/zeitwork/zeitwork/internal/listener"
 	"github.com/zeitwork/zeitwork/internal/reconciler"
+	"github.com/zeitwork/zeitwork/internal/registry"
 	"github.com/zeitwork/zeitwork/internal/shared/base58"
 	dnsresolver "github.com/zeitwork/zeitwork/internal/shared/dns"
 	"github.com/zeitwork/zeitwork/internal/shared/github"
@@ -34,15 +35,57 @@ type Config struct {
 	DockerRegistryURL      string
 	DockerRegistryUsername string
 	DockerRegistryPAT      string // GitHub PAT with write:packages scope for pushing images
+	DockerRegistryInsecure bool   // The registry serves plain HTTP, e.g. the embedded registry
+	DockerRegistryEmbedded bool   // The registry is this node's embedded one, which has repository credentials
+
+	// RegistryCredentials are the credentials of other registries images are pulled from, e.g.
+	// a Docker Hub account or a private mirror. Organisations add their own for their images.
+	RegistryCredentials registry.Auth
 
 	// GitHub App credentials for fetching source code
 	GitHubAppID         string
 	GitHubAppPrivateKey string // base64-encoded
 
+	// GitKnownHosts is the path of the SSH known_hosts file the servers of projects with a git
+	// source are verified against. Empty trusts a server's host key on first use in every build.
+	GitKnownHosts string
+
 	// Multi-node configuration
 	ServerID   uuid.UUID // Stable server identity (read from /data/server-id)
 	InternalIP string    // This server's VLAN IP for cross-server communication
 
+	// DeploymentStartupTimeout is how long a new deployment may take to pass its health checks
+	// before it is marked failed. Defaults to 5 minutes.
+	DeploymentStartupTimeout time.Duration
+
+	// DeploymentDrainTimeout is how long a replaced or stopped VM may keep serving in-flight
+	// requests before it is deleted anyway. Defaults to 30 seconds.
+	DeploymentDrainTimeout time.Duration
+
+	// BuildConcurrency caps the builds running at once across the cluster, and
+	// BuildOrganisationConcurrency the builds of a single organisation. Further builds wait
+	// in the build queue. Default to 4 and 2.
+	BuildConcurrency             int
+	BuildOrganisationConcurrency int
+
+	// BuildpackBuilder is the Cloud Native Buildpacks builder image for projects in buildpacks
+	// mode that don't configure their own. Defaults to paketobuildpacks/builder-jammy-base.
+	BuildpackBuilder string
+
+	// VulnerabilityDBRepository is the OCI repository the vulnerability database is downloaded
+	// from when scanning images, e.g. a mirror in the own registry for clusters without internet
+	// access. Empty uses the scanner's default.
+	VulnerabilityDBRepository string
+
+	// ImageSigningKey is the path of the cosign-compatible private key built images are signed
+	// with, encrypted with ImageSigningPassphrase. Empty disables signing.
+	ImageSigningKey        string
+	ImageSigningPassphrase string
+
+	// ImageVerificationKey is the path of the public key of ImageSigningKey. VMs only boot images
+	// signed with it, unless their project allows external images. Empty disables verification.
+	ImageVerificationKey string
+
 	// RouteChangeNotify is sent to when routes may have changed.
 	// The edge proxy listens on this channel.
 	RouteChangeNotify chan struct{}
@@ -63,6 +106,9 @@ type Service struct {
 	// Docker client
 	dockerClient *client.Client
 
+	// Credentials of the cluster's registry and of RegistryCredentials
+	clusterRegistryAuth registry.Auth
+
 	// DNS resolution
 	dnsResolver dnsresolver.Resolver
 
@@ -73,11 +119,15 @@ type Service struct {
 	vsockManager *VSockManager
 
 	// Schedulers
-	deploymentScheduler *reconciler.Scheduler
-	buildScheduler      *reconciler.Scheduler
-	vmScheduler         *reconciler.Scheduler
-	domainScheduler     *reconciler.Scheduler
-	serverScheduler     *reconciler.Scheduler
+	deploymentScheduler  *reconciler.Scheduler
+	buildScheduler       *reconciler.Scheduler
+	vmScheduler          *reconciler.Scheduler
+	domainScheduler      *reconciler.Scheduler
+	serverScheduler      *reconciler.Scheduler
+	environmentScheduler *reconciler.Scheduler
+	cronJobScheduler     *reconciler.Scheduler
+	cronJobRunScheduler  *reconciler.Scheduler
+	releaseScheduler     *reconciler.Scheduler
 
 	// Direct PG connection URL for leader election (NOT PgBouncer).
 	databaseDirectURL string
@@ -95,10 +145,33 @@ type Service struct {
 	// Build execution tracking (prevents concurrent execution of the same build)
 	activeBuildsMu sync.Mutex
 	activeBuilds   map[uuid.UUID]bool
+
+	// cron job runs whose command is running on this server
+	activeCronJobRunsMu sync.Mutex
+	activeCronJobRuns   map[uuid.UUID]bool
+
+	// Serializes admitting builds from the queue so concurrency caps hold
+	buildQueueMu sync.Mutex
 }
 
 // New creates a new reconciler service
 func New(cfg Config) (*Service, error) {
+	if cfg.DeploymentStartupTimeout <= 0 {
+		cfg.DeploymentStartupTimeout = 5 * time.Minute
+	}
+	if cfg.DeploymentDrainTimeout <= 0 {
+		cfg.DeploymentDrainTimeout = 30 * time.Second
+	}
+	if cfg.BuildConcurrency <= 0 {
+		cfg.BuildConcurrency = 4
+	}
+	if cfg.BuildOrganisationConcurrency <= 0 {
+		cfg.BuildOrganisationConcurrency = 2
+	}
+	if cfg.BuildpackBuilder == "" {
+		cfg.BuildpackBuilder = "paketobuildpacks/builder-jammy-base"
+	}
+
 	s := &Service{
 		cfg:               cfg,
 		db:                cfg.DB,
@@ -112,8 +185,16 @@ func New(cfg Config) (*Service, error) {
 		imageMu:           sync.Mutex{},
 		nextTap:           atomic.Int32{},
 		activeBuilds:      make(map[uuid.UUID]bool),
+		activeCronJobRuns: make(map[uuid.UUID]bool),
 	}
 
+	s.clusterRegistryAuth = cfg.RegistryCredentials.With(registry.Auth{})
+	s.clusterRegistryAuth.Set(cfg.DockerRegistryURL, registry.Credentials{
+		Username: cfg.DockerRegistryUsername,
+		Password: cfg.DockerRegistryPAT,
+		Insecure: cfg.DockerRegistryInsecure,
+	})
+
 	// Initialize GitHub token service if credentials are provided
 	if cfg.GitHubAppID != "" && cfg.GitHubAppPrivateKey != "" {
 		githubSvc, err := github.NewTokenService(github.Config{
@@ -132,6 +213,10 @@ func New(cfg Config) (*Service, error) {
 	s.vmScheduler = reconciler.New("vm", s.reconcileVM)
 	s.domainScheduler = reconciler.New("domain", s.reconcileDomain)
 	s.serverScheduler = reconciler.New("server", s.reconcileServer)
+	s.environmentScheduler = reconciler.New("environment", s.reconcileEnvironment)
+	s.cronJobScheduler = reconciler.New("cron_job", s.reconcileCronJob)
+	s.cronJobRunScheduler = reconciler.New("cron_job_run", s.reconcileCronJobRun)
+	s.releaseScheduler = reconciler.New("release", s.reconcileRelease)
 
 	return s, nil
 }
@@ -158,6 +243,7 @@ func (s *Service) Start(ctx context.Context) error {
 			}
 		}
 	}
+	s.resetBuildVMFirewall(ctx)
 
 	// Start all schedulers
 	s.deploymentScheduler.Start()
@@ -165,6 +251,10 @@ func (s *Service) Start(ctx context.Context) error {
 	s.vmScheduler.Start()
 	s.domainScheduler.Start()
 	s.serverScheduler.Start()
+	s.environmentScheduler.Start()
+	s.cronJobScheduler.Start()
+	s.cronJobRunScheduler.Start()
+	s.releaseScheduler.Start()
 
 	// Start server lifecycle loops
 	go s.heartbeatLoop(ctx)
@@ -243,6 +333,54 @@ func (s *Service) Start(ctx context.Context) error {
 			s.serverScheduler.Schedule(id, time.Now())
 			s.notifyRouteChange()
 		},
+
+		OnRollout: func(ctx context.Context, id uuid.UUID) {
+			s.notifyRouteChange()
+
+			// Notify the deployment being rolled out
+			if rollout, err := s.db.RolloutFirstByID(ctx, id); err != nil {
+				slog.Error("failed to find rollout", "rollout_id", id, "error", err)
+			} else {
+				s.deploymentScheduler.Schedule(rollout.ToDeploymentID, time.Now())
+			}
+		},
+
+		OnEnvironment: func(ctx context.Context, id uuid.UUID) {
+			s.environmentScheduler.Schedule(id, time.Now())
+
+			// Notify deployments of this environment, e.g. to apply a new replica count
+			if deployments, err := s.db.DeploymentFindActiveByEnvironmentID(ctx, id); err != nil {
+				slog.Error("failed to find deployments by environment_id", "environment_id", id, "error", err)
+			} else {
+				for _, d := range deployments {
+					s.deploymentScheduler.Schedule(d.ID, time.Now())
+				}
+			}
+		},
+
+		OnCronJob: func(ctx context.Context, id uuid.UUID) {
+			s.cronJobScheduler.Schedule(id, time.Now())
+		},
+
+		OnCronJobRun: func(ctx context.Context, id uuid.UUID) {
+			s.cronJobRunScheduler.Schedule(id, time.Now())
+		},
+
+		OnProcessType: func(ctx context.Context, id uuid.UUID) {
+			// Notify running deployments of the project to scale the process type
+			processType, err := s.db.ProcessTypeFirstByID(ctx, id)
+			if err != nil {
+				slog.Error("failed to find process type", "process_type_id", id, "error", err)
+				return
+			}
+			if deployments, err := s.db.DeploymentFindRunningByProjectID(ctx, processType.ProjectID); err != nil {
+				slog.Error("failed to find deployments by project_id", "project_id", processType.ProjectID, "error", err)
+			} else {
+				for _, d := range deployments {
+					s.deploymentScheduler.Schedule(d.ID, time.Now())
+				}
+			}
+		},
 	})
 
 	// Start WAL listener (blocks until context is cancelled)
@@ -303,6 +441,36 @@ func (s *Service) bootstrapGlobal(ctx context.Context) error {
 	}
 	slog.InfoContext(ctx, "bootstrapped domains", "count", len(domains))
 
+	// Deleted environments
+	environments, err := s.db.EnvironmentFindDeleted(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find deleted environments: %w", err)
+	}
+	for _, environment := range environments {
+		s.environmentScheduler.Schedule(environment.ID, time.Now())
+	}
+	slog.InfoContext(ctx, "bootstrapped deleted environments", "count", len(environments))
+
+	// Cron jobs
+	cronJobs, err := s.db.CronJobFindActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find cron jobs: %w", err)
+	}
+	for _, job := range cronJobs {
+		s.cronJobScheduler.Schedule(job.ID, time.Now())
+	}
+	slog.InfoContext(ctx, "bootstrapped cron jobs", "count", len(cronJobs))
+
+	// Unfinished cron job runs
+	cronJobRuns, err := s.db.CronJobRunFindUnfinished(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find unfinished cron job runs: %w", err)
+	}
+	for _, run := range cronJobRuns {
+		s.cronJobRunScheduler.Schedule(run.ID, time.Now())
+	}
+	slog.InfoContext(ctx, "bootstrapped cron job runs", "count", len(cronJobRuns))
+
 	slog.InfoContext(ctx, "global bootstrap complete", "server_id", s.serverID)
 	return nil
 }
@@ -321,6 +489,16 @@ func (s *Service) bootstrapLocal(ctx context.Context) error {
 	}
 	slog.InfoContext(ctx, "bootstrapped vms", "count", len(vms), "server_id", s.serverID)
 
+	// Builds — those with a VM on this server run here.
+	builds, err := s.db.BuildFindRunningByServerID(ctx, s.serverID)
+	if err != nil {
+		return fmt.Errorf("failed to find builds for this server: %w", err)
+	}
+	for _, build := range builds {
+		s.buildScheduler.Schedule(build.ID, time.Now())
+	}
+	slog.InfoContext(ctx, "bootstrapped builds", "count", len(builds), "server_id", s.serverID)
+
 	// Servers -- schedule all active servers for host route sync,
 	// and always schedule this server for drain monitoring.
 	servers, err := s.db.ServerFindActive(ctx)
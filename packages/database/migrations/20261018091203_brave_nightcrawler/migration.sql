@@ -0,0 +1,25 @@
+CREATE TYPE "rollout_status" AS ENUM('in_progress', 'completed', 'rolled_back');--> statement-breakpoint
+CREATE TABLE "rollouts" (
+	"id" uuid PRIMARY KEY,
+	"project_id" uuid NOT NULL,
+	"from_deployment_id" uuid NOT NULL,
+	"to_deployment_id" uuid NOT NULL,
+	"status" "rollout_status" DEFAULT 'in_progress'::"rollout_status" NOT NULL,
+	"step" integer DEFAULT 0 NOT NULL,
+	"weight" integer DEFAULT 0 NOT NULL,
+	"requests" integer DEFAULT 0 NOT NULL,
+	"errors" integer DEFAULT 0 NOT NULL,
+	"step_started_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"completed_at" timestamp with time zone,
+	"rolled_back_at" timestamp with time zone,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "rollout_steps" integer[] DEFAULT '{}' NOT NULL;--> statement-breakpoint
+ALTER TABLE "rollouts" ADD CONSTRAINT "rollouts_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "rollouts" ADD CONSTRAINT "rollouts_from_deployment_id_deployments_id_fkey" FOREIGN KEY ("from_deployment_id") REFERENCES "deployments"("id");--> statement-breakpoint
+ALTER TABLE "rollouts" ADD CONSTRAINT "rollouts_to_deployment_id_deployments_id_fkey" FOREIGN KEY ("to_deployment_id") REFERENCES "deployments"("id");--> statement-breakpoint
+ALTER TABLE "rollouts" ADD CONSTRAINT "rollouts_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
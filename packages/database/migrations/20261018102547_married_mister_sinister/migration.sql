@@ -0,0 +1,37 @@
+CREATE TABLE "environments" (
+	"id" uuid PRIMARY KEY,
+	"name" text NOT NULL,
+	"slug" text NOT NULL,
+	"project_id" uuid NOT NULL,
+	"branch" text DEFAULT 'main' NOT NULL,
+	"vcpus" integer DEFAULT 1 NOT NULL,
+	"memory" integer DEFAULT 2048 NOT NULL,
+	"replicas" integer DEFAULT 1 NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone,
+	CONSTRAINT "environments_slug_project_id_unique" UNIQUE("slug","project_id")
+);
+--> statement-breakpoint
+ALTER TABLE "environment_variables" DROP CONSTRAINT "environment_variables_name_project_id_unique";--> statement-breakpoint
+ALTER TABLE "deployments" ADD COLUMN "environment_id" uuid;--> statement-breakpoint
+ALTER TABLE "domains" ADD COLUMN "environment_id" uuid;--> statement-breakpoint
+ALTER TABLE "environment_variables" ADD COLUMN "environment_id" uuid;--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "deployment_id" uuid;--> statement-breakpoint
+INSERT INTO "environments" ("id", "name", "slug", "project_id", "branch", "organisation_id")
+SELECT gen_random_uuid(), 'Production', 'production', "id", 'main', "organisation_id" FROM "projects";--> statement-breakpoint
+UPDATE "deployments" SET "environment_id" = "environments"."id" FROM "environments" WHERE "environments"."project_id" = "deployments"."project_id";--> statement-breakpoint
+UPDATE "domains" SET "environment_id" = "environments"."id" FROM "environments" WHERE "environments"."project_id" = "domains"."project_id";--> statement-breakpoint
+UPDATE "environment_variables" SET "environment_id" = "environments"."id" FROM "environments" WHERE "environments"."project_id" = "environment_variables"."project_id";--> statement-breakpoint
+UPDATE "vms" SET "deployment_id" = "deployments"."id" FROM "deployments" WHERE "deployments"."vm_id" = "vms"."id";--> statement-breakpoint
+ALTER TABLE "deployments" ALTER COLUMN "environment_id" SET NOT NULL;--> statement-breakpoint
+ALTER TABLE "domains" ALTER COLUMN "environment_id" SET NOT NULL;--> statement-breakpoint
+ALTER TABLE "environment_variables" ALTER COLUMN "environment_id" SET NOT NULL;--> statement-breakpoint
+ALTER TABLE "environment_variables" ADD CONSTRAINT "environment_variables_name_environment_id_unique" UNIQUE("name","environment_id");--> statement-breakpoint
+ALTER TABLE "environments" ADD CONSTRAINT "environments_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "environments" ADD CONSTRAINT "environments_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "deployments" ADD CONSTRAINT "deployments_environment_id_environments_id_fkey" FOREIGN KEY ("environment_id") REFERENCES "environments"("id");--> statement-breakpoint
+ALTER TABLE "domains" ADD CONSTRAINT "domains_environment_id_environments_id_fkey" FOREIGN KEY ("environment_id") REFERENCES "environments"("id");--> statement-breakpoint
+ALTER TABLE "environment_variables" ADD CONSTRAINT "environment_variables_environment_id_environments_id_fkey" FOREIGN KEY ("environment_id") REFERENCES "environments"("id");--> statement-breakpoint
+ALTER TABLE "vms" ADD CONSTRAINT "vms_deployment_id_deployments_id_fkey" FOREIGN KEY ("deployment_id") REFERENCES "deployments"("id");
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE "environments" ADD COLUMN "preview" boolean DEFAULT false NOT NULL;--> statement-breakpoint
+ALTER TABLE "environments" ADD COLUMN "github_pull_request" integer;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "preview_deployments" boolean DEFAULT true NOT NULL;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE "deployment_logs" (
+	"id" uuid PRIMARY KEY,
+	"deployment_id" uuid NOT NULL,
+	"message" text NOT NULL,
+	"level" text NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+ALTER TABLE "deployments" ADD COLUMN "release_vm_id" uuid;--> statement-breakpoint
+ALTER TABLE "deployments" ADD COLUMN "released_at" timestamp with time zone;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "release_command" text DEFAULT '' NOT NULL;--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "idle" boolean DEFAULT false NOT NULL;--> statement-breakpoint
+CREATE INDEX "deployment_logs_deployment_id_id_index" ON "deployment_logs" ("deployment_id","id");--> statement-breakpoint
+ALTER TABLE "deployment_logs" ADD CONSTRAINT "deployment_logs_deployment_id_deployments_id_fkey" FOREIGN KEY ("deployment_id") REFERENCES "deployments"("id");--> statement-breakpoint
+ALTER TABLE "deployment_logs" ADD CONSTRAINT "deployment_logs_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "deployments" ADD CONSTRAINT "deployments_release_vm_id_vms_id_fkey" FOREIGN KEY ("release_vm_id") REFERENCES "vms"("id");
\ No newline at end of file
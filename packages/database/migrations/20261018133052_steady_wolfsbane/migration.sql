@@ -0,0 +1,10 @@
+ALTER TABLE "deployments" ADD COLUMN "failed_reason" text;--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "exit_code" integer;--> statement-breakpoint
+UPDATE "deployments" SET "status" = CASE
+	WHEN "failed_at" IS NOT NULL THEN 'failed'::"deployment_status"
+	WHEN "stopped_at" IS NOT NULL THEN 'stopped'::"deployment_status"
+	WHEN "running_at" IS NOT NULL THEN 'running'::"deployment_status"
+	WHEN "starting_at" IS NOT NULL THEN 'starting'::"deployment_status"
+	WHEN "building_at" IS NOT NULL THEN 'building'::"deployment_status"
+	ELSE 'pending'::"deployment_status"
+END;
\ No newline at end of file
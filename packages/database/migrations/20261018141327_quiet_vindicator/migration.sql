@@ -0,0 +1,13 @@
+CREATE TABLE "vm_inflight_requests" (
+	"id" uuid PRIMARY KEY,
+	"server_id" uuid NOT NULL,
+	"vm_id" uuid NOT NULL,
+	"requests" integer DEFAULT 0 NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	CONSTRAINT "vm_inflight_requests_server_id_vm_id_unique" UNIQUE("server_id","vm_id")
+);
+--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "draining_at" timestamp with time zone;--> statement-breakpoint
+CREATE INDEX "vm_inflight_requests_vm_id_index" ON "vm_inflight_requests" ("vm_id");--> statement-breakpoint
+ALTER TABLE "vm_inflight_requests" ADD CONSTRAINT "vm_inflight_requests_server_id_servers_id_fkey" FOREIGN KEY ("server_id") REFERENCES "servers"("id");--> statement-breakpoint
+ALTER TABLE "vm_inflight_requests" ADD CONSTRAINT "vm_inflight_requests_vm_id_vms_id_fkey" FOREIGN KEY ("vm_id") REFERENCES "vms"("id");
\ No newline at end of file
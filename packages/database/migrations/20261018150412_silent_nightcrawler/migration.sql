@@ -0,0 +1,53 @@
+CREATE TYPE "cron_job_run_status" AS ENUM('pending', 'running', 'succeeded', 'failed');--> statement-breakpoint
+CREATE TABLE "cron_jobs" (
+	"id" uuid PRIMARY KEY,
+	"name" text NOT NULL,
+	"schedule" text NOT NULL,
+	"command" text NOT NULL,
+	"timeout" integer DEFAULT 3600 NOT NULL,
+	"project_id" uuid NOT NULL,
+	"environment_id" uuid NOT NULL,
+	"next_run_at" timestamp with time zone,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+CREATE TABLE "cron_job_runs" (
+	"id" uuid PRIMARY KEY,
+	"cron_job_id" uuid NOT NULL,
+	"deployment_id" uuid,
+	"vm_id" uuid,
+	"status" "cron_job_run_status" DEFAULT 'pending'::"cron_job_run_status" NOT NULL,
+	"exit_code" integer,
+	"failed_reason" text,
+	"started_at" timestamp with time zone,
+	"finished_at" timestamp with time zone,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+CREATE TABLE "cron_job_run_logs" (
+	"id" uuid PRIMARY KEY,
+	"cron_job_run_id" uuid NOT NULL,
+	"message" text NOT NULL,
+	"level" text NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX "cron_jobs_project_id_index" ON "cron_jobs" ("project_id");--> statement-breakpoint
+CREATE INDEX "cron_job_runs_cron_job_id_id_index" ON "cron_job_runs" ("cron_job_id","id");--> statement-breakpoint
+CREATE INDEX "cron_job_run_logs_cron_job_run_id_id_index" ON "cron_job_run_logs" ("cron_job_run_id","id");--> statement-breakpoint
+ALTER TABLE "cron_jobs" ADD CONSTRAINT "cron_jobs_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "cron_jobs" ADD CONSTRAINT "cron_jobs_environment_id_environments_id_fkey" FOREIGN KEY ("environment_id") REFERENCES "environments"("id");--> statement-breakpoint
+ALTER TABLE "cron_jobs" ADD CONSTRAINT "cron_jobs_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_runs" ADD CONSTRAINT "cron_job_runs_cron_job_id_cron_jobs_id_fkey" FOREIGN KEY ("cron_job_id") REFERENCES "cron_jobs"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_runs" ADD CONSTRAINT "cron_job_runs_deployment_id_deployments_id_fkey" FOREIGN KEY ("deployment_id") REFERENCES "deployments"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_runs" ADD CONSTRAINT "cron_job_runs_vm_id_vms_id_fkey" FOREIGN KEY ("vm_id") REFERENCES "vms"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_runs" ADD CONSTRAINT "cron_job_runs_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_run_logs" ADD CONSTRAINT "cron_job_run_logs_cron_job_run_id_cron_job_runs_id_fkey" FOREIGN KEY ("cron_job_run_id") REFERENCES "cron_job_runs"("id");--> statement-breakpoint
+ALTER TABLE "cron_job_run_logs" ADD CONSTRAINT "cron_job_run_logs_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
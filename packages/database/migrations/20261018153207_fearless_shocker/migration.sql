@@ -0,0 +1,17 @@
+CREATE TABLE "process_types" (
+	"id" uuid PRIMARY KEY,
+	"name" text NOT NULL,
+	"command" text DEFAULT '' NOT NULL,
+	"replicas" integer DEFAULT 1 NOT NULL,
+	"project_id" uuid NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "process" text DEFAULT 'web' NOT NULL;--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "command" text;--> statement-breakpoint
+CREATE INDEX "process_types_project_id_index" ON "process_types" ("project_id");--> statement-breakpoint
+ALTER TABLE "process_types" ADD CONSTRAINT "process_types_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "process_types" ADD CONSTRAINT "process_types_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
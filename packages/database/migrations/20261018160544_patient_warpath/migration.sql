@@ -0,0 +1,3 @@
+ALTER TABLE "builds" ADD COLUMN "priority" integer DEFAULT 0 NOT NULL;--> statement-breakpoint
+ALTER TABLE "builds" ADD COLUMN "queue_position" integer;--> statement-breakpoint
+CREATE INDEX "builds_status_priority_index" ON "builds" ("status","priority");
\ No newline at end of file
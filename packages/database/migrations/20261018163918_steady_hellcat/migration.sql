@@ -0,0 +1,3 @@
+ALTER TYPE "build_status" ADD VALUE 'cancelled';--> statement-breakpoint
+ALTER TABLE "builds" ADD COLUMN "cancelled_at" timestamp with time zone;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "cancel_superseded_builds" boolean DEFAULT false NOT NULL;
\ No newline at end of file
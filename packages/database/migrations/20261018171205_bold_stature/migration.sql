@@ -0,0 +1,6 @@
+ALTER TABLE "organisations" ADD COLUMN "build_timeout_limit" integer DEFAULT 3600 NOT NULL;--> statement-breakpoint
+ALTER TABLE "organisations" ADD COLUMN "build_vcpus_limit" integer DEFAULT 8 NOT NULL;--> statement-breakpoint
+ALTER TABLE "organisations" ADD COLUMN "build_memory_limit" integer DEFAULT 16384 NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "build_timeout" integer DEFAULT 900 NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "build_vcpus" integer DEFAULT 2 NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "build_memory" integer DEFAULT 4096 NOT NULL;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE "build_variables" (
+	"id" uuid PRIMARY KEY,
+	"name" text NOT NULL,
+	"value" text NOT NULL,
+	"secret" boolean DEFAULT false NOT NULL,
+	"project_id" uuid NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone,
+	CONSTRAINT "build_variables_name_project_id_unique" UNIQUE("name","project_id")
+);
+--> statement-breakpoint
+ALTER TABLE "build_variables" ADD CONSTRAINT "build_variables_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "build_variables" ADD CONSTRAINT "build_variables_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
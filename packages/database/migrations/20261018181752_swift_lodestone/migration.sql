@@ -0,0 +1,3 @@
+CREATE TYPE "build_mode" AS ENUM('dockerfile', 'buildpacks');--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "build_mode" "build_mode" DEFAULT 'dockerfile'::"build_mode" NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "buildpack_builder" text DEFAULT '' NOT NULL;
\ No newline at end of file
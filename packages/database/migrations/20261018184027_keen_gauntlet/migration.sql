@@ -0,0 +1,17 @@
+CREATE TABLE "build_steps" (
+	"id" uuid PRIMARY KEY,
+	"build_id" uuid NOT NULL,
+	"vertex" text NOT NULL,
+	"number" integer NOT NULL,
+	"name" text NOT NULL,
+	"cached" boolean DEFAULT false NOT NULL,
+	"error" text DEFAULT '' NOT NULL,
+	"started_at" timestamp with time zone,
+	"completed_at" timestamp with time zone,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	CONSTRAINT "build_steps_build_id_vertex_unique" UNIQUE("build_id","vertex")
+);
+--> statement-breakpoint
+ALTER TABLE "build_steps" ADD CONSTRAINT "build_steps_build_id_builds_id_fkey" FOREIGN KEY ("build_id") REFERENCES "builds"("id");--> statement-breakpoint
+ALTER TABLE "build_steps" ADD CONSTRAINT "build_steps_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
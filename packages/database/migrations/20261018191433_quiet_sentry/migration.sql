@@ -0,0 +1 @@
+ALTER TABLE "vms" ADD COLUMN "build" boolean DEFAULT false NOT NULL;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TYPE "vulnerability_severity" AS ENUM('low', 'medium', 'high', 'critical');--> statement-breakpoint
+CREATE TABLE "image_sboms" (
+	"id" uuid PRIMARY KEY,
+	"image_id" uuid NOT NULL,
+	"format" text NOT NULL,
+	"document" jsonb NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone,
+	CONSTRAINT "image_sboms_image_id_unique" UNIQUE("image_id")
+);
+--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "vulnerability_scan" boolean DEFAULT false NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "vulnerability_fail_severity" "vulnerability_severity";--> statement-breakpoint
+ALTER TABLE "image_sboms" ADD CONSTRAINT "image_sboms_image_id_images_id_fkey" FOREIGN KEY ("image_id") REFERENCES "images"("id");
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE "projects" ADD COLUMN "allow_external_images" boolean DEFAULT false NOT NULL;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE "images" DROP CONSTRAINT "images_registry_repository_tag_unique";--> statement-breakpoint
+ALTER TABLE "images" ADD COLUMN "digest" text DEFAULT '' NOT NULL;--> statement-breakpoint
+ALTER TABLE "images" ADD CONSTRAINT "images_registry_repository_tag_digest_unique" UNIQUE("registry","repository","tag","digest");
\ No newline at end of file
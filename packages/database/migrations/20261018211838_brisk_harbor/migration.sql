@@ -0,0 +1,15 @@
+CREATE TABLE "registry_credentials" (
+	"id" uuid PRIMARY KEY,
+	"registry" text NOT NULL,
+	"username" text NOT NULL,
+	"password" text NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone,
+	CONSTRAINT "registry_credentials_registry_organisation_id_unique" UNIQUE("registry","organisation_id")
+);
+--> statement-breakpoint
+ALTER TABLE "vms" ADD COLUMN "organisation_id" uuid;--> statement-breakpoint
+ALTER TABLE "registry_credentials" ADD CONSTRAINT "registry_credentials_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "vms" ADD CONSTRAINT "vms_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TYPE "source_provider" AS ENUM('github', 'gitlab', 'bitbucket', 'git');--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "source_provider" "source_provider" DEFAULT 'github'::"source_provider" NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "source_url" text DEFAULT '' NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "source_token" text DEFAULT '' NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ADD COLUMN "source_deploy_key" text DEFAULT '' NOT NULL;--> statement-breakpoint
+ALTER TABLE "projects" ALTER COLUMN "github_installation_id" DROP NOT NULL;
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE "source_uploads" (
+	"id" uuid PRIMARY KEY,
+	"project_id" uuid NOT NULL,
+	"digest" text NOT NULL,
+	"size" integer NOT NULL,
+	"data" text NOT NULL,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+ALTER TABLE "deployments" ADD COLUMN "source_upload_id" uuid;--> statement-breakpoint
+ALTER TABLE "builds" ADD COLUMN "source_upload_id" uuid;--> statement-breakpoint
+CREATE INDEX "source_uploads_project_id_index" ON "source_uploads" ("project_id");--> statement-breakpoint
+ALTER TABLE "source_uploads" ADD CONSTRAINT "source_uploads_project_id_projects_id_fkey" FOREIGN KEY ("project_id") REFERENCES "projects"("id");--> statement-breakpoint
+ALTER TABLE "source_uploads" ADD CONSTRAINT "source_uploads_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "deployments" ADD CONSTRAINT "deployments_source_upload_id_source_uploads_id_fkey" FOREIGN KEY ("source_upload_id") REFERENCES "source_uploads"("id");--> statement-breakpoint
+ALTER TABLE "builds" ADD CONSTRAINT "builds_source_upload_id_source_uploads_id_fkey" FOREIGN KEY ("source_upload_id") REFERENCES "source_uploads"("id");
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE "domains" ADD COLUMN "internal" boolean DEFAULT false NOT NULL;--> statement-breakpoint
+UPDATE "domains" SET "internal" = true WHERE "name" ~ '^[^.]+\.zeitwork\.app$';
\ No newline at end of file
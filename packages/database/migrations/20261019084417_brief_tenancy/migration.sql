@@ -0,0 +1 @@
+ALTER TABLE "vms" ADD COLUMN "expires_at" timestamp with time zone;
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE "api_tokens" (
+	"id" uuid PRIMARY KEY,
+	"name" text NOT NULL,
+	"token_hash" text NOT NULL UNIQUE,
+	"user_id" uuid NOT NULL,
+	"last_used_at" timestamp with time zone,
+	"organisation_id" uuid NOT NULL,
+	"created_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"updated_at" timestamp with time zone DEFAULT now() NOT NULL,
+	"deleted_at" timestamp with time zone
+);
+--> statement-breakpoint
+ALTER TABLE "api_tokens" ADD CONSTRAINT "api_tokens_user_id_users_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id");--> statement-breakpoint
+ALTER TABLE "api_tokens" ADD CONSTRAINT "api_tokens_organisation_id_organisations_id_fkey" FOREIGN KEY ("organisation_id") REFERENCES "organisations"("id");--> statement-breakpoint
+ALTER TABLE "source_uploads" ALTER COLUMN "data" SET DATA TYPE bytea USING decode("data", 'base64');--> statement-breakpoint
+ALTER TABLE "source_uploads" ALTER COLUMN "data" DROP NOT NULL;
\ No newline at end of file
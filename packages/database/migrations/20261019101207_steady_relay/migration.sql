@@ -0,0 +1 @@
+ALTER TABLE "deployments" ADD COLUMN "release_started_at" timestamp with time zone;
\ No newline at end of file
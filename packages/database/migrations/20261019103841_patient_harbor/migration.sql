@@ -0,0 +1,2 @@
+ALTER TABLE "vms" ADD COLUMN "joining_deployment_id" uuid;--> statement-breakpoint
+ALTER TABLE "vms" ADD CONSTRAINT "vms_joining_deployment_id_deployments_id_fkey" FOREIGN KEY ("joining_deployment_id") REFERENCES "deployments"("id");
\ No newline at end of file
@@ -1,6 +1,8 @@
 import {
+  type AnyPgColumn,
   boolean,
   cidr,
+  customType,
   inet,
   integer,
   jsonb,
@@ -15,6 +17,12 @@ import {
 import { uuidv7 } from "uuidv7";
 
 // Helpers
+const bytea = customType<{ data: Buffer; driverData: Buffer }>({
+  dataType() {
+    return "bytea";
+  },
+});
+
 export const timestamps = {
   createdAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
   updatedAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
@@ -44,6 +52,10 @@ export const organisations = pgTable("organisations", {
   name: text().notNull(),
   slug: text().notNull().unique(),
   projectLimit: integer().notNull().default(5),
+  // upper bounds for the build settings of the organisation's projects
+  buildTimeoutLimit: integer().notNull().default(3600), // seconds
+  buildVcpusLimit: integer().notNull().default(8),
+  buildMemoryLimit: integer().notNull().default(16384), // MB
   ...timestamps,
 });
 
@@ -75,41 +87,146 @@ export const domains = pgTable(
     projectId: uuid()
       .notNull()
       .references(() => projects.id),
+    environmentId: uuid()
+      .notNull()
+      .references(() => environments.id),
     deploymentId: uuid().references(() => deployments.id),
     verifiedAt: timestamp({ withTimezone: true }),
     txtVerificationRequired: boolean().notNull().default(false),
     redirectTo: text(),
     redirectStatusCode: integer(),
+    internal: boolean().notNull().default(false), // the zeitwork.app domain of a single deployment
     ...organisationId,
     ...timestamps,
   },
   (t) => [unique().on(t.name, t.projectId)],
 );
 
+export const buildModeEnum = pgEnum("build_mode", ["dockerfile", "buildpacks"]);
+
+export type BuildMode = (typeof buildModeEnum.enumValues)[number];
+
+export const vulnerabilitySeverityEnum = pgEnum("vulnerability_severity", [
+  "low",
+  "medium",
+  "high",
+  "critical",
+]);
+
+export type VulnerabilitySeverity = (typeof vulnerabilitySeverityEnum.enumValues)[number];
+
+// where builds download a project's source from. git is any git server, e.g. Gitea, over SSH with a deploy key
+export const sourceProviderEnum = pgEnum("source_provider", ["github", "gitlab", "bitbucket", "git"]);
+
+export type SourceProvider = (typeof sourceProviderEnum.enumValues)[number];
+
 export const projects = pgTable(
   "projects",
   {
     id: uuid().primaryKey().$defaultFn(uuidv7),
     name: text().notNull(),
     slug: text().notNull(),
-    githubRepository: text().notNull(),
-    githubInstallationId: uuid()
-      .notNull()
-      .references(() => githubInstallations.id),
+    sourceProvider: sourceProviderEnum().notNull().default("github"),
+    githubRepository: text().notNull(), // owner/repo, empty for other providers
+    githubInstallationId: uuid().references(() => githubInstallations.id), // github only
+    // repository URL of other providers, e.g. https://gitlab.com/group/app or git@git.internal:team/app.git
+    sourceUrl: text().notNull().default(""),
+    sourceToken: text().notNull().default(""), // encrypted, gitlab and bitbucket access token
+    sourceDeployKey: text().notNull().default(""), // encrypted, git SSH private key
     rootDirectory: text().notNull().default("/"),
     dockerfilePath: text().notNull().default("Dockerfile"),
+    // traffic percentages for progressive rollouts, e.g. [5, 25, 100]. empty = instant cutover
+    rolloutSteps: integer().array().notNull().default([]),
+    previewDeployments: boolean().notNull().default(true),
+    // runs in a VM from the new image before traffic switches, e.g. migrations. empty = none
+    releaseCommand: text().notNull().default(""),
+    // cancel in-flight builds of a branch when a newer deployment of it arrives
+    cancelSupersededBuilds: boolean().notNull().default(false),
+    // build VM resources and how long a build may take, capped by the organisation's limits
+    buildTimeout: integer().notNull().default(900), // seconds
+    buildVcpus: integer().notNull().default(2),
+    buildMemory: integer().notNull().default(4096), // MB
+    // build with a Dockerfile, or with Cloud Native Buildpacks
+    buildMode: buildModeEnum().notNull().default("dockerfile"),
+    // CNB builder image for buildpacks mode. empty = cluster default
+    buildpackBuilder: text().notNull().default(""),
+    // scan built images for vulnerabilities, and fail builds with any at or above the severity. null = never fail
+    vulnerabilityScan: boolean().notNull().default(false),
+    vulnerabilityFailSeverity: vulnerabilitySeverityEnum(),
+    allowExternalImages: boolean().notNull().default(false), // boot images without the cluster's signature
     ...organisationId,
     ...timestamps,
   },
   (t) => [unique().on(t.slug, t.organisationId)],
 );
 
+export const environments = pgTable(
+  "environments",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    name: text().notNull(), // e.g. Production
+    slug: text().notNull(), // e.g. production
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    branch: text().notNull().default("main"), // git branch deployed to this environment
+    vcpus: integer().notNull().default(1),
+    memory: integer().notNull().default(2048), // MiB
+    replicas: integer().notNull().default(1),
+    // preview environments are created per branch by the GitHub webhook and removed with the branch or PR
+    preview: boolean().notNull().default(false),
+    githubPullRequest: integer(),
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [unique().on(t.slug, t.projectId)],
+);
+
+// Procfile-style process types of a project, e.g. a queue worker next to the web process.
+// Every deployment runs the web process (scaled per environment) and one set of replicas per other process type.
+export const processTypes = pgTable(
+  "process_types",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    name: text().notNull(), // e.g. web, worker
+    command: text().notNull().default(""), // empty = image command
+    replicas: integer().notNull().default(1), // ignored for web, which uses environments.replicas
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [index().on(t.projectId)],
+);
+
 export const environmentVariables = pgTable(
   "environment_variables",
   {
     id: uuid().primaryKey().$defaultFn(uuidv7),
     name: text().notNull(),
     value: text().notNull(),
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    environmentId: uuid()
+      .notNull()
+      .references(() => environments.id),
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [unique().on(t.name, t.environmentId)],
+);
+
+// build args and build secrets of a project, values are encrypted. secrets are mounted
+// with `--secret` and never end up in image layers or build logs
+export const buildVariables = pgTable(
+  "build_variables",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    name: text().notNull(),
+    value: text().notNull(),
+    secret: boolean().notNull().default(false),
     projectId: uuid()
       .notNull()
       .references(() => projects.id),
@@ -119,6 +236,33 @@ export const environmentVariables = pgTable(
   (t) => [unique().on(t.name, t.projectId)],
 );
 
+// credentials of the registries an organisation's private images are pulled from, e.g. base images
+export const registryCredentials = pgTable(
+  "registry_credentials",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    registry: text().notNull(), // host, e.g. registry.example.com
+    username: text().notNull(),
+    password: text().notNull(), // encrypted
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [unique().on(t.registry, t.organisationId)],
+);
+
+// tokens for the API without a browser session, e.g. for zeitworkctl deploy
+export const apiTokens = pgTable("api_tokens", {
+  id: uuid().primaryKey().$defaultFn(uuidv7),
+  name: text().notNull(),
+  tokenHash: text().notNull().unique(), // sha256 of the token, which is only shown on creation
+  userId: uuid()
+    .notNull()
+    .references(() => users.id),
+  lastUsedAt: timestamp({ withTimezone: true }),
+  ...organisationId,
+  ...timestamps,
+});
+
 export const deploymentStatusEnum = pgEnum("deployment_status", [
   "pending",
   "building",
@@ -138,11 +282,16 @@ export const deployments = pgTable("deployments", {
   projectId: uuid()
     .notNull()
     .references(() => projects.id),
+  environmentId: uuid()
+    .notNull()
+    .references(() => environments.id),
   buildId: uuid().references(() => builds.id),
+  sourceUploadId: uuid().references(() => sourceUploads.id), // built instead of github_commit
   imageId: uuid().references(() => images.id),
   vmId: uuid()
     .references(() => vms.id)
     .unique(),
+  releaseVmId: uuid().references(() => vms.id), // ephemeral VM running the project's release command
   //
   pendingAt: timestamp({ withTimezone: true }),
   buildingAt: timestamp({ withTimezone: true }),
@@ -151,11 +300,120 @@ export const deployments = pgTable("deployments", {
   stoppingAt: timestamp({ withTimezone: true }),
   stoppedAt: timestamp({ withTimezone: true }),
   failedAt: timestamp({ withTimezone: true }),
+  releaseStartedAt: timestamp({ withTimezone: true }), // the release command was started, it must not run twice
+  releasedAt: timestamp({ withTimezone: true }),
+  failedReason: text(), // e.g. "health check timed out after 5m"
   //
   ...organisationId,
   ...timestamps,
 });
 
+export const deploymentLogs = pgTable("deployment_logs", {
+  id: uuid().primaryKey().$defaultFn(uuidv7),
+  deploymentId: uuid()
+    .notNull()
+    .references(() => deployments.id),
+  message: text().notNull(),
+  level: text().notNull(),
+  ...organisationId,
+  createdAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
+}, (t) => [
+  index().on(t.deploymentId, t.id),
+]);
+
+export const rolloutStatusEnum = pgEnum("rollout_status", [
+  "in_progress",
+  "completed",
+  "rolled_back",
+]);
+
+// A rollout shifts traffic for a project's custom domains from one deployment to another
+export const rollouts = pgTable("rollouts", {
+  id: uuid().primaryKey().$defaultFn(uuidv7),
+  projectId: uuid()
+    .notNull()
+    .references(() => projects.id),
+  fromDeploymentId: uuid()
+    .notNull()
+    .references(() => deployments.id),
+  toDeploymentId: uuid()
+    .notNull()
+    .references(() => deployments.id),
+  status: rolloutStatusEnum().notNull().default("in_progress"),
+  step: integer().notNull().default(0), // index into projects.rollout_steps
+  weight: integer().notNull().default(0), // percentage of traffic sent to the new deployment
+  // traffic observed by the edge proxies for the new deployment during the current step
+  requests: integer().notNull().default(0),
+  errors: integer().notNull().default(0),
+  stepStartedAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
+  completedAt: timestamp({ withTimezone: true }),
+  rolledBackAt: timestamp({ withTimezone: true }),
+  ...organisationId,
+  ...timestamps,
+});
+
+// A scheduled command that runs in a short-lived VM from the environment's current deployment image
+export const cronJobs = pgTable(
+  "cron_jobs",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    name: text().notNull(),
+    schedule: text().notNull(), // five-field cron expression in UTC, e.g. "0 3 * * *"
+    command: text().notNull(), // run with /bin/sh -c
+    timeout: integer().notNull().default(3600), // seconds
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    environmentId: uuid()
+      .notNull()
+      .references(() => environments.id),
+    nextRunAt: timestamp({ withTimezone: true }), // null = computed from the schedule by the reconciler
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [index().on(t.projectId)],
+);
+
+export const cronJobRunStatusEnum = pgEnum("cron_job_run_status", [
+  "pending",
+  "running",
+  "succeeded",
+  "failed",
+]);
+
+export const cronJobRuns = pgTable(
+  "cron_job_runs",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    cronJobId: uuid()
+      .notNull()
+      .references(() => cronJobs.id),
+    deploymentId: uuid().references(() => deployments.id), // deployment whose image the run used
+    vmId: uuid().references(() => vms.id),
+    status: cronJobRunStatusEnum().notNull().default("pending"),
+    exitCode: integer(),
+    failedReason: text(),
+    startedAt: timestamp({ withTimezone: true }),
+    finishedAt: timestamp({ withTimezone: true }),
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [index().on(t.cronJobId, t.id)],
+);
+
+export const cronJobRunLogs = pgTable("cron_job_run_logs", {
+  id: uuid().primaryKey().$defaultFn(uuidv7),
+  cronJobRunId: uuid()
+    .notNull()
+    .references(() => cronJobRuns.id),
+  message: text().notNull(),
+  level: text().notNull(),
+  ...organisationId,
+  createdAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
+}, (t) => [
+  index().on(t.cronJobRunId, t.id),
+]);
+
 export const vmLogs = pgTable("vm_logs", {
   id: uuid().primaryKey().$defaultFn(uuidv7),
   vmId: uuid()
@@ -173,30 +431,57 @@ export const buildStatusEnum = pgEnum("build_status", [
   "building",
   "succesful",
   "failed",
+  "cancelled",
 ]);
 
-export const builds = pgTable("builds", {
-  id: uuid().primaryKey().$defaultFn(uuidv7),
-  status: buildStatusEnum().notNull().default("pending"),
-  projectId: uuid()
-    .notNull()
-    .references(() => projects.id),
-  githubCommit: text().notNull(),
-  githubBranch: text().notNull(),
-  imageId: uuid().references(() => images.id),
-  vmId: uuid().references(() => vms.id),
-  // build lease coordination — ensures a build is processed by a single server at a time
-  processingBy: uuid().references(() => servers.id),
-  processingStartedAt: timestamp({ withTimezone: true }),
-  //
-  pendingAt: timestamp({ withTimezone: true }),
-  buildingAt: timestamp({ withTimezone: true }),
-  successfulAt: timestamp({ withTimezone: true }),
-  failedAt: timestamp({ withTimezone: true }),
-  //
-  ...organisationId,
-  ...timestamps,
-});
+// A gzip tarball of a directory uploaded with `zeitworkctl deploy`, built instead of a commit
+export const sourceUploads = pgTable(
+  "source_uploads",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    digest: text().notNull(), // sha256 of the tarball, hex
+    size: integer().notNull(), // bytes
+    data: bytea(), // the tarball, cleared once builds no longer need it
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [index().on(t.projectId)],
+);
+
+export const builds = pgTable(
+  "builds",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    status: buildStatusEnum().notNull().default("pending"),
+    projectId: uuid()
+      .notNull()
+      .references(() => projects.id),
+    githubCommit: text().notNull(),
+    githubBranch: text().notNull(),
+    sourceUploadId: uuid().references(() => sourceUploads.id), // built instead of github_commit
+    imageId: uuid().references(() => images.id),
+    vmId: uuid().references(() => vms.id),
+    // build lease coordination — ensures a build is processed by a single server at a time
+    processingBy: uuid().references(() => servers.id),
+    processingStartedAt: timestamp({ withTimezone: true }),
+    //
+    pendingAt: timestamp({ withTimezone: true }),
+    buildingAt: timestamp({ withTimezone: true }),
+    successfulAt: timestamp({ withTimezone: true }),
+    failedAt: timestamp({ withTimezone: true }),
+    cancelledAt: timestamp({ withTimezone: true }),
+    // build queue — pending builds start by priority (higher first), then in creation order
+    priority: integer().notNull().default(0),
+    queuePosition: integer(),
+    //
+    ...organisationId,
+    ...timestamps,
+  },
+  (t) => [index().on(t.status, t.priority)],
+);
 
 export const buildLogs = pgTable("build_logs", {
   id: uuid().primaryKey().$defaultFn(uuidv7),
@@ -209,6 +494,27 @@ export const buildLogs = pgTable("build_logs", {
   createdAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
 });
 
+// a BuildKit solve step of a build, with its timing and whether it was served from cache
+export const buildSteps = pgTable(
+  "build_steps",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    buildId: uuid()
+      .notNull()
+      .references(() => builds.id),
+    vertex: text().notNull(), // BuildKit vertex digest
+    number: integer().notNull(), // in order of appearance, like buildx's #N
+    name: text().notNull(), // e.g. [2/4] RUN npm ci
+    cached: boolean().notNull().default(false),
+    error: text().notNull().default(""),
+    startedAt: timestamp({ withTimezone: true }),
+    completedAt: timestamp({ withTimezone: true }),
+    ...organisationId,
+    createdAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
+  },
+  (t) => [unique().on(t.buildId, t.vertex)],
+);
+
 export const images = pgTable(
   "images",
   {
@@ -217,9 +523,25 @@ export const images = pgTable(
     registry: text().notNull(), // e.g. docker.io
     repository: text().notNull(), // e.g. library/alpine
     tag: text().notNull(), // e.g. latest
+    digest: text().notNull().default(""), // manifest digest the image is pulled by, e.g. sha256:... (empty = pinned on first pull)
     ...timestamps,
   },
-  (t) => [unique().on(t.registry, t.repository, t.tag)],
+  (t) => [unique().on(t.registry, t.repository, t.tag, t.digest)],
+);
+
+// software bill of materials of a built image
+export const imageSboms = pgTable(
+  "image_sboms",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    imageId: uuid()
+      .notNull()
+      .references(() => images.id),
+    format: text().notNull(), // e.g. spdx-json
+    document: jsonb().notNull(),
+    ...timestamps,
+  },
+  (t) => [unique().on(t.imageId)],
 );
 
 // Certificate storage for certmagic
@@ -270,6 +592,15 @@ export const vms = pgTable("vms", {
   ipAddress: inet().notNull(),
   envVariables: text(),
   metadata: jsonb(), // { pid: 1234 }
+  deploymentId: uuid().references((): AnyPgColumn => deployments.id), // set for every replica of a deployment
+  joiningDeploymentId: uuid().references((): AnyPgColumn => deployments.id), // new replica of a running deployment, joins it once healthy
+  idle: boolean().notNull().default(false), // boot without the image command, commands run via exec
+  process: text().notNull().default("web"), // process type of a deployment replica, only web is routed and health checked
+  command: text(), // overrides the image command, run with /bin/sh -c
+  build: boolean().notNull().default(false), // build VM: docker socket over VSOCK only, firewalled from other VMs
+  organisationId: uuid().references(() => organisations.id), // organisation whose registry credentials pull the image (null = cluster image)
+  exitCode: integer(), // exit code of the app, reported by the guest
+  expiresAt: timestamp({ withTimezone: true }), // deleted by the cluster leader once past, e.g. one-off VMs whose session went away
   //
   pendingAt: timestamp({ withTimezone: true }),
   startingAt: timestamp({ withTimezone: true }),
@@ -277,7 +608,25 @@ export const vms = pgTable("vms", {
   stoppingAt: timestamp({ withTimezone: true }),
   stoppedAt: timestamp({ withTimezone: true }),
   failedAt: timestamp({ withTimezone: true }),
+  drainingAt: timestamp({ withTimezone: true }), // out of edge routing, deleted once in-flight requests finish
   //
   ...timestamps,
 });
+
+// In-flight requests each edge proxy currently has open to a VM, used to drain VMs before deleting them
+export const vmInflightRequests = pgTable(
+  "vm_inflight_requests",
+  {
+    id: uuid().primaryKey().$defaultFn(uuidv7),
+    serverId: uuid()
+      .notNull()
+      .references(() => servers.id), // server running the edge proxy
+    vmId: uuid()
+      .notNull()
+      .references(() => vms.id),
+    requests: integer().notNull().default(0),
+    updatedAt: timestamp({ withTimezone: true }).notNull().defaultNow(),
+  },
+  (t) => [unique().on(t.serverId, t.vmId), index().on(t.vmId)],
+);
 // NOTE: ADD CONSTRAINT exclude_overlapping_networks EXCLUDE USING gist (ip_address inet_ops WITH &&);